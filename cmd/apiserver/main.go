@@ -30,6 +30,7 @@ import (
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/endpoints/request"
@@ -70,6 +71,7 @@ func main() {
 	metrics.Register()
 
 	var mgr ctrl.Manager
+	var profiles cache.Cache
 	cmd, err := builder.APIServer.
 		// +kubebuilder:scaffold:resource-register
 		WithResource(&gatewayv1alpha1.ClusterGateway{}).
@@ -80,7 +82,7 @@ func main() {
 		WithConfigFns(
 			func(config *server.RecommendedConfig) *server.RecommendedConfig {
 				config.LongRunningFunc = func(r *http.Request, requestInfo *request.RequestInfo) bool {
-					if requestInfo.Resource == "clustergateways" && requestInfo.Subresource == "proxy" {
+					if requestInfo.Resource == "clustergateways" && (requestInfo.Subresource == "proxy" || requestInfo.Subresource == "tunnel") {
 						return true
 					}
 					return genericfilters.BasicLongRunningRequestCheck(sets.NewString("watch"), sets.NewString())(r, requestInfo)
@@ -89,6 +91,7 @@ func main() {
 			},
 			config.WithUserAgent,
 			func(config *server.RecommendedConfig) *server.RecommendedConfig {
+				singleton.SetLoopbackConfig(config.ClientConfig)
 				var err error
 				mgr, err = manager.New(config.ClientConfig, manager.Options{
 					Scheme:                 scheme,
@@ -108,6 +111,26 @@ func main() {
 				if err != nil {
 					klog.Fatal("unable to create manager", err)
 				}
+				// the secrets of the credential profiles are cached apart from the
+				// ones of the ClusterGateways by their label
+				profileSelector, err := labels.Parse(common.LabelKeyCredentialProfile)
+				if err != nil {
+					klog.Fatal("unable to parse credential profile selector", err)
+				}
+				profiles, err = cache.New(config.ClientConfig, cache.Options{
+					Scheme: scheme,
+					ByObject: map[client.Object]cache.ByObject{
+						&core.Secret{}: {
+							Label: profileSelector,
+						},
+					},
+				})
+				if err != nil {
+					klog.Fatal("unable to create credential profile cache", err)
+				}
+				if err := mgr.Add(profiles); err != nil {
+					klog.Fatal("unable to add credential profile cache", err)
+				}
 
 				err = mgr.GetFieldIndexer().IndexField(context.Background(), &authenticationv1alpha1.Account{}, gatewayv1alpha1.ImpersonatorKey, func(rawObj client.Object) []string {
 					account := rawObj.(*authenticationv1alpha1.Account)
@@ -127,6 +150,30 @@ func main() {
 			if err := config.ValidateClusterProxy(); err != nil {
 				klog.Fatal(err)
 			}
+			if err := config.ValidateEndpointFailover(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateEndpointCA(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateExecCredential(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateTokenRequest(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateLocalCluster(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateKubeconfig(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateCredentialsSubresource(); err != nil {
+				klog.Fatal(err)
+			}
+			if err := config.ValidateDiscoveryCache(); err != nil {
+				klog.Fatal(err)
+			}
 			if err := gatewayv1alpha1.LoadGlobalClusterGatewayProxyConfig(); err != nil {
 				klog.Fatal(err)
 			}
@@ -138,6 +185,12 @@ func main() {
 		}).
 		WithPostStartHook("init-controller-manager", func(ctx server.PostStartHookContext) error {
 			singleton.SetClient(mgr.GetClient())
+			singleton.SetAPIReader(mgr.GetAPIReader())
+			singleton.SetCache(mgr.GetCache())
+			singleton.SetCredentialProfileReader(profiles)
+			if err := mgr.Add(manager.RunnableFunc(gatewayv1alpha1.RunClusterGatewayWatchCache)); err != nil {
+				return err
+			}
 			return mgr.Start(ctx)
 		}).
 		Build()
@@ -150,6 +203,15 @@ func main() {
 	config.AddClusterAuthNamespaceFlags(cmd.Flags())
 	config.AddUserAgentFlags(cmd.Flags())
 	config.AddClusterGatewayProxyConfig(cmd.Flags())
+	config.AddClusterMetadataFlags(cmd.Flags())
+	config.AddEndpointFailoverFlags(cmd.Flags())
+	config.AddEndpointCAFlags(cmd.Flags())
+	config.AddExecCredentialFlags(cmd.Flags())
+	config.AddTokenRequestFlags(cmd.Flags())
+	config.AddLocalClusterFlags(cmd.Flags())
+	config.AddKubeconfigFlags(cmd.Flags())
+	config.AddCredentialsSubresourceFlags(cmd.Flags())
+	config.AddDiscoveryCacheFlags(cmd.Flags())
 	if err := cmd.Execute(); err != nil {
 		klog.Fatal(err)
 	}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/util/reversetunnel"
+)
+
+func main() {
+	var hubKubeconfig string
+	var clusterName string
+	var gatewayReplicas int
+	var targetAddress string
+
+	klog.InitFlags(flag.CommandLine)
+	flag.StringVar(&hubKubeconfig, "hub-kubeconfig", "",
+		"The path to the kubeconfig of the hub cluster")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"The name of the managed cluster")
+	flag.IntVar(&gatewayReplicas, "gateway-replicas", 1,
+		"The number of the gateway replicas, each of which takes a reverse tunnel")
+	flag.StringVar(&targetAddress, "target-address", "",
+		"The address of the kube-apiserver which the tunneled connections dial, "+
+			"defaulting to the in-cluster kube-apiserver")
+	flag.Parse()
+
+	if len(targetAddress) == 0 {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if len(host) == 0 || len(port) == 0 {
+			klog.Fatal("missing flag --target-address outside the cluster")
+		}
+		targetAddress = net.JoinHostPort(host, port)
+	}
+	hubConfig, err := clientcmd.BuildConfigFromFlags("", hubKubeconfig)
+	if err != nil {
+		klog.Fatalf("unable to build hub rest config: %v", err)
+	}
+
+	agent := &reversetunnel.Agent{
+		Config:        hubConfig,
+		Cluster:       clusterName,
+		Replicas:      gatewayReplicas,
+		TargetAddress: targetAddress,
+	}
+	if err := agent.Run(ctrl.SetupSignalHandler()); err != nil {
+		klog.Fatal(err)
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	kmapi "kmodules.xyz/client-go/api/v1"
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -27,12 +29,14 @@ func NewClusterGatewayAddonManager(cfg *rest.Config, c client.Client) agent.Agen
 	return &clusterGatewayAddonManager{
 		clientConfig: cfg,
 		client:       c,
+		nativeClient: kubernetes.NewForConfigOrDie(cfg),
 	}
 }
 
 type clusterGatewayAddonManager struct {
 	clientConfig *rest.Config
 	client       client.Client
+	nativeClient kubernetes.Interface
 }
 
 func (c *clusterGatewayAddonManager) Manifests(cluster *clusterv1.ManagedCluster, addon *addonv1alpha1.ManagedClusterAddOn) ([]runtime.Object, error) {
@@ -54,11 +58,8 @@ func (c *clusterGatewayAddonManager) Manifests(cluster *clusterv1.ManagedCluster
 			return nil, errors.Wrapf(err, "failed getting gateway configuration")
 		}
 
-		if cfg.Spec.SecretManagement.Type == configv1alpha1.SecretManagementTypeManual {
-			return nil, nil
-		}
-		switch cfg.Spec.SecretManagement.Type {
-		case configv1alpha1.SecretManagementTypeManagedServiceAccount:
+		var objs []runtime.Object
+		if cfg.Spec.SecretManagement.Type == configv1alpha1.SecretManagementTypeManagedServiceAccount {
 			managedServiceAccountAddon := &addonv1alpha1.ManagedClusterAddOn{}
 			if err := c.client.Get(
 				context.TODO(),
@@ -67,19 +68,23 @@ func (c *clusterGatewayAddonManager) Manifests(cluster *clusterv1.ManagedCluster
 					Name:      "managed-serviceaccount",
 				},
 				managedServiceAccountAddon); err != nil {
-				if apierrors.IsNotFound(err) {
-					return nil, nil
+				if !apierrors.IsNotFound(err) {
+					return nil, err
 				}
-				return nil, err
+			} else {
+				objs = append(objs, buildClusterGatewayOutboundPermission(
+					managedServiceAccountAddon.Spec.InstallNamespace,
+					cfg.Spec.SecretManagement.ManagedServiceAccount.Name)...)
 			}
-			return buildClusterGatewayOutboundPermission(
-				managedServiceAccountAddon.Spec.InstallNamespace,
-				cfg.Spec.SecretManagement.ManagedServiceAccount.Name), nil
-		case configv1alpha1.SecretManagementTypeManual:
-			fallthrough
-		default:
-			return nil, nil
 		}
+		if cfg.Spec.ReverseTunnel != nil && isReverseTunnelEnabled(addon) {
+			objs = append(objs, buildReverseTunnelAgent(
+				cluster.Name,
+				agentInstallNamespace(addon),
+				cfg.Spec.ReverseTunnel.Image,
+				cfg.Spec.Replicas)...)
+		}
+		return objs, nil
 	}
 	return nil, nil
 }
@@ -93,6 +98,12 @@ func (c *clusterGatewayAddonManager) GetAgentAddonOptions() agent.AgentAddonOpti
 		HealthProber: &agent.HealthProber{
 			Type: agent.HealthProberTypeNone, // TODO: switch to ManifestWork-based prober
 		},
+		// only the reverse tunnel agents are registered to the hub
+		Registration: &agent.RegistrationOption{
+			CSRConfigurations: reverseTunnelCSRConfigurations,
+			CSRApproveCheck:   utils.DefaultCSRApprover(reverseTunnelAgentName),
+			PermissionConfig:  c.reverseTunnelPermission,
+		},
 	}
 }
 
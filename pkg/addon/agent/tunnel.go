@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+const (
+	reverseTunnelAgentName = "tunnel-agent"
+	// defaultAgentInstallNamespace is the namespace of the addon agents unless
+	// the addon prescribes any.
+	defaultAgentInstallNamespace = "open-cluster-management-agent-addon"
+	// hubKubeconfigSecretName is the secret of the hub kubeconfig written by
+	// the registration of the agent.
+	hubKubeconfigSecretName = common.AddonName + "-hub-kubeconfig"
+)
+
+// isReverseTunnelEnabled tells whether the cluster is opted in the reverse
+// tunnel by the addon annotation.
+func isReverseTunnelEnabled(addon *addonv1alpha1.ManagedClusterAddOn) bool {
+	return addon.Annotations[common.AnnotationKeyClusterGatewayReverseTunnel] == "true"
+}
+
+func agentInstallNamespace(addon *addonv1alpha1.ManagedClusterAddOn) string {
+	if len(addon.Status.Namespace) > 0 {
+		return addon.Status.Namespace
+	}
+	if len(addon.Spec.InstallNamespace) > 0 {
+		return addon.Spec.InstallNamespace
+	}
+	return defaultAgentInstallNamespace
+}
+
+// reverseTunnelCSRConfigurations registers the reverse tunnel agents of the
+// clusters opted in.
+func reverseTunnelCSRConfigurations(cluster *clusterv1.ManagedCluster, addon *addonv1alpha1.ManagedClusterAddOn) ([]addonv1alpha1.RegistrationConfig, error) {
+	if !isReverseTunnelEnabled(addon) {
+		return nil, nil
+	}
+	return agent.KubeClientSignerConfigurations(common.AddonName, reverseTunnelAgentName)(cluster, addon)
+}
+
+// reverseTunnelPermission grants the agent of the cluster dialing the tunnel
+// of its own ClusterGateway only.
+func (c *clusterGatewayAddonManager) reverseTunnelPermission(cluster *clusterv1.ManagedCluster, addon *addonv1alpha1.ManagedClusterAddOn) error {
+	if !isReverseTunnelEnabled(addon) {
+		return nil
+	}
+	clusterRole := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "open-cluster-management:cluster-gateway:tunnel:" + cluster.Name,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{config.MetaApiGroupName},
+				Resources:     []string{"clustergateways/tunnel"},
+				ResourceNames: []string{cluster.Name},
+				Verbs:         []string{"get", common.VerbServeTunnel},
+			},
+		},
+	}
+	// the first default group is dedicated to the agents of the cluster
+	group := agent.DefaultGroups(cluster.Name, addon.Name)[0]
+	return utils.NewRBACPermissionConfigBuilder(c.nativeClient).
+		BindClusterRoleToGroup(clusterRole, group).
+		Build()(cluster, addon)
+}
+
+// buildReverseTunnelAgent returns the agent dialing the reverse tunnels of
+// the cluster to every replica of the gateway.
+func buildReverseTunnelAgent(clusterName, namespace, image string, gatewayReplicas int32) []runtime.Object {
+	labels := map[string]string{
+		"app": "cluster-gateway-tunnel-agent",
+	}
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "cluster-gateway-tunnel-agent",
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(int32(1)),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					// the agent merely dials the kube-apiserver
+					AutomountServiceAccountToken: ptr.To(false),
+					Containers: []corev1.Container{
+						{
+							Name:            "tunnel-agent",
+							Image:           image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Args: []string{
+								"--hub-kubeconfig=/etc/hub/kubeconfig",
+								"--cluster-name=" + clusterName,
+								fmt.Sprintf("--gateway-replicas=%d", gatewayReplicas),
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "hub-kubeconfig",
+									MountPath: "/etc/hub",
+									ReadOnly:  true,
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								AllowPrivilegeEscalation: ptr.To(false),
+								Capabilities: &corev1.Capabilities{
+									Drop: []corev1.Capability{"ALL"},
+								},
+								ReadOnlyRootFilesystem: ptr.To(true),
+								RunAsNonRoot:           ptr.To(true),
+								SeccompProfile: &corev1.SeccompProfile{
+									Type: corev1.SeccompProfileTypeRuntimeDefault,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "hub-kubeconfig",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: hubKubeconfigSecretName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return []runtime.Object{deployment}
+}
@@ -2,15 +2,28 @@ package controllers
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	multicluster "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/transport"
@@ -29,6 +42,7 @@ type ClusterGatewayHealthProber struct {
 	multiClusterRestClient rest.Interface
 	gatewayClient          versioned.Interface
 	runtimeClient          client.Client
+	secretReader           client.Reader
 }
 
 func SetupClusterGatewayHealthProberWithManager(mgr ctrl.Manager) error {
@@ -42,10 +56,31 @@ func SetupClusterGatewayHealthProberWithManager(mgr ctrl.Manager) error {
 	if err != nil {
 		return err
 	}
+	// the secrets of the ClusterGateways are cached apart from the other
+	// secrets, which are never read by the prober. The cache is synced by
+	// the manager before the prober starts.
+	secrets, err := cluster.New(mgr.GetConfig(), func(o *cluster.Options) {
+		o.Scheme = mgr.GetScheme()
+		o.Cache.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {
+				Field: fields.OneTermEqualSelector("metadata.name", common.AddonName),
+			},
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := secrets.GetCache().GetInformer(context.TODO(), &corev1.Secret{}); err != nil {
+		return err
+	}
+	if err := mgr.Add(secrets); err != nil {
+		return err
+	}
 	prober := &ClusterGatewayHealthProber{
 		multiClusterRestClient: multiClusterClient.Discovery().RESTClient(),
 		gatewayClient:          gatewayClient,
 		runtimeClient:          mgr.GetClient(),
+		secretReader:           secrets.GetCache(),
 	}
 	src := event.AddOnHealthResyncHandler(mgr.GetClient(), time.Second)
 	return ctrl.NewControllerManagedBy(mgr).
@@ -65,29 +100,37 @@ func (c *ClusterGatewayHealthProber) Reconcile(ctx context.Context, request reco
 	if err != nil {
 		return reconcile.Result{}, err
 	}
+	// the credential contents are not served by the gateway api
+	secret := &corev1.Secret{}
+	if err := c.secretReader.Get(ctx, types.NamespacedName{Namespace: clusterName, Name: common.AddonName}, secret); apierrors.IsNotFound(err) {
+		secret = nil
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
 	resp, healthErr := c.multiClusterRestClient.
 		Get().
 		AbsPath("healthz").
 		DoRaw(multicluster.WithMultiClusterContext(context.TODO(), clusterName))
-	healthy := string(resp) == "ok" && healthErr == nil
+
+	changed := false
+	for _, cond := range probeConditions(gw, secret, resp, healthErr, time.Now()) {
+		cond.ObservedGeneration = gw.Generation
+		if meta.SetStatusCondition(&gw.Status.Conditions, cond) {
+			changed = true
+		}
+	}
+	healthy, healthyReason := gatewayv1alpha1.GetClusterGatewayHealthiness(gw.Status.Conditions)
 	if !healthy {
 		healthErrMsg := ""
 		if healthErr != nil {
 			healthErrMsg = healthErr.Error()
 		}
 		healthLog.Info("Cluster unhealthy", "cluster", clusterName,
+			"reason", healthyReason,
 			"body", string(resp),
 			"error", healthErrMsg)
 	}
-	if healthy != gw.Status.Healthy {
-		gw.Status.Healthy = healthy
-		if !healthy {
-			if healthErr != nil {
-				gw.Status.HealthyReason = gatewayv1alpha1.HealthyReasonType(healthErr.Error())
-			}
-		} else {
-			gw.Status.HealthyReason = ""
-		}
+	if changed {
 		healthLog.Info("Updating cluster healthiness",
 			"cluster", clusterName,
 			"healthy", healthy)
@@ -145,3 +188,184 @@ func (c *ClusterGatewayHealthProber) Reconcile(ctx context.Context, request reco
 	}
 	return reconcile.Result{}, nil
 }
+
+// probeConditions turns the result of the healthz probe and the credential
+// into the conditions of the ClusterGateway. The errors of the probe come
+// back through the proxy subresource as statuses, so they are told apart by
+// the reasons classified by the gateway.
+func probeConditions(gw *gatewayv1alpha1.ClusterGateway, secret *corev1.Secret, resp []byte, healthErr error, now time.Time) []metav1.Condition {
+	endpointResolved := metav1.Condition{
+		Type:    gatewayv1alpha1.ClusterGatewayConditionEndpointResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  "EndpointResolved",
+		Message: "The endpoint is resolved",
+	}
+	reachable := metav1.Condition{
+		Type:    gatewayv1alpha1.ClusterGatewayConditionReachable,
+		Status:  metav1.ConditionTrue,
+		Reason:  "SuccessfullyProbedHealthz",
+		Message: "Returned OK",
+	}
+	authenticated := metav1.Condition{
+		Type:    gatewayv1alpha1.ClusterGatewayConditionAuthenticated,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Authenticated",
+		Message: "The credential is accepted by the cluster",
+	}
+	notProbed := func(cond *metav1.Condition) {
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "NotProbed"
+		cond.Message = "The cluster is not reached"
+	}
+
+	if gw.Spec.Access.Endpoint == nil {
+		endpointResolved.Status = metav1.ConditionFalse
+		endpointResolved.Reason = string(gatewayv1alpha1.HealthyReasonTypeEndpointUnresolvable)
+		endpointResolved.Message = "The endpoint is missing"
+	}
+	switch {
+	case healthErr == nil && string(resp) == "ok":
+	case healthErr == nil:
+		reachable.Status = metav1.ConditionFalse
+		reachable.Reason = string(gatewayv1alpha1.HealthyReasonTypeHealthzFailed)
+		reachable.Message = string(resp)
+	case apierrors.IsUnauthorized(healthErr):
+		authenticated.Status = metav1.ConditionFalse
+		authenticated.Reason = string(gatewayv1alpha1.HealthyReasonTypeUnauthorized)
+		authenticated.Message = healthErr.Error()
+	case apierrors.IsForbidden(healthErr):
+		// authenticated while not authorized to read healthz
+		reachable.Message = healthErr.Error()
+	default:
+		msg := healthErr.Error()
+		reason, _ := gatewayv1alpha1.HealthyReasonOfError(healthErr)
+		switch reason {
+		case gatewayv1alpha1.HealthyReasonTypeEndpointUnresolvable:
+			endpointResolved.Status = metav1.ConditionFalse
+			endpointResolved.Reason = string(reason)
+			endpointResolved.Message = msg
+			notProbed(&reachable)
+			notProbed(&authenticated)
+		case gatewayv1alpha1.HealthyReasonTypeCredentialMissing:
+			notProbed(&reachable)
+			notProbed(&authenticated)
+		case gatewayv1alpha1.HealthyReasonTypeUnauthorized:
+			authenticated.Status = metav1.ConditionFalse
+			authenticated.Reason = string(reason)
+			authenticated.Message = msg
+		case gatewayv1alpha1.HealthyReasonTypeCertificateMismatch, gatewayv1alpha1.HealthyReasonTypeConnectionTimeout:
+			reachable.Status = metav1.ConditionFalse
+			reachable.Reason = string(reason)
+			reachable.Message = msg
+			notProbed(&authenticated)
+		default:
+			reachable.Status = metav1.ConditionFalse
+			reachable.Reason = string(gatewayv1alpha1.HealthyReasonTypeConnectionFailed)
+			reachable.Message = msg
+			notProbed(&authenticated)
+		}
+	}
+	return []metav1.Condition{
+		endpointResolved,
+		reachable,
+		credentialCondition(secret, now),
+		authenticated,
+	}
+}
+
+// credentialCondition checks the credential stored in the cluster-gateway
+// secret without reaching the cluster.
+func credentialCondition(secret *corev1.Secret, now time.Time) metav1.Condition {
+	cond := metav1.Condition{
+		Type:    gatewayv1alpha1.ClusterGatewayConditionCredentialValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  "CredentialValid",
+		Message: "The credential is valid",
+	}
+	invalid := func(reason gatewayv1alpha1.HealthyReasonType, msg string) metav1.Condition {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = string(reason)
+		cond.Message = msg
+		return cond
+	}
+	if secret == nil {
+		return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMissing, "The credential secret is missing")
+	}
+	credentialType, ok := secret.Labels[common.LabelKeyClusterCredentialType]
+	if !ok && secret.Labels[common.LabelKeyIsManagedServiceAccount] == "true" {
+		credentialType = string(gatewayv1alpha1.CredentialTypeServiceAccountToken)
+	}
+	switch gatewayv1alpha1.CredentialType(credentialType) {
+	case gatewayv1alpha1.CredentialTypeX509Certificate:
+		certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+		if len(certPEM) == 0 || len(keyPEM) == 0 {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMissing, "The certificate or the private key is missing")
+		}
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMalformed, err.Error())
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMalformed, err.Error())
+		}
+		if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialExpired,
+				fmt.Sprintf("The certificate is only valid from %s to %s", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339)))
+		}
+	case gatewayv1alpha1.CredentialTypeServiceAccountToken:
+		token := string(secret.Data[corev1.ServiceAccountTokenKey])
+		if len(token) == 0 {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMissing, "The token is missing")
+		}
+		if exp, ok := tokenExpiry(token); ok && now.After(exp) {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialExpired,
+				fmt.Sprintf("The token expired at %s", exp.Format(time.RFC3339)))
+		}
+	case gatewayv1alpha1.CredentialTypeExec:
+		execConfig := &gatewayv1alpha1.ExecConfig{}
+		data := secret.Data[common.SecretKeyClusterCredentialExec]
+		if len(data) == 0 {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMissing, "The exec config is missing")
+		}
+		if err := yaml.Unmarshal(data, execConfig); err != nil {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMalformed, err.Error())
+		}
+		if len(execConfig.Command) == 0 {
+			return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMalformed, "The exec command is missing")
+		}
+	case gatewayv1alpha1.CredentialTypeOIDCClientCredentials:
+		for _, key := range []string{
+			common.SecretKeyClusterCredentialOIDCIssuerURL,
+			common.SecretKeyClusterCredentialOIDCClientID,
+			common.SecretKeyClusterCredentialOIDCClientSecret,
+		} {
+			if len(secret.Data[key]) == 0 {
+				return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMissing, fmt.Sprintf("The %s is missing", key))
+			}
+		}
+	default:
+		return invalid(gatewayv1alpha1.HealthyReasonTypeCredentialMalformed,
+			fmt.Sprintf("Unrecognized credential type %q", credentialType))
+	}
+	return cond
+}
+
+// tokenExpiry reads the "exp" claim of a JWT token without verifying it.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
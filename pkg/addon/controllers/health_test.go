@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	certutil "k8s.io/client-go/util/cert"
+
+	gatewayv1alpha1 "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1"
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+)
+
+func conditionReasons(conditions []metav1.Condition) map[string]string {
+	reasons := make(map[string]string)
+	for _, cond := range conditions {
+		reasons[cond.Type] = fmt.Sprintf("%s/%s", cond.Status, cond.Reason)
+	}
+	return reasons
+}
+
+// gatewayStatusError is the failure reaching the cluster as served by the
+// gateway, which carries the reason in the causes.
+func gatewayStatusError(msg string, reason gatewayv1alpha1.HealthyReasonType) error {
+	statusErr := apierrors.NewInternalError(errors.New(msg))
+	statusErr.ErrStatus.Details.Causes = append(statusErr.ErrStatus.Details.Causes, metav1.StatusCause{
+		Type:    metav1.CauseType(reason),
+		Message: msg,
+	})
+	return statusErr
+}
+
+func TestProbeConditions(t *testing.T) {
+	gw := &gatewayv1alpha1.ClusterGateway{
+		Spec: gatewayv1alpha1.ClusterGatewaySpec{
+			Access: gatewayv1alpha1.ClusterAccess{
+				Endpoint: &gatewayv1alpha1.ClusterEndpoint{Type: gatewayv1alpha1.ClusterEndpointTypeClusterProxy},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{common.LabelKeyClusterCredentialType: string(gatewayv1alpha1.CredentialTypeServiceAccountToken)},
+		},
+		Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte("token")},
+	}
+	cases := []struct {
+		name      string
+		resp      string
+		healthErr error
+		expected  map[string]string
+	}{
+		{
+			name: "healthy",
+			resp: "ok",
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "True/SuccessfullyProbedHealthz",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "True/Authenticated",
+			},
+		},
+		{
+			name:      "unauthorized",
+			healthErr: apierrors.NewUnauthorized("Unauthorized"),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "True/SuccessfullyProbedHealthz",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "False/Unauthorized",
+			},
+		},
+		{
+			name:      "unresolvable",
+			healthErr: gatewayStatusError("dial tcp: lookup foo.example.com: no such host", gatewayv1alpha1.HealthyReasonTypeEndpointUnresolvable),
+			expected: map[string]string{
+				"EndpointResolved": "False/EndpointUnresolvable",
+				"Reachable":        "Unknown/NotProbed",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "Unknown/NotProbed",
+			},
+		},
+		{
+			name:      "timeout",
+			healthErr: gatewayStatusError("dial tcp 10.0.0.1:443: i/o timeout", gatewayv1alpha1.HealthyReasonTypeConnectionTimeout),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "False/ConnectionTimeout",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "Unknown/NotProbed",
+			},
+		},
+		{
+			name:      "certificate mismatch",
+			healthErr: gatewayStatusError("x509: certificate signed by unknown authority", gatewayv1alpha1.HealthyReasonTypeCertificateMismatch),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "False/CertificateMismatch",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "Unknown/NotProbed",
+			},
+		},
+		{
+			name:      "client certificate rejected",
+			healthErr: gatewayStatusError("remote error: tls: bad certificate", gatewayv1alpha1.HealthyReasonTypeUnauthorized),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "True/SuccessfullyProbedHealthz",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "False/Unauthorized",
+			},
+		},
+		{
+			name:      "credential missing",
+			healthErr: gatewayStatusError("proxying cluster foo not support due to lacking credentials", gatewayv1alpha1.HealthyReasonTypeCredentialMissing),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "Unknown/NotProbed",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "Unknown/NotProbed",
+			},
+		},
+		{
+			name:      "unclassified",
+			healthErr: apierrors.NewInternalError(errors.New("x509: certificate signed by unknown authority")),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "False/ConnectionFailed",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "Unknown/NotProbed",
+			},
+		},
+		{
+			name: "unhealthy",
+			resp: "[-]etcd failed",
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "False/HealthzFailed",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "True/Authenticated",
+			},
+		},
+		{
+			name:      "forbidden",
+			healthErr: apierrors.NewForbidden(schema.GroupResource{}, "healthz", errors.New("forbidden")),
+			expected: map[string]string{
+				"EndpointResolved": "True/EndpointResolved",
+				"Reachable":        "True/SuccessfullyProbedHealthz",
+				"CredentialValid":  "True/CredentialValid",
+				"Authenticated":    "True/Authenticated",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conditions := probeConditions(gw, secret, []byte(c.resp), c.healthErr, time.Now())
+			assert.Equal(t, c.expected, conditionReasons(conditions))
+		})
+	}
+}
+
+func TestCredentialCondition(t *testing.T) {
+	now := time.Now()
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey("localhost", nil, nil)
+	require.NoError(t, err)
+	jwt := func(exp time.Time) []byte {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+		return []byte("e30." + payload + ".sig")
+	}
+	x509Labels := map[string]string{common.LabelKeyClusterCredentialType: string(gatewayv1alpha1.CredentialTypeX509Certificate)}
+	tokenLabels := map[string]string{common.LabelKeyClusterCredentialType: string(gatewayv1alpha1.CredentialTypeServiceAccountToken)}
+	cases := []struct {
+		name     string
+		secret   *corev1.Secret
+		now      time.Time
+		expected string
+	}{
+		{name: "missing secret", expected: "CredentialMissing"},
+		{
+			name: "valid certificate",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: x509Labels},
+				Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+			},
+			now:      now,
+			expected: "CredentialValid",
+		},
+		{
+			name: "expired certificate",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: x509Labels},
+				Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+			},
+			now:      now.Add(10 * 365 * 24 * time.Hour),
+			expected: "CredentialExpired",
+		},
+		{
+			name: "mismatched key",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: x509Labels},
+				Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: []byte("foo")},
+			},
+			now:      now,
+			expected: "CredentialMalformed",
+		},
+		{
+			name: "valid token",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: tokenLabels},
+				Data:       map[string][]byte{corev1.ServiceAccountTokenKey: jwt(now.Add(time.Hour))},
+			},
+			now:      now,
+			expected: "CredentialValid",
+		},
+		{
+			name: "expired managed serviceaccount token",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{common.LabelKeyIsManagedServiceAccount: "true"}},
+				Data:       map[string][]byte{corev1.ServiceAccountTokenKey: jwt(now.Add(-time.Hour))},
+			},
+			now:      now,
+			expected: "CredentialExpired",
+		},
+		{
+			name: "valid exec config",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{common.LabelKeyClusterCredentialType: string(gatewayv1alpha1.CredentialTypeExec)}},
+				Data:       map[string][]byte{common.SecretKeyClusterCredentialExec: []byte(`{"command":"/usr/local/bin/aws"}`)},
+			},
+			now:      now,
+			expected: "CredentialValid",
+		},
+		{
+			name: "exec config without command",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{common.LabelKeyClusterCredentialType: string(gatewayv1alpha1.CredentialTypeExec)}},
+				Data:       map[string][]byte{common.SecretKeyClusterCredentialExec: []byte(`{"args":["eks"]}`)},
+			},
+			now:      now,
+			expected: "CredentialMalformed",
+		},
+		{
+			name:     "unknown type",
+			secret:   &corev1.Secret{},
+			now:      now,
+			expected: "CredentialMalformed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, credentialCondition(c.secret, c.now).Reason)
+		})
+	}
+}
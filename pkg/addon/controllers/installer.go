@@ -10,6 +10,7 @@ import (
 
 	"github.com/openshift/library-go/pkg/crypto"
 	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -20,11 +21,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
 	"k8s.io/client-go/kubernetes"
 	corev1lister "k8s.io/client-go/listers/core/v1"
 	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
 	"k8s.io/utils/ptr"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	ocmauthv1beta1 "open-cluster-management.io/managed-serviceaccount/apis/authentication/v1beta1"
 	"open-cluster-management.io/sdk-go/pkg/certrotation"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -36,6 +39,7 @@ import (
 
 	configv1alpha1 "github.com/kluster-manager/cluster-gateway/pkg/apis/config/v1alpha1"
 	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
 	eu "github.com/kluster-manager/cluster-gateway/pkg/event"
 	"github.com/kluster-manager/cluster-gateway/pkg/util/cert"
 )
@@ -289,6 +293,8 @@ func (c *ClusterGatewayInstaller) Reconcile(ctx context.Context, request reconci
 		newAuthDelegatorRole(owner, namespace),
 		newAPFClusterRole(owner),
 		newAPFClusterRoleBinding(owner, namespace),
+		newAPFValidatingAdmissionPolicy(owner, namespace),
+		newAPFValidatingAdmissionPolicyBinding(owner),
 	}
 	for _, obj := range targets {
 		if err := c.hostRtc.Create(context.TODO(), obj); err != nil {
@@ -519,6 +525,15 @@ func newServiceAccount(owner *addonv1alpha1.ClusterManagementAddOn, namespace st
 	}
 }
 
+// clusterProxyModeArg translates the egress mode to the value of the
+// gateway's --proxy-mode flag.
+func clusterProxyModeArg(mode configv1alpha1.ClusterProxyMode) string {
+	if mode == configv1alpha1.ClusterProxyModeHTTPConnect {
+		return config.ClusterProxyModeHTTPConnect
+	}
+	return config.ClusterProxyModeGRPC
+}
+
 const labelKeyClusterGatewayConfigurationGeneration = "config.gateway.open-cluster-management.io/configuration-generation"
 
 func newClusterGatewayDeployment(owner *addonv1alpha1.ClusterManagementAddOn, config *configv1alpha1.ClusterGatewayConfiguration, installNamespace, mcKubeconfigSecretName, clusterAuthNamespace string) *appsv1.Deployment {
@@ -552,6 +567,7 @@ func newClusterGatewayDeployment(owner *addonv1alpha1.ClusterManagementAddOn, co
 			"--proxy-ca-cert=/etc/ca/ca.crt",
 			"--proxy-cert=/etc/tls/tls.crt",
 			"--proxy-key=/etc/tls/tls.key",
+			"--proxy-mode="+clusterProxyModeArg(config.Spec.Egress.ClusterProxy.Mode),
 		)
 		volumes = append(volumes,
 			corev1.Volume{
@@ -877,15 +893,17 @@ func newAPFClusterRole(owner *addonv1alpha1.ClusterManagementAddOn) *rbacv1.Clus
 			},
 		},
 		Rules: []rbacv1.PolicyRule{
+			// read/write managed clusters through clustergateways
 			{
 				APIGroups: []string{"cluster.open-cluster-management.io"},
 				Resources: []string{"managedclusters"},
-				Verbs:     []string{"get", "list", "watch"},
+				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
 			},
+			// create the cluster namespaces, narrowed by the validating admission policy
 			{
 				APIGroups: []string{""},
 				Resources: []string{"namespaces"},
-				Verbs:     []string{"get", "list", "watch"},
+				Verbs:     []string{"get", "list", "watch", "create"},
 			},
 			{
 				APIGroups: []string{"admissionregistration.k8s.io"},
@@ -906,15 +924,38 @@ func newAPFClusterRole(owner *addonv1alpha1.ClusterManagementAddOn) *rbacv1.Clus
 			{
 				APIGroups: []string{"addon.open-cluster-management.io"},
 				Resources: []string{"managedclusteraddons"},
-				Verbs:     []string{"get", "list", "watch", "update", "patch"},
+				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
 			},
-			// read managed service account credentials
+			// read managed service account credentials and write cluster credentials
 			{
 				APIGroups:     []string{""},
 				Resources:     []string{"secrets"},
-				Verbs:         []string{"get", "list", "watch"},
+				Verbs:         []string{"get", "list", "watch", "update", "patch", "delete"},
 				ResourceNames: []string{common.AddonName},
 			},
+			// read the egress proxy credentials of the fixed name
+			{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				Verbs:         []string{"get"},
+				ResourceNames: []string{common.SecretNameEgressProxyCredential},
+			},
+			// cache the secrets of the credential profiles selected by their
+			// label, which are only read by the names prefixed
+			// "cluster-gateway-profile-" in the cluster namespaces as neither can
+			// be restricted by RBAC
+			{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"list", "watch"},
+			},
+			// creating requests cannot be restricted by resource names, which are
+			// narrowed by the validating admission policy instead
+			{
+				APIGroups: []string{""},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"create"},
+			},
 			// read cluster-auth Accounts
 			{
 				APIGroups: []string{"authentication.k8s.appscode.com"},
@@ -952,6 +993,80 @@ func newAPFClusterRoleBinding(owner *addonv1alpha1.ClusterManagementAddOn, names
 	}
 }
 
+// newAPFValidatingAdmissionPolicy narrows the secrets and the namespaces
+// created by the gateway, as the creating requests cannot be restricted by
+// resource names in the RBAC.
+func newAPFValidatingAdmissionPolicy(owner *addonv1alpha1.ClusterManagementAddOn, namespace string) *admissionregistrationv1.ValidatingAdmissionPolicy {
+	return &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "open-cluster-management:cluster-gateway:apiserver",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: addonv1alpha1.GroupVersion.String(),
+					Kind:       "ClusterManagementAddOn",
+					UID:        owner.UID,
+					Name:       owner.Name,
+				},
+			},
+		},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			FailurePolicy: ptr.To(admissionregistrationv1.Fail),
+			MatchConstraints: &admissionregistrationv1.MatchResources{
+				ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{
+					{
+						RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+							Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+							Rule: admissionregistrationv1.Rule{
+								APIGroups:   []string{""},
+								APIVersions: []string{"v1"},
+								Resources:   []string{"secrets", "namespaces"},
+							},
+						},
+					},
+				},
+			},
+			MatchConditions: []admissionregistrationv1.MatchCondition{
+				{
+					Name:       "cluster-gateway-apiserver",
+					Expression: fmt.Sprintf("request.userInfo.username == %q", serviceaccount.MakeUsername(namespace, common.AddonName)),
+				},
+			},
+			Validations: []admissionregistrationv1.Validation{
+				{
+					Expression: fmt.Sprintf("request.resource.resource != \"secrets\" || object.metadata.name == %q", common.AddonName),
+					Message:    "the gateway only creates the secrets named " + common.AddonName,
+				},
+				{
+					Expression: fmt.Sprintf("request.resource.resource != \"namespaces\" || "+
+						"(has(object.metadata.labels) && %[1]q in object.metadata.labels && object.metadata.labels[%[1]q] == object.metadata.name)",
+						clusterv1.ClusterNameLabelKey),
+					Message: "the gateway only creates the cluster namespaces",
+				},
+			},
+		},
+	}
+}
+
+func newAPFValidatingAdmissionPolicyBinding(owner *addonv1alpha1.ClusterManagementAddOn) *admissionregistrationv1.ValidatingAdmissionPolicyBinding {
+	return &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "open-cluster-management:cluster-gateway:apiserver",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: addonv1alpha1.GroupVersion.String(),
+					Kind:       "ClusterManagementAddOn",
+					UID:        owner.UID,
+					Name:       owner.Name,
+				},
+			},
+		},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName:        "open-cluster-management:cluster-gateway:apiserver",
+			ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.Deny},
+		},
+	}
+}
+
 func buildManagedServiceAccount(owner *addonv1alpha1.ManagedClusterAddOn) *ocmauthv1beta1.ManagedServiceAccount {
 	return &ocmauthv1beta1.ManagedServiceAccount{
 		TypeMeta: metav1.TypeMeta{
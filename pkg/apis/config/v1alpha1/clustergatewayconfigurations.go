@@ -39,6 +39,11 @@ type ClusterGatewayConfigurationSpec struct {
 	SecretManagement ClusterGatewaySecretManagement `json:"secretManagement"`
 	// +required
 	Egress ClusterGatewayTrafficEgress `json:"egress"`
+	// `reverseTunnel` deploys the agents dialing the reverse tunnels out to
+	// the gateway into the clusters opted in by the addon annotation
+	// "gateway.open-cluster-management.io/reverse-tunnel".
+	// +optional
+	ReverseTunnel *ClusterGatewayReverseTunnel `json:"reverseTunnel,omitempty"`
 }
 
 type ClusterGatewayConfigurationStatus struct {
@@ -60,17 +65,36 @@ const (
 )
 
 type ClusterGatewayTrafficEgressClusterProxy struct {
-	ProxyServerHost string                                            `json:"proxyServerHost"`
-	ProxyServerPort int32                                             `json:"proxyServerPort"`
-	Credentials     ClusterGatewayTrafficEgressClusterProxyCredential `json:"credentials"`
+	ProxyServerHost string `json:"proxyServerHost"`
+	ProxyServerPort int32  `json:"proxyServerPort"`
+	// `mode` is the mode the proxy server is serving in. The HTTPConnect mode
+	// passes through the load balancers not passing gRPC.
+	// +optional
+	// +kubebuilder:default=GRPC
+	Mode        ClusterProxyMode                                  `json:"mode,omitempty"`
+	Credentials ClusterGatewayTrafficEgressClusterProxyCredential `json:"credentials"`
 }
 
+// +kubebuilder:validation:Enum=GRPC;HTTPConnect
+type ClusterProxyMode string
+
+const (
+	ClusterProxyModeGRPC        ClusterProxyMode = "GRPC"
+	ClusterProxyModeHTTPConnect ClusterProxyMode = "HTTPConnect"
+)
+
 type ClusterGatewayTrafficEgressClusterProxyCredential struct {
 	Namespace               string `json:"namespace"`
 	ProxyClientSecretName   string `json:"proxyClientSecretName"`
 	ProxyClientCASecretName string `json:"proxyClientCASecretName"`
 }
 
+type ClusterGatewayReverseTunnel struct {
+	// `image` is the image of the reverse tunnel agents.
+	// +required
+	Image string `json:"image"`
+}
+
 type ClusterGatewaySecretManagement struct {
 	// +optional
 	// +kubebuilder:default=ManagedServiceAccount
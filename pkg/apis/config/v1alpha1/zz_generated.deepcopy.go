@@ -87,6 +87,11 @@ func (in *ClusterGatewayConfigurationSpec) DeepCopyInto(out *ClusterGatewayConfi
 	*out = *in
 	in.SecretManagement.DeepCopyInto(&out.SecretManagement)
 	in.Egress.DeepCopyInto(&out.Egress)
+	if in.ReverseTunnel != nil {
+		in, out := &in.ReverseTunnel, &out.ReverseTunnel
+		*out = new(ClusterGatewayReverseTunnel)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayConfigurationSpec.
@@ -121,6 +126,21 @@ func (in *ClusterGatewayConfigurationStatus) DeepCopy() *ClusterGatewayConfigura
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayReverseTunnel) DeepCopyInto(out *ClusterGatewayReverseTunnel) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayReverseTunnel.
+func (in *ClusterGatewayReverseTunnel) DeepCopy() *ClusterGatewayReverseTunnel {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayReverseTunnel)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewaySecretManagement) DeepCopyInto(out *ClusterGatewaySecretManagement) {
 	*out = *in
@@ -0,0 +1,185 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+var _ resource.ArbitrarySubResource = &ClusterGatewayCredentialsReader{}
+var _ rest.Getter = &ClusterGatewayCredentialsReader{}
+
+// ClusterGatewayCredentialsReader is an opt-in subresource for ClusterGateway
+// which serves the credentials of the cluster to the break-glass tooling. The
+// reads are authorized by the "reveal" verb upon the subresource in addition
+// to "get", audited, and optionally rate limited for each user.
+type ClusterGatewayCredentialsReader struct {
+}
+
+// ClusterGatewayCredentials is the privileged view of a ClusterGateway served
+// by the credentials subresource, carrying the credential contents which are
+// never served by the ClusterGateway itself.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterGatewayCredentials struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Endpoint is the endpoint of the cluster.
+	// +optional
+	Endpoint *ClusterEndpoint `json:"endpoint,omitempty"`
+	// SSHBastionPrivateKey is the private key authenticating to the SSH
+	// bastion of the endpoint.
+	// +optional
+	SSHBastionPrivateKey []byte `json:"sshBastionPrivateKey,omitempty"`
+	// Credential is the credential of the cluster.
+	// +optional
+	Credential *ClusterAccessCredentialContents `json:"credential,omitempty"`
+}
+
+// ClusterAccessCredentialContents is the serialized ClusterAccessCredential
+// including the credential contents.
+type ClusterAccessCredentialContents struct {
+	Type                CredentialType         `json:"type"`
+	ServiceAccountToken string                 `json:"serviceAccountToken,omitempty"`
+	X509                *X509                  `json:"x509,omitempty"`
+	Exec                *ExecConfig            `json:"exec,omitempty"`
+	OIDC                *OIDCClientCredentials `json:"oidc,omitempty"`
+	TokenRequest        *TokenRequestConfig    `json:"tokenRequest,omitempty"`
+}
+
+func (in *ClusterGatewayCredentialsReader) New() runtime.Object {
+	return &ClusterGatewayCredentials{}
+}
+
+func (in *ClusterGatewayCredentialsReader) SubResourceName() string {
+	return "credentials"
+}
+
+func (in *ClusterGatewayCredentialsReader) Destroy() {}
+
+func (in *ClusterGatewayCredentialsReader) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	if !config.EnableCredentialsSubresource {
+		return nil, apierrors.NewForbidden(clusterGatewayGroupResource(), name,
+			errors.New("the credentials subresource is disabled"))
+	}
+	if isLocalCluster(name) {
+		return nil, apierrors.NewForbidden(clusterGatewayGroupResource(), name,
+			errors.New("the local cluster is authenticated by the gateway itself"))
+	}
+	requester, _ := request.UserFrom(ctx)
+	if err := authorizeCredentialsReading(ctx, requester, name); err != nil {
+		return nil, err
+	}
+	userName := ""
+	if requester != nil {
+		userName = requester.GetName()
+	}
+	if !credentialsReadingLimiter.tryAccept(userName) {
+		return nil, apierrors.NewTooManyRequests(fmt.Sprintf("reading credentials by user %q is rate limited", userName), 1)
+	}
+
+	parentStorage, ok := contextutil.GetParentStorageGetter(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no parent storage found")
+	}
+	parentObj, err := parentStorage.Get(ctx, name, options)
+	if err != nil {
+		return nil, fmt.Errorf("no such cluster %v", name)
+	}
+	credentials := newClusterGatewayCredentials(parentObj.(*ClusterGateway))
+	credentialType := "<none>"
+	if credentials.Credential != nil {
+		credentialType = string(credentials.Credential.Type)
+	}
+	audit.AddAuditAnnotation(ctx, common.AuditAnnotationKeyCredentialsRead, credentialType)
+	klog.Infof("Credentials of cluster %s are read by user %q", name, userName)
+	return credentials, nil
+}
+
+// authorizeCredentialsReading authorizes the user upon the "reveal" verb of
+// the credentials subresource of the cluster, so that reading the credentials
+// is never granted by wildcard subresources of the "get" verb alone.
+func authorizeCredentialsReading(ctx context.Context, requester user.Info, cluster string) error {
+	attr := authorizer.AttributesRecord{
+		User:            requester,
+		APIGroup:        config.MetaApiGroupName,
+		APIVersion:      config.MetaApiVersionName,
+		Resource:        config.MetaApiResourceName,
+		Subresource:     "credentials",
+		Name:            cluster,
+		Verb:            common.VerbRevealCredentials,
+		ResourceRequest: true,
+	}
+	decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("authorizing reading credentials failed: %v", err))
+	}
+	if decision != authorizer.DecisionAllow {
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), cluster,
+			fmt.Errorf("reading credentials requires the %q verb upon the credentials subresource: %s", common.VerbRevealCredentials, reason))
+	}
+	return nil
+}
+
+func newClusterGatewayCredentials(gw *ClusterGateway) *ClusterGatewayCredentials {
+	credentials := &ClusterGatewayCredentials{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              gw.Name,
+			UID:               gw.UID,
+			ResourceVersion:   gw.ResourceVersion,
+			CreationTimestamp: gw.CreationTimestamp,
+		},
+		Endpoint: gw.Spec.Access.Endpoint,
+	}
+	if endpoint := gw.Spec.Access.Endpoint; endpoint != nil && endpoint.SSHBastion != nil {
+		credentials.SSHBastionPrivateKey = endpoint.SSHBastion.PrivateKey
+	}
+	credentials.Credential = credentialContentsOf(gw.Spec.Access.Credential)
+	return credentials
+}
+
+// credentialsReadingLimiterSize is the number of users whose rate limiters
+// of reading credentials are kept.
+const credentialsReadingLimiterSize = 1024
+
+var credentialsReadingLimiter = &userRateLimiters{limiters: lru.New(credentialsReadingLimiterSize)}
+
+// userRateLimiters rate limits each user by the QPS and the burst of the
+// credentials subresource.
+type userRateLimiters struct {
+	lock     sync.Mutex
+	limiters *lru.Cache
+}
+
+func (l *userRateLimiters) tryAccept(name string) bool {
+	if config.CredentialsSubresourceQPS <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	limiter, ok := l.limiters.Get(name)
+	if !ok {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(config.CredentialsSubresourceQPS, config.CredentialsSubresourceBurst)
+		l.limiters.Add(name, limiter)
+	}
+	return limiter.(flowcontrol.RateLimiter).TryAccept()
+}
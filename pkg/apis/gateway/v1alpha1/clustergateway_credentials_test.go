@@ -0,0 +1,80 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/utils/lru"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+func TestClusterGatewayCredentials(t *testing.T) {
+	setLocalClusterNameDuringTest(t, "local-cluster")
+	enabled, qps, burst := config.EnableCredentialsSubresource, config.CredentialsSubresourceQPS, config.CredentialsSubresourceBurst
+	defer func() {
+		config.EnableCredentialsSubresource, config.CredentialsSubresourceQPS, config.CredentialsSubresourceBurst = enabled, qps, burst
+	}()
+	limiters := credentialsReadingLimiter.limiters
+	defer func() { credentialsReadingLimiter.limiters = limiters }()
+	credentialsReadingLimiter.limiters = lru.New(credentialsReadingLimiterSize)
+	original := loopback.GetAuthorizer()
+	defer loopback.SetAuthorizer(original)
+	loopback.SetAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() == "admin" && a.GetVerb() == "reveal" && a.GetSubresource() == "credentials" && a.GetName() == "cluster-a" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}))
+
+	gw := constClusterGateway("cluster-a", x509Credential())
+	gw.Spec.Access.Endpoint.SSHBastion = &ClusterEndpointSSHBastion{Host: "bastion", User: "jump", PrivateKey: []byte("ssh-key")}
+	parent := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	adminCtx := request.WithUser(parent, &user.DefaultInfo{Name: "admin"})
+	reader := &ClusterGatewayCredentialsReader{}
+
+	// opted out by default
+	_, err := reader.Get(adminCtx, "cluster-a", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+
+	config.EnableCredentialsSubresource = true
+	_, err = reader.Get(request.WithUser(parent, &user.DefaultInfo{Name: "alice"}), "cluster-a", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+	_, err = reader.Get(adminCtx, "local-cluster", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+
+	out, err := reader.Get(adminCtx, "cluster-a", &metav1.GetOptions{})
+	require.NoError(t, err)
+	credentials := out.(*ClusterGatewayCredentials)
+	assert.Equal(t, "cluster-a", credentials.Name)
+	assert.Equal(t, gw.Spec.Access.Endpoint, credentials.Endpoint)
+	data, err := json.Marshal(credentials)
+	require.NoError(t, err)
+	var serialized map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &serialized))
+	assert.Equal(t, map[string]interface{}{
+		"type": string(CredentialTypeX509Certificate),
+		"x509": map[string]interface{}{
+			"certificate": "Y2VydERhdGE=",
+			"privateKey":  "a2V5RGF0YQ==",
+		},
+	}, serialized["credential"])
+	assert.Equal(t, "c3NoLWtleQ==", serialized["sshBastionPrivateKey"])
+
+	// rate limited for each user
+	config.CredentialsSubresourceQPS, config.CredentialsSubresourceBurst = 0.001, 1
+	_, err = reader.Get(adminCtx, "cluster-a", &metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = reader.Get(adminCtx, "cluster-a", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsTooManyRequests(err), "unexpected error: %v", err)
+}
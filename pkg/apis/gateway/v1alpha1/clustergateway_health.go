@@ -2,16 +2,27 @@ package v1alpha1
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
+	"time"
 
 	"github.com/kluster-manager/cluster-gateway/pkg/common"
 	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
 
+	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/registry/rest"
 	"k8s.io/klog/v2"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
@@ -54,6 +65,9 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 	if singleton.GetClient() == nil {
 		return nil, false, fmt.Errorf("controller manager is not initialized yet")
 	}
+	if isLocalCluster(name) {
+		return nil, false, newLocalClusterForbiddenError(name)
+	}
 
 	updating, err := objInfo.UpdatedObject(ctx, nil)
 	if err != nil {
@@ -61,6 +75,12 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 	}
 	updatingClusterGateway := updating.(*ClusterGateway)
 
+	var cluster clusterv1.ManagedCluster
+	err = singleton.GetClient().Get(ctx, types.NamespacedName{Name: name}, &cluster)
+	if err != nil {
+		return nil, false, err
+	}
+
 	var gwAddon addonv1alpha1.ManagedClusterAddOn
 	err = singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.AddonName, Namespace: name}, &gwAddon)
 	if err != nil {
@@ -70,8 +90,28 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 	if mod.Annotations == nil {
 		mod.Annotations = make(map[string]string)
 	}
-	mod.Annotations[common.AnnotationKeyClusterGatewayStatusHealthy] = strconv.FormatBool(updatingClusterGateway.Status.Healthy)
-	mod.Annotations[common.AnnotationKeyClusterGatewayStatusHealthyReason] = string(updatingClusterGateway.Status.HealthyReason)
+	healthy, healthyReason := updatingClusterGateway.Status.Healthy, updatingClusterGateway.Status.HealthyReason
+	if len(updatingClusterGateway.Status.Conditions) > 0 {
+		existing, err := decodeClusterGatewayConditions(gwAddon.Annotations)
+		if err != nil {
+			klog.Warningf("Discarding unrecognized conditions of cluster %q: %v", name, err)
+		}
+		conditions := mergeClusterGatewayConditions(existing, updatingClusterGateway.Status.Conditions, cluster.Generation)
+		if errs := metav1validation.ValidateConditions(conditions, field.NewPath("status", "conditions")); len(errs) > 0 {
+			return nil, false, apierrors.NewInvalid(clusterGatewayGroupKind(), name, errs)
+		}
+		data, err := json.Marshal(conditions)
+		if err != nil {
+			return nil, false, err
+		}
+		mod.Annotations[common.AnnotationKeyClusterGatewayStatusConditions] = string(data)
+		healthy, healthyReason = GetClusterGatewayHealthiness(conditions)
+	} else {
+		// the healthiness reported without conditions by legacy clients
+		delete(mod.Annotations, common.AnnotationKeyClusterGatewayStatusConditions)
+	}
+	mod.Annotations[common.AnnotationKeyClusterGatewayStatusHealthy] = strconv.FormatBool(healthy)
+	mod.Annotations[common.AnnotationKeyClusterGatewayStatusHealthyReason] = string(healthyReason)
 
 	patch := client.MergeFrom(&gwAddon)
 	err = singleton.GetClient().Patch(ctx, mod, patch)
@@ -79,12 +119,6 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 		return nil, false, err
 	}
 
-	var cluster clusterv1.ManagedCluster
-	err = singleton.GetClient().Get(ctx, types.NamespacedName{Name: name}, &cluster)
-	if err != nil {
-		return nil, false, err
-	}
-
 	endpointType := getClusterEndpointType(ctx, cluster.Name)
 
 	var secret core.Secret
@@ -94,9 +128,141 @@ func (in *ClusterGatewayHealth) Update(ctx context.Context, name string, objInfo
 		return nil, false, err
 	}
 
-	clusterGateway, err := convert(&cluster, &gwAddon, endpointType, &secret)
+	clusterGateway, err := convert(&cluster, mod, endpointType, &secret)
 	if err != nil {
 		return nil, false, err
 	}
 	return clusterGateway, false, nil
 }
+
+// GetClusterGatewayHealthiness derives the healthiness from the conditions.
+// The cluster is healthy only if all the conditions are true, otherwise the
+// reason comes from the first condition not being true.
+func GetClusterGatewayHealthiness(conditions []metav1.Condition) (bool, HealthyReasonType) {
+	if len(conditions) == 0 {
+		return false, ""
+	}
+	for _, t := range ClusterGatewayConditionTypes {
+		if cond := meta.FindStatusCondition(conditions, t); cond != nil && cond.Status != metav1.ConditionTrue {
+			return false, HealthyReasonType(cond.Reason)
+		}
+	}
+	for _, cond := range conditions {
+		if cond.Status != metav1.ConditionTrue {
+			return false, HealthyReasonType(cond.Reason)
+		}
+	}
+	return true, ""
+}
+
+// mergeClusterGatewayConditions replaces the existing conditions with the
+// reported ones. The lastTransitionTime is only refreshed upon the change of
+// the condition status, and the observedGeneration defaults to the current
+// generation of the ClusterGateway.
+func mergeClusterGatewayConditions(existing, reported []metav1.Condition, generation int64) []metav1.Condition {
+	merged := make([]metav1.Condition, 0, len(reported))
+	for _, cond := range reported {
+		if cond.ObservedGeneration == 0 {
+			cond.ObservedGeneration = generation
+		}
+		if prev := meta.FindStatusCondition(existing, cond.Type); prev != nil && prev.Status == cond.Status {
+			cond.LastTransitionTime = prev.LastTransitionTime
+		} else if cond.LastTransitionTime.IsZero() {
+			cond.LastTransitionTime = metav1.NewTime(time.Now())
+		}
+		merged = append(merged, cond)
+	}
+	return merged
+}
+
+// decodeClusterGatewayConditions reads the conditions persisted in the
+// annotations of the cluster-gateway addon.
+func decodeClusterGatewayConditions(annotations map[string]string) ([]metav1.Condition, error) {
+	raw, ok := annotations[common.AnnotationKeyClusterGatewayStatusConditions]
+	if !ok || len(raw) == 0 {
+		return nil, nil
+	}
+	var conditions []metav1.Condition
+	if err := json.Unmarshal([]byte(raw), &conditions); err != nil {
+		return nil, err
+	}
+	return conditions, nil
+}
+
+// tlsCertificateAlerts are the alerts of the clusters rejecting the client
+// certificate, which come back as the remote errors of the TLS handshake.
+var tlsCertificateAlerts = sets.NewString(
+	"tls: bad certificate",
+	"tls: unsupported certificate",
+	"tls: revoked certificate",
+	"tls: expired certificate",
+	"tls: unknown certificate",
+	"tls: certificate required",
+)
+
+// HealthyReasonOfError tells the reason of the failure reaching the cluster.
+// The errors of the proxied requests lose their types when crossing the
+// gateway, so the reason classified by the gateway is read from the causes
+// of the status, see newEndpointStatusError.
+func HealthyReasonOfError(err error) (HealthyReasonType, bool) {
+	if err == nil {
+		return "", false
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if details := status.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				if healthyReasonCauses.Has(string(cause.Type)) {
+					return HealthyReasonType(cause.Type), true
+				}
+			}
+		}
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return HealthyReasonTypeEndpointUnresolvable, true
+	case errors.As(err, &opErr) && opErr.Op == "remote error" && opErr.Err != nil && tlsCertificateAlerts.Has(opErr.Err.Error()):
+		return HealthyReasonTypeUnauthorized, true
+	case errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &certificateInvalidErr),
+		errors.As(err, &verificationErr):
+		return HealthyReasonTypeCertificateMismatch, true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return HealthyReasonTypeConnectionTimeout, true
+	}
+	return "", false
+}
+
+// healthyReasonCauses are the reasons conveyed as the causes of the status.
+var healthyReasonCauses = sets.NewString(
+	string(HealthyReasonTypeEndpointUnresolvable),
+	string(HealthyReasonTypeUnauthorized),
+	string(HealthyReasonTypeCertificateMismatch),
+	string(HealthyReasonTypeConnectionTimeout),
+	string(HealthyReasonTypeCredentialMissing),
+)
+
+// newEndpointStatusError converts the failure reaching the cluster into the
+// status error served by the gateway, carrying the reason of the failure in
+// its causes.
+func newEndpointStatusError(err error, reason HealthyReasonType) *apierrors.StatusError {
+	statusErr := apierrors.NewInternalError(err)
+	if len(reason) == 0 {
+		reason, _ = HealthyReasonOfError(err)
+	}
+	if len(reason) > 0 {
+		statusErr.ErrStatus.Details.Causes = append(statusErr.ErrStatus.Details.Causes, metav1.StatusCause{
+			Type:    metav1.CauseType(reason),
+			Message: err.Error(),
+		})
+	}
+	return statusErr
+}
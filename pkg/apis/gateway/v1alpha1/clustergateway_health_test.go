@@ -0,0 +1,173 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/registry/rest"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+func TestUpdateClusterGatewayHealthConditions(t *testing.T) {
+	featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultMutableFeatureGate, featuregates.HealthinessCheck, true)
+	ctx := context.TODO()
+	cluster := managedCluster("foo", testEndpoint, []byte(testCAData))
+	cluster.Generation = 3
+	fakeClient := newWriteTestClient(t,
+		cluster,
+		gatewayAddon("foo", nil),
+		credentialSecret("foo", x509Labels, x509Data),
+	)
+	health := &ClusterGatewayHealth{}
+	update := func(status ClusterGatewayStatus) (*ClusterGateway, error) {
+		gw := &ClusterGateway{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Status: status}
+		out, _, err := health.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(gw), nil, nil, false, &metav1.UpdateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return out.(*ClusterGateway), nil
+	}
+	conditions := func(reachable metav1.ConditionStatus) []metav1.Condition {
+		return []metav1.Condition{
+			{Type: ClusterGatewayConditionEndpointResolved, Status: metav1.ConditionTrue, Reason: "EndpointResolved"},
+			{Type: ClusterGatewayConditionReachable, Status: reachable, Reason: string(HealthyReasonTypeConnectionTimeout)},
+			{Type: ClusterGatewayConditionCredentialValid, Status: metav1.ConditionTrue, Reason: "CredentialValid"},
+			{Type: ClusterGatewayConditionAuthenticated, Status: metav1.ConditionTrue, Reason: "Authenticated"},
+		}
+	}
+
+	// healthiness is derived from the conditions
+	gw, err := update(ClusterGatewayStatus{Healthy: true, Conditions: conditions(metav1.ConditionFalse)})
+	require.NoError(t, err)
+	assert.False(t, gw.Status.Healthy)
+	assert.Equal(t, HealthyReasonTypeConnectionTimeout, gw.Status.HealthyReason)
+	require.Len(t, gw.Status.Conditions, 4)
+	transitioned := meta.FindStatusCondition(gw.Status.Conditions, ClusterGatewayConditionReachable).LastTransitionTime
+	assert.False(t, transitioned.IsZero())
+	for _, cond := range gw.Status.Conditions {
+		assert.Equal(t, int64(3), cond.ObservedGeneration, "the observedGeneration defaults to the generation")
+	}
+
+	// the transition time is kept until the status changes
+	reported := conditions(metav1.ConditionFalse)
+	reported[1].LastTransitionTime = metav1.NewTime(time.Now().Add(time.Hour))
+	reported[1].ObservedGeneration = 2
+	gw, err = update(ClusterGatewayStatus{Conditions: reported})
+	require.NoError(t, err)
+	assert.Equal(t, transitioned, meta.FindStatusCondition(gw.Status.Conditions, ClusterGatewayConditionReachable).LastTransitionTime)
+	assert.Equal(t, int64(2), meta.FindStatusCondition(gw.Status.Conditions, ClusterGatewayConditionReachable).ObservedGeneration)
+
+	gw, err = update(ClusterGatewayStatus{Conditions: conditions(metav1.ConditionTrue)})
+	require.NoError(t, err)
+	assert.True(t, gw.Status.Healthy)
+	assert.Empty(t, gw.Status.HealthyReason)
+
+	// the conditions are served by get
+	out, err := (&ClusterGateway{}).Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, gw.Status, out.(*ClusterGateway).Status)
+
+	// invalid conditions are rejected
+	_, err = update(ClusterGatewayStatus{Conditions: []metav1.Condition{{Type: ClusterGatewayConditionReachable}}})
+	assert.True(t, apierrors.IsInvalid(err))
+
+	// legacy clients reporting the bool drop the conditions
+	gw, err = update(ClusterGatewayStatus{Healthy: false, HealthyReason: HealthyReasonTypeConnectionTimeout})
+	require.NoError(t, err)
+	assert.False(t, gw.Status.Healthy)
+	assert.Empty(t, gw.Status.Conditions)
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayStatusConditions)
+}
+
+func TestGetClusterGatewayHealthiness(t *testing.T) {
+	healthy, reason := GetClusterGatewayHealthiness(nil)
+	assert.False(t, healthy)
+	assert.Empty(t, reason)
+
+	// the reason follows the precedence of the condition types
+	healthy, reason = GetClusterGatewayHealthiness([]metav1.Condition{
+		{Type: ClusterGatewayConditionAuthenticated, Status: metav1.ConditionUnknown, Reason: "NotProbed"},
+		{Type: ClusterGatewayConditionEndpointResolved, Status: metav1.ConditionFalse, Reason: "EndpointUnresolvable"},
+	})
+	assert.False(t, healthy)
+	assert.Equal(t, HealthyReasonTypeEndpointUnresolvable, reason)
+}
+
+func TestHealthyReasonOfError(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected HealthyReasonType
+	}{
+		"unresolvable": {
+			err:      &url.Error{Op: "Get", URL: "https://foo.example.com", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "foo.example.com", IsNotFound: true}}},
+			expected: HealthyReasonTypeEndpointUnresolvable,
+		},
+		"timeout": {
+			err:      &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded},
+			expected: HealthyReasonTypeConnectionTimeout,
+		},
+		"deadline exceeded": {
+			err:      errors.Wrap(context.DeadlineExceeded, "probing"),
+			expected: HealthyReasonTypeConnectionTimeout,
+		},
+		"unknown authority": {
+			err:      &url.Error{Op: "Get", URL: "https://foo.example.com", Err: x509.UnknownAuthorityError{}},
+			expected: HealthyReasonTypeCertificateMismatch,
+		},
+		"verification failure": {
+			err:      &tls.CertificateVerificationError{Err: x509.HostnameError{Certificate: &x509.Certificate{}, Host: "foo"}},
+			expected: HealthyReasonTypeCertificateMismatch,
+		},
+		"client certificate rejected": {
+			err:      &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")},
+			expected: HealthyReasonTypeUnauthorized,
+		},
+		"the messages are never classified": {
+			err: apierrors.NewInternalError(errors.New("x509: certificate signed by unknown authority, i/o timeout")),
+		},
+		"connection refused": {
+			err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			reason, ok := HealthyReasonOfError(c.err)
+			assert.Equal(t, c.expected, reason)
+			assert.Equal(t, len(c.expected) > 0, ok)
+
+			// the reason survives serving the error by the gateway
+			recorder := httptest.NewRecorder()
+			writeEndpointError(recorder, c.err, "")
+			assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+			status := metav1.Status{}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+			assert.Equal(t, "Status", status.Kind)
+			reason, _ = HealthyReasonOfError(&apierrors.StatusError{ErrStatus: status})
+			assert.Equal(t, c.expected, reason)
+		})
+	}
+}
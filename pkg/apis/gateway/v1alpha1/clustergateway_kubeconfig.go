@@ -0,0 +1,155 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource/resourcerest"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+var _ resource.SubResource = &ClusterGatewayKubeconfig{}
+var _ registryrest.Storage = &ClusterGatewayKubeconfig{}
+var _ resourcerest.Connecter = &ClusterGatewayKubeconfig{}
+
+// ClusterGatewayKubeconfig is a subresource for ClusterGateway which generates
+// the kubeconfig requesting the managed cluster through the proxy subresource,
+// so that the plain clients e.g. kubectl and helm reach the managed cluster
+// without wiring the gateway round-tripper. The kubeconfig carries no
+// credential: the requests are authenticated by the hub credential of the
+// user, which is referred to by the "authInfo" option and merged from the
+// kubeconfig of the user e.g. KUBECONFIG=<hub kubeconfig>:<generated kubeconfig>.
+type ClusterGatewayKubeconfig struct {
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterGatewayKubeconfigOptions struct {
+	metav1.TypeMeta
+
+	// AuthInfo is the name of the user in the kubeconfig of the caller
+	// authenticating to the hub cluster, which the context of the generated
+	// kubeconfig refers to.
+	// +optional
+	AuthInfo string `json:"authInfo,omitempty"`
+}
+
+func (c *ClusterGatewayKubeconfig) SubResourceName() string {
+	return "kubeconfig"
+}
+
+func (c *ClusterGatewayKubeconfig) New() runtime.Object {
+	return &ClusterGatewayKubeconfigOptions{}
+}
+
+func (c *ClusterGatewayKubeconfig) Destroy() {}
+
+func (c *ClusterGatewayKubeconfig) Connect(ctx context.Context, id string, options runtime.Object, r registryrest.Responder) (http.Handler, error) {
+	kubeconfigOpts, ok := options.(*ClusterGatewayKubeconfigOptions)
+	if !ok {
+		return nil, fmt.Errorf("invalid options object: %#v", options)
+	}
+	parentStorage, ok := contextutil.GetParentStorageGetter(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no parent storage found")
+	}
+	if _, err := parentStorage.Get(ctx, id, &metav1.GetOptions{}); err != nil {
+		return nil, fmt.Errorf("no such cluster %v", id)
+	}
+	kubeconfig, err := newClusterGatewayKubeconfig(id, kubeconfigOpts.AuthInfo)
+	if err != nil {
+		return nil, err
+	}
+	data, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed encoding kubeconfig of cluster %s", id)
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/yaml")
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(data)
+	}), nil
+}
+
+func (c *ClusterGatewayKubeconfig) NewConnectOptions() (runtime.Object, bool, string) {
+	return &ClusterGatewayKubeconfigOptions{}, false, ""
+}
+
+func (c *ClusterGatewayKubeconfig) ConnectMethods() []string {
+	return []string{"GET"}
+}
+
+var _ resource.QueryParameterObject = &ClusterGatewayKubeconfigOptions{}
+
+func (in *ClusterGatewayKubeconfigOptions) ConvertFromUrlValues(values *url.Values) error {
+	in.AuthInfo = values.Get("authInfo")
+	return nil
+}
+
+// newClusterGatewayKubeconfig returns the kubeconfig whose server is the
+// proxy subresource of the cluster on the hub kube-apiserver.
+func newClusterGatewayKubeconfig(name, authInfo string) (*clientcmdapi.Config, error) {
+	hub := &clientcmdapi.Cluster{
+		Server: config.KubeconfigServer,
+	}
+	if loopback := singleton.GetLoopbackConfig(); loopback != nil && len(hub.Server) == 0 {
+		hub.Server = loopback.Host
+		hub.TLSServerName = loopback.ServerName
+	}
+	if len(hub.Server) == 0 {
+		return nil, fmt.Errorf("the address of the hub cluster is unknown")
+	}
+	caData, err := kubeconfigCertificateAuthority()
+	if err != nil {
+		return nil, err
+	}
+	hub.CertificateAuthorityData = caData
+	hub.Server = strings.TrimSuffix(hub.Server, "/") + apiPrefix + name + apiSuffix
+
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[name] = hub
+	kubeconfig.Contexts[name] = &clientcmdapi.Context{
+		Cluster:  name,
+		AuthInfo: authInfo,
+	}
+	kubeconfig.CurrentContext = name
+	return kubeconfig, nil
+}
+
+func kubeconfigCertificateAuthority() ([]byte, error) {
+	if len(config.KubeconfigCertificateAuthority) > 0 {
+		caData, err := os.ReadFile(config.KubeconfigCertificateAuthority)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed reading the CA of the hub cluster")
+		}
+		return caData, nil
+	}
+	loopback := singleton.GetLoopbackConfig()
+	if loopback == nil {
+		return nil, nil
+	}
+	if len(loopback.CAData) > 0 {
+		return loopback.CAData, nil
+	}
+	if len(loopback.CAFile) > 0 {
+		caData, err := os.ReadFile(loopback.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed reading the CA of the hub cluster")
+		}
+		return caData, nil
+	}
+	return nil, nil
+}
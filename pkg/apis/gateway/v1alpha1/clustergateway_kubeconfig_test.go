@@ -0,0 +1,82 @@
+package v1alpha1
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgorest "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+func TestClusterGatewayKubeconfig(t *testing.T) {
+	gw := &ClusterGateway{ObjectMeta: metav1.ObjectMeta{Name: "cluster-a"}}
+	singleton.SetLoopbackConfig(&clientgorest.Config{
+		Host: "https://10.0.0.1:443",
+		TLSClientConfig: clientgorest.TLSClientConfig{
+			CAData:     []byte("hub-ca"),
+			ServerName: "kubernetes.default",
+		},
+	})
+	defer singleton.SetLoopbackConfig(nil)
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+
+	getKubeconfig := func(t *testing.T, options *ClusterGatewayKubeconfigOptions) []byte {
+		handler, err := (&ClusterGatewayKubeconfig{}).Connect(ctx, "cluster-a", options, nil)
+		require.NoError(t, err)
+		svr := httptest.NewServer(handler)
+		defer svr.Close()
+		resp, err := svr.Client().Get(svr.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return data
+	}
+
+	kubeconfig, err := clientcmd.Load(getKubeconfig(t, &ClusterGatewayKubeconfigOptions{AuthInfo: "hub-admin"}))
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-a", kubeconfig.CurrentContext)
+	require.Contains(t, kubeconfig.Clusters, "cluster-a")
+	assert.Equal(t, "https://10.0.0.1:443/apis/gateway.open-cluster-management.io/v1alpha1/clustergateways/cluster-a/proxy",
+		kubeconfig.Clusters["cluster-a"].Server)
+	assert.Equal(t, []byte("hub-ca"), kubeconfig.Clusters["cluster-a"].CertificateAuthorityData)
+	assert.Equal(t, "kubernetes.default", kubeconfig.Clusters["cluster-a"].TLSServerName)
+	require.Contains(t, kubeconfig.Contexts, "cluster-a")
+	assert.Equal(t, "cluster-a", kubeconfig.Contexts["cluster-a"].Cluster)
+	assert.Equal(t, "hub-admin", kubeconfig.Contexts["cluster-a"].AuthInfo)
+	assert.Empty(t, kubeconfig.AuthInfos)
+
+	// the address and the CA of the hub reachable by the users
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("public-ca"), 0600))
+	server, ca := config.KubeconfigServer, config.KubeconfigCertificateAuthority
+	config.KubeconfigServer, config.KubeconfigCertificateAuthority = "https://hub.example.com:6443/", caFile
+	defer func() { config.KubeconfigServer, config.KubeconfigCertificateAuthority = server, ca }()
+	kubeconfig, err = clientcmd.Load(getKubeconfig(t, &ClusterGatewayKubeconfigOptions{}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://hub.example.com:6443/apis/gateway.open-cluster-management.io/v1alpha1/clustergateways/cluster-a/proxy",
+		kubeconfig.Clusters["cluster-a"].Server)
+	assert.Equal(t, []byte("public-ca"), kubeconfig.Clusters["cluster-a"].CertificateAuthorityData)
+	assert.Empty(t, kubeconfig.Clusters["cluster-a"].TLSServerName)
+	assert.Empty(t, kubeconfig.Contexts["cluster-a"].AuthInfo)
+
+	ctx = contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{err: apierrors.NewNotFound(schema.GroupResource{}, "")})
+	_, err = (&ClusterGatewayKubeconfig{}).Connect(ctx, "cluster-b", &ClusterGatewayKubeconfigOptions{}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package v1alpha1
+
+import (
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+// The local cluster is the built-in ClusterGateway of the hub cluster, so
+// that the hub is addressed like any other cluster without a ManagedCluster
+// and a credential secret. It is requested via the client config of the
+// gateway, upon which the same impersonation rules are applied.
+
+// isLocalCluster tells whether the name is the built-in ClusterGateway of the
+// hub cluster.
+func isLocalCluster(name string) bool {
+	return len(config.LocalClusterName) > 0 && name == config.LocalClusterName
+}
+
+// newLocalClusterGateway returns the built-in ClusterGateway of the hub
+// cluster, which is always healthy as long as the gateway serves.
+func newLocalClusterGateway() *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: config.LocalClusterName,
+		},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeLoopback,
+				},
+			},
+		},
+		Status: ClusterGatewayStatus{
+			Healthy: true,
+		},
+	}
+}
+
+// newLocalClusterForbiddenError rejects writing the built-in ClusterGateway.
+func newLocalClusterForbiddenError(name string) error {
+	return apierrors.NewForbidden(clusterGatewayGroupResource(), name,
+		errors.New("the local cluster is built in the gateway and can not be written"))
+}
+
+// newLoopbackConfig returns a copy of the client config of the gateway.
+func newLoopbackConfig() (*restclient.Config, error) {
+	cfg := singleton.GetLoopbackConfig()
+	if cfg == nil {
+		return nil, errors.New("the client config of the gateway is not initialized yet")
+	}
+	return restclient.CopyConfig(cfg), nil
+}
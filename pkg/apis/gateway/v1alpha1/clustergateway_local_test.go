@@ -0,0 +1,138 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/util/feature"
+	clientgorest "k8s.io/client-go/rest"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/kluster-manager/cluster-auth/apis/authentication/v1alpha1"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+func setLocalClusterNameDuringTest(t *testing.T, name string) {
+	original := config.LocalClusterName
+	config.LocalClusterName = name
+	t.Cleanup(func() { config.LocalClusterName = original })
+}
+
+func TestLocalClusterGateway(t *testing.T) {
+	setLocalClusterNameDuringTest(t, "local-cluster")
+	ctx := context.TODO()
+	newWriteTestClient(t,
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", tokenLabels, tokenData),
+		// the local cluster shadows the ManagedCluster of the same name
+		managedCluster("local-cluster", testEndpoint, []byte(testCAData)),
+		gatewayAddon("local-cluster", nil),
+		credentialSecret("local-cluster", tokenLabels, tokenData),
+	)
+	storage := &ClusterGateway{}
+
+	out, err := storage.Get(ctx, "local-cluster", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, newLocalClusterGateway(), out)
+
+	out, err = storage.List(ctx, &internalversion.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, gw := range out.(*ClusterGatewayList).Items {
+		names = append(names, gw.Name)
+	}
+	assert.Equal(t, []string{"cluster-a", "local-cluster"}, names)
+
+	out, err = storage.List(ctx, &internalversion.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(FieldSelectorEndpointType, string(ClusterEndpointTypeLoopback)),
+	})
+	require.NoError(t, err)
+	require.Len(t, out.(*ClusterGatewayList).Items, 1)
+	assert.Equal(t, "local-cluster", out.(*ClusterGatewayList).Items[0].Name)
+
+	// the local cluster can not be written
+	_, err = storage.Create(ctx, constClusterGateway("local-cluster", x509Credential()), nil, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsAlreadyExists(err))
+	_, _, err = storage.Update(ctx, "local-cluster", rest.DefaultUpdatedObjectInfo(constClusterGateway("local-cluster", x509Credential())), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsForbidden(err))
+	_, _, err = storage.Delete(ctx, "local-cluster", nil, &metav1.DeleteOptions{})
+	assert.True(t, apierrors.IsForbidden(err))
+
+	// the view serves the local cluster as well
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+	view, err := newClusterGatewayWatchCache(ctx, &informertest.FakeInformers{Scheme: scheme})
+	require.NoError(t, err)
+	gw, err := view.get("local-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, ClusterEndpointTypeLoopback, gw.Spec.Access.Endpoint.Type)
+	assert.NotEmpty(t, gw.ResourceVersion)
+}
+
+func TestProxyHandlerLocalCluster(t *testing.T) {
+	setLocalClusterNameDuringTest(t, "local-cluster")
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	scheme := runtime.NewScheme()
+	require.NoError(t, authv1alpha1.AddToScheme(scheme))
+	singleton.SetClient(ctrlfake.NewClientBuilder().WithScheme(scheme).Build())
+	global := GlobalClusterGatewayProxyConfiguration
+	GlobalClusterGatewayProxyConfiguration = &ClusterGatewayProxyConfiguration{}
+	defer func() { GlobalClusterGatewayProxyConfiguration = global }()
+
+	var receivingReq *http.Request
+	hubSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivingReq = req
+		resp.Write([]byte("ok"))
+	}))
+	defer hubSvr.Close()
+	singleton.SetLoopbackConfig(&clientgorest.Config{
+		Host:            hubSvr.URL,
+		BearerToken:     "gateway-token",
+		TLSClientConfig: clientgorest.TLSClientConfig{Insecure: true},
+	})
+	defer singleton.SetLoopbackConfig(nil)
+
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: newLocalClusterGateway()})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	// the local cluster is requested as the caller regardless of the option
+	for _, impersonate := range []bool{true, false} {
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "local-cluster", &ClusterGatewayProxyOptions{Path: "/api/v1/namespaces", Impersonate: impersonate}, nil)
+		require.NoError(t, err)
+		svr := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "alice"}))
+			handler.ServeHTTP(resp, req)
+		}))
+
+		resp, err := svr.Client().Get(svr.URL + apiPrefix + "local-cluster" + apiSuffix + "/api/v1/namespaces")
+		require.NoError(t, err)
+		resp.Body.Close()
+		svr.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "/api/v1/namespaces", receivingReq.URL.Path)
+		assert.Equal(t, "Bearer gateway-token", receivingReq.Header.Get("Authorization"))
+		assert.Equal(t, "alice", receivingReq.Header.Get("Impersonate-User"), "impersonate option %v", impersonate)
+	}
+}
@@ -0,0 +1,97 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metainternalversionvalidation "k8s.io/apimachinery/pkg/apis/meta/internalversion/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+// continueKeyPrefix is the virtual storage prefix of ClusterGateway encoded
+// into the continue tokens.
+const continueKeyPrefix = "/clustergateways/"
+
+// clusterGatewayListPage is the page of a list request decoded from its
+// continue token.
+type clusterGatewayListPage struct {
+	// startName is the inclusive lower bound of the names in the page.
+	startName string
+	// resourceVersion is the resourceVersion of the first page which is
+	// preserved across the subsequent pages, which expire once the
+	// ClusterGateways move past it.
+	resourceVersion uint64
+}
+
+// validateClusterGatewayListOptions checks the list options following the
+// conventions of kube-apiserver and decodes the continue token if any.
+func validateClusterGatewayListOptions(opt *internalversion.ListOptions) (*clusterGatewayListPage, error) {
+	if errs := metainternalversionvalidation.ValidateListOptions(opt, false); len(errs) > 0 {
+		return nil, apierrors.NewInvalid(schema.GroupKind{Group: metav1.GroupName, Kind: "ListOptions"}, "", errs)
+	}
+	if opt.Limit < 0 {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid limit %d", opt.Limit))
+	}
+	if len(opt.ResourceVersion) > 0 {
+		if _, err := strconv.ParseUint(opt.ResourceVersion, 10, 64); err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", opt.ResourceVersion))
+		}
+	}
+	if len(opt.Continue) == 0 {
+		return &clusterGatewayListPage{}, nil
+	}
+	if len(opt.ResourceVersion) > 0 && opt.ResourceVersion != "0" {
+		return nil, apierrors.NewBadRequest("specifying resource version is not allowed when using continue")
+	}
+	fromKey, rv, err := storage.DecodeContinue(opt.Continue, continueKeyPrefix)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+	}
+	return &clusterGatewayListPage{
+		startName:       strings.TrimPrefix(fromKey, continueKeyPrefix),
+		resourceVersion: uint64(rv),
+	}, nil
+}
+
+// encodeClusterGatewayContinue builds the continue token for the page next to
+// the given ClusterGateway.
+func encodeClusterGatewayContinue(lastName string, resourceVersion uint64) (string, error) {
+	// the zero byte makes the next page start right after the last name
+	return storage.EncodeContinue(continueKeyPrefix+lastName+"\x00", continueKeyPrefix, int64(resourceVersion))
+}
+
+// checkContinueResourceVersion verifies the page decoded from the continue
+// token against the current resourceVersion of ClusterGateway. The pages are
+// served from the most recent state rather than a snapshot, so the pages are
+// only consistent with the first one until anything changes, after which
+// the list must be restarted as kube-apiserver does upon compaction.
+func checkContinueResourceVersion(page *clusterGatewayListPage, current uint64) error {
+	if page.resourceVersion == 0 || current <= page.resourceVersion {
+		return nil
+	}
+	return apierrors.NewResourceExpired(fmt.Sprintf("The provided continue parameter is too old to display a consistent list result (%d < %d). "+
+		"You can start a new list without the continue parameter.", page.resourceVersion, current))
+}
+
+// checkListResourceVersion verifies the resourceVersion of a list request
+// against the current resourceVersion of ClusterGateway. Listing is always
+// served from the most recent state, so an "Exact" match is only fulfilled
+// when nothing changed since the requested resourceVersion.
+func checkListResourceVersion(opt *internalversion.ListOptions, current uint64) error {
+	if len(opt.ResourceVersion) == 0 || opt.ResourceVersion == "0" {
+		return nil
+	}
+	rv := parseResourceVersion(opt.ResourceVersion)
+	if rv > current {
+		return storage.NewTooLargeResourceVersionError(rv, current, 1)
+	}
+	if opt.ResourceVersionMatch == metav1.ResourceVersionMatchExact && rv < current {
+		return apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", rv, current))
+	}
+	return nil
+}
@@ -48,7 +48,6 @@ import (
 	"k8s.io/apiserver/pkg/endpoints/request"
 	registryrest "k8s.io/apiserver/pkg/registry/rest"
 	restclient "k8s.io/client-go/rest"
-	"k8s.io/client-go/transport"
 	kmapi "kmodules.xyz/client-go/api/v1"
 	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
 	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource/resourcerest"
@@ -85,6 +84,13 @@ type ClusterGatewayProxyOptions struct {
 	// the target cluster for the impersonated users (i.e. the end-
 	// user using the proxy subresource.).
 	Impersonate bool `json:"impersonate"`
+
+	// Credential is the name of the credential profile of the cluster
+	// proxying the request instead of the default credential. Using a
+	// profile requires the verb "credential:<profile>" upon the proxy
+	// subresource of the cluster on the hub.
+	// +optional
+	Credential string `json:"credential,omitempty"`
 }
 
 func (c *ClusterGatewayProxy) SubResourceName() string {
@@ -160,12 +166,21 @@ func (c *ClusterGatewayProxy) Connect(ctx context.Context, id string, options ru
 		}
 	}
 
+	var credential *ClusterAccessCredential
+	if len(proxyOpts.Credential) > 0 {
+		if credential, err = getCredentialProfile(ctx, clusterGateway, proxyOpts.Credential); err != nil {
+			return nil, err
+		}
+	}
+
 	return &proxyHandler{
-		parentName:     id,
-		path:           proxyOpts.Path,
-		impersonate:    proxyOpts.Impersonate,
-		clusterGateway: clusterGateway,
-		responder:      r,
+		parentName:        id,
+		path:              proxyOpts.Path,
+		impersonate:       proxyOpts.Impersonate,
+		clusterGateway:    clusterGateway,
+		credential:        credential,
+		credentialProfile: proxyOpts.Credential,
+		responder:         r,
 		finishFunc: func(code int) {
 			metrics.RecordProxiedRequestsByResource(proxyReqInfo.Resource, proxyReqInfo.Verb, code)
 			metrics.RecordProxiedRequestsByCluster(id, code)
@@ -187,6 +202,7 @@ var _ resource.QueryParameterObject = &ClusterGatewayProxyOptions{}
 func (in *ClusterGatewayProxyOptions) ConvertFromUrlValues(values *url.Values) error {
 	in.Path = values.Get("path")
 	in.Impersonate = values.Get("impersonate") == "true"
+	in.Credential = values.Get("credential")
 	return nil
 }
 
@@ -194,12 +210,14 @@ var _ http.Handler = &proxyHandler{}
 
 // +k8s:openapi-gen=false
 type proxyHandler struct {
-	parentName     string
-	path           string
-	impersonate    bool
-	clusterGateway *ClusterGateway
-	responder      registryrest.Responder
-	finishFunc     func(code int)
+	parentName        string
+	path              string
+	impersonate       bool
+	clusterGateway    *ClusterGateway
+	credential        *ClusterAccessCredential
+	credentialProfile string
+	responder         registryrest.Responder
+	finishFunc        func(code int)
 }
 
 var (
@@ -232,21 +250,71 @@ func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Requ
 		p.finishFunc(writer.statusCode)
 	}()
 	cluster := p.clusterGateway
-	if cluster.Spec.Access.Credential == nil {
-		responsewriters.InternalError(writer, request, fmt.Errorf("proxying cluster %s not support due to lacking credentials", cluster.Name))
+	// the local cluster is authenticated by the client config of the gateway
+	if cluster.Spec.Access.Credential == nil && cluster.Spec.Access.Endpoint.Type != ClusterEndpointTypeLoopback {
+		writeEndpointError(writer, fmt.Errorf("proxying cluster %s not support due to lacking credentials", cluster.Name), HealthyReasonTypeCredentialMissing)
 		return
 	}
 
+	if p.credential != nil {
+		cluster = clusterGatewayWithCredential(cluster, p.credential)
+	}
+
+	if key, ok := p.discoveryDocumentKeyOf(request, cluster); ok {
+		p.serveDiscoveryDocument(writer, request, cluster, key)
+		return
+	}
+	p.serveCluster(writer, request, cluster)
+	if isDiscoveryChangingRequest(p.path, request.Method) {
+		discoveryDocuments.settle(cluster.Name)
+	}
+}
+
+// serveCluster proxies the request to the endpoints of the cluster, failing
+// over to the next endpoint if any.
+func (p *proxyHandler) serveCluster(writer *proxyResponseWriter, request *http.Request, cluster *ClusterGateway) {
+	candidates := clusterGatewayEndpointCandidates(cluster)
+	body := newFailoverBody(request.Body)
+	defer body.release()
+	for i, candidate := range candidates {
+		last := i == len(candidates)-1
+		body.rewind()
+		if last {
+			body.release()
+		}
+		retry, endpointErr := p.serveEndpoint(writer, request, candidate, body, !last)
+		if len(candidates) == 1 {
+			return
+		}
+		address := endpointCandidateAddress(candidate)
+		if endpointErr == nil {
+			preferredEndpoints.record(cluster.Name, candidate)
+			return
+		}
+		if !retry {
+			return
+		}
+		klog.Warningf("Failing over the proxied request of cluster %s from endpoint %s: %v", cluster.Name, address, endpointErr)
+	}
+}
+
+// serveEndpoint proxies the request to the endpoint of the given cluster. It
+// returns the error if the endpoint is not reachable, along with whether the
+// error is withheld from the client for retrying the next endpoint.
+func (p *proxyHandler) serveEndpoint(writer *proxyResponseWriter, request *http.Request, cluster *ClusterGateway, body *failoverBody, canFailover bool) (bool, error) {
 	// Go 1.19 removes the URL clone in WithContext method and therefore change
 	// to deep copy here
 	newReq := request.Clone(request.Context())
 	newReq.Header = utilnet.CloneHeader(request.Header)
 	newReq.URL.Path = p.path
+	if body != nil {
+		newReq.Body = body
+	}
 
 	urlAddr, err := GetEndpointURL(cluster)
 	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed parsing endpoint for cluster %s", cluster.Name))
-		return
+		writeEndpointError(writer, errors.Wrapf(err, "failed parsing endpoint for cluster %s", cluster.Name), HealthyReasonTypeEndpointUnresolvable)
+		return false, nil
 	}
 	host, _, _ := net.SplitHostPort(urlAddr.Host)
 	path := strings.TrimPrefix(request.URL.Path, apiPrefix+p.parentName+apiSuffix)
@@ -255,19 +323,10 @@ func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Requ
 	newReq.URL.RawQuery = unescapeQueryValues(request.URL.Query()).Encode()
 	newReq.RequestURI = newReq.URL.RequestURI()
 
-	cfg, err := NewConfigFromCluster(request.Context(), cluster)
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating cluster proxy client config %s", cluster.Name))
-		return
-	}
-	if p.impersonate || utilfeature.DefaultFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
-		cfg.Impersonate = p.getImpersonationConfig(request)
-	}
-
-	rt, err := restclient.TransportFor(cfg)
+	t, err := proxyTransports.get(request.Context(), p.clusterGateway, cluster, p.credentialProfile, p.impersonationOf(request, cluster))
 	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating cluster proxy client %s", cluster.Name))
-		return
+		responsewriters.InternalError(writer, request, err)
+		return false, nil
 	}
 	proxy := apiproxy.NewUpgradeAwareHandler(
 		&url.URL{
@@ -276,43 +335,37 @@ func (p *proxyHandler) ServeHTTP(_writer http.ResponseWriter, request *http.Requ
 			Host:     urlAddr.Host,
 			RawQuery: request.URL.RawQuery,
 		},
-		rt,
+		t.transport,
 		false,
 		false,
 		nil)
 
 	const defaultFlushInterval = 200 * time.Millisecond
-	transportCfg, err := cfg.TransportConfig()
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating transport config %s", cluster.Name))
-		return
-	}
-	tlsConfig, err := transport.TLSConfigFor(transportCfg)
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating tls config %s", cluster.Name))
-		return
-	}
-	upgrader, err := transport.HTTPWrappersForConfig(transportCfg, apiproxy.MirrorRequest)
-	if err != nil {
-		responsewriters.InternalError(writer, request, errors.Wrapf(err, "failed creating upgrader client %s", cluster.Name))
-		return
-	}
-	upgrading := utilnet.SetOldTransportDefaults(&http.Transport{
-		TLSClientConfig: tlsConfig,
-		DialContext:     cfg.Dial,
-	})
-	proxy.UpgradeTransport = apiproxy.NewUpgradeRequestRoundTripper(
-		upgrading,
-		RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
-			newReq := utilnet.CloneRequest(req)
-			return upgrader.RoundTrip(newReq)
-		}))
-	proxy.Transport = rt
+	proxy.UpgradeTransport = t.upgradeTransport
+	proxy.Transport = t.transport
 	proxy.FlushInterval = defaultFlushInterval
+	var endpointErr error
+	var retry bool
 	proxy.Responder = ErrorResponderFunc(func(w http.ResponseWriter, req *http.Request, err error) {
-		p.responder.Error(err)
+		if isEndpointFailoverError(err) {
+			endpointErr = err
+			if canFailover && body.replayable() {
+				retry = true
+				return
+			}
+		}
+		p.responder.Error(newEndpointStatusError(err, ""))
 	})
 	proxy.ServeHTTP(writer, newReq)
+	return retry, endpointErr
+}
+
+// writeEndpointError serves the failure reaching the cluster as the status
+// carrying the reason of the failure, see HealthyReasonOfError.
+func writeEndpointError(writer http.ResponseWriter, err error, reason HealthyReasonType) {
+	status := newEndpointStatusError(err, reason).ErrStatus
+	status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	responsewriters.WriteRawJSON(int(status.Code), status, writer)
 }
 
 type noSuppressPanicError struct{}
@@ -343,6 +396,20 @@ func (e ErrorResponderFunc) Error(w http.ResponseWriter, req *http.Request, err
 	e(w, req, err)
 }
 
+// impersonationOf returns the identity impersonated upon the cluster if any.
+// The downstream ClusterGateway and the local cluster are always requested as
+// the original user so that the user is authorized instead of the gateway,
+// whose own identity is never lent to the callers.
+func (p *proxyHandler) impersonationOf(request *http.Request, cluster *ClusterGateway) *restclient.ImpersonationConfig {
+	if p.impersonate || utilfeature.DefaultFeatureGate.Enabled(featuregates.ClientIdentityPenetration) ||
+		cluster.Spec.Access.Endpoint.Type == ClusterEndpointTypeClusterGateway ||
+		cluster.Spec.Access.Endpoint.Type == ClusterEndpointTypeLoopback {
+		cfg := p.getImpersonationConfig(request)
+		return &cfg
+	}
+	return nil
+}
+
 func (p *proxyHandler) getImpersonationConfig(req *http.Request) restclient.ImpersonationConfig {
 	user, _ := request.UserFrom(req.Context())
 	if p.clusterGateway.Spec.ProxyConfig != nil {
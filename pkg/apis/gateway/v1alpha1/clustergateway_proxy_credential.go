@@ -0,0 +1,84 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+// getCredentialProfile returns the named credential profile of the cluster
+// once the user is authorized to use it. A credential profile is stored in
+// the secret "cluster-gateway-profile-<profile>" of the cluster namespace in
+// the same layout as the secret of the ClusterGateway, which is labeled by the
+// profile name so as to be held by the cache of the credential profiles.
+func getCredentialProfile(ctx context.Context, cluster *ClusterGateway, profile string) (*ClusterAccessCredential, error) {
+	if errs := validation.IsDNS1123Label(profile); len(errs) > 0 {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid credential profile %q: %s", profile, strings.Join(errs, ", ")))
+	}
+	if cluster.Spec.Access.Endpoint != nil && cluster.Spec.Access.Endpoint.Type == ClusterEndpointTypeLoopback {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("credential profiles are not supported by the local cluster %s", cluster.Name))
+	}
+	if err := authorizeCredentialProfile(ctx, cluster.Name, profile); err != nil {
+		return nil, err
+	}
+	var secret v1.Secret
+	name := common.SecretNamePrefixCredentialProfile + profile
+	err := singleton.GetCredentialProfileReader().Get(ctx, types.NamespacedName{Namespace: cluster.Name, Name: name}, &secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil || secret.Labels[common.LabelKeyCredentialProfile] != profile {
+		return nil, apierrors.NewNotFound(clusterGatewayGroupResource(), cluster.Name+"/"+profile)
+	}
+	return convertClusterAccessCredential(&secret)
+}
+
+// authorizeCredentialProfile authorizes the user upon the verb of the
+// credential profile, e.g. "credential:readonly", over the proxy subresource
+// of the cluster.
+func authorizeCredentialProfile(ctx context.Context, cluster, profile string) error {
+	user, _ := request.UserFrom(ctx)
+	attr := authorizer.AttributesRecord{
+		User:            user,
+		APIGroup:        config.MetaApiGroupName,
+		APIVersion:      config.MetaApiVersionName,
+		Resource:        config.MetaApiResourceName,
+		Subresource:     "proxy",
+		Name:            cluster,
+		Verb:            common.VerbPrefixCredentialProfile + profile,
+		ResourceRequest: true,
+	}
+	decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("authorizing credential profile %s failed: %v", profile, err))
+	}
+	if decision != authorizer.DecisionAllow {
+		name := ""
+		if user != nil {
+			name = user.GetName()
+		}
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), cluster,
+			fmt.Errorf("user %q may not use credential profile %s: %s", name, profile, reason))
+	}
+	return nil
+}
+
+// clusterGatewayWithCredential returns a copy of the cluster authenticated by
+// the given credential.
+func clusterGatewayWithCredential(c *ClusterGateway, credential *ClusterAccessCredential) *ClusterGateway {
+	out := *c
+	out.Spec.Access.Credential = credential
+	return &out
+}
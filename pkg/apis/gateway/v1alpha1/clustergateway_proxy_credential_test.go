@@ -0,0 +1,144 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+func credentialProfileSecret(namespace, profile, token string) *corev1.Secret {
+	secret := credentialSecret(namespace, map[string]string{
+		common.LabelKeyClusterCredentialType: string(CredentialTypeServiceAccountToken),
+		common.LabelKeyCredentialProfile:     profile,
+	}, map[string][]byte{
+		corev1.ServiceAccountTokenKey: []byte(token),
+	})
+	secret.Name = common.SecretNamePrefixCredentialProfile + profile
+	return secret
+}
+
+func TestProxyHandlerCredentialProfile(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	unlabeled := credentialProfileSecret("cluster-a", "unlabeled", "unlabeled-token")
+	delete(unlabeled.Labels, common.LabelKeyCredentialProfile)
+	fakeClient := newWriteTestClient(t,
+		credentialProfileSecret("cluster-a", "readonly", "readonly-token"),
+		credentialProfileSecret("cluster-a", "ci", "ci-token"),
+		credentialProfileSecret("cluster-a", "admin", "admin-token"),
+		unlabeled,
+	)
+	// the cache holds the secrets of the ClusterGateways only
+	singleton.SetClient(ctrlfake.NewClientBuilder().Build())
+	singleton.SetCredentialProfileReader(fakeClient)
+	defer singleton.SetCredentialProfileReader(nil)
+	original := loopback.GetAuthorizer()
+	defer loopback.SetAuthorizer(original)
+	var attrs []authorizer.Attributes
+	loopback.SetAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		attrs = append(attrs, a)
+		if a.GetUser().GetName() == "alice" && (a.GetVerb() == "credential:readonly" || a.GetVerb() == "credential:ci" || a.GetVerb() == "credential:missing" || a.GetVerb() == "credential:unlabeled") {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}))
+
+	var receivingReq *http.Request
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivingReq = req
+		resp.Write([]byte("ok"))
+	}))
+	defer endpointSvr.Close()
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-a"},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "default-token",
+				},
+			},
+		},
+	}
+	proxyTransports.invalidate("cluster-a", nil)
+	defer proxyTransports.invalidate("cluster-a", nil)
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	ctx = request.WithUser(ctx, &user.DefaultInfo{Name: "alice"})
+
+	proxyWith := func(t *testing.T, profile string) string {
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/api", Credential: profile}, nil)
+		require.NoError(t, err)
+		svr := httptest.NewServer(handler)
+		defer svr.Close()
+		resp, err := svr.Client().Get(svr.URL + apiPrefix + "cluster-a" + apiSuffix + "/api")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return receivingReq.Header.Get("Authorization")
+	}
+
+	assert.Equal(t, "Bearer default-token", proxyWith(t, ""))
+	assert.Empty(t, attrs)
+	assert.Equal(t, "Bearer readonly-token", proxyWith(t, "readonly"))
+	require.Len(t, attrs, 1)
+	assert.Equal(t, authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "alice"},
+		Verb:            "credential:readonly",
+		APIGroup:        config.MetaApiGroupName,
+		APIVersion:      config.MetaApiVersionName,
+		Resource:        config.MetaApiResourceName,
+		Subresource:     "proxy",
+		Name:            "cluster-a",
+		ResourceRequest: true,
+	}, attrs[0])
+	// switching back and forth among the profiles reuses the transports
+	assert.Equal(t, "Bearer default-token", proxyWith(t, ""))
+	assert.Equal(t, "Bearer readonly-token", proxyWith(t, "readonly"))
+	assert.Equal(t, 2, proxyTransports.clusters["cluster-a"].transports.Len())
+	// the profiles of the same credential type never share the transports
+	assert.Equal(t, "Bearer ci-token", proxyWith(t, "ci"))
+	assert.Equal(t, "Bearer readonly-token", proxyWith(t, "readonly"))
+	assert.Equal(t, 3, proxyTransports.clusters["cluster-a"].transports.Len())
+	// the rotated profile is taken effect
+	rotated := credentialProfileSecret("cluster-a", "ci", "rotated-ci-token")
+	require.NoError(t, fakeClient.Update(context.TODO(), rotated))
+	assert.Equal(t, "Bearer rotated-ci-token", proxyWith(t, "ci"))
+
+	_, err := (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/api", Credential: "admin"}, nil)
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+	_, err = (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/api", Credential: "missing"}, nil)
+	assert.True(t, apierrors.IsNotFound(err), "unexpected error: %v", err)
+	// the profile not labeled as such is never used
+	_, err = (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/api", Credential: "unlabeled"}, nil)
+	assert.True(t, apierrors.IsNotFound(err), "unexpected error: %v", err)
+	_, err = (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/api", Credential: "Read_Only"}, nil)
+	assert.True(t, apierrors.IsBadRequest(err), "unexpected error: %v", err)
+}
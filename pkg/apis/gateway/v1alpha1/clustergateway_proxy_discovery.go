@@ -0,0 +1,416 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+const (
+	// maxDiscoveryDocumentSize is the size of the largest document cached.
+	maxDiscoveryDocumentSize = 32 << 20
+	// discoveryDocumentRefreshTimeout bounds refreshing a document in the
+	// background.
+	discoveryDocumentRefreshTimeout = time.Minute
+	// discoveryDocumentSettlingPeriod is how long the documents of a cluster
+	// are not cached after writing its CRDs or APIServices, which covers the
+	// CRDs being established and the APIServices being available.
+	discoveryDocumentSettlingPeriod = time.Minute
+	// discoveryRootDocumentRefreshInterval caps the refresh interval of the
+	// root documents "/api" and "/apis" listing the groups, so that the CRDs
+	// and the APIServices written directly to the clusters are discovered
+	// shortly.
+	discoveryRootDocumentRefreshInterval = 30 * time.Second
+)
+
+// discoveryDocuments keeps the discovery and the OpenAPI documents of the
+// clusters, so that the clients requesting them through the proxy subresource
+// are answered without requesting the clusters. The documents older than
+// the refresh interval are served while being refreshed in the background,
+// and the documents older than twice the interval are fetched again, which
+// bounds the staleness upon the CRDs or the APIServices written directly to
+// the clusters, further bounded for the root documents listing the groups.
+// Only the CRDs or the APIServices written through the gateway drop the
+// documents of the cluster, which are then not cached for a settling period. The documents of all the clusters are bounded by the
+// max size, beyond which the least recently used ones are evicted.
+var discoveryDocuments = newDiscoveryDocumentCache()
+
+type discoveryDocumentCache struct {
+	lock     sync.Mutex
+	clusters map[string]*clusterDiscoveryDocuments
+	// recent orders the documents of all the clusters from the most recently
+	// used to the least.
+	recent *list.List
+	size   int64
+}
+
+type clusterDiscoveryDocuments struct {
+	documents map[discoveryDocumentKey]*list.Element
+	// settlingUntil is the time until which no document is cached.
+	settlingUntil time.Time
+}
+
+type discoveryDocumentEntry struct {
+	cluster  *clusterDiscoveryDocuments
+	key      discoveryDocumentKey
+	document *discoveryDocument
+	size     int64
+}
+
+func newDiscoveryDocumentCache() *discoveryDocumentCache {
+	return &discoveryDocumentCache{
+		clusters: make(map[string]*clusterDiscoveryDocuments),
+		recent:   list.New(),
+	}
+}
+
+// discoveryDocumentKey tells the documents of a cluster apart, including the
+// representations negotiated by the headers, e.g. the aggregated discovery,
+// and the identities requesting the cluster which may be served differently.
+type discoveryDocumentKey struct {
+	path           string
+	query          string
+	accept         string
+	acceptEncoding string
+	// credential is the credential profile requesting the cluster if any.
+	credential string
+	// impersonation is the digest of the impersonated identity if any.
+	impersonation string
+}
+
+type discoveryDocument struct {
+	header     http.Header
+	body       []byte
+	etag       string
+	fetched    time.Time
+	refreshing bool
+}
+
+// isDiscoveryDocumentPath tells whether the path requests a discovery or an
+// OpenAPI document, e.g. "/api", "/apis/apps/v1" and "/openapi/v3/apis/apps/v1".
+func isDiscoveryDocumentPath(path string) bool {
+	switch path {
+	case "/api", "/apis", "/openapi/v2", "/openapi/v3":
+		return true
+	}
+	if strings.HasPrefix(path, "/openapi/v3/") {
+		return true
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch segments[0] {
+	case "api":
+		// the versions of the core group, e.g. "/api/v1"
+		return len(segments) == 2
+	case "apis":
+		// the groups and the versions, e.g. "/apis/apps" and "/apis/apps/v1"
+		return len(segments) == 2 || len(segments) == 3
+	}
+	return false
+}
+
+// isDiscoveryChangingRequest tells whether the request writes the CRDs or the
+// APIServices which change the discovery and the OpenAPI documents.
+func isDiscoveryChangingRequest(path, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return strings.HasPrefix(path, "/apis/apiextensions.k8s.io/") ||
+		strings.HasPrefix(path, "/apis/apiregistration.k8s.io/")
+}
+
+func (p *proxyHandler) discoveryDocumentKeyOf(request *http.Request, cluster *ClusterGateway) (discoveryDocumentKey, bool) {
+	if config.DiscoveryCacheRefreshInterval <= 0 || request.Method != http.MethodGet || !isDiscoveryDocumentPath(p.path) {
+		return discoveryDocumentKey{}, false
+	}
+	key := discoveryDocumentKey{
+		path:           p.path,
+		query:          request.URL.RawQuery,
+		accept:         request.Header.Get("Accept"),
+		acceptEncoding: request.Header.Get("Accept-Encoding"),
+		credential:     p.credentialProfile,
+	}
+	if impersonation := p.impersonationOf(request, cluster); impersonation != nil {
+		data, err := json.Marshal(impersonation)
+		if err != nil {
+			return discoveryDocumentKey{}, false
+		}
+		digest := sha256.Sum256(data)
+		key.impersonation = hex.EncodeToString(digest[:])
+	}
+	return key, true
+}
+
+// documentsOf returns the documents of the cluster, which are passed back
+// when storing a document so that the documents fetched before dropping the
+// documents of the cluster are discarded.
+func (c *discoveryDocumentCache) documentsOf(cluster string) *clusterDiscoveryDocuments {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	documents, ok := c.clusters[cluster]
+	if !ok {
+		documents = &clusterDiscoveryDocuments{documents: make(map[discoveryDocumentKey]*list.Element)}
+		c.clusters[cluster] = documents
+	}
+	return documents
+}
+
+// refreshIntervalOf returns the age of the document after which it is
+// refreshed.
+func refreshIntervalOf(key discoveryDocumentKey) time.Duration {
+	if (key.path == "/api" || key.path == "/apis") && config.DiscoveryCacheRefreshInterval > discoveryRootDocumentRefreshInterval {
+		return discoveryRootDocumentRefreshInterval
+	}
+	return config.DiscoveryCacheRefreshInterval
+}
+
+// get returns the document along with whether the caller is to refresh it.
+func (c *discoveryDocumentCache) get(cluster string, key discoveryDocumentKey) (*discoveryDocument, bool, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	documents, ok := c.clusters[cluster]
+	if !ok {
+		return nil, false, false
+	}
+	element, ok := documents.documents[key]
+	if !ok {
+		return nil, false, false
+	}
+	doc := element.Value.(*discoveryDocumentEntry).document
+	age, interval := time.Since(doc.fetched), refreshIntervalOf(key)
+	if age >= 2*interval {
+		return nil, false, false
+	}
+	c.recent.MoveToFront(element)
+	refresh := !doc.refreshing && age >= interval
+	if refresh {
+		doc.refreshing = true
+	}
+	return doc, true, refresh
+}
+
+// store keeps the document recorded from the cluster. The failures keep the
+// existing document until the next refresh interval.
+func (c *discoveryDocumentCache) store(cluster string, documents *clusterDiscoveryDocuments, key discoveryDocumentKey, recorder *discoveryDocumentRecorder) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.clusters[cluster] != documents || time.Now().Before(documents.settlingUntil) {
+		return
+	}
+	existing, ok := documents.documents[key]
+	doc, recorded := recorder.document()
+	if !recorded {
+		if ok {
+			existing.Value.(*discoveryDocumentEntry).document.refreshing = false
+			existing.Value.(*discoveryDocumentEntry).document.fetched = time.Now()
+		}
+		return
+	}
+	if ok {
+		c.remove(existing)
+	}
+	entry := &discoveryDocumentEntry{
+		cluster:  documents,
+		key:      key,
+		document: doc,
+		size:     int64(len(doc.body) + len(key.path) + len(key.query) + len(key.accept) + len(key.acceptEncoding)),
+	}
+	if entry.size > config.DiscoveryCacheMaxSize {
+		return
+	}
+	documents.documents[key] = c.recent.PushFront(entry)
+	c.size += entry.size
+	for c.size > config.DiscoveryCacheMaxSize {
+		c.remove(c.recent.Back())
+	}
+}
+
+func (c *discoveryDocumentCache) remove(element *list.Element) {
+	entry := element.Value.(*discoveryDocumentEntry)
+	c.recent.Remove(element)
+	delete(entry.cluster.documents, entry.key)
+	c.size -= entry.size
+}
+
+// invalidate drops the documents of the cluster.
+func (c *discoveryDocumentCache) invalidate(cluster string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drop(cluster)
+}
+
+// settle drops the documents of the cluster and caches none of them until
+// the changes of the discovery settle, so that neither the documents being
+// fetched nor the ones fetched before the CRDs are established are cached.
+func (c *discoveryDocumentCache) settle(cluster string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drop(cluster)
+	c.clusters[cluster] = &clusterDiscoveryDocuments{
+		documents:     make(map[discoveryDocumentKey]*list.Element),
+		settlingUntil: time.Now().Add(discoveryDocumentSettlingPeriod),
+	}
+}
+
+func (c *discoveryDocumentCache) drop(cluster string) {
+	documents, ok := c.clusters[cluster]
+	if !ok {
+		return
+	}
+	for _, element := range documents.documents {
+		c.remove(element)
+	}
+	delete(c.clusters, cluster)
+}
+
+func (d *discoveryDocument) serve(writer http.ResponseWriter, request *http.Request) {
+	for k, v := range d.header {
+		writer.Header()[k] = v
+	}
+	writer.Header().Set("ETag", d.etag)
+	if etagMatches(request.Header.Get("If-None-Match"), d.etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writer.Header().Set("Content-Length", strconv.Itoa(len(d.body)))
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(d.body)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveDiscoveryDocument answers the request from the cached document, or
+// proxies the request to the cluster while recording the document.
+func (p *proxyHandler) serveDiscoveryDocument(writer *proxyResponseWriter, request *http.Request, cluster *ClusterGateway, key discoveryDocumentKey) {
+	doc, ok, refresh := discoveryDocuments.get(cluster.Name, key)
+	if ok {
+		if refresh {
+			// the request is cloned before it is returned to the server
+			refreshing := request.Clone(context.WithoutCancel(request.Context()))
+			refreshing.Body = http.NoBody
+			refreshing.Header.Del("If-None-Match")
+			go p.refreshDiscoveryDocument(refreshing, cluster, key)
+		}
+		doc.serve(writer, request)
+		return
+	}
+	documents := discoveryDocuments.documentsOf(cluster.Name)
+	recorder := &discoveryDocumentRecorder{writer: writer}
+	p.serveCluster(newProxyResponseWriter(recorder), request, cluster)
+	discoveryDocuments.store(cluster.Name, documents, key, recorder)
+}
+
+func (p *proxyHandler) refreshDiscoveryDocument(request *http.Request, cluster *ClusterGateway, key discoveryDocumentKey) {
+	ctx, cancel := context.WithTimeout(request.Context(), discoveryDocumentRefreshTimeout)
+	defer cancel()
+	documents := discoveryDocuments.documentsOf(cluster.Name)
+	recorder := &discoveryDocumentRecorder{header: make(http.Header)}
+	// the errors are not responded to the finished request
+	refresher := *p
+	refresher.responder = discardingResponder{}
+	refresher.serveCluster(newProxyResponseWriter(recorder), request.WithContext(ctx), cluster)
+	if _, ok := recorder.document(); !ok {
+		klog.V(4).Infof("Failed refreshing document %s of cluster %s: status %d", key.path, cluster.Name, recorder.statusCode)
+	}
+	discoveryDocuments.store(cluster.Name, documents, key, recorder)
+}
+
+var _ registryrest.Responder = discardingResponder{}
+
+type discardingResponder struct{}
+
+func (discardingResponder) Object(statusCode int, obj runtime.Object) {}
+
+func (discardingResponder) Error(err error) {}
+
+var _ http.Flusher = &discoveryDocumentRecorder{}
+
+// discoveryDocumentRecorder records the document proxied from the cluster
+// while writing it to the client if any.
+type discoveryDocumentRecorder struct {
+	writer     http.ResponseWriter
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+	overflow   bool
+}
+
+func (r *discoveryDocumentRecorder) Header() http.Header {
+	if r.writer != nil {
+		return r.writer.Header()
+	}
+	return r.header
+}
+
+func (r *discoveryDocumentRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	if r.writer != nil {
+		r.writer.WriteHeader(statusCode)
+	}
+}
+
+func (r *discoveryDocumentRecorder) Write(data []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	if !r.overflow {
+		if r.body.Len()+len(data) > maxDiscoveryDocumentSize {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(data)
+		}
+	}
+	if r.writer != nil {
+		return r.writer.Write(data)
+	}
+	return len(data), nil
+}
+
+func (r *discoveryDocumentRecorder) Flush() {
+	if flusher, ok := r.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *discoveryDocumentRecorder) document() (*discoveryDocument, bool) {
+	if r.statusCode != http.StatusOK || r.overflow {
+		return nil, false
+	}
+	header := make(http.Header)
+	for _, k := range []string{"Content-Type", "Content-Encoding", "Vary"} {
+		if v := r.Header().Values(k); len(v) > 0 {
+			header[k] = v
+		}
+	}
+	body := r.body.Bytes()
+	sum := sha256.Sum256(body)
+	return &discoveryDocument{
+		header:  header,
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:]) + `"`,
+		fetched: time.Now(),
+	}, true
+}
@@ -0,0 +1,255 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/utils/pointer"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/kluster-manager/cluster-auth/apis/authentication/v1alpha1"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+func TestIsDiscoveryDocumentPath(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/api":                          true,
+		"/api/v1":                       true,
+		"/apis":                         true,
+		"/apis/apps":                    true,
+		"/apis/apps/v1":                 true,
+		"/openapi/v2":                   true,
+		"/openapi/v3":                   true,
+		"/openapi/v3/apis/apps/v1":      true,
+		"/api/v1/namespaces":            false,
+		"/apis/apps/v1/deployments":     false,
+		"/apis/apps/v1/namespaces/a/b":  false,
+		"/healthz":                      false,
+		"/version":                      false,
+		"/openapi/v3x":                  false,
+		"/apis/apps/v1/namespaces/a/b/": false,
+	} {
+		assert.Equal(t, expected, isDiscoveryDocumentPath(path), path)
+	}
+}
+
+func TestProxyHandlerDiscoveryDocuments(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	interval := config.DiscoveryCacheRefreshInterval
+	defer func() { config.DiscoveryCacheRefreshInterval = interval }()
+	config.DiscoveryCacheRefreshInterval = time.Hour
+	discoveryDocuments.invalidate("cluster-a")
+	defer discoveryDocuments.invalidate("cluster-a")
+
+	var fetched, written atomic.Int32
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			written.Add(1)
+			resp.WriteHeader(http.StatusCreated)
+			return
+		}
+		n := fetched.Add(1)
+		resp.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(resp, `{"path":%q,"accept":%q,"n":%d}`, req.URL.Path, req.Header.Get("Accept"), n)
+	}))
+	defer endpointSvr.Close()
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-a"},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  endpointSvr.URL,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: "token",
+				},
+			},
+		},
+	}
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+
+	proxy := func(t *testing.T, method, path string, header http.Header) *http.Response {
+		ctx := request.WithRequestInfo(ctx, &request.RequestInfo{Verb: strings.ToLower(method)})
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: path}, &fakeResponder{})
+		require.NoError(t, err)
+		svr := httptest.NewServer(handler)
+		defer svr.Close()
+		req, err := http.NewRequest(method, svr.URL+apiPrefix+"cluster-a"+apiSuffix+path, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := svr.Client().Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	get := func(t *testing.T, path string, header http.Header) (int, string, string) {
+		resp := proxy(t, http.MethodGet, path, header)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data), resp.Header.Get("ETag")
+	}
+
+	code, body, _ := get(t, "/apis", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":1}`, body)
+	// answered from the cache
+	code, body, etag := get(t, "/apis", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":1}`, body)
+	assert.NotEmpty(t, etag)
+	code, body, _ = get(t, "/apis", http.Header{"If-None-Match": []string{etag}})
+	assert.Equal(t, http.StatusNotModified, code)
+	assert.Empty(t, body)
+	assert.Equal(t, int32(1), fetched.Load())
+
+	// the representations are cached apart
+	aggregated := http.Header{"Accept": []string{"application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"}}
+	_, body, _ = get(t, "/apis", aggregated)
+	assert.Equal(t, `{"path":"/apis","accept":"application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList","n":2}`, body)
+	_, body, _ = get(t, "/apis", aggregated)
+	assert.Equal(t, `{"path":"/apis","accept":"application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList","n":2}`, body)
+
+	// the other requests are never cached
+	_, body, _ = get(t, "/api/v1/namespaces", nil)
+	assert.Equal(t, `{"path":"/api/v1/namespaces","accept":"","n":3}`, body)
+	_, body, _ = get(t, "/api/v1/namespaces", nil)
+	assert.Equal(t, `{"path":"/api/v1/namespaces","accept":"","n":4}`, body)
+
+	// writing the CRDs drops the documents of the cluster, which are not
+	// cached until the CRDs are established
+	resp := proxy(t, http.MethodPost, "/apis/apiextensions.k8s.io/v1/customresourcedefinitions", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, int32(1), written.Load())
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":5}`, body)
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":6}`, body)
+	discoveryDocuments.lock.Lock()
+	discoveryDocuments.clusters["cluster-a"].settlingUntil = time.Time{}
+	discoveryDocuments.lock.Unlock()
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":7}`, body)
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":7}`, body)
+
+	fetchedAgo := func(age time.Duration) {
+		discoveryDocuments.lock.Lock()
+		defer discoveryDocuments.lock.Unlock()
+		for key, element := range discoveryDocuments.clusters["cluster-a"].documents {
+			if key.path == "/apis" && len(key.accept) == 0 {
+				element.Value.(*discoveryDocumentEntry).document.fetched = time.Now().Add(-age)
+			}
+		}
+	}
+	// the stale documents are served while being refreshed in the background,
+	// which are the ones older than 30s for the root documents
+	fetchedAgo(45 * time.Second)
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":7}`, body)
+	assert.Eventually(t, func() bool {
+		_, body, _ = get(t, "/apis", nil)
+		return body == `{"path":"/apis","accept":"","n":8}`
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the documents older than twice the interval are never served
+	fetchedAgo(time.Minute)
+	_, body, _ = get(t, "/apis", nil)
+	assert.Equal(t, `{"path":"/apis","accept":"","n":9}`, body)
+
+	// the documents are cached apart for the impersonated identities and the
+	// credential profiles
+	scheme := runtime.NewScheme()
+	require.NoError(t, authv1alpha1.AddToScheme(scheme))
+	singleton.SetClient(ctrlfake.NewClientBuilder().WithScheme(scheme).Build())
+	global := GlobalClusterGatewayProxyConfiguration
+	GlobalClusterGatewayProxyConfiguration = &ClusterGatewayProxyConfiguration{}
+	defer func() { GlobalClusterGatewayProxyConfiguration = global }()
+	getAs := func(t *testing.T, name string) string {
+		ctx := request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+		handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "cluster-a", &ClusterGatewayProxyOptions{Path: "/apis", Impersonate: true}, &fakeResponder{})
+		require.NoError(t, err)
+		svr := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			handler.ServeHTTP(resp, req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: name})))
+		}))
+		defer svr.Close()
+		resp, err := svr.Client().Get(svr.URL + apiPrefix + "cluster-a" + apiSuffix + "/apis")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, `{"path":"/apis","accept":"","n":10}`, getAs(t, "alice"))
+	assert.Equal(t, `{"path":"/apis","accept":"","n":10}`, getAs(t, "alice"))
+	assert.Equal(t, `{"path":"/apis","accept":"","n":11}`, getAs(t, "bob"))
+	req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+	req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "alice"}))
+	defaultKey, ok := (&proxyHandler{path: "/apis", clusterGateway: gw}).discoveryDocumentKeyOf(req, gw)
+	require.True(t, ok)
+	profileKey, ok := (&proxyHandler{path: "/apis", clusterGateway: gw, credentialProfile: "readonly"}).discoveryDocumentKeyOf(req, gw)
+	require.True(t, ok)
+	assert.NotEqual(t, defaultKey, profileKey)
+}
+
+func TestDiscoveryDocumentCacheMaxSize(t *testing.T) {
+	maxSize := config.DiscoveryCacheMaxSize
+	defer func() { config.DiscoveryCacheMaxSize = maxSize }()
+	config.DiscoveryCacheMaxSize = 10
+	interval := config.DiscoveryCacheRefreshInterval
+	defer func() { config.DiscoveryCacheRefreshInterval = interval }()
+	config.DiscoveryCacheRefreshInterval = time.Hour
+
+	cache := newDiscoveryDocumentCache()
+	store := func(cluster, path, body string) {
+		recorder := &discoveryDocumentRecorder{header: make(http.Header)}
+		recorder.Write([]byte(body))
+		cache.store(cluster, cache.documentsOf(cluster), discoveryDocumentKey{path: path}, recorder)
+	}
+	cached := func(cluster, path string) bool {
+		_, ok, _ := cache.get(cluster, discoveryDocumentKey{path: path})
+		return ok
+	}
+	store("cluster-a", "/a", "aaa")
+	store("cluster-b", "/b", "bbb")
+	assert.True(t, cached("cluster-a", "/a"))
+	// the least recently used documents across the clusters are evicted
+	store("cluster-c", "/c", "ccc")
+	assert.False(t, cached("cluster-b", "/b"))
+	assert.True(t, cached("cluster-a", "/a"))
+	assert.True(t, cached("cluster-c", "/c"))
+	assert.Equal(t, int64(10), cache.size)
+	// the documents beyond the max size are never cached
+	store("cluster-a", "/large", "0123456789")
+	assert.False(t, cached("cluster-a", "/large"))
+
+	cache.invalidate("cluster-a")
+	assert.False(t, cached("cluster-a", "/a"))
+	assert.Equal(t, int64(5), cache.size)
+	assert.Equal(t, 1, cache.recent.Len())
+}
@@ -198,6 +198,68 @@ func TestProxyHandler(t *testing.T) {
 	}
 }
 
+func TestProxyHandlerChainedClusterGateway(t *testing.T) {
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	scheme := runtime.NewScheme()
+	require.NoError(t, authv1alpha1.AddToScheme(scheme))
+	singleton.SetClient(ctrlfake.NewClientBuilder().WithScheme(scheme).Build())
+	global := GlobalClusterGatewayProxyConfiguration
+	GlobalClusterGatewayProxyConfiguration = &ClusterGatewayProxyConfiguration{}
+	defer func() { GlobalClusterGatewayProxyConfiguration = global }()
+
+	var receivingReq *http.Request
+	downstreamSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivingReq = req
+		resp.Write([]byte("ok"))
+	}))
+	defer downstreamSvr.Close()
+	parent := &fakeParentStorage{
+		obj: &ClusterGateway{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "leaf",
+			},
+			Spec: ClusterGatewaySpec{
+				Access: ClusterAccess{
+					Endpoint: &ClusterEndpoint{
+						Type: ClusterEndpointTypeClusterGateway,
+						Const: &ClusterEndpointConst{
+							Address:  downstreamSvr.URL,
+							Insecure: pointer.Bool(true),
+						},
+						ClusterGateway: &ClusterEndpointClusterGateway{
+							Cluster: "remote-leaf",
+						},
+					},
+					Credential: &ClusterAccessCredential{
+						Type:                CredentialTypeServiceAccountToken,
+						ServiceAccountToken: "myToken",
+					},
+				},
+			},
+		},
+	}
+	ctx := contextutil.WithParentStorage(context.TODO(), parent)
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "leaf", &ClusterGatewayProxyOptions{Path: "/api/v1/pods"}, nil)
+	require.NoError(t, err)
+	// the requests are authenticated as the user by the hub
+	svr := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}}))
+		handler.ServeHTTP(resp, req)
+	}))
+	defer svr.Close()
+
+	resp, err := svr.Client().Get(svr.URL + apiPrefix + "leaf" + apiSuffix + "/api/v1/pods?limit=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, apiPrefix+"remote-leaf"+apiSuffix+"/api/v1/pods", receivingReq.URL.Path)
+	assert.Equal(t, "limit=1", receivingReq.URL.RawQuery)
+	assert.Equal(t, "Bearer myToken", receivingReq.Header.Get("Authorization"))
+	assert.Equal(t, "alice", receivingReq.Header.Get("Impersonate-User"))
+	assert.Equal(t, []string{"dev"}, receivingReq.Header.Values("Impersonate-Group"))
+}
+
 var _ rest.Storage = &fakeParentStorage{}
 var _ rest.Getter = &fakeParentStorage{}
 
@@ -0,0 +1,196 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	apiproxy "k8s.io/apimachinery/pkg/util/proxy"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"k8s.io/utils/lru"
+)
+
+// proxyTransportCacheSize is the number of transports kept for each cluster,
+// one for each endpoint, impersonation config and credential profile.
+const proxyTransportCacheSize = 64
+
+// proxyTransports keeps the transports of the proxy subresource so that the
+// connections and the TLS sessions are reused across the proxied requests.
+var proxyTransports = &proxyTransportCache{clusters: make(map[string]*clusterProxyTransports)}
+
+type proxyTransportCache struct {
+	lock     sync.Mutex
+	clusters map[string]*clusterProxyTransports
+}
+
+// clusterProxyTransports are the transports of a cluster built upon the same
+// endpoints and credential.
+type clusterProxyTransports struct {
+	fingerprint string
+	transports  *lru.Cache
+}
+
+// proxyTransportKey tells the transports of a cluster apart.
+type proxyTransportKey struct {
+	address       string
+	impersonation string
+	credential    string
+}
+
+// proxyTransport is the pair of transports proxying the plain requests and
+// the upgrading requests to an endpoint of the cluster.
+type proxyTransport struct {
+	transport        http.RoundTripper
+	upgradeTransport apiproxy.UpgradeRequestRoundTripper
+	upgrading        *http.Transport
+}
+
+func (t *proxyTransport) closeIdleConnections() {
+	utilnet.CloseIdleConnectionsFor(t.transport)
+	t.upgrading.CloseIdleConnections()
+}
+
+// get returns the transport proxying the requests to the endpoint of the
+// candidate, which is one of the candidates of the cluster authenticated by
+// the named credential profile if any. The transports are rebuilt once the
+// endpoints or the credential of the cluster change.
+func (c *proxyTransportCache) get(ctx context.Context, cluster, candidate *ClusterGateway, credentialProfile string, impersonation *restclient.ImpersonationConfig) (*proxyTransport, error) {
+	fingerprint, err := clusterAccessFingerprint(cluster)
+	if err != nil {
+		return nil, err
+	}
+	key := proxyTransportKey{}
+	if endpoint := candidate.Spec.Access.Endpoint; endpoint.Type == ClusterEndpointTypeConst && endpoint.Const != nil {
+		key.address = endpoint.Const.Address
+	}
+	// the candidate authenticated by a credential profile is told apart by
+	// the profile and the digest of its contents, so that the rotation of
+	// the profile takes effect
+	if len(credentialProfile) > 0 {
+		digest, err := credentialFingerprint(candidate.Spec.Access.Credential)
+		if err != nil {
+			return nil, err
+		}
+		key.credential = credentialProfile + "/" + digest
+	}
+	if impersonation != nil {
+		data, err := json.Marshal(impersonation)
+		if err != nil {
+			return nil, err
+		}
+		key.impersonation = string(data)
+	}
+	if t, ok := c.lookup(cluster.Name, fingerprint, key); ok {
+		return t, nil
+	}
+	t, err := newProxyTransport(ctx, candidate, impersonation)
+	if err != nil {
+		return nil, err
+	}
+	return c.add(cluster.Name, fingerprint, key, t), nil
+}
+
+func (c *proxyTransportCache) lookup(cluster, fingerprint string, key proxyTransportKey) (*proxyTransport, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	transports, ok := c.clusters[cluster]
+	if !ok || transports.fingerprint != fingerprint {
+		return nil, false
+	}
+	t, ok := transports.transports.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return t.(*proxyTransport), true
+}
+
+// add stores the transport unless another one is stored concurrently, and
+// returns the stored one.
+func (c *proxyTransportCache) add(cluster, fingerprint string, key proxyTransportKey, t *proxyTransport) *proxyTransport {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	transports, ok := c.clusters[cluster]
+	if !ok || transports.fingerprint != fingerprint {
+		if ok {
+			transports.transports.Clear()
+		}
+		transports = &clusterProxyTransports{
+			fingerprint: fingerprint,
+			transports: lru.NewWithEvictionFunc(proxyTransportCacheSize, func(_ lru.Key, value interface{}) {
+				value.(*proxyTransport).closeIdleConnections()
+			}),
+		}
+		c.clusters[cluster] = transports
+	}
+	if existing, ok := transports.transports.Get(key); ok {
+		t.closeIdleConnections()
+		return existing.(*proxyTransport)
+	}
+	transports.transports.Add(key, t)
+	return t
+}
+
+// invalidate drops the transports of the cluster unless they are built upon
+// the current endpoints and credential of the cluster. A nil cluster drops
+// all the transports.
+func (c *proxyTransportCache) invalidate(name string, cluster *ClusterGateway) {
+	fingerprint := ""
+	if cluster != nil {
+		var err error
+		if fingerprint, err = clusterAccessFingerprint(cluster); err != nil {
+			fingerprint = ""
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	transports, ok := c.clusters[name]
+	if !ok || (len(fingerprint) > 0 && transports.fingerprint == fingerprint) {
+		return
+	}
+	transports.transports.Clear()
+	delete(c.clusters, name)
+}
+
+func newProxyTransport(ctx context.Context, cluster *ClusterGateway, impersonation *restclient.ImpersonationConfig) (*proxyTransport, error) {
+	cfg, err := NewConfigFromCluster(ctx, cluster)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating cluster proxy client config %s", cluster.Name)
+	}
+	if impersonation != nil {
+		cfg.Impersonate = *impersonation
+	}
+	rt, err := restclient.TransportFor(cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating cluster proxy client %s", cluster.Name)
+	}
+	transportCfg, err := cfg.TransportConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating transport config %s", cluster.Name)
+	}
+	tlsConfig, err := transport.TLSConfigFor(transportCfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating tls config %s", cluster.Name)
+	}
+	upgrader, err := transport.HTTPWrappersForConfig(transportCfg, apiproxy.MirrorRequest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed creating upgrader client %s", cluster.Name)
+	}
+	upgrading := utilnet.SetOldTransportDefaults(&http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext:     cfg.Dial,
+	})
+	return &proxyTransport{
+		transport: rt,
+		upgradeTransport: apiproxy.NewUpgradeRequestRoundTripper(
+			upgrading,
+			RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				newReq := utilnet.CloneRequest(req)
+				return upgrader.RoundTrip(newReq)
+			})),
+		upgrading: upgrading,
+	}, nil
+}
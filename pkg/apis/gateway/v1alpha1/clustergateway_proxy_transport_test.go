@@ -0,0 +1,144 @@
+package v1alpha1
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+// newConnCountingServer serves TLS and counts the accepted connections.
+func newConnCountingServer(t testing.TB) (*httptest.Server, *int64) {
+	var conns int64
+	svr := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	svr.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	svr.StartTLS()
+	t.Cleanup(svr.Close)
+	return svr, &conns
+}
+
+func proxyTransportClusterGateway(name, address, token string) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  address,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: token,
+				},
+			},
+		},
+	}
+}
+
+func roundTripThrough(t testing.TB, rt http.RoundTripper, address string) {
+	req, err := http.NewRequest(http.MethodGet, address+"/healthz", nil)
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestProxyTransportCache(t *testing.T) {
+	svr, conns := newConnCountingServer(t)
+	cache := &proxyTransportCache{clusters: make(map[string]*clusterProxyTransports)}
+	ctx := context.TODO()
+	gw := proxyTransportClusterGateway("cluster-a", svr.URL, "token")
+
+	// the cached transport reuses the connection
+	first, err := cache.get(ctx, gw, gw, "", nil)
+	require.NoError(t, err)
+	roundTripThrough(t, first.transport, svr.URL)
+	second, err := cache.get(ctx, gw, gw, "", nil)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	roundTripThrough(t, second.transport, svr.URL)
+	assert.Equal(t, int64(1), atomic.LoadInt64(conns))
+
+	// the impersonation configs are told apart
+	alice, err := cache.get(ctx, gw, gw, "", &restclient.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}})
+	require.NoError(t, err)
+	assert.NotSame(t, first, alice)
+	aliceAgain, err := cache.get(ctx, gw, gw, "", &restclient.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}})
+	require.NoError(t, err)
+	assert.Same(t, alice, aliceAgain)
+
+	// rotating the credential rebuilds the transports
+	rotated := proxyTransportClusterGateway("cluster-a", svr.URL, "rotated")
+	third, err := cache.get(ctx, rotated, rotated, "", nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+	assert.Equal(t, 1, cache.clusters["cluster-a"].transports.Len())
+
+	// the current credential keeps the transports
+	cache.invalidate("cluster-a", rotated)
+	fourth, err := cache.get(ctx, rotated, rotated, "", nil)
+	require.NoError(t, err)
+	assert.Same(t, third, fourth)
+
+	// removing the cluster drops the transports
+	cache.invalidate("cluster-a", nil)
+	assert.Empty(t, cache.clusters)
+
+	// transports through cluster-proxy are cached as well
+	defer func(getter func(context.Context) (k8snet.DialFunc, error)) { DialerGetter = getter }(DialerGetter)
+	DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
+		return (&net.Dialer{}).DialContext, nil
+	}
+	proxied := gw.DeepCopy()
+	proxied.Spec.Access.Endpoint = &ClusterEndpoint{Type: ClusterEndpointTypeClusterProxy}
+	fifth, err := cache.get(ctx, proxied, proxied, "", nil)
+	require.NoError(t, err)
+	sixth, err := cache.get(ctx, proxied, proxied, "", nil)
+	require.NoError(t, err)
+	assert.Same(t, fifth, sixth)
+}
+
+// BenchmarkProxyTransport compares proxying a request through the cached
+// transports against building the transports upon every request.
+func BenchmarkProxyTransport(b *testing.B) {
+	svr, _ := newConnCountingServer(b)
+	gw := proxyTransportClusterGateway("cluster-a", svr.URL, "token")
+	impersonation := &restclient.ImpersonationConfig{UserName: "alice"}
+	ctx := context.TODO()
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			t, err := newProxyTransport(ctx, gw, impersonation)
+			require.NoError(b, err)
+			roundTripThrough(b, t.transport, svr.URL)
+			t.closeIdleConnections()
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := &proxyTransportCache{clusters: make(map[string]*clusterProxyTransports)}
+		for i := 0; i < b.N; i++ {
+			t, err := cache.get(ctx, gw, gw, "", impersonation)
+			require.NoError(b, err)
+			roundTripThrough(b, t.transport, svr.URL)
+		}
+	})
+}
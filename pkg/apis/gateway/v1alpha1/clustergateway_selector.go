@@ -0,0 +1,106 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/storage"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+// Field selectors supported by ClusterGateway list and watch requests.
+const (
+	FieldSelectorName           = "metadata.name"
+	FieldSelectorEndpointType   = "spec.access.endpoint.type"
+	FieldSelectorCredentialType = "spec.access.credential.type"
+	FieldSelectorHealthy        = "status.healthy"
+)
+
+var supportedFieldSelectors = []string{
+	FieldSelectorName,
+	FieldSelectorEndpointType,
+	FieldSelectorCredentialType,
+	FieldSelectorHealthy,
+}
+
+// ConvertClusterGatewayFieldLabel validates the field selectors of
+// ClusterGateway requests.
+func ConvertClusterGatewayFieldLabel(label, value string) (string, string, error) {
+	for _, supported := range supportedFieldSelectors {
+		if label == supported {
+			return label, value, nil
+		}
+	}
+	return "", "", fmt.Errorf("field label not supported: %s", label)
+}
+
+// GetClusterGatewayAttrs returns the labels and the selectable fields of a
+// ClusterGateway.
+func GetClusterGatewayAttrs(obj runtime.Object) (labels.Set, fields.Set, error) {
+	gw, ok := obj.(*ClusterGateway)
+	if !ok {
+		return nil, nil, fmt.Errorf("not a clustergateway: %T", obj)
+	}
+	fieldSet := fields.Set{
+		FieldSelectorName:           gw.Name,
+		FieldSelectorEndpointType:   "",
+		FieldSelectorCredentialType: "",
+		FieldSelectorHealthy:        strconv.FormatBool(gw.Status.Healthy),
+	}
+	if gw.Spec.Access.Endpoint != nil {
+		fieldSet[FieldSelectorEndpointType] = string(gw.Spec.Access.Endpoint.Type)
+	}
+	if gw.Spec.Access.Credential != nil {
+		fieldSet[FieldSelectorCredentialType] = string(gw.Spec.Access.Credential.Type)
+	}
+	return gw.Labels, fieldSet, nil
+}
+
+// newClusterGatewayPredicate builds the selection predicate from the label
+// and field selectors of the list options.
+func newClusterGatewayPredicate(opt *internalversion.ListOptions) (storage.SelectionPredicate, error) {
+	p := storage.SelectionPredicate{
+		Label:    labels.Everything(),
+		Field:    fields.Everything(),
+		GetAttrs: GetClusterGatewayAttrs,
+	}
+	if opt == nil {
+		return p, nil
+	}
+	if opt.LabelSelector != nil {
+		p.Label = opt.LabelSelector
+	}
+	if opt.FieldSelector != nil {
+		for _, req := range opt.FieldSelector.Requirements() {
+			if _, _, err := ConvertClusterGatewayFieldLabel(req.Field, req.Value); err != nil {
+				return p, err
+			}
+		}
+		p.Field = opt.FieldSelector
+	}
+	return p, nil
+}
+
+// selectClusterAnnotations picks the annotations of ManagedCluster to be
+// copied onto ClusterGateway according to "--propagated-cluster-annotations".
+func selectClusterAnnotations(annotations map[string]string) map[string]string {
+	var selected map[string]string
+	for k, v := range annotations {
+		for _, key := range config.PropagatedClusterAnnotations {
+			if k == key || (strings.HasSuffix(key, "/") && strings.HasPrefix(k, key)) {
+				if selected == nil {
+					selected = make(map[string]string)
+				}
+				selected[k] = v
+				break
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,132 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	registryrest "k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource"
+	"sigs.k8s.io/apiserver-runtime/pkg/builder/resource/resourcerest"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/reversetunnel"
+)
+
+var _ resource.SubResource = &ClusterGatewayTunnel{}
+var _ registryrest.Storage = &ClusterGatewayTunnel{}
+var _ resourcerest.Connecter = &ClusterGatewayTunnel{}
+
+// ClusterGatewayTunnel is a subresource for ClusterGateway which accepts the
+// reverse tunnels dialed out by the agents in the managed clusters. The
+// tunnels are authorized by the "serve" verb upon the subresource in addition
+// to "get", which are granted to the agent of each cluster upon the
+// registration. A live session of the cluster is never replaced by a new one.
+type ClusterGatewayTunnel struct {
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterGatewayTunnelOptions struct {
+	metav1.TypeMeta
+}
+
+func (c *ClusterGatewayTunnel) SubResourceName() string {
+	return "tunnel"
+}
+
+func (c *ClusterGatewayTunnel) New() runtime.Object {
+	return &ClusterGatewayTunnelOptions{}
+}
+
+func (c *ClusterGatewayTunnel) Destroy() {}
+
+func (c *ClusterGatewayTunnel) Connect(ctx context.Context, id string, options runtime.Object, r registryrest.Responder) (http.Handler, error) {
+	parentStorage, ok := contextutil.GetParentStorageGetter(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no parent storage found")
+	}
+	if _, err := parentStorage.Get(ctx, id, &metav1.GetOptions{}); err != nil {
+		return nil, fmt.Errorf("no such cluster %v", id)
+	}
+	requester, _ := request.UserFrom(ctx)
+	if err := authorizeTunnelServing(ctx, requester, id); err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !reversetunnel.IsTunnelRequest(request) {
+			r.Error(apierrors.NewBadRequest(fmt.Sprintf("tunnel requests must upgrade to %s", reversetunnel.Protocol)))
+			return
+		}
+		if err := reverseTunnelSessions.Admit(request.Context(), id); err != nil {
+			r.Error(apierrors.NewConflict(clusterGatewayGroupResource(), id, err))
+			return
+		}
+		conn, err := reversetunnel.Accept(writer, request, reverseTunnelReplica)
+		if err != nil {
+			r.Error(err)
+			return
+		}
+		// the session outlives the request which returns upon the upgrade
+		session, err := reversetunnel.NewSession(conn)
+		if err != nil {
+			klog.Warningf("Failed opening reverse tunnel session of cluster %s: %v", id, err)
+			return
+		}
+		if err := reverseTunnelSessions.Register(id, session); err != nil {
+			klog.Warningf("Refused reverse tunnel session of cluster %s: %v", id, err)
+			session.Close()
+			return
+		}
+		klog.Infof("Accepted reverse tunnel session of cluster %s", id)
+	}), nil
+}
+
+// authorizeTunnelServing authorizes the user upon the "serve" verb of the
+// tunnel subresource of the cluster, so that serving the tunnel is never
+// granted by wildcard subresources of the "get" verb alone.
+func authorizeTunnelServing(ctx context.Context, requester user.Info, cluster string) error {
+	attr := authorizer.AttributesRecord{
+		User:            requester,
+		APIGroup:        config.MetaApiGroupName,
+		APIVersion:      config.MetaApiVersionName,
+		Resource:        config.MetaApiResourceName,
+		Subresource:     "tunnel",
+		Name:            cluster,
+		Verb:            common.VerbServeTunnel,
+		ResourceRequest: true,
+	}
+	decision, reason, err := loopback.GetAuthorizer().Authorize(ctx, attr)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("authorizing serving tunnel failed: %v", err))
+	}
+	if decision != authorizer.DecisionAllow {
+		return apierrors.NewForbidden(clusterGatewayGroupResource(), cluster,
+			fmt.Errorf("serving tunnel requires the %q verb upon the tunnel subresource: %s", common.VerbServeTunnel, reason))
+	}
+	return nil
+}
+
+func (c *ClusterGatewayTunnel) NewConnectOptions() (runtime.Object, bool, string) {
+	return &ClusterGatewayTunnelOptions{}, false, ""
+}
+
+func (c *ClusterGatewayTunnel) ConnectMethods() []string {
+	return []string{"GET"}
+}
+
+var _ resource.QueryParameterObject = &ClusterGatewayTunnelOptions{}
+
+func (in *ClusterGatewayTunnelOptions) ConvertFromUrlValues(values *url.Values) error {
+	return nil
+}
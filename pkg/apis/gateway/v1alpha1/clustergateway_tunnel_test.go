@@ -0,0 +1,37 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+)
+
+func TestClusterGatewayTunnelAuthorization(t *testing.T) {
+	original := loopback.GetAuthorizer()
+	defer loopback.SetAuthorizer(original)
+	loopback.SetAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() == "agent" && a.GetVerb() == "serve" && a.GetSubresource() == "tunnel" && a.GetName() == "cluster-a" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}))
+
+	gw := constClusterGateway("cluster-a", x509Credential())
+	parent := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	tunnel := &ClusterGatewayTunnel{}
+
+	// the "get" verb alone never serves the tunnel
+	_, err := tunnel.Connect(request.WithUser(parent, &user.DefaultInfo{Name: "alice"}), "cluster-a", &ClusterGatewayTunnelOptions{}, nil)
+	assert.True(t, apierrors.IsForbidden(err), "unexpected error: %v", err)
+
+	handler, err := tunnel.Connect(request.WithUser(parent, &user.DefaultInfo{Name: "agent"}), "cluster-a", &ClusterGatewayTunnelOptions{}, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, handler)
+}
@@ -78,6 +78,13 @@ const (
 	// CredentialTypeX509Certificate means the cluster is accessible via
 	// X509 certificate and key.
 	CredentialTypeX509Certificate CredentialType = "X509Certificate"
+	// CredentialTypeExec means the cluster is accessible via the credential
+	// issued by an exec plugin, e.g. the cloud provider's CLI.
+	CredentialTypeExec CredentialType = "Exec"
+	// CredentialTypeOIDCClientCredentials means the cluster is accessible via
+	// the access token issued by an OIDC issuer through the client-credentials
+	// grant.
+	CredentialTypeOIDCClientCredentials CredentialType = "OIDCClientCredentials"
 )
 
 type ClusterEndpointType string
@@ -87,6 +94,19 @@ type ClusterEndpoint struct {
 	Type ClusterEndpointType `json:"type"`
 	// Const prescribes fixed endpoint for requesting target clusters.
 	Const *ClusterEndpointConst `json:"const,omitempty"`
+	// SSHBastion prescribes the SSH jump host tunneling the requests to the
+	// Const endpoint under SSHBastion mode.
+	SSHBastion *ClusterEndpointSSHBastion `json:"sshBastion,omitempty"`
+	// ClusterGateway prescribes the ClusterGateway on the downstream hub
+	// routing the requests to the cluster under ClusterGateway mode, where
+	// the Const endpoint is the kube-apiserver of the downstream hub.
+	ClusterGateway *ClusterEndpointClusterGateway `json:"clusterGateway,omitempty"`
+	// Fallback is the endpoint type which the requests fall back to when
+	// the endpoint of Type is not reachable. It's only supported between
+	// Const and ClusterProxy, where the Const endpoint is also required
+	// under ClusterProxy mode falling back to Const.
+	// +optional
+	Fallback ClusterEndpointType `json:"fallback,omitempty"`
 }
 
 const (
@@ -97,6 +117,25 @@ const (
 	// through the konnectivity tunnel. Note that no explicit endpoint are
 	// required under ClusterProxy mode.
 	ClusterEndpointTypeClusterProxy ClusterEndpointType = "ClusterProxy"
+	// ClusterEndpointTypeSSHBastion prescribes requesting kube-apiserver via
+	// the fixed endpoint url through the SSH tunnels of a jump host, where
+	// the endpoint url is resolved.
+	ClusterEndpointTypeSSHBastion ClusterEndpointType = "SSHBastion"
+	// ClusterEndpointTypeReverseTunnel prescribes requesting kube-apiserver
+	// through the tunnels dialed out to the gateway by the agent in the
+	// cluster. Note that no explicit endpoint are required under
+	// ReverseTunnel mode.
+	ClusterEndpointTypeReverseTunnel ClusterEndpointType = "ReverseTunnel"
+	// ClusterEndpointTypeClusterGateway prescribes requesting kube-apiserver
+	// through the proxy subresource of the ClusterGateway on another hub,
+	// which is requested via the fixed endpoint url of that hub. The
+	// requests are impersonated as the original user so that the downstream
+	// hub authorizes the user instead of the gateway.
+	ClusterEndpointTypeClusterGateway ClusterEndpointType = "ClusterGateway"
+	// ClusterEndpointTypeLoopback prescribes requesting the kube-apiserver of
+	// the hub cluster via the client config of the gateway, which is only
+	// served by the built-in local cluster and can not be written.
+	ClusterEndpointTypeLoopback ClusterEndpointType = "Loopback"
 )
 
 type ClusterEndpointConst struct {
@@ -109,13 +148,101 @@ type ClusterEndpointConst struct {
 	Insecure *bool `json:"insecure,omitempty"`
 	// ProxyURL indicates the proxy url of the server
 	ProxyURL *string `json:"proxy-url,omitempty"`
+	// EgressProxy prescribes the proxy which the connections to the server
+	// egress through, including the upgraded ones of exec and port-forward.
+	// It can not be set along with ProxyURL.
+	// +optional
+	EgressProxy *ClusterEndpointEgressProxy `json:"egressProxy,omitempty"`
+	// Alternatives are the endpoints of the same kube-apiserver to fail over
+	// to when the Address is not reachable, following the order of the
+	// ManagedClusterClientConfigs.
+	// +optional
+	Alternatives []ClusterEndpointAlternative `json:"alternatives,omitempty"`
+}
+
+type ClusterEndpointEgressProxy struct {
+	// URL is the address of the proxy whose scheme is one of "http", "https"
+	// and "socks5". The connections are tunneled by CONNECT requests to the
+	// http(s) proxies.
+	URL string `json:"url"`
+	// CABundle is used for verifying the serving certificate of the https
+	// proxy, defaulting to the system trust roots.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+	// CredentialSecretRef refers to the Secret "cluster-gateway-egress-proxy"
+	// in the namespace of the cluster holding the "username" and the
+	// "password" authenticating to the proxy.
+	// +optional
+	CredentialSecretRef *EgressProxyCredentialSecretReference `json:"credentialSecretRef,omitempty"`
+	// NoProxy lists the hosts connected directly in the format of the
+	// NO_PROXY environment variable, each of which is either "*", an IP
+	// address, a CIDR or a domain name matching its subdomains as well,
+	// optionally followed by a port.
+	// +optional
+	NoProxy []string `json:"noProxy,omitempty"`
+}
+
+type EgressProxyCredentialSecretReference struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+}
+
+type ClusterEndpointAlternative struct {
+	// Address is a qualified hostname for accessing the local kube-apiserver.
+	Address string `json:"address"`
+	// CABundle is used for verifying the serving CA certificate of the
+	// endpoint. The CABundle of the primary endpoint is used if absent.
+	CABundle []byte `json:"caBundle,omitempty"`
+}
+
+type ClusterEndpointSSHBastion struct {
+	// Host is the address of the SSH server in the form of "host[:port]",
+	// the port defaults to 22.
+	Host string `json:"host"`
+	// User is the user logging in the SSH server.
+	User string `json:"user"`
+	// KnownHosts are the known_hosts lines verifying the host keys of the
+	// SSH server, which is mandatory.
+	KnownHosts []byte `json:"knownHosts"`
+	// PrivateKey is the PEM encoded private key authenticating the user.
+	PrivateKey []byte `json:"-"`
+}
+
+type ClusterEndpointClusterGateway struct {
+	// Cluster is the name of the ClusterGateway on the downstream hub.
+	Cluster string `json:"cluster"`
 }
 
 type ClusterAccessCredential struct {
 	// Type is the union discriminator for credential contents.
-	Type                CredentialType `json:"type"`
-	ServiceAccountToken string         `json:"-"`
-	X509                *X509          `json:"-"`
+	Type                CredentialType         `json:"type"`
+	ServiceAccountToken string                 `json:"-"`
+	X509                *X509                  `json:"-"`
+	Exec                *ExecConfig            `json:"-"`
+	OIDC                *OIDCClientCredentials `json:"-"`
+	// TokenRequest opts in minting short-lived tokens of a ServiceAccount in
+	// the cluster, in which case the credential above is only used for the
+	// TokenRequest calls and the proxied requests carry the minted tokens.
+	// +optional
+	TokenRequest *TokenRequestConfig `json:"tokenRequest,omitempty"`
+}
+
+// TokenRequestConfig prescribes the ServiceAccount to mint tokens for and the
+// properties of the minted tokens.
+type TokenRequestConfig struct {
+	// ServiceAccountNamespace is the namespace of the ServiceAccount in the
+	// cluster.
+	ServiceAccountNamespace string `json:"serviceAccountNamespace"`
+	// ServiceAccountName is the name of the ServiceAccount in the cluster.
+	ServiceAccountName string `json:"serviceAccountName"`
+	// Audiences are the intended audiences of the minted tokens, defaults
+	// to the audiences of the cluster's kube-apiserver.
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+	// ExpirationSeconds is the requested lifetime of the minted tokens,
+	// defaults to the "--token-request-expiration-seconds" of the gateway.
+	// +optional
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
 }
 
 type X509 struct {
@@ -123,6 +250,47 @@ type X509 struct {
 	PrivateKey  []byte `json:"privateKey"`
 }
 
+// ExecConfig prescribes the exec plugin issuing the credential, following
+// the ExecConfig of the kubeconfig.
+type ExecConfig struct {
+	// Command to execute, which must be allowed by the gateway.
+	Command string `json:"command"`
+	// Args are the arguments to pass to the command.
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Env defines additional environment variables to expose to the process,
+	// except the ones of the loaders and the interpreters, e.g. PATH and
+	// LD_PRELOAD.
+	// +optional
+	Env []ExecEnvVar `json:"env,omitempty"`
+	// APIVersion is the preferred input version of the ExecInfo, defaults to
+	// "client.authentication.k8s.io/v1".
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+}
+
+// ExecEnvVar is used for setting environment variables when executing an
+// exec-based credential plugin.
+type ExecEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// OIDCClientCredentials prescribes the OIDC client requesting access tokens
+// through the client-credentials grant.
+type OIDCClientCredentials struct {
+	// IssuerURL is the URL of the OIDC issuer serving the discovery document
+	// under "/.well-known/openid-configuration".
+	IssuerURL string `json:"issuerURL"`
+	// ClientID is the id of the OIDC client.
+	ClientID string `json:"clientID"`
+	// ClientSecret is the secret of the OIDC client.
+	ClientSecret string `json:"clientSecret"`
+	// Scopes are the scopes requested along with the access token.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+}
+
 var _ resource.Object = &ClusterGateway{}
 var _ resourcestrategy.Validater = &ClusterGateway{}
 
@@ -178,16 +346,61 @@ const (
 	HealthyReasonTypeCertificateMismatch         HealthyReasonType = "CertificateMismatch"
 	HealthyReasonTypeConnectionTimeout           HealthyReasonType = "ConnectionTimeout"
 	HealthyReasonTypeUnknownPrefix               HealthyReasonType = "Unknown:"
+	HealthyReasonTypeEndpointUnresolvable        HealthyReasonType = "EndpointUnresolvable"
+	HealthyReasonTypeConnectionFailed            HealthyReasonType = "ConnectionFailed"
+	HealthyReasonTypeHealthzFailed               HealthyReasonType = "HealthzFailed"
+	HealthyReasonTypeCredentialMissing           HealthyReasonType = "CredentialMissing"
+	HealthyReasonTypeCredentialMalformed         HealthyReasonType = "CredentialMalformed"
+	HealthyReasonTypeCredentialExpired           HealthyReasonType = "CredentialExpired"
+	HealthyReasonTypeUnauthorized                HealthyReasonType = "Unauthorized"
+)
+
+const (
+	// ClusterGatewayConditionEndpointResolved indicates whether the endpoint
+	// of the cluster is present and resolvable.
+	ClusterGatewayConditionEndpointResolved = "EndpointResolved"
+	// ClusterGatewayConditionReachable indicates whether the kube-apiserver of
+	// the cluster responds the healthz probes.
+	ClusterGatewayConditionReachable = "Reachable"
+	// ClusterGatewayConditionCredentialValid indicates whether the credential
+	// of the cluster is present, well-formed and not expired.
+	ClusterGatewayConditionCredentialValid = "CredentialValid"
+	// ClusterGatewayConditionAuthenticated indicates whether the cluster
+	// accepts the credential.
+	ClusterGatewayConditionAuthenticated = "Authenticated"
 )
 
+// ClusterGatewayConditionTypes are the condition types of ClusterGateway in
+// the order of precedence for explaining an unhealthy cluster.
+var ClusterGatewayConditionTypes = []string{
+	ClusterGatewayConditionEndpointResolved,
+	ClusterGatewayConditionReachable,
+	ClusterGatewayConditionCredentialValid,
+	ClusterGatewayConditionAuthenticated,
+}
+
 // ClusterGatewayStatus defines the observed state of ClusterGateway
 type ClusterGatewayStatus struct {
 	// Healthy indicates whether the cluster is healthy.
 	// If the `HealthinessCheck` feature gate is enabled, calling proxy
 	// subresource upon unhealthy clusters will be rejected.
+	// When the conditions are reported, it is derived from them and is true
+	// only if all the conditions are true.
 	Healthy bool `json:"healthy"`
 	// HealthyReason is the reason explaining the cluster's healthiness.
+	// When the conditions are reported, it is the reason of the first
+	// condition which is not true.
 	HealthyReason HealthyReasonType `json:"healthyReason,omitempty"`
+	// Conditions are the observations of the cluster's healthiness.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ActiveEndpointType is the endpoint type which served the last request
+	// proxied to the cluster by the gateway, reported when the endpoint
+	// prescribes a fallback.
+	// +optional
+	ActiveEndpointType ClusterEndpointType `json:"activeEndpointType,omitempty"`
 }
 
 var _ resource.ObjectWithArbitrarySubResource = &ClusterGateway{}
@@ -196,5 +409,8 @@ func (in *ClusterGateway) GetArbitrarySubResources() []resource.ArbitrarySubReso
 	return []resource.ArbitrarySubResource{
 		&ClusterGatewayProxy{},
 		&ClusterGatewayHealth{},
+		&ClusterGatewayTunnel{},
+		&ClusterGatewayKubeconfig{},
+		&ClusterGatewayCredentialsReader{},
 	}
 }
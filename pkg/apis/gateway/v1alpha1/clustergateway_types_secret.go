@@ -2,8 +2,11 @@ package v1alpha1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/kluster-manager/cluster-gateway/pkg/common"
 	"github.com/kluster-manager/cluster-gateway/pkg/config"
@@ -20,15 +23,18 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ rest.Getter = &ClusterGateway{}
 var _ rest.Lister = &ClusterGateway{}
+var _ rest.Watcher = &ClusterGateway{}
 
 // Conversion between corev1.Secret and ClusterGateway:
 //  1. Storing credentials under the secret's data including X.509 key-pair or token.
@@ -36,13 +42,36 @@ var _ rest.Lister = &ClusterGateway{}
 //  3. Extending the status of ClusterGateway by the secrets' annotation.
 //
 // NOTE: Because the secret resource is designed to have no "metadata.generation" field,
-// the ClusterGateway resource also misses the generation tracking.
+// the generation of a ClusterGateway is inherited from its ManagedCluster which is
+// observed by the conditions. The resourceVersion of a ClusterGateway is composed
+// from the objects it is converted from, see compositeResourceVersion.
 
 func (in *ClusterGateway) Get(ctx context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
 	if singleton.GetClient() == nil {
 		return nil, fmt.Errorf("controller manager is not initialized yet")
 	}
+	var gw *ClusterGateway
+	if singleton.GetCache() != nil {
+		view, err := getClusterGatewayWatchCache(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if gw, err = view.get(name); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if gw, err = getClusterGateway(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	return gw, nil
+}
 
+func getClusterGateway(ctx context.Context, name string) (*ClusterGateway, error) {
+	if isLocalCluster(name) {
+		return newLocalClusterGateway(), nil
+	}
 	var cluster clusterv1.ManagedCluster
 	err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: name}, &cluster)
 	if err != nil {
@@ -69,55 +98,191 @@ func (in *ClusterGateway) Get(ctx context.Context, name string, _ *metav1.GetOpt
 
 func (in *ClusterGateway) List(ctx context.Context, opt *internalversion.ListOptions) (runtime.Object, error) {
 	if opt.Watch {
-		// TODO: convert watch events from both Secret and ManagedCluster
-		return nil, fmt.Errorf("watch not supported")
+		return nil, fmt.Errorf("watch must be served by the watch verb")
+	}
+
+	predicate, err := newClusterGatewayPredicate(opt)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	page, err := validateClusterGatewayListOptions(opt)
+	if err != nil {
+		return nil, err
 	}
 
 	list := &ClusterGatewayList{
 		Items: []ClusterGateway{},
 	}
 
-	var clusters clusterv1.ManagedClusterList
-	err := singleton.GetClient().List(ctx, &clusters)
+	// Serving from the watch cache guarantees the returned resourceVersion
+	// is resumable by a subsequent watch request.
+	var watchCache *clusterGatewayWatchCache
+	if singleton.GetCache() != nil {
+		if watchCache, err = getClusterGatewayWatchCache(ctx); err != nil {
+			return nil, err
+		}
+		if page.resourceVersion == 0 && opt.ResourceVersionMatch != metav1.ResourceVersionMatchExact &&
+			len(opt.ResourceVersion) > 0 && opt.ResourceVersion != "0" {
+			if err := watchCache.waitUntilFresh(ctx, parseResourceVersion(opt.ResourceVersion)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var gateways []*ClusterGateway
+	var viewResourceVersion uint64
+	if watchCache != nil {
+		gateways, viewResourceVersion, err = watchCache.list(predicate, page.startName, opt.Limit)
+	} else {
+		gateways, err = listClusterGateways(ctx, predicate, page.startName, opt.Limit)
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	for _, cluster := range clusters.Items {
-		var gwAddon addonv1alpha1.ManagedClusterAddOn
-		err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.AddonName, Namespace: cluster.Name}, &gwAddon)
-		if apierrors.IsNotFound(err) {
-			continue
-		} else if err != nil {
+	if watchCache != nil {
+		if err := checkContinueResourceVersion(page, viewResourceVersion); err != nil {
 			return nil, err
 		}
+	}
+	// the item beyond the limit tells there are more so that the last page
+	// never comes empty
+	hasMore := opt.Limit > 0 && int64(len(gateways)) > opt.Limit
+	if hasMore {
+		gateways = gateways[:opt.Limit]
+	}
+	for _, gw := range gateways {
+		list.Items = append(list.Items, *gw)
+	}
 
-		endpointType := getClusterEndpointType(ctx, cluster.Name)
+	if page.resourceVersion > 0 {
+		list.ResourceVersion = strconv.FormatUint(page.resourceVersion, 10)
+	} else {
+		objs := make([]metav1.Object, 0, len(list.Items))
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+		list.ResourceVersion = compositeResourceVersion(objs...)
+		if watchCache != nil && viewResourceVersion > parseResourceVersion(list.ResourceVersion) {
+			list.ResourceVersion = strconv.FormatUint(viewResourceVersion, 10)
+		}
+		if err := checkListResourceVersion(opt, parseResourceVersion(list.ResourceVersion)); err != nil {
+			return nil, err
+		}
+	}
+	if hasMore {
+		list.Continue, err = encodeClusterGatewayContinue(
+			list.Items[len(list.Items)-1].Name, parseResourceVersion(list.ResourceVersion))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
 
-		var secret v1.Secret
-		err = singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.AddonName, Namespace: cluster.Name}, &secret)
-		if apierrors.IsNotFound(err) {
-			continue
-		} else if err != nil {
+// listClusterGateways converts the ClusterGateways matching the predicate from
+// the input objects in the order of their names starting from startName. At
+// most limit+1 items are returned so that the caller tells whether there are
+// more.
+func listClusterGateways(ctx context.Context, predicate storage.SelectionPredicate, startName string, limit int64) ([]*ClusterGateway, error) {
+	var clusters clusterv1.ManagedClusterList
+	if name, ok := predicate.MatchesSingle(); ok {
+		var cluster clusterv1.ManagedCluster
+		err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: name}, &cluster)
+		if err == nil {
+			clusters.Items = append(clusters.Items, cluster)
+		} else if !apierrors.IsNotFound(err) {
 			return nil, err
 		}
+	} else {
+		listOpts := []client.ListOption{}
+		if !predicate.Label.Empty() {
+			// ClusterGateway inherits the labels of ManagedCluster
+			listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: predicate.Label})
+		}
+		if err := singleton.GetClient().List(ctx, &clusters, listOpts...); err != nil {
+			return nil, err
+		}
+	}
+	if local := config.LocalClusterName; len(local) > 0 {
+		if name, ok := predicate.MatchesSingle(); !ok || name == local {
+			clusters.Items = append(clusters.Items, clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: local}})
+		}
+	}
+	// paging walks through the clusters in the order of their names
+	sort.Slice(clusters.Items, func(i, j int) bool {
+		return clusters.Items[i].Name < clusters.Items[j].Name
+	})
 
-		gw, err := convert(&cluster, &gwAddon, endpointType, &secret)
-		if err != nil {
-			klog.Warningf("skipping %v: failed converting clustergateway resource", secret.Name)
+	var gateways []*ClusterGateway
+	for i, cluster := range clusters.Items {
+		if cluster.Name < startName {
 			continue
 		}
-		list.Items = append(list.Items, *gw)
+		// the local cluster shadows the ManagedCluster of the same name
+		if i > 0 && clusters.Items[i-1].Name == cluster.Name {
+			continue
+		}
+		var gw *ClusterGateway
+		if isLocalCluster(cluster.Name) {
+			gw = newLocalClusterGateway()
+		} else {
+			var err error
+			if gw, err = convertListedCluster(ctx, &clusters.Items[i]); err != nil {
+				return nil, err
+			} else if gw == nil {
+				continue
+			}
+		}
+		if matched, err := predicate.Matches(gw); err != nil {
+			return nil, err
+		} else if !matched {
+			continue
+		}
+		gateways = append(gateways, gw)
+		if limit > 0 && int64(len(gateways)) > limit {
+			break
+		}
 	}
-	return list, nil
+	return gateways, nil
+}
+
+// convertListedCluster converts the ClusterGateway of the listed cluster. The
+// clusters without the gateway addon or the credential secret, or failing the
+// conversion are skipped with nil.
+func convertListedCluster(ctx context.Context, cluster *clusterv1.ManagedCluster) (*ClusterGateway, error) {
+	var gwAddon addonv1alpha1.ManagedClusterAddOn
+	err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.AddonName, Namespace: cluster.Name}, &gwAddon)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	endpointType := getClusterEndpointType(ctx, cluster.Name)
+
+	var secret v1.Secret
+	err = singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.AddonName, Namespace: cluster.Name}, &secret)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	gw, err := convert(cluster, &gwAddon, endpointType, &secret)
+	if err != nil {
+		klog.Warningf("skipping %v: failed converting clustergateway resource", secret.Name)
+		return nil, nil
+	}
+	return gw, nil
 }
 
 func (in *ClusterGateway) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	options, _ := tableOptions.(*metav1.TableOptions)
 	switch object.(type) {
 	case *ClusterGateway:
-		return printClusterGateway(object.(*ClusterGateway)), nil
+		return printClusterGateway(object.(*ClusterGateway), options), nil
 	case *ClusterGatewayList:
-		return printClusterGatewayList(object.(*ClusterGatewayList)), nil
+		return printClusterGatewayList(object.(*ClusterGatewayList), options), nil
 	default:
 		return nil, fmt.Errorf("unknown type %T", object)
 	}
@@ -127,7 +292,7 @@ func getClusterEndpointType(ctx context.Context, clusterName string) ClusterEndp
 	endpointType := ClusterEndpointTypeConst
 	if config.ClusterProxyHost != "" {
 		var proxyAddon addonv1alpha1.ManagedClusterAddOn
-		err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: "cluster-proxy", Namespace: clusterName}, &proxyAddon)
+		err := singleton.GetClient().Get(ctx, types.NamespacedName{Name: common.ClusterProxyAddonName, Namespace: clusterName}, &proxyAddon)
 		if err == nil {
 			for _, cond := range proxyAddon.Status.Conditions {
 				if cond.Type == "Available" && cond.Status == metav1.ConditionTrue {
@@ -148,27 +313,91 @@ func getEndpointFromManagedCluster(cluster *clusterv1.ManagedCluster) ([]byte, s
 	return cfg.CABundle, cfg.URL, nil
 }
 
+// getAlternativeEndpointsFromManagedCluster returns the endpoints listed after
+// the primary one in the ManagedClusterClientConfigs.
+func getAlternativeEndpointsFromManagedCluster(cluster *clusterv1.ManagedCluster) []ClusterEndpointAlternative {
+	var alternatives []ClusterEndpointAlternative
+	for i := 1; i < len(cluster.Spec.ManagedClusterClientConfigs); i++ {
+		cfg := cluster.Spec.ManagedClusterClientConfigs[i]
+		if len(cfg.URL) == 0 {
+			continue
+		}
+		alternatives = append(alternatives, ClusterEndpointAlternative{
+			Address:  cfg.URL,
+			CABundle: cfg.CABundle,
+		})
+	}
+	return alternatives
+}
+
 func convert(cluster *clusterv1.ManagedCluster, gwAddon *addonv1alpha1.ManagedClusterAddOn, endpointType ClusterEndpointType, secret *v1.Secret) (*ClusterGateway, error) {
 	caData, apiServerEndpoint, err := getEndpointFromManagedCluster(cluster)
 	if err != nil {
 		return nil, err
 	}
-	insecure := len(caData) == 0
+	// the addon may override the endpoint of the ManagedCluster
+	if address := gwAddon.Annotations[common.AnnotationKeyClusterGatewayEndpointAddress]; len(address) > 0 {
+		apiServerEndpoint = address
+	}
+	if caBundle, ok := gwAddon.Annotations[common.AnnotationKeyClusterGatewayEndpointCABundle]; ok {
+		caData = []byte(caBundle)
+	}
+	// the endpoint without CA bundle is verified by the CA pinned on the
+	// first contact of the same address unless it's allowed to be requested
+	// insecurely
+	if len(caData) == 0 && isPinnedCAFor(gwAddon, apiServerEndpoint) && !config.AllowInsecureEndpoints {
+		caData = []byte(gwAddon.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle])
+	}
+	insecure := len(caData) == 0 && config.AllowInsecureEndpoints
 
 	c := &ClusterGateway{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              cluster.Name,
+			UID:               cluster.UID,
+			Generation:        cluster.Generation,
 			CreationTimestamp: cluster.CreationTimestamp,
+			ResourceVersion:   compositeResourceVersion(cluster, gwAddon, secret),
+			Annotations:       selectClusterAnnotations(cluster.Annotations),
 		},
 	}
+	if len(cluster.Labels) > 0 {
+		c.Labels = make(map[string]string, len(cluster.Labels))
+		for k, v := range cluster.Labels {
+			c.Labels[k] = v
+		}
+	}
 
 	// converting endpoint
 	var proxyURL *string
 	if url, useProxy := gwAddon.Annotations["proxy-url"]; useProxy && len(url) > 0 {
 		proxyURL = pointer.String(url)
 	}
+	var egressProxy *ClusterEndpointEgressProxy
+	if raw := gwAddon.Annotations[common.AnnotationKeyClusterGatewayEgressProxy]; len(raw) > 0 {
+		egressProxy = &ClusterEndpointEgressProxy{}
+		if err := json.Unmarshal([]byte(raw), egressProxy); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing egress proxy of cluster %s", cluster.Name)
+		}
+	}
+	// the endpoint type pinned by the addon overrides the one observed from
+	// the cluster-proxy addon
+	if pinned := ClusterEndpointType(gwAddon.Annotations[common.AnnotationKeyClusterGatewayEndpointType]); pinned == ClusterEndpointTypeConst ||
+		pinned == ClusterEndpointTypeClusterProxy && config.ClusterProxyHost != "" {
+		endpointType = pinned
+	}
+	// the SSH bastion prescribed by the secret, the reverse tunnel opted in
+	// by the addon or the downstream ClusterGateway prescribed by the addon
+	// overrides the endpoint type
+	downstreamCluster := gwAddon.Annotations[common.AnnotationKeyClusterGatewayDownstreamCluster]
+	if _, ok := secret.Data[common.SecretKeySSHBastionHost]; ok {
+		endpointType = ClusterEndpointTypeSSHBastion
+	} else if gwAddon.Annotations[common.AnnotationKeyClusterGatewayReverseTunnel] == "true" {
+		endpointType = ClusterEndpointTypeReverseTunnel
+	} else if len(downstreamCluster) > 0 {
+		endpointType = ClusterEndpointTypeClusterGateway
+	}
 	switch endpointType {
-	case ClusterEndpointTypeClusterProxy:
+	case ClusterEndpointTypeClusterProxy, ClusterEndpointTypeReverseTunnel:
 		c.Spec.Access.Endpoint = &ClusterEndpoint{
 			Type: endpointType,
 		}
@@ -180,24 +409,136 @@ func convert(cluster *clusterv1.ManagedCluster, gwAddon *addonv1alpha1.ManagedCl
 			c.Spec.Access.Endpoint = &ClusterEndpoint{
 				Type: endpointType,
 				Const: &ClusterEndpointConst{
-					Address:  apiServerEndpoint,
-					Insecure: &insecure,
-					ProxyURL: proxyURL,
+					Address:      apiServerEndpoint,
+					Insecure:     &insecure,
+					ProxyURL:     proxyURL,
+					EgressProxy:  egressProxy,
+					Alternatives: getAlternativeEndpointsFromManagedCluster(cluster),
 				},
 			}
 		} else {
 			c.Spec.Access.Endpoint = &ClusterEndpoint{
 				Type: endpointType,
 				Const: &ClusterEndpointConst{
-					Address:  apiServerEndpoint,
-					CABundle: caData,
-					ProxyURL: proxyURL,
+					Address:      apiServerEndpoint,
+					CABundle:     caData,
+					ProxyURL:     proxyURL,
+					EgressProxy:  egressProxy,
+					Alternatives: getAlternativeEndpointsFromManagedCluster(cluster),
 				},
 			}
 		}
+	case ClusterEndpointTypeSSHBastion:
+		if len(apiServerEndpoint) == 0 {
+			return nil, errors.New("missing label key: api-endpoint")
+		}
+		c.Spec.Access.Endpoint = &ClusterEndpoint{
+			Type: endpointType,
+			Const: &ClusterEndpointConst{
+				Address: apiServerEndpoint,
+			},
+			SSHBastion: &ClusterEndpointSSHBastion{
+				Host:       string(secret.Data[common.SecretKeySSHBastionHost]),
+				User:       string(secret.Data[common.SecretKeySSHBastionUser]),
+				KnownHosts: secret.Data[common.SecretKeySSHBastionKnownHosts],
+				PrivateKey: secret.Data[common.SecretKeySSHBastionPrivateKey],
+			},
+		}
+		if insecure {
+			c.Spec.Access.Endpoint.Const.Insecure = &insecure
+		} else {
+			c.Spec.Access.Endpoint.Const.CABundle = caData
+		}
+	case ClusterEndpointTypeClusterGateway:
+		if len(apiServerEndpoint) == 0 {
+			return nil, errors.New("missing label key: api-endpoint")
+		}
+		c.Spec.Access.Endpoint = &ClusterEndpoint{
+			Type: endpointType,
+			Const: &ClusterEndpointConst{
+				Address: apiServerEndpoint,
+			},
+			ClusterGateway: &ClusterEndpointClusterGateway{
+				Cluster: downstreamCluster,
+			},
+		}
+		if insecure {
+			c.Spec.Access.Endpoint.Const.Insecure = &insecure
+		} else {
+			c.Spec.Access.Endpoint.Const.CABundle = caData
+		}
+	}
+	fallback := ClusterEndpointType(gwAddon.Annotations[common.AnnotationKeyClusterGatewayEndpointFallback])
+	switch {
+	case endpointType == ClusterEndpointTypeConst && fallback == ClusterEndpointTypeClusterProxy && config.ClusterProxyHost != "":
+		c.Spec.Access.Endpoint.Fallback = fallback
+	case endpointType == ClusterEndpointTypeClusterProxy && fallback == ClusterEndpointTypeConst && len(apiServerEndpoint) > 0:
+		c.Spec.Access.Endpoint.Fallback = fallback
+		c.Spec.Access.Endpoint.Const = &ClusterEndpointConst{
+			Address:      apiServerEndpoint,
+			ProxyURL:     proxyURL,
+			EgressProxy:  egressProxy,
+			Alternatives: getAlternativeEndpointsFromManagedCluster(cluster),
+		}
+		if insecure {
+			c.Spec.Access.Endpoint.Const.Insecure = &insecure
+		} else {
+			c.Spec.Access.Endpoint.Const.CABundle = caData
+		}
+	}
+	// the status reports the fallback serving the requests
+	if c.Spec.Access.Endpoint != nil && len(c.Spec.Access.Endpoint.Fallback) > 0 {
+		c.Status.ActiveEndpointType = c.Spec.Access.Endpoint.Type
+		if ClusterEndpointType(gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusActiveEndpointType]) == fallback {
+			c.Status.ActiveEndpointType = fallback
+		}
 	}
 
 	// converting credential
+	credential, err := convertClusterAccessCredential(secret)
+	if err != nil {
+		return nil, err
+	}
+	c.Spec.Access.Credential = credential
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.HealthinessCheck) {
+		if healthyRaw, ok := gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusHealthy]; ok {
+			healthy, err := strconv.ParseBool(healthyRaw)
+			if err != nil {
+				return nil, fmt.Errorf("unrecogized healthiness status: %v", healthyRaw)
+			}
+			c.Status.Healthy = healthy
+		}
+		if healthyReason, ok := gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusHealthyReason]; ok {
+			c.Status.HealthyReason = HealthyReasonType(healthyReason)
+		}
+		if conditions, err := decodeClusterGatewayConditions(gwAddon.Annotations); err != nil {
+			klog.Warningf("Ignoring unrecognized conditions of cluster %q: %v", c.Name, err)
+		} else if len(conditions) > 0 {
+			c.Status.Conditions = conditions
+			c.Status.Healthy, c.Status.HealthyReason = GetClusterGatewayHealthiness(conditions)
+		}
+	}
+
+	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
+		if proxyConfigRaw, ok := gwAddon.Annotations[AnnotationClusterGatewayProxyConfiguration]; ok {
+			proxyConfig := &ClusterGatewayProxyConfiguration{}
+			if err := yaml.Unmarshal([]byte(proxyConfigRaw), proxyConfig); err == nil {
+				for _, rule := range proxyConfig.Spec.Rules {
+					rule.Source.Cluster = pointer.String(c.Name)
+				}
+				c.Spec.ProxyConfig = proxyConfig
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// convertClusterAccessCredential converts the credential stored in the secret,
+// which is either the secret of the ClusterGateway or a credential profile.
+func convertClusterAccessCredential(secret *v1.Secret) (*ClusterAccessCredential, error) {
+	var credential *ClusterAccessCredential
 	credentialType, ok := secret.Labels[common.LabelKeyClusterCredentialType]
 	if !ok {
 		if secret.Labels[common.LabelKeyIsManagedServiceAccount] != "true" {
@@ -210,7 +551,7 @@ func convert(cluster *clusterv1.ManagedCluster, gwAddon *addonv1alpha1.ManagedCl
 	}
 	switch CredentialType(credentialType) {
 	case CredentialTypeX509Certificate:
-		c.Spec.Access.Credential = &ClusterAccessCredential{
+		credential = &ClusterAccessCredential{
 			Type: CredentialTypeX509Certificate,
 			X509: &X509{
 				Certificate: secret.Data[v1.TLSCertKey],
@@ -218,38 +559,55 @@ func convert(cluster *clusterv1.ManagedCluster, gwAddon *addonv1alpha1.ManagedCl
 			},
 		}
 	case CredentialTypeServiceAccountToken:
-		c.Spec.Access.Credential = &ClusterAccessCredential{
+		credential = &ClusterAccessCredential{
 			Type:                CredentialTypeServiceAccountToken,
 			ServiceAccountToken: string(secret.Data[v1.ServiceAccountTokenKey]),
 		}
+	case CredentialTypeExec:
+		execConfig := &ExecConfig{}
+		if err := yaml.Unmarshal(secret.Data[common.SecretKeyClusterCredentialExec], execConfig); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing exec config of secret %s/%s", secret.Namespace, secret.Name)
+		}
+		credential = &ClusterAccessCredential{
+			Type: CredentialTypeExec,
+			Exec: execConfig,
+		}
+	case CredentialTypeOIDCClientCredentials:
+		credential = &ClusterAccessCredential{
+			Type: CredentialTypeOIDCClientCredentials,
+			OIDC: &OIDCClientCredentials{
+				IssuerURL:    string(secret.Data[common.SecretKeyClusterCredentialOIDCIssuerURL]),
+				ClientID:     string(secret.Data[common.SecretKeyClusterCredentialOIDCClientID]),
+				ClientSecret: string(secret.Data[common.SecretKeyClusterCredentialOIDCClientSecret]),
+				Scopes:       strings.Fields(string(secret.Data[common.SecretKeyClusterCredentialOIDCScopes])),
+			},
+		}
 	default:
 		return nil, fmt.Errorf("unrecognized secret credential type %v", credentialType)
 	}
-
-	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.HealthinessCheck) {
-		if healthyRaw, ok := gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusHealthy]; ok {
-			healthy, err := strconv.ParseBool(healthyRaw)
-			if err != nil {
-				return nil, fmt.Errorf("unrecogized healthiness status: %v", healthyRaw)
-			}
-			c.Status.Healthy = healthy
-		}
-		if healthyReason, ok := gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusHealthyReason]; ok {
-			c.Status.HealthyReason = HealthyReasonType(healthyReason)
+	if tokenRequestRaw, ok := secret.Annotations[common.AnnotationKeyClusterCredentialTokenRequest]; ok {
+		tokenRequest := &TokenRequestConfig{}
+		if err := yaml.Unmarshal([]byte(tokenRequestRaw), tokenRequest); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing token request config of secret %s/%s", secret.Namespace, secret.Name)
 		}
+		credential.TokenRequest = tokenRequest
 	}
+	return credential, nil
+}
 
-	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
-		if proxyConfigRaw, ok := gwAddon.Annotations[AnnotationClusterGatewayProxyConfiguration]; ok {
-			proxyConfig := &ClusterGatewayProxyConfiguration{}
-			if err := yaml.Unmarshal([]byte(proxyConfigRaw), proxyConfig); err == nil {
-				for _, rule := range proxyConfig.Spec.Rules {
-					rule.Source.Cluster = pointer.String(c.Name)
-				}
-				c.Spec.ProxyConfig = proxyConfig
-			}
+// compositeResourceVersion returns the newest resourceVersion among the given
+// objects. ManagedCluster, ManagedClusterAddOn and Secret share the etcd of the
+// hub cluster, so an update to any of them always produces a greater value and
+// the same set of objects always yields the same resourceVersion.
+func compositeResourceVersion(objs ...metav1.Object) string {
+	var latest uint64
+	for _, obj := range objs {
+		if rv, err := strconv.ParseUint(obj.GetResourceVersion(), 10, 64); err == nil && rv > latest {
+			latest = rv
 		}
 	}
-
-	return c, nil
+	if latest == 0 {
+		return ""
+	}
+	return strconv.FormatUint(latest, 10)
 }
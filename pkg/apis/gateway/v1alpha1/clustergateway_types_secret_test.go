@@ -5,13 +5,17 @@ import (
 	"testing"
 
 	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
 	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/utils/pointer"
@@ -90,13 +94,14 @@ func x509Credential() *ClusterAccessCredential {
 
 func TestConvert(t *testing.T) {
 	cases := []struct {
-		name            string
-		cluster         *clusterv1.ManagedCluster
-		gwAddon         *addonv1alpha1.ManagedClusterAddOn
-		endpointType    ClusterEndpointType
-		secret          *corev1.Secret
-		expectedFailure bool
-		expected        *ClusterGateway
+		name                   string
+		allowInsecureEndpoints bool
+		cluster                *clusterv1.ManagedCluster
+		gwAddon                *addonv1alpha1.ManagedClusterAddOn
+		endpointType           ClusterEndpointType
+		secret                 *corev1.Secret
+		expectedFailure        bool
+		expected               *ClusterGateway
 	}{
 		{
 			name:         "x509 certificate, const endpoint",
@@ -164,11 +169,83 @@ func TestConvert(t *testing.T) {
 			},
 		},
 		{
-			name:         "missing CA bundle yields an insecure const endpoint",
+			name:         "missing CA bundle is left to the discovery",
 			cluster:      managedCluster(testClusterName, testEndpoint, nil),
 			gwAddon:      gatewayAddon(testClusterName, nil),
 			endpointType: ClusterEndpointTypeConst,
 			secret:       credentialSecret(testClusterName, x509Labels, x509Data),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: x509Credential(),
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address: testEndpoint,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "missing CA bundle is verified by the pinned CA",
+			cluster: managedCluster(testClusterName, testEndpoint, nil),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayPinnedCABundle: testCAData,
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, x509Labels, x509Data),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: x509Credential(),
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "CA pinned for another address is never applied",
+			cluster: managedCluster(testClusterName, testEndpoint, nil),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayPinnedCABundle:  testCAData,
+				common.AnnotationKeyClusterGatewayPinnedCAAddress: "https://moved.example.com",
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, x509Labels, x509Data),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: x509Credential(),
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address: testEndpoint,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:                   "missing CA bundle yields an insecure const endpoint if allowed",
+			allowInsecureEndpoints: true,
+			cluster:                managedCluster(testClusterName, testEndpoint, nil),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayPinnedCABundle: testCAData,
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, x509Labels, x509Data),
 			expected: &ClusterGateway{
 				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
 				Spec: ClusterGatewaySpec{
@@ -237,6 +314,38 @@ func TestConvert(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "multiple client configs, const endpoint with alternatives",
+			cluster: func() *clusterv1.ManagedCluster {
+				cluster := managedCluster(testClusterName, testEndpoint, []byte(testCAData))
+				cluster.Spec.ManagedClusterClientConfigs = append(cluster.Spec.ManagedClusterClientConfigs,
+					clusterv1.ClientConfig{URL: "https://backup:6443", CABundle: []byte("backupCAData")},
+					clusterv1.ClientConfig{URL: "https://10.0.0.1:6443"})
+				return cluster
+			}(),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, x509Labels, x509Data),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: x509Credential(),
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+								Alternatives: []ClusterEndpointAlternative{
+									{Address: "https://backup:6443", CABundle: []byte("backupCAData")},
+									{Address: "https://10.0.0.1:6443"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name:            "missing credential type label fails",
 			cluster:         managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
@@ -245,6 +354,386 @@ func TestConvert(t *testing.T) {
 			secret:          credentialSecret(testClusterName, nil, nil),
 			expectedFailure: true,
 		},
+		{
+			name:         "exec plugin, const endpoint",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeConst,
+			secret: credentialSecret(testClusterName,
+				map[string]string{common.LabelKeyClusterCredentialType: string(CredentialTypeExec)},
+				map[string][]byte{common.SecretKeyClusterCredentialExec: []byte("command: /usr/local/bin/aws\nargs: [eks, get-token]\nenv:\n- name: AWS_REGION\n  value: us-east-1\n")}),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type: CredentialTypeExec,
+							Exec: &ExecConfig{
+								Command: "/usr/local/bin/aws",
+								Args:    []string{"eks", "get-token"},
+								Env:     []ExecEnvVar{{Name: "AWS_REGION", Value: "us-east-1"}},
+							},
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "oidc client credentials, cluster-proxy endpoint",
+			cluster:      managedCluster(testClusterName, "", nil),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret: credentialSecret(testClusterName,
+				map[string]string{common.LabelKeyClusterCredentialType: string(CredentialTypeOIDCClientCredentials)},
+				map[string][]byte{
+					common.SecretKeyClusterCredentialOIDCIssuerURL:    []byte("https://issuer.example.com"),
+					common.SecretKeyClusterCredentialOIDCClientID:     []byte("foo"),
+					common.SecretKeyClusterCredentialOIDCClientSecret: []byte("bar"),
+					common.SecretKeyClusterCredentialOIDCScopes:       []byte("openid  k8s"),
+				}),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type: CredentialTypeOIDCClientCredentials,
+							OIDC: &OIDCClientCredentials{
+								IssuerURL:    "https://issuer.example.com",
+								ClientID:     "foo",
+								ClientSecret: "bar",
+								Scopes:       []string{"openid", "k8s"},
+							},
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterProxy,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "token request annotation opts in minting tokens",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeConst,
+			secret: func() *corev1.Secret {
+				secret := credentialSecret(testClusterName, tokenLabels, tokenData)
+				secret.Annotations = map[string]string{
+					common.AnnotationKeyClusterCredentialTokenRequest: `{"serviceAccountNamespace":"foo","serviceAccountName":"bar","audiences":["gateway"],"expirationSeconds":1800}`,
+				}
+				return secret
+			}(),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+							TokenRequest: &TokenRequestConfig{
+								ServiceAccountNamespace: "foo",
+								ServiceAccountName:      "bar",
+								Audiences:               []string{"gateway"},
+								ExpirationSeconds:       pointer.Int64(1800),
+							},
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "ssh bastion in the secret overrides the endpoint type",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret: credentialSecret(testClusterName, tokenLabels, map[string][]byte{
+				corev1.ServiceAccountTokenKey:        []byte(testToken),
+				common.SecretKeySSHBastionHost:       []byte("bastion.example.com"),
+				common.SecretKeySSHBastionUser:       []byte("gateway"),
+				common.SecretKeySSHBastionPrivateKey: []byte("private-key"),
+				common.SecretKeySSHBastionKnownHosts: []byte("known-hosts"),
+			}),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeSSHBastion,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+							SSHBastion: &ClusterEndpointSSHBastion{
+								Host:       "bastion.example.com",
+								User:       "gateway",
+								PrivateKey: []byte("private-key"),
+								KnownHosts: []byte("known-hosts"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "reverse tunnel opted in by the addon overrides the endpoint type",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, map[string]string{common.AnnotationKeyClusterGatewayReverseTunnel: "true"}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeReverseTunnel,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:         "downstream cluster gateway prescribed by the addon overrides the endpoint type",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, map[string]string{common.AnnotationKeyClusterGatewayDownstreamCluster: "remote"}),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterGateway,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+							ClusterGateway: &ClusterEndpointClusterGateway{
+								Cluster: "remote",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "endpoint type pinned by the addon overrides the observed one",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEndpointType: string(ClusterEndpointTypeConst),
+			}),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "endpoint overridden by the addon",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEndpointAddress:  "https://override.example.com",
+				common.AnnotationKeyClusterGatewayEndpointCABundle: "override-ca",
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  "https://override.example.com",
+								CABundle: []byte("override-ca"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "cluster-proxy endpoint falling back to const endpoint",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEndpointFallback: string(ClusterEndpointTypeConst),
+			}),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterProxy,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+							Fallback: ClusterEndpointTypeConst,
+						},
+					},
+				},
+				Status: ClusterGatewayStatus{ActiveEndpointType: ClusterEndpointTypeClusterProxy},
+			},
+		},
+		{
+			name:    "cluster-proxy endpoint fallen back to const endpoint",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEndpointFallback:         string(ClusterEndpointTypeConst),
+				common.AnnotationKeyClusterGatewayStatusActiveEndpointType: string(ClusterEndpointTypeConst),
+			}),
+			endpointType: ClusterEndpointTypeClusterProxy,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterProxy,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+							Fallback: ClusterEndpointTypeConst,
+						},
+					},
+				},
+				Status: ClusterGatewayStatus{ActiveEndpointType: ClusterEndpointTypeConst},
+			},
+		},
+		{
+			name:    "unsupported fallback is ignored",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEndpointFallback: string(ClusterEndpointTypeConst),
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "egress proxy prescribed by the addon",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEgressProxy: `{"url":"socks5://proxy:1080","credentialSecretRef":{"name":"cluster-gateway-egress-proxy"},"noProxy":[".svc"]}`,
+			}),
+			endpointType: ClusterEndpointTypeConst,
+			secret:       credentialSecret(testClusterName, tokenLabels, tokenData),
+			expected: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{Name: testClusterName},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeConst,
+							Const: &ClusterEndpointConst{
+								Address:  testEndpoint,
+								CABundle: []byte(testCAData),
+								EgressProxy: &ClusterEndpointEgressProxy{
+									URL:                 "socks5://proxy:1080",
+									CredentialSecretRef: &EgressProxyCredentialSecretReference{Name: common.SecretNameEgressProxyCredential},
+									NoProxy:             []string{".svc"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "malformed egress proxy fails",
+			cluster: managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon: gatewayAddon(testClusterName, map[string]string{
+				common.AnnotationKeyClusterGatewayEgressProxy: "{",
+			}),
+			endpointType:    ClusterEndpointTypeConst,
+			secret:          credentialSecret(testClusterName, tokenLabels, tokenData),
+			expectedFailure: true,
+		},
+		{
+			name:         "malformed exec config fails",
+			cluster:      managedCluster(testClusterName, testEndpoint, []byte(testCAData)),
+			gwAddon:      gatewayAddon(testClusterName, nil),
+			endpointType: ClusterEndpointTypeConst,
+			secret: credentialSecret(testClusterName,
+				map[string]string{common.LabelKeyClusterCredentialType: string(CredentialTypeExec)},
+				map[string][]byte{common.SecretKeyClusterCredentialExec: []byte("[")}),
+			expectedFailure: true,
+		},
 		{
 			name:            "const endpoint without an api server address fails",
 			cluster:         managedCluster(testClusterName, "", nil),
@@ -256,6 +745,8 @@ func TestConvert(t *testing.T) {
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
+			config.AllowInsecureEndpoints = c.allowInsecureEndpoints
+			defer func() { config.AllowInsecureEndpoints = false }()
 			gw, err := convert(c.cluster, c.gwAddon, c.endpointType, c.secret)
 			if c.expectedFailure {
 				assert.Error(t, err)
@@ -303,3 +794,207 @@ func TestListHybridClusterGateway(t *testing.T) {
 	}
 	assert.Equal(t, sets.NewString("cluster-a", "cluster-b"), actualNames)
 }
+
+func TestListClusterGatewayWithSelectors(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	clusterA := managedCluster("cluster-a", testEndpoint, []byte(testCAData))
+	clusterA.Labels = map[string]string{"env": "prod"}
+	clusterA.Annotations = map[string]string{
+		"example.com/owner":   "team-a",
+		"example.com/region":  "us-east",
+		"unrelated/annotated": "true",
+	}
+	clusterB := managedCluster("cluster-b", testEndpoint, []byte(testCAData))
+	clusterB.Labels = map[string]string{"env": "dev"}
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		clusterA,
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+		clusterB,
+		gatewayAddon("cluster-b", nil),
+		credentialSecret("cluster-b", tokenLabels, tokenData),
+	).Build()
+	singleton.SetClient(fakeClient)
+
+	config.PropagatedClusterAnnotations = []string{"example.com/"}
+	defer func() { config.PropagatedClusterAnnotations = nil }()
+
+	cases := []struct {
+		name          string
+		labelSelector string
+		fieldSelector string
+		expected      sets.String
+		expectedErr   bool
+	}{
+		{name: "everything", expected: sets.NewString("cluster-a", "cluster-b")},
+		{name: "label selector", labelSelector: "env=prod", expected: sets.NewString("cluster-a")},
+		{name: "name field selector", fieldSelector: "metadata.name=cluster-b", expected: sets.NewString("cluster-b")},
+		{name: "name field selector not found", fieldSelector: "metadata.name=cluster-c", expected: sets.NewString()},
+		{
+			name:          "credential type field selector",
+			fieldSelector: "spec.access.credential.type=" + string(CredentialTypeServiceAccountToken),
+			expected:      sets.NewString("cluster-b"),
+		},
+		{
+			name:          "label and field selectors",
+			labelSelector: "env=prod",
+			fieldSelector: "spec.access.credential.type=" + string(CredentialTypeServiceAccountToken),
+			expected:      sets.NewString(),
+		},
+		{name: "unsupported field selector", fieldSelector: "spec.foo=bar", expectedErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opt := &internalversion.ListOptions{}
+			if c.labelSelector != "" {
+				selector, err := labels.Parse(c.labelSelector)
+				require.NoError(t, err)
+				opt.LabelSelector = selector
+			}
+			if c.fieldSelector != "" {
+				selector, err := fields.ParseSelector(c.fieldSelector)
+				require.NoError(t, err)
+				opt.FieldSelector = selector
+			}
+			out, err := (&ClusterGateway{}).List(context.TODO(), opt)
+			if c.expectedErr {
+				assert.True(t, apierrors.IsBadRequest(err))
+				return
+			}
+			require.NoError(t, err)
+			actualNames := sets.NewString()
+			for _, gw := range out.(*ClusterGatewayList).Items {
+				actualNames.Insert(gw.Name)
+				if gw.Name == "cluster-a" {
+					assert.Equal(t, map[string]string{"env": "prod"}, gw.Labels)
+					assert.Equal(t, map[string]string{
+						"example.com/owner":  "team-a",
+						"example.com/region": "us-east",
+					}, gw.Annotations)
+				}
+			}
+			assert.Equal(t, c.expected, actualNames)
+		})
+	}
+}
+
+func TestListClusterGatewayPagination(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	objs := []client.Object{
+		// cluster-c has no gateway addon and is skipped across pages.
+		managedCluster("cluster-c", testEndpoint, []byte(testCAData)),
+	}
+	for _, name := range []string{"cluster-e", "cluster-a", "cluster-d", "cluster-b"} {
+		objs = append(objs,
+			managedCluster(name, testEndpoint, []byte(testCAData)),
+			gatewayAddon(name, nil),
+			credentialSecret(name, x509Labels, x509Data))
+	}
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	singleton.SetClient(fakeClient)
+	storage := &ClusterGateway{}
+
+	var names []string
+	var firstRV string
+	opt := &internalversion.ListOptions{Limit: 3}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3, "too many pages")
+		out, err := storage.List(context.TODO(), opt)
+		require.NoError(t, err)
+		list := out.(*ClusterGatewayList)
+		if firstRV == "" {
+			firstRV = list.ResourceVersion
+		}
+		assert.Equal(t, firstRV, list.ResourceVersion, "resourceVersion changed across pages")
+		for _, gw := range list.Items {
+			names = append(names, gw.Name)
+		}
+		if list.Continue == "" {
+			break
+		}
+		opt = &internalversion.ListOptions{Limit: 3, Continue: list.Continue}
+	}
+	assert.Equal(t, []string{"cluster-a", "cluster-b", "cluster-d", "cluster-e"}, names)
+
+	// exactly filled pages come without a continue token
+	out, err := storage.List(context.TODO(), &internalversion.ListOptions{Limit: 4})
+	require.NoError(t, err)
+	assert.Len(t, out.(*ClusterGatewayList).Items, 4)
+	assert.Empty(t, out.(*ClusterGatewayList).Continue)
+	currentRV := out.(*ClusterGatewayList).ResourceVersion
+
+	cases := []struct {
+		name        string
+		opt         *internalversion.ListOptions
+		expectedErr func(error) bool
+	}{
+		{
+			name:        "malformed continue token",
+			opt:         &internalversion.ListOptions{Continue: "foo"},
+			expectedErr: apierrors.IsBadRequest,
+		},
+		{
+			name:        "resourceVersion with continue token",
+			opt:         &internalversion.ListOptions{Continue: opt.Continue, ResourceVersion: currentRV},
+			expectedErr: apierrors.IsBadRequest,
+		},
+		{
+			name:        "resourceVersionMatch without resourceVersion",
+			opt:         &internalversion.ListOptions{ResourceVersionMatch: metav1.ResourceVersionMatchExact},
+			expectedErr: apierrors.IsInvalid,
+		},
+		{
+			name:        "negative limit",
+			opt:         &internalversion.ListOptions{Limit: -1},
+			expectedErr: apierrors.IsBadRequest,
+		},
+		{
+			name: "exact resourceVersion",
+			opt: &internalversion.ListOptions{
+				ResourceVersion:      currentRV,
+				ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+			},
+		},
+		{
+			name: "exact resourceVersion too old",
+			opt: &internalversion.ListOptions{
+				ResourceVersion:      "1",
+				ResourceVersionMatch: metav1.ResourceVersionMatchExact,
+			},
+			expectedErr: apierrors.IsResourceExpired,
+		},
+		{
+			name: "not older than an old resourceVersion",
+			opt: &internalversion.ListOptions{
+				ResourceVersion:      "1",
+				ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+			},
+		},
+		{
+			name: "not older than a future resourceVersion",
+			opt: &internalversion.ListOptions{
+				ResourceVersion:      "100000",
+				ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+			},
+			expectedErr: apierrors.IsTimeout,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := storage.List(context.TODO(), c.opt)
+			if c.expectedErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, c.expectedErr(err), "unexpected error: %v", err)
+		})
+	}
+}
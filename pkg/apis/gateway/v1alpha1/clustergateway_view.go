@@ -0,0 +1,127 @@
+package v1alpha1
+
+import (
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/storage"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+// The watch cache doubles as the materialized view of ClusterGateway serving
+// the get, list and proxy requests, so that the hot path neither re-converts
+// the ClusterGateway nor reads the input objects.
+
+// clusterGatewayIndexedFields are the field selectors indexed by the view.
+var clusterGatewayIndexedFields = []string{
+	FieldSelectorEndpointType,
+	FieldSelectorCredentialType,
+}
+
+// set stores the converted ClusterGateway and must be called with the cache
+// locked. The stored objects are never mutated.
+func (c *clusterGatewayWatchCache) set(gw *ClusterGateway) {
+	if _, ok := c.gateways[gw.Name]; ok {
+		c.unindex(gw.Name)
+	} else {
+		i := sort.SearchStrings(c.names, gw.Name)
+		c.names = append(c.names, "")
+		copy(c.names[i+1:], c.names[i:])
+		c.names[i] = gw.Name
+	}
+	c.gateways[gw.Name] = gw
+	delete(c.failures, gw.Name)
+	_, fieldSet, _ := GetClusterGatewayAttrs(gw)
+	for _, field := range clusterGatewayIndexedFields {
+		values, ok := c.index[field]
+		if !ok {
+			values = make(map[string]sets.Set[string])
+			c.index[field] = values
+		}
+		if _, ok := values[fieldSet[field]]; !ok {
+			values[fieldSet[field]] = sets.New[string]()
+		}
+		values[fieldSet[field]].Insert(gw.Name)
+	}
+}
+
+// unset removes the ClusterGateway and must be called with the cache locked.
+func (c *clusterGatewayWatchCache) unset(name string) {
+	if _, ok := c.gateways[name]; !ok {
+		return
+	}
+	c.unindex(name)
+	delete(c.gateways, name)
+	if i := sort.SearchStrings(c.names, name); i < len(c.names) && c.names[i] == name {
+		c.names = append(c.names[:i], c.names[i+1:]...)
+	}
+}
+
+func (c *clusterGatewayWatchCache) unindex(name string) {
+	_, fieldSet, _ := GetClusterGatewayAttrs(c.gateways[name])
+	for _, field := range clusterGatewayIndexedFields {
+		if names, ok := c.index[field][fieldSet[field]]; ok {
+			names.Delete(name)
+			if names.Len() == 0 {
+				delete(c.index[field], fieldSet[field])
+			}
+		}
+	}
+}
+
+// get returns a copy of the ClusterGateway. A cluster failing the conversion
+// yields the conversion error.
+func (c *clusterGatewayWatchCache) get(name string) (*ClusterGateway, error) {
+	c.Lock()
+	defer c.Unlock()
+	if gw, ok := c.gateways[name]; ok {
+		return gw.DeepCopy(), nil
+	}
+	if err, ok := c.failures[name]; ok {
+		return nil, err
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{
+		Group:    config.MetaApiGroupName,
+		Resource: config.MetaApiResourceName,
+	}, name)
+}
+
+// list returns the copies of the ClusterGateways matching the predicate in
+// the order of their names starting from startName, along with the
+// resourceVersion of the view. At most limit+1 items are returned so that
+// the caller tells whether there are more.
+func (c *clusterGatewayWatchCache) list(predicate storage.SelectionPredicate, startName string, limit int64) ([]*ClusterGateway, uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	names := c.names
+	if name, ok := predicate.MatchesSingle(); ok {
+		names = []string{name}
+	} else {
+		for _, field := range clusterGatewayIndexedFields {
+			if value, ok := predicate.Field.RequiresExactMatch(field); ok {
+				names = sets.List(c.index[field][value])
+				break
+			}
+		}
+	}
+	var gateways []*ClusterGateway
+	for i := sort.SearchStrings(names, startName); i < len(names); i++ {
+		gw, ok := c.gateways[names[i]]
+		if !ok {
+			continue
+		}
+		if matched, err := predicate.Matches(gw); err != nil {
+			return nil, 0, err
+		} else if !matched {
+			continue
+		}
+		gateways = append(gateways, gw.DeepCopy())
+		if limit > 0 && int64(len(gateways)) > limit {
+			break
+		}
+	}
+	return gateways, c.advertise(), nil
+}
@@ -0,0 +1,163 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestClusterGatewayView(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	execLabels := map[string]string{common.LabelKeyClusterCredentialType: string(CredentialTypeExec)}
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+		managedCluster("cluster-b", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-b", nil),
+		credentialSecret("cluster-b", tokenLabels, tokenData),
+		managedCluster("cluster-c", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-c", nil),
+		credentialSecret("cluster-c", x509Labels, x509Data),
+		// cluster-d fails the conversion upon the malformed exec config
+		managedCluster("cluster-d", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-d", nil),
+		credentialSecret("cluster-d", execLabels, map[string][]byte{common.SecretKeyClusterCredentialExec: []byte("[")}),
+	).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	view, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+
+	// the view serves without reading the input objects
+	var reads int
+	countingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			reads++
+			return c.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			reads++
+			return c.List(ctx, list, opts...)
+		},
+	})
+	singleton.SetClient(countingClient)
+	defer singleton.SetClient(fakeClient)
+
+	t.Run("get", func(t *testing.T) {
+		gw, err := view.get("cluster-a")
+		require.NoError(t, err)
+		assert.Equal(t, CredentialTypeX509Certificate, gw.Spec.Access.Credential.Type)
+		// the returned object is a copy
+		gw.Spec.Access.Credential.Type = CredentialTypeServiceAccountToken
+		gw, err = view.get("cluster-a")
+		require.NoError(t, err)
+		assert.Equal(t, CredentialTypeX509Certificate, gw.Spec.Access.Credential.Type)
+
+		_, err = view.get("cluster-d")
+		assert.Error(t, err)
+		assert.False(t, apierrors.IsNotFound(err))
+
+		_, err = view.get("cluster-e")
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		names := func(gateways []*ClusterGateway) []string {
+			var names []string
+			for _, gw := range gateways {
+				names = append(names, gw.Name)
+			}
+			return names
+		}
+		predicate, err := newClusterGatewayPredicate(&internalversion.ListOptions{})
+		require.NoError(t, err)
+		gateways, _, err := view.list(predicate, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cluster-a", "cluster-b", "cluster-c"}, names(gateways))
+
+		gateways, _, err = view.list(predicate, "cluster-b", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cluster-b", "cluster-c"}, names(gateways))
+
+		predicate, err = newClusterGatewayPredicate(&internalversion.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(FieldSelectorCredentialType, string(CredentialTypeX509Certificate)),
+		})
+		require.NoError(t, err)
+		gateways, _, err = view.list(predicate, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cluster-a", "cluster-c"}, names(gateways))
+
+		predicate, err = newClusterGatewayPredicate(&internalversion.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(FieldSelectorName, "cluster-b"),
+		})
+		require.NoError(t, err)
+		gateways, _, err = view.list(predicate, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cluster-b"}, names(gateways))
+	})
+	assert.Zero(t, reads)
+
+	t.Run("events update the view", func(t *testing.T) {
+		singleton.SetClient(fakeClient)
+		secretInformer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+		require.NoError(t, err)
+
+		// re-labeling the secret of cluster-b moves it across the index
+		secret := &corev1.Secret{}
+		require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-b", Name: common.AddonName}, secret))
+		secret.Labels = x509Labels
+		secret.Data = x509Data
+		require.NoError(t, fakeClient.Update(ctx, secret))
+		secretInformer.Update(secret, secret)
+		predicate, err := newClusterGatewayPredicate(&internalversion.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(FieldSelectorCredentialType, string(CredentialTypeServiceAccountToken)),
+		})
+		require.NoError(t, err)
+		gateways, _, err := view.list(predicate, "", 0)
+		require.NoError(t, err)
+		assert.Empty(t, gateways)
+
+		// fixing the exec config of cluster-d recovers its gateway
+		secret = &corev1.Secret{}
+		require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-d", Name: common.AddonName}, secret))
+		secret.Data = map[string][]byte{common.SecretKeyClusterCredentialExec: []byte("command: /usr/local/bin/aws\n")}
+		require.NoError(t, fakeClient.Update(ctx, secret))
+		secretInformer.Update(secret, secret)
+		gw, err := view.get("cluster-d")
+		require.NoError(t, err)
+		assert.Equal(t, CredentialTypeExec, gw.Spec.Access.Credential.Type)
+
+		// removing the secret of cluster-a drops its gateway
+		secret = &corev1.Secret{}
+		require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-a", Name: common.AddonName}, secret))
+		require.NoError(t, fakeClient.Delete(ctx, secret))
+		secretInformer.Delete(secret)
+		_, err = view.get("cluster-a")
+		assert.True(t, apierrors.IsNotFound(err))
+		assert.Equal(t, []string{"cluster-b", "cluster-c", "cluster-d"}, view.names)
+	})
+}
@@ -0,0 +1,568 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+const (
+	// watchCacheCapacity is the number of recent events kept in memory for
+	// resuming watches from a previously observed resourceVersion.
+	watchCacheCapacity = 1024
+	// watchResultBufferSize is the number of events buffered for a watcher
+	// on top of its initial events before it is considered too slow.
+	watchResultBufferSize = 100
+	// watchBookmarkInterval is the period of bookmark events sent to the
+	// watchers allowing bookmarks.
+	watchBookmarkInterval = time.Minute
+	// watchFreshnessTimeout is how long a list request waits for the cache to
+	// catch up with the requested resourceVersion.
+	watchFreshnessTimeout      = 3 * time.Second
+	watchFreshnessPollInterval = 100 * time.Millisecond
+)
+
+var (
+	clusterGatewayWatchCacheLock sync.Mutex
+	clusterGatewayWatchCacheInst *clusterGatewayWatchCache
+)
+
+func (in *ClusterGateway) Watch(ctx context.Context, opt *internalversion.ListOptions) (watch.Interface, error) {
+	if singleton.GetClient() == nil || singleton.GetCache() == nil {
+		return nil, fmt.Errorf("controller manager is not initialized yet")
+	}
+	watchCache, err := getClusterGatewayWatchCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return watchCache.Watch(ctx, opt)
+}
+
+// getClusterGatewayWatchCache lazily starts the process-wide watch cache upon
+// the informers of the controller manager.
+func getClusterGatewayWatchCache(ctx context.Context) (*clusterGatewayWatchCache, error) {
+	clusterGatewayWatchCacheLock.Lock()
+	defer clusterGatewayWatchCacheLock.Unlock()
+	if clusterGatewayWatchCacheInst != nil {
+		return clusterGatewayWatchCacheInst, nil
+	}
+	watchCache, err := newClusterGatewayWatchCache(ctx, singleton.GetCache())
+	if err != nil {
+		return nil, err
+	}
+	clusterGatewayWatchCacheInst = watchCache
+	return watchCache, nil
+}
+
+// RunClusterGatewayWatchCache sends the bookmarks to the watchers of the
+// watch cache until the context of the controller manager is done, upon
+// which the watchers are terminated.
+func RunClusterGatewayWatchCache(ctx context.Context) error {
+	ticker := time.NewTicker(watchBookmarkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if watchCache := runningClusterGatewayWatchCache(); watchCache != nil {
+				watchCache.stop()
+			}
+			return nil
+		case <-ticker.C:
+			if watchCache := runningClusterGatewayWatchCache(); watchCache != nil {
+				watchCache.bookmark()
+			}
+		}
+	}
+}
+
+func runningClusterGatewayWatchCache() *clusterGatewayWatchCache {
+	clusterGatewayWatchCacheLock.Lock()
+	defer clusterGatewayWatchCacheLock.Unlock()
+	return clusterGatewayWatchCacheInst
+}
+
+// clusterGatewayWatchCache converts the events of ManagedCluster, the gateway
+// ManagedClusterAddOn, the cluster-proxy ManagedClusterAddOn and the credential
+// Secret into ClusterGateway events. It keeps the latest converted object for
+// each cluster and a bounded history of events for resuming watches.
+type clusterGatewayWatchCache struct {
+	sync.Mutex
+
+	gateways map[string]*ClusterGateway
+	// names are the sorted names of the gateways.
+	names []string
+	// index maps the values of the indexed fields to the names of gateways.
+	index map[string]map[string]sets.Set[string]
+	// failures are the errors of the clusters failing the conversion.
+	failures map[string]error
+	events   []watchCacheEvent
+	// oldestResourceVersion is the resourceVersion right before the first
+	// event in the history. Watches starting from an older version have to
+	// re-list.
+	oldestResourceVersion uint64
+	// latestResourceVersion is the greatest resourceVersion observed so far.
+	latestResourceVersion uint64
+	// resourceVersion is the greatest resourceVersion dispatched or
+	// advertised so far. The informers feeding the cache lag behind each
+	// other, so the events are dispatched with increasing resourceVersions
+	// beyond it regardless of the order the objects are observed.
+	resourceVersion uint64
+	// composites are the resourceVersions composed from the objects of the
+	// gateways, which are kept apart from the dispatched ones.
+	composites map[string]uint64
+	// listed tells whether the initial state is listed, before which nothing
+	// is dispatched to any watcher out of order.
+	listed bool
+
+	// syncing marks the clusters being converted, whose events arriving
+	// meanwhile are converted again after the conversion.
+	syncing map[string]bool
+
+	watchers      map[int64]*clusterGatewayWatcher
+	nextWatcherID int64
+}
+
+func newClusterGatewayWatchCache(ctx context.Context, informers cache.Informers) (*clusterGatewayWatchCache, error) {
+	c := &clusterGatewayWatchCache{
+		gateways:   make(map[string]*ClusterGateway),
+		index:      make(map[string]map[string]sets.Set[string]),
+		failures:   make(map[string]error),
+		composites: make(map[string]uint64),
+		syncing:    make(map[string]bool),
+		watchers:   make(map[int64]*clusterGatewayWatcher),
+	}
+	for _, obj := range []client.Object{
+		&clusterv1.ManagedCluster{},
+		&addonv1alpha1.ManagedClusterAddOn{},
+		&v1.Secret{},
+	} {
+		informer, err := informers.GetInformer(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			AddFunc:    c.onEvent,
+			UpdateFunc: func(_, obj interface{}) { c.onEvent(obj) },
+			DeleteFunc: c.onEvent,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var clusters clusterv1.ManagedClusterList
+	if err := singleton.GetClient().List(ctx, &clusters); err != nil {
+		return nil, err
+	}
+	for _, cluster := range clusters.Items {
+		c.Lock()
+		c.observe(cluster.ResourceVersion)
+		c.Unlock()
+		c.sync(cluster.Name)
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(config.LocalClusterName) > 0 {
+		// the local cluster never changes since it is observed
+		local := newLocalClusterGateway()
+		local.ResourceVersion = strconv.FormatUint(c.latestResourceVersion, 10)
+		c.set(local)
+	}
+	// the initial state is listed instead of replayed
+	c.events = nil
+	c.oldestResourceVersion = c.advertise()
+	c.listed = true
+	return c, nil
+}
+
+func (c *clusterGatewayWatchCache) onEvent(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	clusterName, ok := clusterNameFromObject(obj)
+	if !ok {
+		return
+	}
+	c.Lock()
+	c.observe(obj.(client.Object).GetResourceVersion())
+	c.Unlock()
+	c.sync(clusterName)
+}
+
+// clusterNameFromObject maps an input object to the name of the ClusterGateway
+// converted from it.
+func clusterNameFromObject(obj interface{}) (string, bool) {
+	switch o := obj.(type) {
+	case *clusterv1.ManagedCluster:
+		return o.Name, true
+	case *addonv1alpha1.ManagedClusterAddOn:
+		if o.Name == common.AddonName || o.Name == common.ClusterProxyAddonName {
+			return o.Namespace, true
+		}
+	case *v1.Secret:
+		if o.Name == common.AddonName {
+			return o.Namespace, true
+		}
+	}
+	return "", false
+}
+
+// sync re-converts the ClusterGateway without locking the cache, which
+// reads the objects composing the ClusterGateway. The conversions of the same
+// cluster are serialized so that a stale conversion never overrides a later
+// one.
+func (c *clusterGatewayWatchCache) sync(name string) {
+	c.Lock()
+	if _, ok := c.syncing[name]; ok {
+		c.syncing[name] = true
+		c.Unlock()
+		return
+	}
+	c.syncing[name] = false
+	c.Unlock()
+	for {
+		gw, err := getClusterGateway(context.TODO(), name)
+		c.Lock()
+		c.apply(name, gw, err)
+		if !c.syncing[name] {
+			delete(c.syncing, name)
+			c.Unlock()
+			return
+		}
+		c.syncing[name] = false
+		c.Unlock()
+	}
+}
+
+// apply dispatches an event if the converted ClusterGateway differs from the
+// last dispatched one.
+func (c *clusterGatewayWatchCache) apply(name string, gw *ClusterGateway, err error) {
+	delete(c.failures, name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.V(4).Infof("Treating clustergateway %s as absent: %v", name, err)
+			c.failures[name] = err
+		}
+		gw = nil
+	}
+	proxyTransports.invalidate(name, gw)
+	if gw == nil {
+		discoveryDocuments.invalidate(name)
+		discoveredEndpointCAs.invalidate(name)
+	}
+	last, existed := c.gateways[name]
+	switch {
+	case gw == nil && !existed:
+		return
+	case gw == nil:
+		c.unset(name)
+		delete(c.composites, name)
+		deleted := last.DeepCopy()
+		deleted.ResourceVersion = ""
+		c.stamp(deleted)
+		c.dispatch(watchCacheEvent{Type: watch.Deleted, Object: deleted})
+	case !existed:
+		c.composites[name] = parseResourceVersion(gw.ResourceVersion)
+		c.stamp(gw)
+		c.set(gw)
+		c.dispatch(watchCacheEvent{Type: watch.Added, Object: gw.DeepCopy()})
+	default:
+		// The objects out of the composed resourceVersion, e.g. the
+		// cluster-proxy addon deciding the endpoint type, change the spec
+		// without a newer composed resourceVersion.
+		composite := parseResourceVersion(gw.ResourceVersion)
+		if composite <= c.composites[name] && equality.Semantic.DeepEqual(gw.Spec, last.Spec) {
+			return
+		}
+		c.composites[name] = composite
+		c.stamp(gw)
+		c.set(gw)
+		c.dispatch(watchCacheEvent{Type: watch.Modified, Object: gw.DeepCopy(), PrevObject: last})
+	}
+}
+
+// stamp assigns the resourceVersion of the gateway to be dispatched, which is
+// the composed one unless it is not newer than the ones dispatched or
+// advertised before, e.g. composed from the objects of a lagging informer.
+func (c *clusterGatewayWatchCache) stamp(gw *ClusterGateway) {
+	rv := parseResourceVersion(gw.ResourceVersion)
+	if c.listed && rv <= c.resourceVersion {
+		rv = c.resourceVersion + 1
+	}
+	if rv > c.resourceVersion {
+		c.resourceVersion = rv
+	}
+	gw.ResourceVersion = strconv.FormatUint(rv, 10)
+}
+
+// advertise returns the resourceVersion of the cache for the bookmarks and
+// the lists, beyond which the later events are dispatched.
+func (c *clusterGatewayWatchCache) advertise() uint64 {
+	if c.latestResourceVersion > c.resourceVersion {
+		c.resourceVersion = c.latestResourceVersion
+	}
+	return c.resourceVersion
+}
+
+// compositeResourceVersion returns the resourceVersion composed from the
+// objects of the cached gateway if it is of the given resourceVersion, which
+// differs from the composed one once stamped.
+func (c *clusterGatewayWatchCache) compositeResourceVersion(name, resourceVersion string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	gw, ok := c.gateways[name]
+	if !ok || gw.ResourceVersion != resourceVersion {
+		return "", false
+	}
+	return strconv.FormatUint(c.composites[name], 10), true
+}
+
+// watchCacheEvent is a ClusterGateway event along with the previous state of
+// the object for telling whether the object enters or leaves the selection
+// of a watcher.
+type watchCacheEvent struct {
+	Type       watch.EventType
+	Object     *ClusterGateway
+	PrevObject *ClusterGateway
+}
+
+func (c *clusterGatewayWatchCache) dispatch(event watchCacheEvent) {
+	c.observe(event.Object.ResourceVersion)
+	c.events = append(c.events, event)
+	if len(c.events) > watchCacheCapacity {
+		evicted := parseResourceVersion(c.events[0].Object.ResourceVersion)
+		if evicted > c.oldestResourceVersion {
+			c.oldestResourceVersion = evicted
+		}
+		c.events = c.events[1:]
+	}
+	for _, w := range c.watchers {
+		if filtered, ok := w.filter(event); ok {
+			w.send(filtered)
+		}
+	}
+}
+
+// stop terminates the watchers.
+func (c *clusterGatewayWatchCache) stop() {
+	c.Lock()
+	defer c.Unlock()
+	for _, w := range c.watchers {
+		w.stopLocked()
+	}
+}
+
+func (c *clusterGatewayWatchCache) bookmark() {
+	c.Lock()
+	defer c.Unlock()
+	for _, w := range c.watchers {
+		if w.bookmarks {
+			w.send(c.bookmarkEvent(false))
+		}
+	}
+}
+
+func (c *clusterGatewayWatchCache) bookmarkEvent(initialEventsEnd bool) watch.Event {
+	gw := &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			ResourceVersion: strconv.FormatUint(c.advertise(), 10),
+		},
+	}
+	if initialEventsEnd {
+		gw.Annotations = map[string]string{metav1.InitialEventsAnnotationKey: "true"}
+	}
+	return watch.Event{Type: watch.Bookmark, Object: gw}
+}
+
+func (c *clusterGatewayWatchCache) observe(resourceVersion string) {
+	if rv := parseResourceVersion(resourceVersion); rv > c.latestResourceVersion {
+		c.latestResourceVersion = rv
+	}
+}
+
+// waitUntilFresh blocks until the cache has observed the given
+// resourceVersion so that a "NotOlderThan" list is served from a state no
+// older than requested.
+func (c *clusterGatewayWatchCache) waitUntilFresh(ctx context.Context, resourceVersion uint64) error {
+	err := wait.PollUntilContextTimeout(ctx, watchFreshnessPollInterval, watchFreshnessTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			c.Lock()
+			defer c.Unlock()
+			return c.latestResourceVersion >= resourceVersion, nil
+		})
+	if err != nil {
+		c.Lock()
+		defer c.Unlock()
+		return storage.NewTooLargeResourceVersionError(resourceVersion, c.latestResourceVersion, 1)
+	}
+	return nil
+}
+
+func (c *clusterGatewayWatchCache) Watch(ctx context.Context, opt *internalversion.ListOptions) (watch.Interface, error) {
+	rv, err := strconv.ParseUint(opt.ResourceVersion, 10, 64)
+	if len(opt.ResourceVersion) > 0 && err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", opt.ResourceVersion))
+	}
+	predicate, err := newClusterGatewayPredicate(opt)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	sendInitialEvents := rv == 0
+	if opt.SendInitialEvents != nil {
+		sendInitialEvents = *opt.SendInitialEvents
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	w := &clusterGatewayWatcher{
+		id:        c.nextWatcherID,
+		cache:     c,
+		predicate: predicate,
+		bookmarks: opt.AllowWatchBookmarks,
+		done:      make(chan struct{}),
+	}
+	var initEvents []watch.Event
+	switch {
+	case sendInitialEvents:
+		names := make([]string, 0, len(c.gateways))
+		for name := range c.gateways {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if event, ok := w.filter(watchCacheEvent{Type: watch.Added, Object: c.gateways[name]}); ok {
+				event.Object = c.gateways[name].DeepCopy()
+				initEvents = append(initEvents, event)
+			}
+		}
+	case rv == 0:
+		// starting from the most recent state
+	default:
+		if rv < c.oldestResourceVersion {
+			return nil, apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", rv, c.oldestResourceVersion))
+		}
+		for _, event := range c.events {
+			if parseResourceVersion(event.Object.ResourceVersion) <= rv {
+				continue
+			}
+			if filtered, ok := w.filter(event); ok {
+				initEvents = append(initEvents, filtered)
+			}
+		}
+	}
+
+	w.result = make(chan watch.Event, len(initEvents)+watchResultBufferSize)
+	c.nextWatcherID++
+	for _, event := range initEvents {
+		w.result <- event
+	}
+	if opt.SendInitialEvents != nil && *opt.SendInitialEvents && w.bookmarks {
+		w.result <- c.bookmarkEvent(true)
+	}
+	c.watchers[w.id] = w
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-w.done:
+		}
+	}()
+	return w, nil
+}
+
+var _ watch.Interface = &clusterGatewayWatcher{}
+
+type clusterGatewayWatcher struct {
+	id        int64
+	cache     *clusterGatewayWatchCache
+	predicate storage.SelectionPredicate
+	bookmarks bool
+	result    chan watch.Event
+	done      chan struct{}
+}
+
+func (w *clusterGatewayWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *clusterGatewayWatcher) Stop() {
+	w.cache.Lock()
+	defer w.cache.Unlock()
+	w.stopLocked()
+}
+
+func (w *clusterGatewayWatcher) stopLocked() {
+	if _, ok := w.cache.watchers[w.id]; !ok {
+		return
+	}
+	delete(w.cache.watchers, w.id)
+	close(w.done)
+	close(w.result)
+}
+
+// filter converts the cache event into the event observed by the watcher
+// according to its selectors. An object stops matching the selectors is
+// observed as deleted while an object starts matching is observed as added.
+func (w *clusterGatewayWatcher) filter(event watchCacheEvent) (watch.Event, bool) {
+	matches := func(gw *ClusterGateway) bool {
+		if gw == nil {
+			return false
+		}
+		matched, err := w.predicate.Matches(gw)
+		return err == nil && matched
+	}
+	cur := matches(event.Object)
+	switch event.Type {
+	case watch.Modified:
+		prev := matches(event.PrevObject)
+		switch {
+		case cur && prev:
+			return watch.Event{Type: watch.Modified, Object: event.Object}, true
+		case cur:
+			return watch.Event{Type: watch.Added, Object: event.Object}, true
+		case prev:
+			return watch.Event{Type: watch.Deleted, Object: event.Object}, true
+		}
+		return watch.Event{}, false
+	default:
+		return watch.Event{Type: event.Type, Object: event.Object}, cur
+	}
+}
+
+// send must be called with the cache locked. Watchers failing to keep up
+// with the events are terminated so that the clients re-establish them.
+func (w *clusterGatewayWatcher) send(event watch.Event) {
+	select {
+	case w.result <- event:
+	default:
+		klog.Warningf("Terminating slow clustergateway watcher %d", w.id)
+		w.stopLocked()
+	}
+}
+
+func parseResourceVersion(resourceVersion string) uint64 {
+	rv, _ := strconv.ParseUint(resourceVersion, 10, 64)
+	return rv
+}
@@ -0,0 +1,601 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/utils/pointer"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func nextWatchEvent(t *testing.T, w watch.Interface) watch.Event {
+	select {
+	case ev, ok := <-w.ResultChan():
+		require.True(t, ok, "watch closed unexpectedly")
+		return ev
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for watch event")
+	}
+	return watch.Event{}
+}
+
+func assertNoWatchEvent(t *testing.T, w watch.Interface) {
+	select {
+	case ev := <-w.ResultChan():
+		assert.Failf(t, "unexpected watch event", "%s %v", ev.Type, ev.Object)
+	default:
+	}
+}
+
+func TestWatchClusterGateway(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+		// cluster-b lacks the credential type label until it gets updated.
+		managedCluster("cluster-b", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-b", nil),
+		credentialSecret("cluster-b", nil, x509Data),
+	).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{AllowWatchBookmarks: true})
+	require.NoError(t, err)
+	defer w.Stop()
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, "cluster-a", ev.Object.(*ClusterGateway).Name)
+	startRV := ev.Object.(*ClusterGateway).ResourceVersion
+	assertNoWatchEvent(t, w)
+
+	secretInformer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+	require.NoError(t, err)
+
+	// labeling the secret of cluster-b makes its gateway appear
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-b", Name: common.AddonName}, secret))
+	secret.Labels = x509Labels
+	require.NoError(t, fakeClient.Update(ctx, secret))
+	secretInformer.Update(secret, secret)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, "cluster-b", ev.Object.(*ClusterGateway).Name)
+	assert.Equal(t, secret.ResourceVersion, ev.Object.(*ClusterGateway).ResourceVersion)
+
+	// re-delivering an unchanged object is not an event
+	secretInformer.Update(secret, secret)
+	assertNoWatchEvent(t, w)
+
+	// removing the secret of cluster-a deletes its gateway
+	secret = &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-a", Name: common.AddonName}, secret))
+	require.NoError(t, fakeClient.Delete(ctx, secret))
+	secretInformer.Delete(secret)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Deleted, ev.Type)
+	assert.Equal(t, "cluster-a", ev.Object.(*ClusterGateway).Name)
+
+	watchCache.bookmark()
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Bookmark, ev.Type)
+	latestRV := ev.Object.(*ClusterGateway).ResourceVersion
+
+	// resuming from the initial resourceVersion replays the history
+	resumed, err := watchCache.Watch(ctx, &internalversion.ListOptions{ResourceVersion: startRV})
+	require.NoError(t, err)
+	defer resumed.Stop()
+	assert.Equal(t, watch.Added, nextWatchEvent(t, resumed).Type)
+	assert.Equal(t, watch.Deleted, nextWatchEvent(t, resumed).Type)
+	assertNoWatchEvent(t, resumed)
+
+	// resuming from the latest resourceVersion replays nothing
+	latest, err := watchCache.Watch(ctx, &internalversion.ListOptions{ResourceVersion: latestRV})
+	require.NoError(t, err)
+	defer latest.Stop()
+	assertNoWatchEvent(t, latest)
+
+	// resourceVersions older than the history are expired
+	_, err = watchCache.Watch(ctx, &internalversion.ListOptions{ResourceVersion: "1"})
+	assert.True(t, apierrors.IsResourceExpired(err))
+
+	// initial events end with an annotated bookmark
+	initial, err := watchCache.Watch(ctx, &internalversion.ListOptions{
+		ResourceVersion:     latestRV,
+		SendInitialEvents:   pointer.Bool(true),
+		AllowWatchBookmarks: true,
+	})
+	require.NoError(t, err)
+	ev = nextWatchEvent(t, initial)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, "cluster-b", ev.Object.(*ClusterGateway).Name)
+	ev = nextWatchEvent(t, initial)
+	assert.Equal(t, watch.Bookmark, ev.Type)
+	assert.Equal(t, "true", ev.Object.(*ClusterGateway).Annotations[metav1.InitialEventsAnnotationKey])
+
+	// stopped watchers are closed
+	initial.Stop()
+	_, ok := <-initial.ResultChan()
+	assert.False(t, ok)
+}
+
+func TestWatchClusterGatewayWithSelector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+	).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+
+	_, err = watchCache.Watch(ctx, &internalversion.ListOptions{FieldSelector: fields.OneTermEqualSelector("spec.foo", "bar")})
+	assert.True(t, apierrors.IsBadRequest(err))
+
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{LabelSelector: labels.SelectorFromSet(labels.Set{"env": "prod"})})
+	require.NoError(t, err)
+	defer w.Stop()
+	assertNoWatchEvent(t, w)
+
+	clusterInformer, err := informers.FakeInformerFor(ctx, &clusterv1.ManagedCluster{})
+	require.NoError(t, err)
+	updateLabels := func(l map[string]string) {
+		cluster := &clusterv1.ManagedCluster{}
+		require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "cluster-a"}, cluster))
+		cluster.Labels = l
+		require.NoError(t, fakeClient.Update(ctx, cluster))
+		clusterInformer.Update(cluster, cluster)
+	}
+
+	// entering the selection is observed as added
+	updateLabels(map[string]string{"env": "prod"})
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Added, ev.Type)
+	assert.Equal(t, "cluster-a", ev.Object.(*ClusterGateway).Name)
+
+	// changes inside the selection are observed as modified
+	updateLabels(map[string]string{"env": "prod", "tier": "1"})
+	assert.Equal(t, watch.Modified, nextWatchEvent(t, w).Type)
+
+	// leaving the selection is observed as deleted
+	updateLabels(map[string]string{"env": "dev"})
+	assert.Equal(t, watch.Deleted, nextWatchEvent(t, w).Type)
+
+	// changes outside the selection are not observed
+	updateLabels(map[string]string{"env": "test"})
+	assertNoWatchEvent(t, w)
+}
+
+func TestWatchClusterGatewayActiveEndpointType(t *testing.T) {
+	setEndpointFailoverDuringTest(t, config.EndpointFailoverOrderDeclared, false)
+	clusterProxyHost := config.ClusterProxyHost
+	config.ClusterProxyHost = "cluster-proxy.example.com"
+	defer func() { config.ClusterProxyHost = clusterProxyHost }()
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", map[string]string{
+			common.AnnotationKeyClusterGatewayEndpointFallback: string(ClusterEndpointTypeClusterProxy),
+		}),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+	).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, ClusterEndpointTypeConst, ev.Object.(*ClusterGateway).Status.ActiveEndpointType)
+	startRV := parseResourceVersion(ev.Object.(*ClusterGateway).ResourceVersion)
+
+	// falling back to cluster-proxy is observed with a new resourceVersion
+	gw := ev.Object.(*ClusterGateway)
+	preferredEndpoints.record("cluster-a", clusterGatewayForEndpointType(gw, ClusterEndpointTypeClusterProxy))
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.Eventually(t, func() bool {
+		require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-a", Name: common.AddonName}, addon))
+		return len(addon.Annotations[common.AnnotationKeyClusterGatewayStatusActiveEndpointType]) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	addonInformer, err := informers.FakeInformerFor(ctx, &addonv1alpha1.ManagedClusterAddOn{})
+	require.NoError(t, err)
+	addonInformer.Update(addon, addon)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, ClusterEndpointTypeClusterProxy, ev.Object.(*ClusterGateway).Status.ActiveEndpointType)
+	assert.Greater(t, parseResourceVersion(ev.Object.(*ClusterGateway).ResourceVersion), startRV)
+}
+
+// blockingClient blocks after reading a Secret once armed until released.
+type blockingClient struct {
+	client.Client
+	armed    chan struct{}
+	blocked  chan struct{}
+	released chan struct{}
+}
+
+func (c *blockingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if _, ok := obj.(*corev1.Secret); ok {
+		select {
+		case <-c.armed:
+			c.armed = make(chan struct{})
+			close(c.blocked)
+			<-c.released
+		default:
+		}
+	}
+	return err
+}
+
+func TestWatchClusterGatewayConvertsWithoutLocking(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+	).Build()
+	blocking := &blockingClient{
+		Client:   fakeClient,
+		armed:    make(chan struct{}),
+		blocked:  make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	singleton.SetClient(blocking)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+	assert.Equal(t, watch.Added, nextWatchEvent(t, w).Type)
+
+	clusterInformer, err := informers.FakeInformerFor(ctx, &clusterv1.ManagedCluster{})
+	require.NoError(t, err)
+	secretInformer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+	require.NoError(t, err)
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "cluster-a"}, cluster))
+	cluster.Labels = map[string]string{"foo": "bar"}
+	require.NoError(t, fakeClient.Update(ctx, cluster))
+	close(blocking.armed)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clusterInformer.Update(cluster, cluster)
+	}()
+	<-blocking.blocked
+
+	// the cache is never locked while converting
+	watchCache.bookmark()
+	// the events arriving meanwhile are converted after the conversion
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-a", Name: common.AddonName}, secret))
+	require.NoError(t, fakeClient.Delete(ctx, secret))
+	secretInformer.Delete(secret)
+	close(blocking.released)
+	<-done
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, map[string]string{"foo": "bar"}, ev.Object.(*ClusterGateway).Labels)
+	assert.Equal(t, watch.Deleted, nextWatchEvent(t, w).Type)
+	assertNoWatchEvent(t, w)
+}
+
+func TestWatchClusterGatewayOutOfOrder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+		managedCluster("cluster-b", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-b", nil),
+		credentialSecret("cluster-b", x509Labels, x509Data),
+	).Build()
+	singleton.SetClient(fakeClient)
+	singleton.SetAPIReader(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+	clusterGatewayWatchCacheLock.Lock()
+	original := clusterGatewayWatchCacheInst
+	clusterGatewayWatchCacheInst = watchCache
+	clusterGatewayWatchCacheLock.Unlock()
+	defer func() {
+		clusterGatewayWatchCacheLock.Lock()
+		defer clusterGatewayWatchCacheLock.Unlock()
+		clusterGatewayWatchCacheInst = original
+	}()
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{SendInitialEvents: pointer.Bool(false), AllowWatchBookmarks: true})
+	require.NoError(t, err)
+	defer w.Stop()
+
+	clusterInformer, err := informers.FakeInformerFor(ctx, &clusterv1.ManagedCluster{})
+	require.NoError(t, err)
+	secretInformer, err := informers.FakeInformerFor(ctx, &corev1.Secret{})
+	require.NoError(t, err)
+	// the secret of cluster-b is updated before the ManagedCluster of
+	// cluster-a but observed after it by the lagging secret informer
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "cluster-b", Name: common.AddonName}, secret))
+	secret.Annotations = map[string]string{"foo": "bar"}
+	require.NoError(t, fakeClient.Update(ctx, secret))
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "cluster-a"}, cluster))
+	for _, value := range []string{"bar", "baz"} {
+		cluster.Labels = map[string]string{"foo": value}
+		require.NoError(t, fakeClient.Update(ctx, cluster))
+	}
+	require.Greater(t, parseResourceVersion(cluster.ResourceVersion), parseResourceVersion(secret.ResourceVersion))
+
+	clusterInformer.Update(cluster, cluster)
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, "cluster-a", ev.Object.(*ClusterGateway).Name)
+	resumingRV := ev.Object.(*ClusterGateway).ResourceVersion
+	assert.Equal(t, cluster.ResourceVersion, resumingRV)
+	watchCache.bookmark()
+	ev = nextWatchEvent(t, w)
+	require.Equal(t, watch.Bookmark, ev.Type)
+	bookmarkRV := parseResourceVersion(ev.Object.(*ClusterGateway).ResourceVersion)
+
+	// the late event is dispatched beyond the ones dispatched or advertised
+	secretInformer.Update(secret, secret)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, "cluster-b", ev.Object.(*ClusterGateway).Name)
+	lateRV := ev.Object.(*ClusterGateway).ResourceVersion
+	assert.Greater(t, parseResourceVersion(lateRV), bookmarkRV)
+
+	// resuming from the earlier event never misses the late one
+	resumed, err := watchCache.Watch(ctx, &internalversion.ListOptions{ResourceVersion: resumingRV})
+	require.NoError(t, err)
+	defer resumed.Stop()
+	ev = nextWatchEvent(t, resumed)
+	assert.Equal(t, "cluster-b", ev.Object.(*ClusterGateway).Name)
+	assert.Equal(t, lateRV, ev.Object.(*ClusterGateway).ResourceVersion)
+	assertNoWatchEvent(t, resumed)
+
+	// the gateway read from the cache is updated by its resourceVersion
+	got, err := watchCache.get("cluster-b")
+	require.NoError(t, err)
+	assert.Equal(t, lateRV, got.ResourceVersion)
+	updating := got.DeepCopy()
+	updating.Labels = map[string]string{"env": "dev"}
+	_, _, err = (&ClusterGateway{}).Update(ctx, "cluster-b", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	assert.NoError(t, err)
+}
+
+func TestWatchClusterGatewaySpecChange(t *testing.T) {
+	clusterProxyHost := config.ClusterProxyHost
+	config.ClusterProxyHost = "cluster-proxy.example.com"
+	defer func() { config.ClusterProxyHost = clusterProxyHost }()
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		managedCluster("cluster-a", testEndpoint, []byte(testCAData)),
+		gatewayAddon("cluster-a", nil),
+		credentialSecret("cluster-a", x509Labels, x509Data),
+	).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+	w, err := watchCache.Watch(ctx, &internalversion.ListOptions{})
+	require.NoError(t, err)
+	defer w.Stop()
+	ev := nextWatchEvent(t, w)
+	assert.Equal(t, ClusterEndpointTypeConst, ev.Object.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	startRV := parseResourceVersion(ev.Object.(*ClusterGateway).ResourceVersion)
+
+	// the available cluster-proxy changes the spec without changing any of
+	// the objects composing the resourceVersion
+	proxyAddon := &addonv1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: common.ClusterProxyAddonName},
+		Status: addonv1alpha1.ManagedClusterAddOnStatus{
+			Conditions: []metav1.Condition{{Type: "Available", Status: metav1.ConditionTrue}},
+		},
+	}
+	require.NoError(t, fakeClient.Create(ctx, proxyAddon))
+	addonInformer, err := informers.FakeInformerFor(ctx, &addonv1alpha1.ManagedClusterAddOn{})
+	require.NoError(t, err)
+	addonInformer.Add(proxyAddon)
+	ev = nextWatchEvent(t, w)
+	assert.Equal(t, watch.Modified, ev.Type)
+	assert.Equal(t, ClusterEndpointTypeClusterProxy, ev.Object.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	assert.Greater(t, parseResourceVersion(ev.Object.(*ClusterGateway).ResourceVersion), startRV)
+
+	// re-delivering it changes nothing
+	addonInformer.Update(proxyAddon, proxyAddon)
+	assertNoWatchEvent(t, w)
+}
+
+func TestListClusterGatewayPaginationExpired(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+
+	var objs []client.Object
+	for _, name := range []string{"cluster-a", "cluster-b", "cluster-c"} {
+		objs = append(objs,
+			managedCluster(name, testEndpoint, []byte(testCAData)),
+			gatewayAddon(name, nil),
+			credentialSecret(name, x509Labels, x509Data))
+	}
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	singleton.SetClient(fakeClient)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+	singleton.SetCache(informers)
+	defer singleton.SetCache(nil)
+
+	ctx := context.TODO()
+	watchCache, err := newClusterGatewayWatchCache(ctx, informers)
+	require.NoError(t, err)
+	clusterGatewayWatchCacheLock.Lock()
+	original := clusterGatewayWatchCacheInst
+	clusterGatewayWatchCacheInst = watchCache
+	clusterGatewayWatchCacheLock.Unlock()
+	defer func() {
+		clusterGatewayWatchCacheLock.Lock()
+		defer clusterGatewayWatchCacheLock.Unlock()
+		clusterGatewayWatchCacheInst = original
+	}()
+	storage := &ClusterGateway{}
+
+	out, err := storage.List(ctx, &internalversion.ListOptions{Limit: 1})
+	require.NoError(t, err)
+	first := out.(*ClusterGatewayList)
+	require.NotEmpty(t, first.Continue)
+	out, err = storage.List(ctx, &internalversion.ListOptions{Limit: 1, Continue: first.Continue})
+	require.NoError(t, err, "the unchanged ClusterGateways are continued")
+	assert.Equal(t, first.ResourceVersion, out.(*ClusterGatewayList).ResourceVersion)
+	assert.Equal(t, "cluster-b", out.(*ClusterGatewayList).Items[0].Name)
+
+	// the ClusterGateway changed after the first page expires the pages
+	// following it, which would mix up the states before and after the change
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "cluster-c"}, cluster))
+	cluster.Labels = map[string]string{"foo": "bar"}
+	require.NoError(t, fakeClient.Update(ctx, cluster))
+	clusterInformer, err := informers.FakeInformerFor(ctx, &clusterv1.ManagedCluster{})
+	require.NoError(t, err)
+	clusterInformer.Update(cluster, cluster)
+	_, err = storage.List(ctx, &internalversion.ListOptions{Limit: 1, Continue: first.Continue})
+	assert.True(t, apierrors.IsResourceExpired(err), "unexpected error: %v", err)
+
+	// restarting the list serves the current state
+	out, err = storage.List(ctx, &internalversion.ListOptions{Limit: 1})
+	require.NoError(t, err)
+	out, err = storage.List(ctx, &internalversion.ListOptions{Limit: 1, Continue: out.(*ClusterGatewayList).Continue})
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-b", out.(*ClusterGatewayList).Items[0].Name)
+}
+
+func TestRunClusterGatewayWatchCache(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+	singleton.SetClient(ctrlfake.NewClientBuilder().WithScheme(scheme).Build())
+	watchCache, err := newClusterGatewayWatchCache(context.TODO(), &informertest.FakeInformers{Scheme: scheme})
+	require.NoError(t, err)
+	clusterGatewayWatchCacheLock.Lock()
+	original := clusterGatewayWatchCacheInst
+	clusterGatewayWatchCacheInst = watchCache
+	clusterGatewayWatchCacheLock.Unlock()
+	defer func() {
+		clusterGatewayWatchCacheLock.Lock()
+		defer clusterGatewayWatchCacheLock.Unlock()
+		clusterGatewayWatchCacheInst = original
+	}()
+
+	w, err := watchCache.Watch(context.TODO(), &internalversion.ListOptions{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, RunClusterGatewayWatchCache(ctx))
+	}()
+	cancel()
+	<-done
+	// the watchers are terminated along with the manager
+	_, ok := <-w.ResultChan()
+	assert.False(t, ok)
+}
+
+func TestClusterNameFromObject(t *testing.T) {
+	cases := []struct {
+		name     string
+		obj      client.Object
+		expected string
+		ok       bool
+	}{
+		{name: "managed cluster", obj: managedCluster("foo", "", nil), expected: "foo", ok: true},
+		{name: "gateway addon", obj: gatewayAddon("foo", nil), expected: "foo", ok: true},
+		{
+			name: "cluster-proxy addon",
+			obj: &addonv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: common.ClusterProxyAddonName},
+			},
+			expected: "foo",
+			ok:       true,
+		},
+		{
+			name: "unrelated addon",
+			obj: &addonv1alpha1.ManagedClusterAddOn{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"},
+			},
+		},
+		{name: "credential secret", obj: credentialSecret("foo", nil, nil), expected: "foo", ok: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name, ok := clusterNameFromObject(c.obj)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.expected, name)
+		})
+	}
+}
@@ -0,0 +1,792 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/apiserver/pkg/util/dryrun"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ rest.Creater = &ClusterGateway{}
+var _ rest.Updater = &ClusterGateway{}
+var _ rest.GracefulDeleter = &ClusterGateway{}
+
+// Writing ClusterGateway is the inversion of the conversion:
+//  1. The labels, the propagated annotations and the const endpoint are
+//     written to the ManagedCluster.
+//  2. The proxy-url, the egress proxy and the proxy configuration are
+//     written to the annotations of the cluster-gateway addon.
+//  3. The credential is written to the cluster-gateway secret along with the
+//     credential type label.
+//
+// The credential contents are write-only, an update omitting them keeps the
+// stored credential. The status is owned by the health subresource and is
+// never written here. Deleting a ClusterGateway removes the addon and the
+// secret, the ManagedCluster is only removed if it was created by a
+// ClusterGateway.
+
+func (in *ClusterGateway) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	if singleton.GetClient() == nil {
+		return nil, fmt.Errorf("controller manager is not initialized yet")
+	}
+	gw, ok := obj.(*ClusterGateway)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("not a clustergateway: %T", obj))
+	}
+	gw = gw.DeepCopy()
+	if len(gw.Name) == 0 && len(gw.GenerateName) > 0 {
+		gw.Name = names.SimpleNameGenerator.GenerateName(gw.GenerateName)
+	}
+	if isLocalCluster(gw.Name) {
+		return nil, apierrors.NewAlreadyExists(clusterGatewayGroupResource(), gw.Name)
+	}
+
+	current, err := getClusterGatewayObjects(ctx, gw.Name)
+	if err != nil {
+		return nil, err
+	}
+	if current.complete() {
+		return nil, apierrors.NewAlreadyExists(clusterGatewayGroupResource(), gw.Name)
+	}
+	if errs := validateClusterGatewayCreate(gw, current); len(errs) > 0 {
+		return nil, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+	}
+	if createValidation != nil {
+		if err := createValidation(ctx, gw); err != nil {
+			return nil, err
+		}
+	}
+	return writeClusterGateway(ctx, gw, current, options != nil && dryrun.IsDryRun(options.DryRun))
+}
+
+func (in *ClusterGateway) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	if singleton.GetClient() == nil {
+		return nil, false, fmt.Errorf("controller manager is not initialized yet")
+	}
+	if isLocalCluster(name) {
+		return nil, false, newLocalClusterForbiddenError(name)
+	}
+	current, err := getClusterGatewayObjects(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var existing *ClusterGateway
+	if current.complete() {
+		if existing, err = convert(current.cluster, current.addon, getClusterEndpointType(ctx, name), current.secret); err != nil {
+			return nil, false, err
+		}
+	} else if !forceAllowCreate {
+		return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+	}
+
+	var oldObj runtime.Object
+	if existing != nil {
+		oldObj = existing
+	}
+	updated, err := objInfo.UpdatedObject(ctx, oldObj)
+	if err != nil {
+		return nil, false, err
+	}
+	gw, ok := updated.(*ClusterGateway)
+	if !ok {
+		return nil, false, apierrors.NewBadRequest(fmt.Sprintf("not a clustergateway: %T", updated))
+	}
+	gw = gw.DeepCopy()
+	if gw.Name != name {
+		return nil, false, apierrors.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", gw.Name, name))
+	}
+	dryRun := options != nil && dryrun.IsDryRun(options.DryRun)
+
+	if existing == nil {
+		if errs := validateClusterGatewayCreate(gw, current); len(errs) > 0 {
+			return nil, false, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+		}
+		if createValidation != nil {
+			if err := createValidation(ctx, gw); err != nil {
+				return nil, false, err
+			}
+		}
+		created, err := writeClusterGateway(ctx, gw, current, dryRun)
+		return created, true, err
+	}
+
+	if len(gw.ResourceVersion) > 0 && !isResourceVersionOf(gw.ResourceVersion, existing) {
+		return nil, false, apierrors.NewConflict(clusterGatewayGroupResource(), name,
+			fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	inheritCredential(gw, existing)
+	inheritSSHBastionPrivateKey(gw, existing)
+	errs := ValidateClusterGateway(gw)
+	errs = append(errs, validateClusterGatewayObjects(gw, current)...)
+	if len(errs) > 0 {
+		return nil, false, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+	}
+	if updateValidation != nil {
+		if err := updateValidation(ctx, gw, existing); err != nil {
+			return nil, false, err
+		}
+	}
+	written, err := writeClusterGateway(ctx, gw, current, dryRun)
+	return written, false, err
+}
+
+// isResourceVersionOf tells whether the resourceVersion is the one of the
+// existing ClusterGateway, either composed from its objects or dispatched by
+// the watch cache.
+func isResourceVersionOf(resourceVersion string, existing *ClusterGateway) bool {
+	if resourceVersion == existing.ResourceVersion {
+		return true
+	}
+	if watchCache := runningClusterGatewayWatchCache(); watchCache != nil {
+		composite, ok := watchCache.compositeResourceVersion(existing.Name, resourceVersion)
+		return ok && composite == existing.ResourceVersion
+	}
+	return false
+}
+
+func (in *ClusterGateway) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	if singleton.GetClient() == nil {
+		return nil, false, fmt.Errorf("controller manager is not initialized yet")
+	}
+	if isLocalCluster(name) {
+		return nil, false, newLocalClusterForbiddenError(name)
+	}
+	current, err := getClusterGatewayObjects(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !current.complete() {
+		return nil, false, apierrors.NewNotFound(clusterGatewayGroupResource(), name)
+	}
+	existing, err := convert(current.cluster, current.addon, getClusterEndpointType(ctx, name), current.secret)
+	if err != nil {
+		return nil, false, err
+	}
+	if options != nil && options.Preconditions != nil {
+		if rv := options.Preconditions.ResourceVersion; rv != nil && !isResourceVersionOf(*rv, existing) {
+			return nil, false, apierrors.NewConflict(clusterGatewayGroupResource(), name,
+				fmt.Errorf("the ResourceVersion in the precondition (%s) does not match the ResourceVersion in record (%s)", *rv, existing.ResourceVersion))
+		}
+		if uid := options.Preconditions.UID; uid != nil && *uid != existing.UID {
+			return nil, false, apierrors.NewConflict(clusterGatewayGroupResource(), name,
+				fmt.Errorf("the UID in the precondition (%s) does not match the UID in record (%s)", *uid, existing.UID))
+		}
+	}
+	if deleteValidation != nil {
+		if err := deleteValidation(ctx, existing); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var deleteOpts []client.DeleteOption
+	if options != nil && dryrun.IsDryRun(options.DryRun) {
+		deleteOpts = append(deleteOpts, client.DryRunAll)
+	}
+	deleting := []client.Object{current.secret, current.addon}
+	if current.cluster.Annotations[common.AnnotationKeyClusterGatewayCreatedBy] == common.AddonName {
+		deleting = append(deleting, current.cluster)
+	}
+	for _, obj := range deleting {
+		if err := singleton.GetClient().Delete(ctx, obj, deleteOpts...); err != nil && !apierrors.IsNotFound(err) {
+			return nil, false, err
+		}
+	}
+	return existing, true, nil
+}
+
+// clusterGatewayObjects are the OCM objects a ClusterGateway is converted
+// from, the missing objects are left nil.
+type clusterGatewayObjects struct {
+	cluster    *clusterv1.ManagedCluster
+	addon      *addonv1alpha1.ManagedClusterAddOn
+	secret     *v1.Secret
+	proxyAddon *addonv1alpha1.ManagedClusterAddOn
+	namespace  *v1.Namespace
+}
+
+func (o *clusterGatewayObjects) complete() bool {
+	return o.cluster != nil && o.addon != nil && o.secret != nil
+}
+
+func getClusterGatewayObjects(ctx context.Context, name string) (*clusterGatewayObjects, error) {
+	return readClusterGatewayObjects(ctx, singleton.GetClient(), name)
+}
+
+func readClusterGatewayObjects(ctx context.Context, reader client.Reader, name string) (*clusterGatewayObjects, error) {
+	o := &clusterGatewayObjects{}
+	get := func(key types.NamespacedName, obj client.Object) (bool, error) {
+		err := reader.Get(ctx, key, obj)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	cluster := &clusterv1.ManagedCluster{}
+	if found, err := get(types.NamespacedName{Name: name}, cluster); err != nil {
+		return nil, err
+	} else if found {
+		o.cluster = cluster
+	}
+	namespace := &v1.Namespace{}
+	if found, err := get(types.NamespacedName{Name: name}, namespace); err != nil {
+		return nil, err
+	} else if found {
+		o.namespace = namespace
+	}
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	if found, err := get(types.NamespacedName{Namespace: name, Name: common.AddonName}, addon); err != nil {
+		return nil, err
+	} else if found {
+		o.addon = addon
+	}
+	proxyAddon := &addonv1alpha1.ManagedClusterAddOn{}
+	if found, err := get(types.NamespacedName{Namespace: name, Name: common.ClusterProxyAddonName}, proxyAddon); err != nil {
+		return nil, err
+	} else if found {
+		o.proxyAddon = proxyAddon
+	}
+	secret := &v1.Secret{}
+	if found, err := get(types.NamespacedName{Namespace: name, Name: common.AddonName}, secret); err != nil {
+		return nil, err
+	} else if found {
+		o.secret = secret
+	}
+	return o, nil
+}
+
+// validateClusterGatewayCreate validates a ClusterGateway to be created which
+// must come with the credential.
+func validateClusterGatewayCreate(gw *ClusterGateway, current *clusterGatewayObjects) field.ErrorList {
+	errs := ValidateClusterGateway(gw)
+	if gw.Spec.Access.Credential == nil {
+		errs = append(errs, field.Required(field.NewPath("spec", "access", "credential"), "should provide cluster credential"))
+	}
+	errs = append(errs, validateClusterGatewayObjects(gw, current)...)
+	errs = append(errs, validateClusterNamespace(gw, current)...)
+	return errs
+}
+
+// validateClusterNamespace rejects taking over an existing namespace which
+// is not the namespace of a cluster, e.g. "kube-system" or "default". The
+// namespaces created for the clusters by either OCM or the gateway carry the
+// cluster name label, and the ones left by a partially failed create come
+// with the ManagedCluster created by the gateway.
+func validateClusterNamespace(gw *ClusterGateway, current *clusterGatewayObjects) field.ErrorList {
+	if current.namespace == nil || current.namespace.Labels[clusterv1.ClusterNameLabelKey] == gw.Name ||
+		current.cluster != nil && current.cluster.Annotations[common.AnnotationKeyClusterGatewayCreatedBy] == common.AddonName {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("metadata", "name"),
+		fmt.Sprintf("namespace %s exists and is not the namespace of a cluster", gw.Name))}
+}
+
+// validateClusterGatewayObjects rejects the writes which cannot be mapped
+// onto the existing OCM objects.
+func validateClusterGatewayObjects(gw *ClusterGateway, current *clusterGatewayObjects) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, apimachineryvalidation.ValidateObjectMeta(&gw.ObjectMeta, false,
+		apimachineryvalidation.NameIsDNSLabel, field.NewPath("metadata"))...)
+	if gw.Spec.Access.Endpoint != nil && config.ClusterProxyHost == "" {
+		if gw.Spec.Access.Endpoint.Type == ClusterEndpointTypeClusterProxy {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "access", "endpoint", "type"), "cluster-proxy is not enabled"))
+		}
+		if gw.Spec.Access.Endpoint.Fallback == ClusterEndpointTypeClusterProxy {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "access", "endpoint", "fallback"), "cluster-proxy is not enabled"))
+		}
+	}
+	if current.secret != nil && current.secret.Labels[common.LabelKeyIsManagedServiceAccount] == "true" {
+		if _, ok := current.secret.Labels[common.LabelKeyClusterCredentialType]; !ok {
+			existing := &ClusterAccessCredential{
+				Type:                CredentialTypeServiceAccountToken,
+				ServiceAccountToken: string(current.secret.Data[v1.ServiceAccountTokenKey]),
+			}
+			if !apiequality.Semantic.DeepEqual(existing, gw.Spec.Access.Credential) {
+				errs = append(errs, field.Forbidden(field.NewPath("spec", "access", "credential"), "the credential is managed by managed-serviceaccount"))
+			}
+		}
+	}
+	return errs
+}
+
+// inheritCredential fills the write-only credential contents omitted by the
+// update from the existing ClusterGateway.
+func inheritCredential(gw, existing *ClusterGateway) {
+	cred, old := gw.Spec.Access.Credential, existing.Spec.Access.Credential
+	switch {
+	case old == nil:
+	case cred == nil:
+		gw.Spec.Access.Credential = old.DeepCopy()
+	case cred.Type != old.Type:
+	case cred.Type == CredentialTypeServiceAccountToken && len(cred.ServiceAccountToken) == 0:
+		cred.ServiceAccountToken = old.ServiceAccountToken
+	case cred.Type == CredentialTypeX509Certificate && cred.X509 == nil:
+		cred.X509 = old.X509.DeepCopy()
+	case cred.Type == CredentialTypeExec && cred.Exec == nil:
+		cred.Exec = old.Exec.DeepCopy()
+	case cred.Type == CredentialTypeOIDCClientCredentials && cred.OIDC == nil:
+		cred.OIDC = old.OIDC.DeepCopy()
+	case cred.Type == CredentialTypeOIDCClientCredentials && old.OIDC != nil && len(cred.OIDC.ClientSecret) == 0:
+		cred.OIDC.ClientSecret = old.OIDC.ClientSecret
+	}
+}
+
+// inheritSSHBastionPrivateKey fills the write-only private key of the SSH
+// bastion omitted by the update from the existing ClusterGateway.
+func inheritSSHBastionPrivateKey(gw, existing *ClusterGateway) {
+	bastion, old := gw.Spec.Access.Endpoint, existing.Spec.Access.Endpoint
+	if bastion == nil || bastion.SSHBastion == nil || old == nil || old.SSHBastion == nil {
+		return
+	}
+	if len(bastion.SSHBastion.PrivateKey) == 0 {
+		bastion.SSHBastion.PrivateKey = old.SSHBastion.PrivateKey
+	}
+}
+
+// writeClusterGateway applies the ClusterGateway onto the OCM objects and
+// returns the ClusterGateway converted back from the written objects. Every
+// step of persisting is idempotent, so that the objects left by a partially
+// failed write are taken over by the retry: the objects which turn out to
+// exist upon creating are read from the hub kube-apiserver and the
+// ClusterGateway is applied again onto them.
+func writeClusterGateway(ctx context.Context, gw *ClusterGateway, current *clusterGatewayObjects, dryRun bool) (*ClusterGateway, error) {
+	hubAcceptsClient := false
+	if current.cluster == nil {
+		var err error
+		if hubAcceptsClient, err = canAcceptCluster(ctx, gw.Name); err != nil {
+			return nil, err
+		}
+	}
+	desired, err := current.apply(gw, hubAcceptsClient)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		err := current.persist(ctx, desired)
+		if apierrors.IsAlreadyExists(err) {
+			if current, err = readClusterGatewayObjects(ctx, singleton.GetAPIReader(), gw.Name); err != nil {
+				return nil, err
+			}
+			// created by another writer in the meantime
+			if current.complete() {
+				return nil, apierrors.NewAlreadyExists(clusterGatewayGroupResource(), gw.Name)
+			}
+			errs := validateClusterGatewayObjects(gw, current)
+			errs = append(errs, validateClusterNamespace(gw, current)...)
+			if len(errs) > 0 {
+				return nil, apierrors.NewInvalid(clusterGatewayGroupKind(), gw.Name, errs)
+			}
+			if desired, err = current.apply(gw, hubAcceptsClient); err != nil {
+				return nil, err
+			}
+			err = current.persist(ctx, desired)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return convert(desired.cluster, desired.addon, getClusterEndpointType(ctx, gw.Name), desired.secret)
+}
+
+// canAcceptCluster tells whether the requester is allowed to accept the
+// cluster, which OCM requires for setting hubAcceptsClient. The ManagedCluster
+// created for the requester not allowed is left to be accepted by others.
+func canAcceptCluster(ctx context.Context, name string) (bool, error) {
+	requester, ok := request.UserFrom(ctx)
+	if !ok || loopback.GetAuthorizer() == nil {
+		return false, nil
+	}
+	attr := authorizer.AttributesRecord{
+		User:            requester,
+		APIGroup:        "register.open-cluster-management.io",
+		Resource:        "managedclusters",
+		Subresource:     "accept",
+		Name:            name,
+		Verb:            "update",
+		ResourceRequest: true,
+	}
+	decision, _, err := loopback.GetAuthorizer().Authorize(ctx, attr)
+	if err != nil {
+		return false, apierrors.NewInternalError(fmt.Errorf("authorizing accepting cluster failed: %v", err))
+	}
+	return decision == authorizer.DecisionAllow, nil
+}
+
+// apply returns the OCM objects updated by the ClusterGateway without
+// mutating the current ones. The ManagedCluster created is accepted by the
+// hub if hubAcceptsClient is set.
+func (o *clusterGatewayObjects) apply(gw *ClusterGateway, hubAcceptsClient bool) (*clusterGatewayObjects, error) {
+	desired := &clusterGatewayObjects{}
+
+	// ManagedCluster
+	if o.cluster != nil {
+		desired.cluster = o.cluster.DeepCopy()
+	} else {
+		desired.cluster = &clusterv1.ManagedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: gw.Name,
+				Annotations: map[string]string{
+					common.AnnotationKeyClusterGatewayCreatedBy: common.AddonName,
+				},
+			},
+			Spec: clusterv1.ManagedClusterSpec{
+				HubAcceptsClient: hubAcceptsClient,
+			},
+		}
+	}
+	// the labels omitted by updating the ClusterGateway are removed except
+	// the ones owned by OCM, while taking over an existing ManagedCluster
+	// removes none
+	for k := range desired.cluster.Labels {
+		if _, ok := gw.Labels[k]; !ok && o.complete() && !isOCMLabel(k) {
+			delete(desired.cluster.Labels, k)
+		}
+	}
+	for k, v := range gw.Labels {
+		if desired.cluster.Labels == nil {
+			desired.cluster.Labels = make(map[string]string, len(gw.Labels))
+		}
+		desired.cluster.Labels[k] = v
+	}
+	for k := range selectClusterAnnotations(desired.cluster.Annotations) {
+		delete(desired.cluster.Annotations, k)
+	}
+	for k, v := range selectClusterAnnotations(gw.Annotations) {
+		if desired.cluster.Annotations == nil {
+			desired.cluster.Annotations = make(map[string]string)
+		}
+		desired.cluster.Annotations[k] = v
+	}
+	endpoint := gw.Spec.Access.Endpoint
+	if endpoint.Type == ClusterEndpointTypeConst || endpoint.Type == ClusterEndpointTypeSSHBastion || endpoint.Type == ClusterEndpointTypeClusterGateway ||
+		endpoint.Fallback == ClusterEndpointTypeConst {
+		clientConfig := clusterv1.ClientConfig{URL: endpoint.Const.Address}
+		if endpoint.Const.Insecure == nil || !*endpoint.Const.Insecure {
+			clientConfig.CABundle = endpoint.Const.CABundle
+		}
+		clientConfigs := []clusterv1.ClientConfig{clientConfig}
+		for _, alternative := range endpoint.Const.Alternatives {
+			clientConfigs = append(clientConfigs, clusterv1.ClientConfig{
+				URL:      alternative.Address,
+				CABundle: alternative.CABundle,
+			})
+		}
+		desired.cluster.Spec.ManagedClusterClientConfigs = clientConfigs
+	}
+
+	// Namespace of the cluster
+	if o.namespace != nil {
+		desired.namespace = o.namespace
+	} else {
+		// the label is required by the admission policy narrowing the
+		// namespaces created by the gateway to the cluster namespaces
+		desired.namespace = &v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   gw.Name,
+			Labels: map[string]string{clusterv1.ClusterNameLabelKey: gw.Name},
+		}}
+	}
+
+	// cluster-gateway addon
+	if o.addon != nil {
+		desired.addon = o.addon.DeepCopy()
+	} else {
+		desired.addon = &addonv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: gw.Name,
+				Name:      common.AddonName,
+			},
+		}
+	}
+	if desired.addon.Annotations == nil {
+		desired.addon.Annotations = make(map[string]string)
+	}
+	delete(desired.addon.Annotations, "proxy-url")
+	if (endpoint.Type == ClusterEndpointTypeConst || endpoint.Fallback == ClusterEndpointTypeConst) &&
+		endpoint.Const.ProxyURL != nil && len(*endpoint.Const.ProxyURL) > 0 {
+		desired.addon.Annotations["proxy-url"] = *endpoint.Const.ProxyURL
+	}
+	delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayEgressProxy)
+	if (endpoint.Type == ClusterEndpointTypeConst || endpoint.Fallback == ClusterEndpointTypeConst) && endpoint.Const.EgressProxy != nil {
+		data, err := json.Marshal(endpoint.Const.EgressProxy)
+		if err != nil {
+			return nil, err
+		}
+		desired.addon.Annotations[common.AnnotationKeyClusterGatewayEgressProxy] = string(data)
+	}
+	// the endpoint type pinned and the endpoint overridden by the addon
+	// follow the written endpoint
+	if _, ok := desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointType]; ok &&
+		(endpoint.Type == ClusterEndpointTypeConst || endpoint.Type == ClusterEndpointTypeClusterProxy) {
+		desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointType] = string(endpoint.Type)
+	}
+	if endpoint.Const != nil {
+		if _, ok := desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointAddress]; ok {
+			desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointAddress] = endpoint.Const.Address
+		}
+		if _, ok := desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointCABundle]; ok {
+			desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointCABundle] = ""
+			if endpoint.Const.Insecure == nil || !*endpoint.Const.Insecure {
+				desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointCABundle] = string(endpoint.Const.CABundle)
+			}
+		}
+	}
+	// the CA pinned for the endpoint overridden by the addon is dropped once
+	// the endpoint changes, which is pinned again on the first contact
+	if o.addon != nil {
+		for _, key := range []string{common.AnnotationKeyClusterGatewayEndpointAddress, common.AnnotationKeyClusterGatewayEndpointCABundle} {
+			if desired.addon.Annotations[key] != o.addon.Annotations[key] {
+				delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayPinnedCABundle)
+				delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayPinnedCAAddress)
+				break
+			}
+		}
+	}
+	delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayEndpointFallback)
+	if len(endpoint.Fallback) > 0 {
+		desired.addon.Annotations[common.AnnotationKeyClusterGatewayEndpointFallback] = string(endpoint.Fallback)
+	}
+	delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayReverseTunnel)
+	if endpoint.Type == ClusterEndpointTypeReverseTunnel {
+		desired.addon.Annotations[common.AnnotationKeyClusterGatewayReverseTunnel] = "true"
+	}
+	delete(desired.addon.Annotations, common.AnnotationKeyClusterGatewayDownstreamCluster)
+	if endpoint.Type == ClusterEndpointTypeClusterGateway {
+		desired.addon.Annotations[common.AnnotationKeyClusterGatewayDownstreamCluster] = endpoint.ClusterGateway.Cluster
+	}
+	if utilfeature.DefaultMutableFeatureGate.Enabled(featuregates.ClientIdentityPenetration) {
+		delete(desired.addon.Annotations, AnnotationClusterGatewayProxyConfiguration)
+		if gw.Spec.ProxyConfig != nil {
+			data, err := json.Marshal(gw.Spec.ProxyConfig)
+			if err != nil {
+				return nil, err
+			}
+			desired.addon.Annotations[AnnotationClusterGatewayProxyConfiguration] = string(data)
+		}
+	}
+
+	// cluster-proxy addon
+	desired.proxyAddon = o.proxyAddon
+	if (endpoint.Type == ClusterEndpointTypeClusterProxy || endpoint.Fallback == ClusterEndpointTypeClusterProxy) && o.proxyAddon == nil {
+		desired.proxyAddon = &addonv1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: gw.Name,
+				Name:      common.ClusterProxyAddonName,
+			},
+		}
+	}
+
+	// cluster-gateway secret
+	if o.secret != nil {
+		desired.secret = o.secret.DeepCopy()
+	} else {
+		desired.secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: gw.Name,
+				Name:      common.AddonName,
+			},
+			Type: v1.SecretTypeOpaque,
+		}
+	}
+	for _, key := range []string{
+		common.SecretKeySSHBastionHost,
+		common.SecretKeySSHBastionUser,
+		common.SecretKeySSHBastionPrivateKey,
+		common.SecretKeySSHBastionKnownHosts,
+	} {
+		delete(desired.secret.Data, key)
+	}
+	if endpoint.Type == ClusterEndpointTypeSSHBastion {
+		if desired.secret.Data == nil {
+			desired.secret.Data = make(map[string][]byte)
+		}
+		desired.secret.Data[common.SecretKeySSHBastionHost] = []byte(endpoint.SSHBastion.Host)
+		desired.secret.Data[common.SecretKeySSHBastionUser] = []byte(endpoint.SSHBastion.User)
+		desired.secret.Data[common.SecretKeySSHBastionPrivateKey] = endpoint.SSHBastion.PrivateKey
+		desired.secret.Data[common.SecretKeySSHBastionKnownHosts] = endpoint.SSHBastion.KnownHosts
+	}
+	if cred := gw.Spec.Access.Credential; cred != nil {
+		if _, ok := desired.secret.Labels[common.LabelKeyClusterCredentialType]; !ok &&
+			desired.secret.Labels[common.LabelKeyIsManagedServiceAccount] == "true" {
+			// the credentials of managed-serviceaccount are left untouched
+			return desired, nil
+		}
+		if desired.secret.Labels == nil {
+			desired.secret.Labels = make(map[string]string)
+		}
+		desired.secret.Labels[common.LabelKeyClusterCredentialType] = string(cred.Type)
+		delete(desired.secret.Annotations, common.AnnotationKeyClusterCredentialTokenRequest)
+		if cred.TokenRequest != nil {
+			data, err := json.Marshal(cred.TokenRequest)
+			if err != nil {
+				return nil, err
+			}
+			if desired.secret.Annotations == nil {
+				desired.secret.Annotations = make(map[string]string)
+			}
+			desired.secret.Annotations[common.AnnotationKeyClusterCredentialTokenRequest] = string(data)
+		}
+		if desired.secret.Data == nil {
+			desired.secret.Data = make(map[string][]byte)
+		}
+		delete(desired.secret.Data, v1.TLSCertKey)
+		delete(desired.secret.Data, v1.TLSPrivateKeyKey)
+		delete(desired.secret.Data, v1.ServiceAccountTokenKey)
+		delete(desired.secret.Data, common.SecretKeyClusterCredentialExec)
+		delete(desired.secret.Data, common.SecretKeyClusterCredentialOIDCIssuerURL)
+		delete(desired.secret.Data, common.SecretKeyClusterCredentialOIDCClientID)
+		delete(desired.secret.Data, common.SecretKeyClusterCredentialOIDCClientSecret)
+		delete(desired.secret.Data, common.SecretKeyClusterCredentialOIDCScopes)
+		switch cred.Type {
+		case CredentialTypeX509Certificate:
+			desired.secret.Data[v1.TLSCertKey] = cred.X509.Certificate
+			desired.secret.Data[v1.TLSPrivateKeyKey] = cred.X509.PrivateKey
+		case CredentialTypeServiceAccountToken:
+			desired.secret.Data[v1.ServiceAccountTokenKey] = []byte(cred.ServiceAccountToken)
+		case CredentialTypeExec:
+			data, err := json.Marshal(cred.Exec)
+			if err != nil {
+				return nil, err
+			}
+			desired.secret.Data[common.SecretKeyClusterCredentialExec] = data
+		case CredentialTypeOIDCClientCredentials:
+			desired.secret.Data[common.SecretKeyClusterCredentialOIDCIssuerURL] = []byte(cred.OIDC.IssuerURL)
+			desired.secret.Data[common.SecretKeyClusterCredentialOIDCClientID] = []byte(cred.OIDC.ClientID)
+			desired.secret.Data[common.SecretKeyClusterCredentialOIDCClientSecret] = []byte(cred.OIDC.ClientSecret)
+			if len(cred.OIDC.Scopes) > 0 {
+				desired.secret.Data[common.SecretKeyClusterCredentialOIDCScopes] = []byte(strings.Join(cred.OIDC.Scopes, " "))
+			}
+		}
+	}
+	return desired, nil
+}
+
+// isOCMLabel tells whether the label is owned by OCM, e.g. the cluster set
+// and the feature labels of the ManagedClusters.
+func isOCMLabel(key string) bool {
+	prefix, _, ok := strings.Cut(key, "/")
+	return ok && (prefix == "open-cluster-management.io" || strings.HasSuffix(prefix, ".open-cluster-management.io"))
+}
+
+// persist creates the missing objects and patches the existing ones towards
+// the desired state, which conflicts if the existing ones changed since read.
+// The desired objects are refreshed by the responses. The objects created
+// since read are reported by the AlreadyExists error.
+func (o *clusterGatewayObjects) persist(ctx context.Context, desired *clusterGatewayObjects) error {
+	write := func(current, desired client.Object) error {
+		if current == nil || current.GetResourceVersion() == "" {
+			return singleton.GetClient().Create(ctx, desired)
+		}
+		return singleton.GetClient().Patch(ctx, desired, client.MergeFromWithOptions(current, client.MergeFromWithOptimisticLock{}))
+	}
+	var cluster client.Object
+	if o.cluster != nil {
+		cluster = o.cluster
+	}
+	if err := write(cluster, desired.cluster); err != nil {
+		return err
+	}
+	if o.namespace == nil {
+		// the namespace created since read is validated before taken over
+		if err := singleton.GetClient().Create(ctx, desired.namespace); err != nil {
+			return err
+		}
+	}
+	var addon client.Object
+	if o.addon != nil {
+		addon = o.addon
+	}
+	if err := write(addon, desired.addon); err != nil {
+		return err
+	}
+	if o.proxyAddon == nil && desired.proxyAddon != nil {
+		if err := singleton.GetClient().Create(ctx, desired.proxyAddon); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	var secret client.Object
+	if o.secret != nil {
+		secret = o.secret
+	}
+	return write(secret, desired.secret)
+}
+
+// UnmarshalJSON reads the credential contents which are never served back to
+// the clients, so that the credentials can be written through the API.
+func (in *ClusterAccessCredential) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type                CredentialType         `json:"type"`
+		ServiceAccountToken string                 `json:"serviceAccountToken,omitempty"`
+		X509                *X509                  `json:"x509,omitempty"`
+		Exec                *ExecConfig            `json:"exec,omitempty"`
+		OIDC                *OIDCClientCredentials `json:"oidc,omitempty"`
+		TokenRequest        *TokenRequestConfig    `json:"tokenRequest,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	in.Type = raw.Type
+	in.ServiceAccountToken = raw.ServiceAccountToken
+	in.X509 = raw.X509
+	in.Exec = raw.Exec
+	in.OIDC = raw.OIDC
+	in.TokenRequest = raw.TokenRequest
+	return nil
+}
+
+// UnmarshalJSON reads the private key which is never served back to the
+// clients, so that the SSH bastion can be written through the API.
+func (in *ClusterEndpointSSHBastion) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Host       string `json:"host"`
+		User       string `json:"user"`
+		KnownHosts []byte `json:"knownHosts"`
+		PrivateKey []byte `json:"privateKey,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	in.Host = raw.Host
+	in.User = raw.User
+	in.KnownHosts = raw.KnownHosts
+	in.PrivateKey = raw.PrivateKey
+	return nil
+}
+
+func clusterGatewayGroupResource() schema.GroupResource {
+	return schema.GroupResource{
+		Group:    config.MetaApiGroupName,
+		Resource: config.MetaApiResourceName,
+	}
+}
+
+func clusterGatewayGroupKind() schema.GroupKind {
+	return schema.GroupKind{
+		Group: config.MetaApiGroupName,
+		Kind:  "ClusterGateway",
+	}
+}
@@ -0,0 +1,540 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/utils/pointer"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/apiserver-runtime/pkg/util/loopback"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newWriteTestClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, clusterv1.Install(scheme))
+	require.NoError(t, addonv1alpha1.Install(scheme))
+	fakeClient := ctrlfake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	singleton.SetClient(fakeClient)
+	singleton.SetAPIReader(fakeClient)
+	return fakeClient
+}
+
+func constClusterGateway(name string, cred *ClusterAccessCredential) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"env": "prod"},
+		},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  testEndpoint,
+						CABundle: []byte(testCAData),
+						ProxyURL: pointer.String("http://proxy:3128"),
+					},
+				},
+				Credential: cred,
+			},
+		},
+	}
+}
+
+func TestCreateClusterGateway(t *testing.T) {
+	original := loopback.GetAuthorizer()
+	defer loopback.SetAuthorizer(original)
+	loopback.SetAuthorizer(authorizer.AuthorizerFunc(func(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		if a.GetUser().GetName() == "admin" && a.GetAPIGroup() == "register.open-cluster-management.io" &&
+			a.GetResource() == "managedclusters" && a.GetSubresource() == "accept" && a.GetVerb() == "update" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionNoOpinion, "", nil
+	}))
+	ctx := request.WithUser(context.TODO(), &user.DefaultInfo{Name: "admin"})
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+
+	// dry-run persists nothing
+	_, err := storage.Create(ctx, constClusterGateway("foo", x509Credential()), nil, &metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, &clusterv1.ManagedCluster{})))
+
+	out, err := storage.Create(ctx, constClusterGateway("foo", x509Credential()), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	created := out.(*ClusterGateway)
+	assert.Equal(t, map[string]string{"env": "prod"}, created.Labels)
+	assert.Equal(t, x509Credential(), created.Spec.Access.Credential)
+	assert.Equal(t, testEndpoint, created.Spec.Access.Endpoint.Const.Address)
+	assert.Equal(t, pointer.String("http://proxy:3128"), created.Spec.Access.Endpoint.Const.ProxyURL)
+
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, cluster))
+	assert.True(t, cluster.Spec.HubAcceptsClient)
+	assert.Equal(t, common.AddonName, cluster.Annotations[common.AnnotationKeyClusterGatewayCreatedBy])
+	assert.Equal(t, []clusterv1.ClientConfig{{URL: testEndpoint, CABundle: []byte(testCAData)}}, cluster.Spec.ManagedClusterClientConfigs)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, &corev1.Namespace{}))
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, secret))
+	assert.Equal(t, string(CredentialTypeX509Certificate), secret.Labels[common.LabelKeyClusterCredentialType])
+	assert.Equal(t, x509Data, secret.Data)
+
+	// the created object is readable
+	got, err := storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created.ResourceVersion, got.(*ClusterGateway).ResourceVersion)
+
+	_, err = storage.Create(ctx, constClusterGateway("foo", x509Credential()), nil, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsAlreadyExists(err))
+
+	// the cluster created by the requester not allowed to accept it is left
+	// to be accepted
+	_, err = storage.Create(request.WithUser(context.TODO(), &user.DefaultInfo{Name: "alice"}),
+		constClusterGateway("baz", x509Credential()), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "baz"}, cluster))
+	assert.False(t, cluster.Spec.HubAcceptsClient)
+
+	invalid := constClusterGateway("bar", nil)
+	invalid.Spec.Access.Endpoint.Const.Address = "http://localhost"
+	_, err = storage.Create(ctx, invalid, nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err))
+	causes := err.(apierrors.APIStatus).Status().Details.Causes
+	fields := make([]string, 0, len(causes))
+	for _, cause := range causes {
+		fields = append(fields, cause.Field)
+	}
+	assert.ElementsMatch(t, []string{"spec.access.endpoint", "spec.access.credential"}, fields)
+}
+
+// staleCacheClient has not observed the ManagedClusters yet.
+type staleCacheClient struct {
+	client.Client
+}
+
+func (c staleCacheClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*clusterv1.ManagedCluster); ok {
+		return apierrors.NewNotFound(clusterv1.Resource("managedclusters"), key.Name)
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func TestCreateClusterGatewayAfterPartialWrite(t *testing.T) {
+	ctx := context.TODO()
+	// the ManagedCluster is left by a create failed before writing the rest
+	fakeClient := newWriteTestClient(t, &clusterv1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Labels:      map[string]string{"env": "prod"},
+			Annotations: map[string]string{common.AnnotationKeyClusterGatewayCreatedBy: common.AddonName},
+			Finalizers:  []string{"cluster.open-cluster-management.io/api-resource-cleanup"},
+		},
+		Spec: clusterv1.ManagedClusterSpec{HubAcceptsClient: true},
+	})
+	singleton.SetClient(staleCacheClient{Client: fakeClient})
+	storage := &ClusterGateway{}
+
+	out, err := storage.Create(ctx, constClusterGateway("foo", x509Credential()), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, x509Credential(), out.(*ClusterGateway).Spec.Access.Credential)
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, cluster))
+	assert.Equal(t, []string{"cluster.open-cluster-management.io/api-resource-cleanup"}, cluster.Finalizers)
+	assert.Equal(t, []clusterv1.ClientConfig{{URL: testEndpoint, CABundle: []byte(testCAData)}}, cluster.Spec.ManagedClusterClientConfigs)
+	namespace := &corev1.Namespace{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, namespace))
+	assert.Equal(t, "foo", namespace.Labels[clusterv1.ClusterNameLabelKey])
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, &corev1.Secret{}))
+
+	// the complete ClusterGateway is never overwritten by creating
+	_, err = storage.Create(ctx, constClusterGateway("foo", x509Credential()), nil, &metav1.CreateOptions{})
+	assert.True(t, apierrors.IsAlreadyExists(err), "unexpected error: %v", err)
+}
+
+func TestCreateClusterGatewayIntoExistingNamespace(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		// the namespace of the cluster registered to OCM
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "registered",
+			Labels: map[string]string{clusterv1.ClusterNameLabelKey: "registered"},
+		}},
+		managedCluster("registered", testEndpoint, []byte(testCAData)),
+	)
+	storage := &ClusterGateway{}
+
+	// the namespaces other than the cluster namespaces are never taken over
+	_, err := storage.Create(ctx, constClusterGateway("kube-system", x509Credential()), nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err), "unexpected error: %v", err)
+	assert.Equal(t, "metadata.name", err.(apierrors.APIStatus).Status().Details.Causes[0].Field)
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: "kube-system"}, &clusterv1.ManagedCluster{})))
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: common.AddonName}, &corev1.Secret{})))
+
+	_, err = storage.Create(ctx, constClusterGateway("registered", x509Credential()), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "registered", Name: common.AddonName}, &corev1.Secret{}))
+}
+
+func TestUpdateClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t,
+		managedCluster("foo", testEndpoint, []byte(testCAData)),
+		gatewayAddon("foo", nil),
+		credentialSecret("foo", tokenLabels, tokenData),
+	)
+	storage := &ClusterGateway{}
+	out, err := storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	existing := out.(*ClusterGateway)
+
+	// updating without the credential contents keeps the stored token
+	updating := existing.DeepCopy()
+	updating.Labels = map[string]string{"env": "dev"}
+	updating.Spec.Access.Endpoint.Const.Address = "https://example.com:6443"
+	updating.Spec.Access.Credential = &ClusterAccessCredential{Type: CredentialTypeServiceAccountToken}
+	out, created, err := storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	updated := out.(*ClusterGateway)
+	assert.Equal(t, map[string]string{"env": "dev"}, updated.Labels)
+	assert.Equal(t, "https://example.com:6443", updated.Spec.Access.Endpoint.Const.Address)
+	assert.Equal(t, testToken, updated.Spec.Access.Credential.ServiceAccountToken)
+	assert.NotEqual(t, existing.ResourceVersion, updated.ResourceVersion)
+
+	// switching the credential type replaces the secret contents
+	updating = updated.DeepCopy()
+	updating.Spec.Access.Credential = x509Credential()
+	_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, secret))
+	assert.Equal(t, string(CredentialTypeX509Certificate), secret.Labels[common.LabelKeyClusterCredentialType])
+	assert.Equal(t, x509Data, secret.Data)
+
+	// the alternative endpoints are written as the subsequent client configs
+	out, err = storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	updating = out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint.Const.Alternatives = []ClusterEndpointAlternative{
+		{Address: "https://backup:6443", CABundle: []byte("backupCAData")},
+	}
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, updating.Spec.Access.Endpoint.Const.Alternatives, out.(*ClusterGateway).Spec.Access.Endpoint.Const.Alternatives)
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, cluster))
+	assert.Equal(t, []clusterv1.ClientConfig{
+		{URL: "https://example.com:6443", CABundle: []byte(testCAData)},
+		{URL: "https://backup:6443", CABundle: []byte("backupCAData")},
+	}, cluster.Spec.ManagedClusterClientConfigs)
+
+	// stale resourceVersion conflicts
+	_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(existing), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsConflict(err))
+
+	// the labels owned by OCM are kept unless written
+	cluster.Labels["cluster.open-cluster-management.io/clusterset"] = "default"
+	require.NoError(t, fakeClient.Update(ctx, cluster))
+	out, err = storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	updating = out.(*ClusterGateway).DeepCopy()
+	updating.Labels = map[string]string{"env": "prod"}
+	_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, cluster))
+	assert.Equal(t, map[string]string{"env": "prod", "cluster.open-cluster-management.io/clusterset": "default"}, cluster.Labels)
+
+	// the objects changed since read are never overwritten
+	current, err := getClusterGatewayObjects(ctx, "foo")
+	require.NoError(t, err)
+	cluster.Labels["env"] = "test"
+	require.NoError(t, fakeClient.Update(ctx, cluster))
+	desired, err := current.apply(updating, false)
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsConflict(current.persist(ctx, desired)))
+
+	// updating a missing object creates nothing unless allowed
+	_, _, err = storage.Update(ctx, "bar", rest.DefaultUpdatedObjectInfo(constClusterGateway("bar", x509Credential())), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, created, err = storage.Update(ctx, "bar", rest.DefaultUpdatedObjectInfo(constClusterGateway("bar", x509Credential())), nil, nil, true, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.True(t, created)
+}
+
+func TestUpdateManagedServiceAccountClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	newWriteTestClient(t,
+		managedCluster("foo", testEndpoint, []byte(testCAData)),
+		gatewayAddon("foo", nil),
+		credentialSecret("foo", map[string]string{common.LabelKeyIsManagedServiceAccount: "true"}, tokenData),
+	)
+	storage := &ClusterGateway{}
+	out, err := storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+
+	updating := out.(*ClusterGateway).DeepCopy()
+	updating.Labels = map[string]string{"env": "dev"}
+	updating.Spec.Access.Credential = nil
+	_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	updating.ResourceVersion = ""
+	updating.Spec.Access.Credential = x509Credential()
+	_, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsInvalid(err), "unexpected error: %v", err)
+}
+
+func TestDeleteClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t,
+		managedCluster("foo", testEndpoint, []byte(testCAData)),
+		gatewayAddon("foo", nil),
+		credentialSecret("foo", x509Labels, x509Data),
+	)
+	storage := &ClusterGateway{}
+
+	_, _, err := storage.Delete(ctx, "foo", nil, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: pointer.String("1")},
+	})
+	assert.True(t, apierrors.IsConflict(err))
+
+	_, deleted, err := storage.Delete(ctx, "foo", nil, &metav1.DeleteOptions{})
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	// the ManagedCluster not created by ClusterGateway is retained
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, &clusterv1.ManagedCluster{}))
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, &corev1.Secret{})))
+	_, err = storage.Get(ctx, "foo", &metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	_, _, err = storage.Delete(ctx, "foo", nil, &metav1.DeleteOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	_, err = storage.Create(ctx, constClusterGateway("bar", x509Credential()), nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, _, err = storage.Delete(ctx, "bar", nil, &metav1.DeleteOptions{})
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: "bar"}, &clusterv1.ManagedCluster{})))
+}
+
+func TestClusterAccessCredentialJSON(t *testing.T) {
+	cred := &ClusterAccessCredential{}
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"ServiceAccountToken","serviceAccountToken":"token"}`), cred))
+	assert.Equal(t, &ClusterAccessCredential{Type: CredentialTypeServiceAccountToken, ServiceAccountToken: "token"}, cred)
+
+	// the credential contents are never served
+	data, err := json.Marshal(x509Credential())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"X509Certificate"}`, string(data))
+}
+
+func TestWriteSSHBastionClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+	_, privateKey := newSSHClientKey(t)
+	hostKey, _ := newSSHClientKey(t)
+	knownHosts := []byte(knownhosts.Line([]string{"bastion.example.com"}, hostKey))
+
+	gw := constClusterGateway("foo", x509Credential())
+	gw.Spec.Access.Endpoint.Type = ClusterEndpointTypeSSHBastion
+	gw.Spec.Access.Endpoint.Const.ProxyURL = nil
+	gw.Spec.Access.Endpoint.SSHBastion = &ClusterEndpointSSHBastion{
+		Host:       "bastion.example.com",
+		User:       "gateway",
+		KnownHosts: knownHosts,
+	}
+	_, err := storage.Create(ctx, gw.DeepCopy(), nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err))
+	assert.Equal(t, "spec.access.endpoint.sshBastion.privateKey", err.(apierrors.APIStatus).Status().Details.Causes[0].Field)
+
+	gw.Spec.Access.Endpoint.SSHBastion.PrivateKey = privateKey
+	out, err := storage.Create(ctx, gw, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, gw.Spec.Access.Endpoint.SSHBastion, out.(*ClusterGateway).Spec.Access.Endpoint.SSHBastion)
+	secret := &corev1.Secret{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, secret))
+	assert.Equal(t, []byte("bastion.example.com"), secret.Data[common.SecretKeySSHBastionHost])
+	assert.Equal(t, privateKey, secret.Data[common.SecretKeySSHBastionPrivateKey])
+
+	// updating without the private key keeps the stored one
+	updating := out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint.SSHBastion.PrivateKey = nil
+	updating.Spec.Access.Endpoint.SSHBastion.User = "admin"
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", out.(*ClusterGateway).Spec.Access.Endpoint.SSHBastion.User)
+	assert.Equal(t, privateKey, out.(*ClusterGateway).Spec.Access.Endpoint.SSHBastion.PrivateKey)
+
+	// switching to the const endpoint removes the bastion
+	updating = out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint.Type = ClusterEndpointTypeConst
+	updating.Spec.Access.Endpoint.SSHBastion = nil
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ClusterEndpointTypeConst, out.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, secret))
+	assert.NotContains(t, secret.Data, common.SecretKeySSHBastionPrivateKey)
+}
+
+func TestWriteReverseTunnelClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+
+	gw := constClusterGateway("foo", x509Credential())
+	gw.Spec.Access.Endpoint.Type = ClusterEndpointTypeReverseTunnel
+	gw.Spec.Access.Endpoint.Const = nil
+	out, err := storage.Create(ctx, gw, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ClusterEndpointTypeReverseTunnel, out.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.Equal(t, "true", addon.Annotations[common.AnnotationKeyClusterGatewayReverseTunnel])
+
+	// switching to the const endpoint opts the cluster out of the tunnel
+	updating := out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint = constClusterGateway("foo", x509Credential()).Spec.Access.Endpoint
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ClusterEndpointTypeConst, out.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayReverseTunnel)
+}
+
+func TestWriteChainedClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+
+	gw := constClusterGateway("foo", x509Credential())
+	gw.Spec.Access.Endpoint.Type = ClusterEndpointTypeClusterGateway
+	gw.Spec.Access.Endpoint.Const.ProxyURL = nil
+	gw.Spec.Access.Endpoint.ClusterGateway = &ClusterEndpointClusterGateway{Cluster: "remote/foo"}
+	_, err := storage.Create(ctx, gw.DeepCopy(), nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err))
+	assert.Equal(t, "spec.access.endpoint.clusterGateway.cluster", err.(apierrors.APIStatus).Status().Details.Causes[0].Field)
+
+	gw.Spec.Access.Endpoint.ClusterGateway.Cluster = "remote-foo"
+	out, err := storage.Create(ctx, gw, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, gw.Spec.Access.Endpoint, out.(*ClusterGateway).Spec.Access.Endpoint)
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.Equal(t, "remote-foo", addon.Annotations[common.AnnotationKeyClusterGatewayDownstreamCluster])
+	cluster := &clusterv1.ManagedCluster{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, cluster))
+	assert.Equal(t, []clusterv1.ClientConfig{{URL: testEndpoint, CABundle: []byte(testCAData)}}, cluster.Spec.ManagedClusterClientConfigs)
+
+	// switching to the const endpoint drops the downstream cluster gateway
+	updating := out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint = constClusterGateway("foo", x509Credential()).Spec.Access.Endpoint
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ClusterEndpointTypeConst, out.(*ClusterGateway).Spec.Access.Endpoint.Type)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayDownstreamCluster)
+}
+
+func TestWriteFallbackClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+
+	gw := constClusterGateway("foo", x509Credential())
+	gw.Spec.Access.Endpoint.Fallback = ClusterEndpointTypeClusterProxy
+	_, err := storage.Create(ctx, gw.DeepCopy(), nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err), "cluster-proxy is not enabled")
+
+	originalHost := config.ClusterProxyHost
+	config.ClusterProxyHost = "proxy-entrypoint"
+	defer func() { config.ClusterProxyHost = originalHost }()
+	out, err := storage.Create(ctx, gw, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, gw.Spec.Access.Endpoint, out.(*ClusterGateway).Spec.Access.Endpoint)
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.Equal(t, string(ClusterEndpointTypeClusterProxy), addon.Annotations[common.AnnotationKeyClusterGatewayEndpointFallback])
+	proxyAddon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.ClusterProxyAddonName}, proxyAddon))
+
+	// the endpoint overridden by the addon follows the written endpoint
+	addon.Annotations[common.AnnotationKeyClusterGatewayEndpointAddress] = "https://override.example.com"
+	addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle] = "pinned"
+	addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCAAddress] = "https://override.example.com"
+	require.NoError(t, fakeClient.Update(ctx, addon))
+	out, err = storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://override.example.com", out.(*ClusterGateway).Spec.Access.Endpoint.Const.Address)
+	updating := out.(*ClusterGateway).DeepCopy()
+	updating.Spec.Access.Endpoint.Const.Address = "https://updated.example.com"
+	updating.Spec.Access.Endpoint.Fallback = ""
+	out, _, err = storage.Update(ctx, "foo", rest.DefaultUpdatedObjectInfo(updating), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://updated.example.com", out.(*ClusterGateway).Spec.Access.Endpoint.Const.Address)
+	assert.Empty(t, out.(*ClusterGateway).Spec.Access.Endpoint.Fallback)
+	require.NoError(t, fakeClient.Get(ctx, types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	assert.Equal(t, "https://updated.example.com", addon.Annotations[common.AnnotationKeyClusterGatewayEndpointAddress])
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayEndpointFallback)
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayPinnedCABundle, "the CA pinned for the former endpoint is dropped")
+	assert.NotContains(t, addon.Annotations, common.AnnotationKeyClusterGatewayPinnedCAAddress)
+}
+
+func TestWriteInsecureClusterGateway(t *testing.T) {
+	ctx := context.TODO()
+	fakeClient := newWriteTestClient(t)
+	storage := &ClusterGateway{}
+
+	gw := constClusterGateway("foo", x509Credential())
+	gw.Spec.Access.Endpoint.Const.Insecure = pointer.Bool(true)
+	_, err := storage.Create(ctx, gw.DeepCopy(), nil, &metav1.CreateOptions{})
+	require.True(t, apierrors.IsInvalid(err))
+	causes := err.(apierrors.APIStatus).Status().Details.Causes
+	require.Len(t, causes, 1)
+	assert.Equal(t, "spec.access.endpoint.const.insecure", causes[0].Field)
+	assert.True(t, apierrors.IsNotFound(fakeClient.Get(ctx, types.NamespacedName{Name: "foo"}, &clusterv1.ManagedCluster{})))
+
+	// the insecure endpoint is read back as written once allowed
+	config.AllowInsecureEndpoints = true
+	defer func() { config.AllowInsecureEndpoints = false }()
+	out, err := storage.Create(ctx, gw, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pointer.Bool(true), out.(*ClusterGateway).Spec.Access.Endpoint.Const.Insecure)
+	assert.Empty(t, out.(*ClusterGateway).Spec.Access.Endpoint.Const.CABundle)
+	out, err = storage.Get(ctx, "foo", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pointer.Bool(true), out.(*ClusterGateway).Spec.Access.Endpoint.Const.Insecure)
+}
+
+func TestClusterEndpointSSHBastionJSON(t *testing.T) {
+	bastion := &ClusterEndpointSSHBastion{}
+	require.NoError(t, json.Unmarshal([]byte(`{"host":"bastion","user":"gateway","knownHosts":"a25vd24=","privateKey":"a2V5"}`), bastion))
+	assert.Equal(t, &ClusterEndpointSSHBastion{Host: "bastion", User: "gateway", KnownHosts: []byte("known"), PrivateKey: []byte("key")}, bastion)
+
+	// the private key is never served
+	data, err := json.Marshal(bastion)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host":"bastion","user":"gateway","knownHosts":"a25vd24="}`, string(data))
+}
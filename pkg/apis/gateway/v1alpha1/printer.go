@@ -1,35 +1,59 @@
 package v1alpha1
 
 import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
+// The columns of priority 1 are printed by "kubectl get -o wide" only. The
+// labels are printed by "--show-labels" from the objects of the rows.
 var (
 	definitions = []metav1.TableColumnDefinition{
 		{Name: "Name", Type: "string", Format: "name", Description: "the name of the cluster"},
 		{Name: "Credential-Type", Type: "string", Description: "the credential type"},
 		{Name: "Endpoint-Type", Type: "string", Description: "the endpoint type"},
 		{Name: "Healthy", Type: "string", Description: "the healthiness of the gateway"},
+		{Name: "Age", Type: "string", Description: "the age of the cluster"},
+		{Name: "Endpoint", Type: "string", Priority: 1, Description: "the address of the const endpoint"},
+		{Name: "Healthy-Reason", Type: "string", Priority: 1, Description: "the reason of the healthiness"},
+		{Name: "Credential-Expiry", Type: "string", Priority: 1, Description: "the expiry of the X.509 certificate or the service account token"},
+		{Name: "Egress-Proxy", Type: "string", Priority: 1, Description: "the egress proxy of the const endpoint"},
 	}
 )
 
-func printClusterGateway(in *ClusterGateway) *metav1.Table {
-	return &metav1.Table{
+func printClusterGateway(in *ClusterGateway, options *metav1.TableOptions) *metav1.Table {
+	return withTableOptions(&metav1.Table{
 		ColumnDefinitions: definitions,
 		Rows:              []metav1.TableRow{printClusterGatewayRow(in)},
-	}
+	}, options)
 }
 
-func printClusterGatewayList(in *ClusterGatewayList) *metav1.Table {
+func printClusterGatewayList(in *ClusterGatewayList, options *metav1.TableOptions) *metav1.Table {
 	t := &metav1.Table{
 		ColumnDefinitions: definitions,
 	}
+	t.ResourceVersion = in.ResourceVersion
+	t.Continue = in.Continue
 	for _, c := range in.Items {
 		t.Rows = append(t.Rows, printClusterGatewayRow(&c))
 	}
+	return withTableOptions(t, options)
+}
+
+func withTableOptions(t *metav1.Table, options *metav1.TableOptions) *metav1.Table {
+	if options != nil && options.NoHeaders {
+		t.ColumnDefinitions = nil
+	}
 	return t
 }
 
@@ -39,10 +63,95 @@ func printClusterGatewayRow(c *ClusterGateway) metav1.TableRow {
 	if c.Spec.Access.Credential != nil {
 		credType = string(c.Spec.Access.Credential.Type)
 	}
-	epType := string(c.Spec.Access.Endpoint.Type)
+	epType := "<none>"
+	address, egressProxy := "<none>", "<none>"
+	if endpoint := c.Spec.Access.Endpoint; endpoint != nil {
+		epType = string(endpoint.Type)
+		if endpoint.Type == ClusterEndpointTypeConst && endpoint.Const != nil {
+			address = endpoint.Const.Address
+			if proxyURL := printEgressProxy(endpoint.Const); len(proxyURL) > 0 {
+				egressProxy = proxyURL
+			}
+		}
+	}
+	healthyReason := "<none>"
+	if len(c.Status.HealthyReason) > 0 {
+		healthyReason = string(c.Status.HealthyReason)
+	}
+	expiry := "<none>"
+	if notAfter, ok := credentialExpiry(c.Spec.Access.Credential); ok {
+		expiry = notAfter.UTC().Format(time.RFC3339)
+	}
 	row := metav1.TableRow{
 		Object: runtime.RawExtension{Object: c},
 	}
-	row.Cells = append(row.Cells, name, credType, epType, strconv.FormatBool(c.Status.Healthy))
+	row.Cells = append(row.Cells, name, credType, epType, strconv.FormatBool(c.Status.Healthy), printAge(c.CreationTimestamp),
+		address, healthyReason, expiry, egressProxy)
 	return row
 }
+
+func printAge(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
+// printEgressProxy returns the egress proxy of the endpoint without the
+// user info of the legacy proxy url.
+func printEgressProxy(endpoint *ClusterEndpointConst) string {
+	var proxyURL string
+	switch {
+	case endpoint.EgressProxy != nil:
+		proxyURL = endpoint.EgressProxy.URL
+	case endpoint.ProxyURL != nil:
+		proxyURL = *endpoint.ProxyURL
+	}
+	if u, err := url.Parse(proxyURL); err == nil && u.User != nil {
+		u.User = nil
+		proxyURL = u.String()
+	}
+	return proxyURL
+}
+
+// credentialExpiry returns the expiry of the X.509 certificate or the
+// service account token of the credential. The expiry of the tokens minted
+// on the fly is unknown.
+func credentialExpiry(credential *ClusterAccessCredential) (time.Time, bool) {
+	if credential == nil || credential.TokenRequest != nil {
+		return time.Time{}, false
+	}
+	switch credential.Type {
+	case CredentialTypeX509Certificate:
+		if credential.X509 == nil {
+			return time.Time{}, false
+		}
+		block, _ := pem.Decode(credential.X509.Certificate)
+		if block == nil {
+			return time.Time{}, false
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return cert.NotAfter, true
+	case CredentialTypeServiceAccountToken:
+		// the expiry of a JWT is read without verifying the signature
+		parts := strings.Split(credential.ServiceAccountToken, ".")
+		if len(parts) != 3 {
+			return time.Time{}, false
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		claims := struct {
+			Expiry int64 `json:"exp"`
+		}{}
+		if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiry == 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(claims.Expiry, 0), true
+	}
+	return time.Time{}, false
+}
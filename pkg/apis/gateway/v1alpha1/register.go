@@ -33,12 +33,17 @@ var AddToScheme = func(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(schema.GroupVersion{
 		Group:   config.MetaApiGroupName,
 		Version: config.MetaApiVersionName,
-	}, &ClusterGateway{}, &ClusterGatewayList{})
+	}, &ClusterGateway{}, &ClusterGatewayList{}, &ClusterGatewayCredentials{})
 	scheme.AddKnownTypes(schema.GroupVersion{
 		Group:   config.MetaApiGroupName,
 		Version: config.MetaApiVersionName,
-	}, &ClusterGatewayProxyOptions{})
+	}, &ClusterGatewayProxyOptions{}, &ClusterGatewayTunnelOptions{}, &ClusterGatewayKubeconfigOptions{})
 
+	if err := scheme.AddFieldLabelConversionFunc(
+		SchemeGroupVersion.WithKind("ClusterGateway"),
+		ConvertClusterGatewayFieldLabel); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -2,10 +2,15 @@ package v1alpha1
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/url"
+	gopath "path"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -14,43 +19,113 @@ import (
 	"google.golang.org/grpc/keepalive"
 	k8snet "k8s.io/apimachinery/pkg/util/net"
 	restclient "k8s.io/client-go/rest"
-	konnectivity "sigs.k8s.io/apiserver-network-proxy/konnectivity-client/pkg/client"
-	"sigs.k8s.io/apiserver-network-proxy/pkg/util"
 
 	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/konnectivity"
 )
 
+var (
+	clusterProxyDialerLock sync.Mutex
+	clusterProxyDialer     k8snet.DialFunc
+)
+
+// DialerGetter returns the dialer through the cluster-proxy. In the grpc mode
+// the dials are multiplexed over the long-lived connections of a
+// process-wide pool, while in the http-connect mode every dial tunnels over
+// a dedicated TLS connection by a CONNECT request.
 var DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
-	tlsCfg, err := util.GetClientTLSConfig(
+	clusterProxyDialerLock.Lock()
+	defer clusterProxyDialerLock.Unlock()
+	if clusterProxyDialer != nil {
+		return clusterProxyDialer, nil
+	}
+	tlsCfg, err := konnectivity.NewReloadingClientTLSConfig(
 		config.ClusterProxyCAFile,
 		config.ClusterProxyCertFile,
 		config.ClusterProxyKeyFile,
-		config.ClusterProxyHost,
-		nil)
+		config.ClusterProxyHost)
 	if err != nil {
 		return nil, err
 	}
-	dialerTunnel, err := konnectivity.CreateSingleUseGrpcTunnel(
-		ctx,
-		net.JoinHostPort(config.ClusterProxyHost, strconv.Itoa(config.ClusterProxyPort)),
-		grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsCfg)),
-		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time: time.Second * 5,
-		}),
-	)
-	if err != nil {
-		return nil, err
+	address := net.JoinHostPort(config.ClusterProxyHost, strconv.Itoa(config.ClusterProxyPort))
+	switch config.ClusterProxyMode {
+	case config.ClusterProxyModeHTTPConnect:
+		clusterProxyDialer = konnectivity.NewHTTPConnectDialer(address, tlsCfg).DialContext
+	default:
+		clusterProxyDialer = konnectivity.NewPool(
+			address,
+			config.ClusterProxyTunnelPoolSize,
+			grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsCfg)),
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time: time.Second * 5,
+			}),
+		).DialContext
 	}
-	return dialerTunnel.DialContext, nil
+	return clusterProxyDialer, nil
 }
 
+// NewConfigFromCluster builds the client config for the cluster. A cluster
+// with alternative endpoints or a fallback endpoint type fails over to the
+// next endpoint upon dial or TLS errors. A cluster opting in TokenRequest is
+// authenticated by the tokens minted for its ServiceAccount.
 func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.Config, error) {
+	if c.Spec.Access.Endpoint.Type == ClusterEndpointTypeLoopback {
+		return newLoopbackConfig()
+	}
+	if cred := c.Spec.Access.Credential; cred != nil && cred.TokenRequest != nil {
+		return newTokenRequestConfigFromCluster(ctx, c)
+	}
+	candidates := clusterGatewayEndpointCandidates(c)
+	cfg, err := newConfigFromCluster(ctx, candidates[0])
+	if err != nil || len(candidates) == 1 {
+		return cfg, err
+	}
+	failover := &failoverRoundTripper{
+		cluster:   c.Name,
+		delegates: make([]http.RoundTripper, len(candidates)),
+	}
+	for i, candidate := range candidates {
+		u, err := GetEndpointURL(candidate)
+		if err != nil {
+			return nil, err
+		}
+		failover.candidates = append(failover.candidates, candidate)
+		failover.urls = append(failover.urls, u)
+		if i == 0 {
+			continue
+		}
+		// the authentication is applied by the wrappers of the returned
+		// config so that only the TLS transport is built here
+		candidateCfg, err := newConfigFromCluster(ctx, candidate)
+		if err != nil {
+			return nil, err
+		}
+		candidateCfg.BearerToken = ""
+		candidateCfg.ExecProvider = nil
+		candidateCfg.WrapTransport = nil
+		if failover.delegates[i], err = restclient.TransportFor(candidateCfg); err != nil {
+			return nil, errors.Wrapf(err, "failed creating transport for endpoint %s of cluster %s",
+				endpointCandidateAddress(candidate), c.Name)
+		}
+	}
+	// the authenticating wrappers stay outermost so that the requests to
+	// every endpoint are authenticated
+	authWrapper := cfg.WrapTransport
+	cfg.WrapTransport = nil
+	cfg.Wrap(failover.withPrimary)
+	if authWrapper != nil {
+		cfg.Wrap(authWrapper)
+	}
+	return cfg, nil
+}
+
+func newConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.Config, error) {
 	cfg := &restclient.Config{
 		Timeout: time.Second * 40,
 	}
 	// setting up endpoint
 	switch c.Spec.Access.Endpoint.Type {
-	case ClusterEndpointTypeConst:
+	case ClusterEndpointTypeConst, ClusterEndpointTypeSSHBastion, ClusterEndpointTypeClusterGateway:
 		cfg.Host = c.Spec.Access.Endpoint.Const.Address
 		cfg.CAData = c.Spec.Access.Endpoint.Const.CABundle
 		if c.Spec.Access.Endpoint.Const.Insecure != nil && *c.Spec.Access.Endpoint.Const.Insecure {
@@ -82,6 +157,36 @@ func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.C
 			}
 			cfg.Proxy = http.ProxyURL(_url)
 		}
+		if egressProxy := c.Spec.Access.Endpoint.Const.EgressProxy; egressProxy != nil {
+			dialer, err := newEgressProxyDialer(c.Name, egressProxy)
+			if err != nil {
+				return nil, err
+			}
+			// the connections are dialed through the egress proxy so that
+			// the upgraded connections egress through it as well, which
+			// supersedes the proxies of the environment
+			cfg.Dial = dialErrorsOf(dialer.DialContext)
+			cfg.Proxy = noProxy
+		}
+		if c.Spec.Access.Endpoint.Type == ClusterEndpointTypeSSHBastion {
+			dial, err := sshBastionClients.dialer(c)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Dial = dial
+		}
+		if len(cfg.CAData) == 0 && !cfg.Insecure && isEndpointCADiscoveryEnabled() {
+			// the endpoint is verified by the CA discovered on the first
+			// contact through the same path as the requests
+			if cfg.CAData, err = discoveredEndpointCAs.get(ctx, c, c.Spec.Access.Endpoint.Const.Address, cfg); err != nil {
+				return nil, err
+			}
+		}
+		if c.Spec.Access.Endpoint.Type == ClusterEndpointTypeClusterGateway {
+			// the clients of the config request the cluster through the
+			// proxy subresource of the downstream ClusterGateway
+			cfg.Host = downstreamClusterGatewayURL(u, c.Spec.Access.Endpoint.ClusterGateway.Cluster).String()
+		}
 	case ClusterEndpointTypeClusterProxy:
 		cfg.Host = c.Name // the same as the cluster name
 		cfg.Insecure = true
@@ -90,7 +195,12 @@ func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.C
 		if err != nil {
 			return nil, err
 		}
-		cfg.Dial = dail
+		cfg.Dial = dialErrorsOf(dail)
+	case ClusterEndpointTypeReverseTunnel:
+		cfg.Host = c.Name // the same as the cluster name
+		cfg.Insecure = true
+		cfg.CAData = nil
+		cfg.Dial = reverseTunnelDialer(c.Name)
 	}
 	// setting up credentials
 	switch c.Spec.Access.Credential.Type {
@@ -99,20 +209,95 @@ func NewConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.C
 	case CredentialTypeX509Certificate:
 		cfg.CertData = c.Spec.Access.Credential.X509.Certificate
 		cfg.KeyData = c.Spec.Access.Credential.X509.PrivateKey
+	case CredentialTypeExec:
+		execProvider, err := newExecProvider(c)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExecProvider = execProvider
+	case CredentialTypeOIDCClientCredentials:
+		wrapper, err := newOIDCTransportWrapper(c)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Wrap(wrapper)
 	}
 	return cfg, nil
 }
 
+// clusterAccessFingerprint digests the endpoint and the credential of the
+// cluster, which changes once the cluster is accessed differently.
+func clusterAccessFingerprint(c *ClusterGateway) (string, error) {
+	access := struct {
+		Endpoint      *ClusterEndpoint                 `json:"endpoint"`
+		Credential    *ClusterAccessCredentialContents `json:"credential,omitempty"`
+		SSHPrivateKey []byte                           `json:"sshPrivateKey,omitempty"`
+	}{
+		Endpoint:   c.Spec.Access.Endpoint,
+		Credential: credentialContentsOf(c.Spec.Access.Credential),
+	}
+	if endpoint := c.Spec.Access.Endpoint; endpoint != nil && endpoint.SSHBastion != nil {
+		access.SSHPrivateKey = endpoint.SSHBastion.PrivateKey
+	}
+	return fingerprintOf(access)
+}
+
+// credentialFingerprint digests the contents of the credential, which are
+// never marshaled by the ClusterAccessCredential itself.
+func credentialFingerprint(cred *ClusterAccessCredential) (string, error) {
+	return fingerprintOf(credentialContentsOf(cred))
+}
+
+func credentialContentsOf(cred *ClusterAccessCredential) *ClusterAccessCredentialContents {
+	if cred == nil {
+		return nil
+	}
+	return &ClusterAccessCredentialContents{
+		Type:                cred.Type,
+		ServiceAccountToken: cred.ServiceAccountToken,
+		X509:                cred.X509,
+		Exec:                cred.Exec,
+		OIDC:                cred.OIDC,
+		TokenRequest:        cred.TokenRequest,
+	}
+}
+
+func fingerprintOf(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 func GetEndpointURL(c *ClusterGateway) (*url.URL, error) {
 	switch c.Spec.Access.Endpoint.Type {
-	case ClusterEndpointTypeConst:
+	case ClusterEndpointTypeConst, ClusterEndpointTypeSSHBastion:
 		urlAddr, err := url.Parse(c.Spec.Access.Endpoint.Const.Address)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed parsing url from cluster %s invalid value %s",
 				c.Name, c.Spec.Access.Endpoint.Const.Address)
 		}
 		return urlAddr, nil
-	case ClusterEndpointTypeClusterProxy:
+	case ClusterEndpointTypeClusterGateway:
+		urlAddr, err := url.Parse(c.Spec.Access.Endpoint.Const.Address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed parsing url from cluster %s invalid value %s",
+				c.Name, c.Spec.Access.Endpoint.Const.Address)
+		}
+		return downstreamClusterGatewayURL(urlAddr, c.Spec.Access.Endpoint.ClusterGateway.Cluster), nil
+	case ClusterEndpointTypeLoopback:
+		cfg, err := newLoopbackConfig()
+		if err != nil {
+			return nil, err
+		}
+		urlAddr, _, err := restclient.DefaultServerUrlFor(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed parsing url from the client config of the gateway")
+		}
+		return urlAddr, nil
+	case ClusterEndpointTypeClusterProxy, ClusterEndpointTypeReverseTunnel:
 		return &url.URL{
 			Scheme: "https",
 			Host:   c.Name,
@@ -121,3 +306,11 @@ func GetEndpointURL(c *ClusterGateway) (*url.URL, error) {
 		return nil, errors.New("unsupported cluster gateway endpoint type")
 	}
 }
+
+// downstreamClusterGatewayURL returns the url of the proxy subresource of the
+// ClusterGateway served by the downstream hub at the given url.
+func downstreamClusterGatewayURL(hub *url.URL, cluster string) *url.URL {
+	u := *hub
+	u.Path = gopath.Join(hub.Path, apiPrefix+cluster+apiSuffix)
+	return &u
+}
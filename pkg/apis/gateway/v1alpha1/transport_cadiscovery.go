@@ -0,0 +1,302 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+const (
+	// caDiscoveryTimeout bounds discovering the CA of an endpoint.
+	caDiscoveryTimeout = 10 * time.Second
+	// maxClusterInfoSize bounds reading the cluster-info ConfigMap.
+	maxClusterInfoSize = 1 << 20
+)
+
+// errClusterInfoNotServed tells the cluster-info ConfigMap prescribes no CA,
+// upon which the CA is discovered from the serving chain in the Auto mode.
+var errClusterInfoNotServed = errors.New("cluster-info not served")
+
+// discoveredEndpointCAs keeps the CA bundles discovered on the first contact
+// of the endpoints, which verify the endpoints until the CA pinned in the
+// addon is observed. The CAs are kept for each address of each incarnation of
+// the clusters, so that neither a moved endpoint nor a re-created cluster is
+// verified by a stale CA.
+var discoveredEndpointCAs = &endpointCAs{bundles: make(map[endpointCAKey]*discoveredEndpointCA)}
+
+type endpointCAs struct {
+	lock    sync.Mutex
+	bundles map[endpointCAKey]*discoveredEndpointCA
+}
+
+type endpointCAKey struct {
+	cluster string
+	uid     types.UID
+	address string
+}
+
+type discoveredEndpointCA struct {
+	caBundle []byte
+	// pinned tells the CA is persisted in the addon, after which the CA
+	// missing from the addon is re-discovered, e.g. the annotations are
+	// removed for re-pinning.
+	pinned bool
+	// pinnedResourceVersion is the resourceVersion of the addon persisting
+	// the CA, until which the cached addon has yet to observe the CA.
+	pinnedResourceVersion uint64
+}
+
+func isEndpointCADiscoveryEnabled() bool {
+	switch config.EndpointCADiscovery {
+	case config.EndpointCADiscoveryAuto, config.EndpointCADiscoveryClusterInfo, config.EndpointCADiscoveryServingChain:
+		return true
+	}
+	return false
+}
+
+// get returns the CA bundle of the endpoint of the cluster, discovering it
+// from the endpoint on the first contact and pinning it in the addon of the
+// cluster.
+func (e *endpointCAs) get(ctx context.Context, c *ClusterGateway, address string, cfg *restclient.Config) ([]byte, error) {
+	key := endpointCAKey{cluster: c.Name, uid: c.UID, address: address}
+	e.lock.Lock()
+	discovered, ok := e.bundles[key]
+	e.lock.Unlock()
+	if ok && discovered.pinned && !isEndpointCAPinned(ctx, c.Name, address, discovered.pinnedResourceVersion) {
+		klog.Infof("Re-pinning the CA of endpoint %s of cluster %s removed from the addon", address, c.Name)
+		e.lock.Lock()
+		if e.bundles[key] == discovered {
+			delete(e.bundles, key)
+		}
+		e.lock.Unlock()
+		ok = false
+	}
+	if ok {
+		return discovered.caBundle, nil
+	}
+	caBundle, err := discoverEndpointCA(ctx, address, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed discovering CA of endpoint %s of cluster %s", address, c.Name)
+	}
+	e.lock.Lock()
+	if existing, ok := e.bundles[key]; ok {
+		// the CA discovered concurrently goes first
+		e.lock.Unlock()
+		return existing.caBundle, nil
+	}
+	discovered = &discoveredEndpointCA{caBundle: caBundle}
+	e.bundles[key] = discovered
+	e.lock.Unlock()
+	klog.Infof("Pinned the CA discovered from endpoint %s of cluster %s", address, c.Name)
+	resourceVersion, err := pinEndpointCA(ctx, c.Name, address, caBundle)
+	if err != nil {
+		klog.Warningf("Failed pinning the CA of cluster %s in the addon: %v", c.Name, err)
+		return caBundle, nil
+	}
+	e.lock.Lock()
+	discovered.pinned = true
+	discovered.pinnedResourceVersion = resourceVersion
+	e.lock.Unlock()
+	return caBundle, nil
+}
+
+// invalidate drops the CAs discovered from the endpoints of the cluster.
+func (e *endpointCAs) invalidate(cluster string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for key := range e.bundles {
+		if key.cluster == cluster {
+			delete(e.bundles, key)
+		}
+	}
+}
+
+// isEndpointCAPinned tells whether the cached addon of the cluster pins a CA
+// for the address. The addon older than the one persisting the CA has yet to
+// observe the pin, which is taken as pinned as well as the failures, so that
+// the CA is never re-discovered upon the transient errors.
+func isEndpointCAPinned(ctx context.Context, cluster, address string, pinnedResourceVersion uint64) bool {
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	if err := singleton.GetClient().Get(ctx, types.NamespacedName{Namespace: cluster, Name: common.AddonName}, addon); err != nil {
+		return !apierrors.IsNotFound(err)
+	}
+	return parseResourceVersion(addon.ResourceVersion) < pinnedResourceVersion || isPinnedCAFor(addon, address)
+}
+
+// isPinnedCAFor tells whether the CA pinned in the addon is discovered from
+// the address. The CAs pinned before the addresses are recorded are taken as
+// pinned for the current address.
+func isPinnedCAFor(addon *addonv1alpha1.ManagedClusterAddOn, address string) bool {
+	if len(addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle]) == 0 {
+		return false
+	}
+	pinnedAddress, ok := addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCAAddress]
+	return !ok || pinnedAddress == address
+}
+
+// pinEndpointCA persists the CA bundle of the address in the addon of the
+// cluster unless a CA is pinned for the address already, returning the
+// resourceVersion of the addon pinning the CA. The CA pinned for another
+// address is replaced.
+func pinEndpointCA(ctx context.Context, cluster, address string, caBundle []byte) (uint64, error) {
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	if err := singleton.GetClient().Get(ctx, types.NamespacedName{Namespace: cluster, Name: common.AddonName}, addon); err != nil {
+		return 0, err
+	}
+	if isPinnedCAFor(addon, address) {
+		return parseResourceVersion(addon.ResourceVersion), nil
+	}
+	pinned := addon.DeepCopy()
+	if pinned.Annotations == nil {
+		pinned.Annotations = make(map[string]string)
+	}
+	pinned.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle] = string(caBundle)
+	pinned.Annotations[common.AnnotationKeyClusterGatewayPinnedCAAddress] = address
+	if err := singleton.GetClient().Patch(ctx, pinned, client.MergeFrom(addon)); err != nil {
+		return 0, err
+	}
+	return parseResourceVersion(pinned.ResourceVersion), nil
+}
+
+// discoverEndpointCA discovers the CA of the endpoint by requesting it
+// without verification, either from the cluster-info ConfigMap which must
+// have signed the serving certificate or by pinning the topmost certificate
+// of the serving chain. A cluster-info not signing the serving certificate
+// fails the discovery instead of pinning the serving chain.
+func discoverEndpointCA(ctx context.Context, address string, cfg *restclient.Config) ([]byte, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, caDiscoveryTimeout)
+	defer cancel()
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // the serving chain is verified by the discovered CA
+			ServerName:         u.Hostname(),
+		},
+		DialContext: cfg.Dial,
+		Proxy:       cfg.Proxy,
+	}
+	defer transport.CloseIdleConnections()
+	if config.EndpointCADiscovery != config.EndpointCADiscoveryServingChain {
+		caBundle, err := discoverClusterInfoCA(ctx, transport, u)
+		if err == nil || config.EndpointCADiscovery == config.EndpointCADiscoveryClusterInfo || !errors.Is(err, errClusterInfoNotServed) {
+			return caBundle, err
+		}
+		klog.V(4).Infof("Pinning the serving chain of endpoint %s: %v", address, err)
+	}
+	return pinServingChain(ctx, transport, u)
+}
+
+// discoverClusterInfoCA reads the CA from the kubeconfig of the cluster-info
+// ConfigMap which is readable anonymously.
+func discoverClusterInfoCA(ctx context.Context, transport http.RoundTripper, u *url.URL) ([]byte, error) {
+	clusterInfoURL := *u
+	clusterInfoURL.Path = gopath.Join("/", u.Path, "/api/v1/namespaces/kube-public/configmaps/cluster-info")
+	resp, chain, err := getWithoutVerification(ctx, transport, &clusterInfoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(errClusterInfoNotServed, "unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxClusterInfoSize))
+	if err != nil {
+		return nil, err
+	}
+	clusterInfo := &v1.ConfigMap{}
+	if err := json.Unmarshal(data, clusterInfo); err != nil {
+		return nil, errors.Wrapf(err, "failed parsing cluster-info")
+	}
+	kubeconfig, err := clientcmd.Load([]byte(clusterInfo.Data["kubeconfig"]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing the kubeconfig of cluster-info")
+	}
+	for _, cluster := range kubeconfig.Clusters {
+		if len(cluster.CertificateAuthorityData) == 0 {
+			continue
+		}
+		if err := verifyServingChain(chain, cluster.CertificateAuthorityData, u.Hostname()); err != nil {
+			return nil, errors.Wrapf(err, "the serving certificate is not signed by the CA of cluster-info")
+		}
+		return cluster.CertificateAuthorityData, nil
+	}
+	return nil, errors.Wrapf(errClusterInfoNotServed, "no CA found")
+}
+
+// pinServingChain returns the topmost certificate of the serving chain.
+func pinServingChain(ctx context.Context, transport http.RoundTripper, u *url.URL) ([]byte, error) {
+	versionURL := *u
+	versionURL.Path = gopath.Join("/", u.Path, "/version")
+	resp, chain, err := getWithoutVerification(ctx, transport, &versionURL)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[len(chain)-1].Raw})
+	if err := verifyServingChain(chain, caBundle, u.Hostname()); err != nil {
+		return nil, err
+	}
+	return caBundle, nil
+}
+
+func getWithoutVerification(ctx context.Context, transport http.RoundTripper, u *url.URL) (*http.Response, []*x509.Certificate, error) {
+	if u.Scheme != "https" {
+		return nil, nil, errors.Errorf("unexpected scheme %q", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		resp.Body.Close()
+		return nil, nil, errors.New("no serving certificate presented")
+	}
+	return resp, resp.TLS.PeerCertificates, nil
+}
+
+// verifyServingChain verifies the serving chain for the host by the CA bundle.
+func verifyServingChain(chain []*x509.Certificate, caBundle []byte, host string) error {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caBundle) {
+		return errors.New("no certificate found in the CA bundle")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
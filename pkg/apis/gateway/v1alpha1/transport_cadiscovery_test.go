@@ -0,0 +1,241 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/utils/pointer"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+func setEndpointCADiscoveryDuringTest(t *testing.T, discovery string) {
+	original := config.EndpointCADiscovery
+	config.EndpointCADiscovery = discovery
+	discoveredEndpointCAs = &endpointCAs{bundles: make(map[endpointCAKey]*discoveredEndpointCA)}
+	t.Cleanup(func() { config.EndpointCADiscovery = original })
+}
+
+// newClusterInfoServer serves the cluster-info ConfigMap prescribing the CA
+// bundle, or nothing if the CA bundle is nil.
+func newClusterInfoServer(t *testing.T, caBundle func() []byte) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/namespaces/kube-public/configmaps/cluster-info" {
+			resp.Write([]byte("ok"))
+			return
+		}
+		ca := caBundle()
+		if ca == nil {
+			resp.WriteHeader(http.StatusForbidden)
+			return
+		}
+		kubeconfig, err := clientcmd.Write(clientcmdapi.Config{
+			Clusters: map[string]*clientcmdapi.Cluster{
+				"": {Server: "https://" + req.Host, CertificateAuthorityData: ca},
+			},
+		})
+		require.NoError(t, err)
+		json.NewEncoder(resp).Encode(&corev1.ConfigMap{Data: map[string]string{"kubeconfig": string(kubeconfig)}})
+	}))
+}
+
+func servingCA(svr *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+}
+
+func TestEndpointCADiscovery(t *testing.T) {
+	var clusterInfoCA []byte
+	svr := newClusterInfoServer(t, func() []byte { return clusterInfoCA })
+	defer svr.Close()
+	otherCA, _, err := certutil.GenerateSelfSignedCertKey("other", nil, nil)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name          string
+		discovery     string
+		clusterInfoCA []byte
+		expectedCA    []byte
+		expectFailure bool
+	}{
+		{
+			name:          "cluster-info",
+			discovery:     config.EndpointCADiscoveryClusterInfo,
+			clusterInfoCA: servingCA(svr),
+			expectedCA:    servingCA(svr),
+		},
+		{
+			name:          "cluster-info not signing the serving certificate",
+			discovery:     config.EndpointCADiscoveryAuto,
+			clusterInfoCA: otherCA,
+			expectFailure: true,
+		},
+		{
+			name:          "cluster-info not served",
+			discovery:     config.EndpointCADiscoveryClusterInfo,
+			expectFailure: true,
+		},
+		{
+			name:       "serving chain pinned without cluster-info",
+			discovery:  config.EndpointCADiscoveryAuto,
+			expectedCA: servingCA(svr),
+		},
+		{
+			name:          "serving chain",
+			discovery:     config.EndpointCADiscoveryServingChain,
+			clusterInfoCA: otherCA,
+			expectedCA:    servingCA(svr),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setEndpointCADiscoveryDuringTest(t, c.discovery)
+			clusterInfoCA = c.clusterInfoCA
+			fakeClient := newWriteTestClient(t, gatewayAddon("foo", nil))
+			gw := failoverClusterGateway("foo", svr.URL, nil)
+			cfg, err := NewConfigFromCluster(context.TODO(), gw)
+			if c.expectFailure {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.expectedCA, cfg.CAData)
+			addon := &addonv1alpha1.ManagedClusterAddOn{}
+			require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+			assert.Equal(t, string(c.expectedCA), addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle])
+			assert.Equal(t, svr.URL, addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCAAddress])
+
+			// the endpoint is verified by the discovered CA
+			rt, err := restclient.TransportFor(cfg)
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodGet, svr.URL+"/version", nil)
+			require.NoError(t, err)
+			resp, err := rt.RoundTrip(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			// the discovered CA is reused afterwards
+			clusterInfoCA = otherCA
+			cfg, err = NewConfigFromCluster(context.TODO(), gw)
+			require.NoError(t, err)
+			assert.Equal(t, c.expectedCA, cfg.CAData)
+		})
+	}
+}
+
+func TestEndpointCARepinning(t *testing.T) {
+	setEndpointCADiscoveryDuringTest(t, config.EndpointCADiscoveryClusterInfo)
+	var clusterInfoCA []byte
+	svr := newClusterInfoServer(t, func() []byte { return clusterInfoCA })
+	defer svr.Close()
+	moved := newClusterInfoServer(t, func() []byte { return clusterInfoCA })
+	defer moved.Close()
+	fakeClient := newWriteTestClient(t, gatewayAddon("foo", nil))
+	pinned := func() (string, string) {
+		addon := &addonv1alpha1.ManagedClusterAddOn{}
+		require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+		return addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCAAddress], addon.Annotations[common.AnnotationKeyClusterGatewayPinnedCABundle]
+	}
+	discover := func(gw *ClusterGateway) []byte {
+		cfg, err := NewConfigFromCluster(context.TODO(), gw)
+		require.NoError(t, err)
+		return cfg.CAData
+	}
+
+	gw := failoverClusterGateway("foo", svr.URL, nil)
+	gw.UID = "1"
+	clusterInfoCA = servingCA(svr)
+	assert.Equal(t, servingCA(svr), discover(gw))
+
+	// the moved endpoint is never verified by the CA of the former address
+	clusterInfoCA = servingCA(moved)
+	movedGateway := failoverClusterGateway("foo", moved.URL, nil)
+	movedGateway.UID = "1"
+	assert.Equal(t, servingCA(moved), discover(movedGateway))
+	address, caBundle := pinned()
+	assert.Equal(t, moved.URL, address)
+	assert.Equal(t, string(servingCA(moved)), caBundle)
+
+	// removing the pinned CA from the addon re-pins the endpoint
+	clusterInfoCA = servingCA(svr)
+	assert.Equal(t, servingCA(svr), discover(gw))
+	address, _ = pinned()
+	assert.Equal(t, svr.URL, address)
+	addon := &addonv1alpha1.ManagedClusterAddOn{}
+	require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+	addon.Annotations = nil
+	require.NoError(t, fakeClient.Update(context.TODO(), addon))
+	otherCA, _, err := certutil.GenerateSelfSignedCertKey("other", nil, nil)
+	require.NoError(t, err)
+	clusterInfoCA = otherCA
+	_, err = NewConfigFromCluster(context.TODO(), gw)
+	assert.Error(t, err, "the re-discovered CA is expected to be verified")
+
+	// the re-created cluster is never verified by the CA of the former one
+	clusterInfoCA = servingCA(svr)
+	assert.Equal(t, servingCA(svr), discover(gw))
+	discoveredEndpointCAs.lock.Lock()
+	discoveredEndpointCAs.bundles[endpointCAKey{cluster: "foo", uid: "1", address: svr.URL}].caBundle = otherCA
+	discoveredEndpointCAs.lock.Unlock()
+	recreated := failoverClusterGateway("foo", svr.URL, nil)
+	recreated.UID = "2"
+	assert.Equal(t, servingCA(svr), discover(recreated))
+
+	discoveredEndpointCAs.invalidate("foo")
+	discoveredEndpointCAs.lock.Lock()
+	defer discoveredEndpointCAs.lock.Unlock()
+	assert.Empty(t, discoveredEndpointCAs.bundles)
+}
+
+func TestEndpointCAPinnedByCachedAddon(t *testing.T) {
+	ctx := context.TODO()
+	addon := gatewayAddon("foo", nil)
+	newWriteTestClient(t, addon)
+	resourceVersion, err := pinEndpointCA(ctx, "foo", "https://foo.example.com", []byte("ca"))
+	require.NoError(t, err)
+	assert.True(t, isEndpointCAPinned(ctx, "foo", "https://foo.example.com", resourceVersion))
+	assert.False(t, isEndpointCAPinned(ctx, "foo", "https://moved.example.com", resourceVersion))
+
+	// the cache yet to observe the pin never triggers re-discovery
+	newWriteTestClient(t, gatewayAddon("foo", nil))
+	assert.True(t, isEndpointCAPinned(ctx, "foo", "https://foo.example.com", resourceVersion))
+	assert.False(t, isEndpointCAPinned(ctx, "foo", "https://foo.example.com", resourceVersion-1))
+	newWriteTestClient(t)
+	assert.False(t, isEndpointCAPinned(ctx, "foo", "https://foo.example.com", resourceVersion))
+}
+
+func TestEndpointCADiscoveryDisabled(t *testing.T) {
+	setEndpointCADiscoveryDuringTest(t, config.EndpointCADiscoveryDisabled)
+	cfg, err := NewConfigFromCluster(context.TODO(), failoverClusterGateway("foo", "https://foo.example.com", nil))
+	require.NoError(t, err)
+	// verified by the system trust roots
+	assert.Empty(t, cfg.CAData)
+	assert.False(t, cfg.Insecure)
+
+	gw := failoverClusterGateway("foo", "https://foo.example.com", nil)
+	require.NotEmpty(t, ValidateClusterGateway(gw))
+	config.EndpointCADiscovery = config.EndpointCADiscoveryAuto
+	assert.Empty(t, ValidateClusterGateway(gw))
+
+	gw.Spec.Access.Endpoint.Const.Insecure = pointer.Bool(true)
+	errs := ValidateClusterGateway(gw)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "spec.access.endpoint.const.insecure", errs[0].Field)
+	config.AllowInsecureEndpoints = true
+	defer func() { config.AllowInsecureEndpoints = false }()
+	assert.Empty(t, ValidateClusterGateway(gw))
+}
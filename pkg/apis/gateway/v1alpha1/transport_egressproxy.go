@@ -0,0 +1,42 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/egressproxy"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+// newEgressProxyDialer returns the dialer through the egress proxy of the
+// cluster. The credential is looked up from the referred Secret upon every
+// dial, so that the rotated credential takes effect immediately. The Secret
+// is read from the hub kube-apiserver directly as the cache holds the secrets
+// of the ClusterGateways only.
+func newEgressProxyDialer(cluster string, egressProxy *ClusterEndpointEgressProxy) (*egressproxy.Dialer, error) {
+	var credential egressproxy.Credential
+	if ref := egressProxy.CredentialSecretRef; ref != nil {
+		if ref.Name != common.SecretNameEgressProxyCredential {
+			return nil, errors.Errorf("egress proxy credential secret %s/%s is not %s", cluster, ref.Name, common.SecretNameEgressProxyCredential)
+		}
+		credential = func(ctx context.Context) (string, string, error) {
+			secret := &v1.Secret{}
+			if err := singleton.GetAPIReader().Get(ctx, types.NamespacedName{Namespace: cluster, Name: ref.Name}, secret); err != nil {
+				return "", "", err
+			}
+			return string(secret.Data[v1.BasicAuthUsernameKey]), string(secret.Data[v1.BasicAuthPasswordKey]), nil
+		}
+	}
+	return egressproxy.NewDialer(egressProxy.URL, egressProxy.CABundle, credential, egressProxy.NoProxy)
+}
+
+// noProxy connects every request directly.
+func noProxy(*http.Request) (*url.URL, error) {
+	return nil, nil
+}
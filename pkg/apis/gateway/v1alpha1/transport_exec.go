@@ -0,0 +1,52 @@
+package v1alpha1
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+const defaultExecAPIVersion = "client.authentication.k8s.io/v1"
+
+var execAPIVersions = sets.NewString(defaultExecAPIVersion, "client.authentication.k8s.io/v1beta1")
+
+// newExecProvider converts the exec credential of the cluster into the exec
+// provider of the client config. The credentials issued by the plugin are
+// cached by client-go per exec config and cluster info, and are refreshed
+// upon expiry or rejection, so that the plugin is not invoked per request.
+func newExecProvider(c *ClusterGateway) (*clientcmdapi.ExecConfig, error) {
+	exec := c.Spec.Access.Credential.Exec
+	if exec == nil || len(exec.Command) == 0 {
+		return nil, errors.Errorf("missing exec command for cluster %s", c.Name)
+	}
+	// the exec config is read from the secret which may bypass the
+	// validation, so the allow-list is enforced once more before executing
+	if !config.IsExecCommandAllowed(exec.Command) {
+		return nil, errors.Errorf("exec command %q of cluster %s is not allowed", exec.Command, c.Name)
+	}
+	provider := &clientcmdapi.ExecConfig{
+		Command:    exec.Command,
+		Args:       exec.Args,
+		APIVersion: exec.APIVersion,
+		// providing the cluster info also keys the cached credentials by
+		// the cluster
+		ProvideClusterInfo: true,
+		InteractiveMode:    clientcmdapi.NeverExecInteractiveMode,
+		StdinUnavailable:   true,
+	}
+	if len(provider.APIVersion) == 0 {
+		provider.APIVersion = defaultExecAPIVersion
+	}
+	for _, env := range exec.Env {
+		if !config.IsExecEnvAllowed(env.Name) {
+			return nil, errors.Errorf("exec env %q of cluster %s is not allowed", env.Name, c.Name)
+		}
+		provider.Env = append(provider.Env, clientcmdapi.ExecEnvVar{
+			Name:  env.Name,
+			Value: env.Value,
+		})
+	}
+	return provider, nil
+}
@@ -0,0 +1,144 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+func setExecCredentialAllowedCommandsDuringTest(t *testing.T, commands ...string) {
+	original := config.ExecCredentialAllowedCommands
+	config.ExecCredentialAllowedCommands = commands
+	t.Cleanup(func() {
+		config.ExecCredentialAllowedCommands = original
+	})
+}
+
+// execPlugin writes an exec plugin issuing the token and counting its
+// invocations in the returned file.
+func execPlugin(t *testing.T, token string) (string, string) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "invocations")
+	plugin := filepath.Join(dir, "plugin")
+	script := fmt.Sprintf(`#!/bin/sh
+echo x >> %s
+cat <<EOT
+{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"%s-$CLUSTER_SUFFIX","expirationTimestamp":"2999-01-01T00:00:00Z"}}
+EOT
+`, counter, token)
+	require.NoError(t, os.WriteFile(plugin, []byte(script), 0700))
+	return plugin, counter
+}
+
+func execClusterGateway(name, address, command string) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  address,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type: CredentialTypeExec,
+					Exec: &ExecConfig{
+						Command: command,
+						Env:     []ExecEnvVar{{Name: "CLUSTER_SUFFIX", Value: name}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestNewConfigFromClusterExec(t *testing.T) {
+	var receivedAuth []string
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedAuth = append(receivedAuth, req.Header.Get("Authorization"))
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	plugin, counter := execPlugin(t, "exec-token")
+
+	setExecCredentialAllowedCommandsDuringTest(t)
+	_, err := NewConfigFromCluster(t.Context(), execClusterGateway("foo", svr.URL, plugin))
+	assert.Error(t, err, "the command is not allowed")
+
+	setExecCredentialAllowedCommandsDuringTest(t, plugin)
+	for _, name := range []string{"foo", "foo", "bar"} {
+		cfg, err := NewConfigFromCluster(t.Context(), execClusterGateway(name, svr.URL, plugin))
+		require.NoError(t, err)
+		require.NotNil(t, cfg.ExecProvider)
+		assert.Equal(t, defaultExecAPIVersion, cfg.ExecProvider.APIVersion)
+		rt, err := restclient.TransportFor(cfg)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, svr.URL+"/healthz", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, []string{"Bearer exec-token-foo", "Bearer exec-token-foo", "Bearer exec-token-bar"}, receivedAuth)
+
+	// the credential is cached per cluster across the client configs
+	invocations, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(invocations), "x"))
+}
+
+func TestValidateExecConfigEnv(t *testing.T) {
+	setExecCredentialAllowedCommandsDuringTest(t, "/usr/local/bin/plugin")
+	cases := map[string]struct {
+		env       []ExecEnvVar
+		errFields []string
+	}{
+		"plugin envs": {
+			env: []ExecEnvVar{{Name: "AWS_PROFILE", Value: "foo"}, {Name: "CLUSTER_SUFFIX", Value: "foo"}},
+		},
+		"loader envs": {
+			env:       []ExecEnvVar{{Name: "LD_PRELOAD", Value: "/tmp/x.so"}, {Name: "DYLD_INSERT_LIBRARIES", Value: "/tmp/x.dylib"}},
+			errFields: []string{"exec.env[0].name", "exec.env[1].name"},
+		},
+		"command resolution envs": {
+			env:       []ExecEnvVar{{Name: "PATH", Value: "/tmp"}, {Name: "home", Value: "/tmp"}, {Name: "PYTHONPATH", Value: "/tmp"}},
+			errFields: []string{"exec.env[0].name", "exec.env[1].name", "exec.env[2].name"},
+		},
+		"malformed env": {
+			env:       []ExecEnvVar{{Name: "FOO=BAR", Value: "foo"}},
+			errFields: []string{"exec.env[0].name"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var errFields []string
+			for _, err := range ValidateExecConfig(&ExecConfig{Command: "/usr/local/bin/plugin", Env: c.env}, field.NewPath("exec")) {
+				errFields = append(errFields, err.Field)
+			}
+			assert.Equal(t, c.errFields, errFields)
+		})
+	}
+
+	// the envs read from the secret bypassing the validation are rejected
+	// before executing
+	gw := execClusterGateway("foo", "https://foo.example.com", "/usr/local/bin/plugin")
+	gw.Spec.Access.Credential.Exec.Env = []ExecEnvVar{{Name: "LD_PRELOAD", Value: "/tmp/x.so"}}
+	_, err := NewConfigFromCluster(t.Context(), gw)
+	assert.Error(t, err)
+}
@@ -0,0 +1,392 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/util/singleton"
+)
+
+// activeEndpointTypeReportTimeout bounds persisting the endpoint type serving
+// the requests of a cluster.
+const activeEndpointTypeReportTimeout = 10 * time.Second
+
+// preferredEndpoints remembers the endpoint of each cluster which served the
+// last request successfully, along with its endpoint type.
+var preferredEndpoints = &endpointPreferences{
+	addresses:     make(map[string]string),
+	endpointTypes: make(map[string]ClusterEndpointType),
+}
+
+type endpointPreferences struct {
+	lock          sync.RWMutex
+	addresses     map[string]string
+	endpointTypes map[string]ClusterEndpointType
+}
+
+func (p *endpointPreferences) get(cluster string) (string, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	address, ok := p.addresses[cluster]
+	return address, ok
+}
+
+func (p *endpointPreferences) record(cluster string, candidate *ClusterGateway) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	endpointType := candidate.Spec.Access.Endpoint.Type
+	if previous, ok := p.endpointTypes[cluster]; !ok || previous != endpointType {
+		go reportActiveEndpointType(cluster)
+	}
+	p.endpointTypes[cluster] = endpointType
+	if config.EndpointFailoverSticky {
+		p.addresses[cluster] = endpointCandidateAddress(candidate)
+	}
+}
+
+// reportActiveEndpointType persists the endpoint type which served the last
+// request to the cluster in the addon, which changes the resourceVersion of
+// the ClusterGateway reporting it in the status. Only the clusters falling
+// back between the endpoint types are reported.
+func reportActiveEndpointType(cluster string) {
+	if singleton.GetClient() == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), activeEndpointTypeReportTimeout)
+	defer cancel()
+	gwAddon := &addonv1alpha1.ManagedClusterAddOn{}
+	if err := singleton.GetClient().Get(ctx, types.NamespacedName{Namespace: cluster, Name: common.AddonName}, gwAddon); err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warningf("Failed reporting the active endpoint type of cluster %s: %v", cluster, err)
+		}
+		return
+	}
+	if len(gwAddon.Annotations[common.AnnotationKeyClusterGatewayEndpointFallback]) == 0 {
+		return
+	}
+	preferredEndpoints.lock.RLock()
+	endpointType := preferredEndpoints.endpointTypes[cluster]
+	preferredEndpoints.lock.RUnlock()
+	if ClusterEndpointType(gwAddon.Annotations[common.AnnotationKeyClusterGatewayStatusActiveEndpointType]) == endpointType {
+		return
+	}
+	mod := gwAddon.DeepCopy()
+	if mod.Annotations == nil {
+		mod.Annotations = make(map[string]string)
+	}
+	mod.Annotations[common.AnnotationKeyClusterGatewayStatusActiveEndpointType] = string(endpointType)
+	if err := singleton.GetClient().Patch(ctx, mod, client.MergeFrom(gwAddon)); err != nil {
+		klog.Warningf("Failed reporting the active endpoint type of cluster %s: %v", cluster, err)
+	}
+}
+
+// clusterGatewayEndpointCandidates splits the ClusterGateway into one
+// ClusterGateway per endpoint in the order of trying them, where the
+// endpoints of the fallback type come after the ones of the prescribed type.
+// A ClusterGateway with neither alternative endpoints nor a fallback is
+// returned as is.
+func clusterGatewayEndpointCandidates(c *ClusterGateway) []*ClusterGateway {
+	endpoint := c.Spec.Access.Endpoint
+	if endpoint == nil {
+		return []*ClusterGateway{c}
+	}
+	fallback := fallbackEndpointCandidates(c)
+	hasAlternatives := endpoint.Type == ClusterEndpointTypeConst && endpoint.Const != nil && len(endpoint.Const.Alternatives) > 0
+	if !hasAlternatives && len(fallback) == 0 {
+		return []*ClusterGateway{c}
+	}
+	var candidates []*ClusterGateway
+	switch endpoint.Type {
+	case ClusterEndpointTypeConst:
+		candidates = constEndpointCandidates(c)
+	default:
+		candidates = []*ClusterGateway{clusterGatewayForEndpointType(c, endpoint.Type)}
+	}
+	candidates = append(candidates, fallback...)
+	if config.EndpointFailoverSticky {
+		if preferred, ok := preferredEndpoints.get(c.Name); ok {
+			for i := range candidates {
+				if endpointCandidateAddress(candidates[i]) == preferred {
+					candidate := candidates[i]
+					copy(candidates[1:i+1], candidates[:i])
+					candidates[0] = candidate
+					break
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// fallbackEndpointCandidates returns the candidates of the fallback endpoint
+// type of the ClusterGateway, if any.
+func fallbackEndpointCandidates(c *ClusterGateway) []*ClusterGateway {
+	endpoint := c.Spec.Access.Endpoint
+	switch {
+	case endpoint.Type == ClusterEndpointTypeConst && endpoint.Fallback == ClusterEndpointTypeClusterProxy:
+		return []*ClusterGateway{clusterGatewayForEndpointType(c, ClusterEndpointTypeClusterProxy)}
+	case endpoint.Type == ClusterEndpointTypeClusterProxy && endpoint.Fallback == ClusterEndpointTypeConst && endpoint.Const != nil:
+		return constEndpointCandidates(c)
+	}
+	return nil
+}
+
+// constEndpointCandidates returns one candidate per Const endpoint of the
+// ClusterGateway.
+func constEndpointCandidates(c *ClusterGateway) []*ClusterGateway {
+	endpoint := c.Spec.Access.Endpoint
+	candidates := make([]*ClusterGateway, 0, len(endpoint.Const.Alternatives)+1)
+	candidates = append(candidates, clusterGatewayForEndpoint(c, endpoint.Const.Address, endpoint.Const.CABundle))
+	for _, alternative := range endpoint.Const.Alternatives {
+		caBundle := alternative.CABundle
+		if len(caBundle) == 0 {
+			caBundle = endpoint.Const.CABundle
+		}
+		candidates = append(candidates, clusterGatewayForEndpoint(c, alternative.Address, caBundle))
+	}
+	if config.EndpointFailoverOrder == config.EndpointFailoverOrderRandom {
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	}
+	return candidates
+}
+
+func clusterGatewayForEndpoint(c *ClusterGateway, address string, caBundle []byte) *ClusterGateway {
+	endpointConst := *c.Spec.Access.Endpoint.Const
+	endpointConst.Address = address
+	endpointConst.CABundle = caBundle
+	endpointConst.Alternatives = nil
+	candidate := *c
+	candidate.Spec.Access.Endpoint = &ClusterEndpoint{
+		Type:  ClusterEndpointTypeConst,
+		Const: &endpointConst,
+	}
+	return &candidate
+}
+
+// clusterGatewayForEndpointType returns the candidate of the endpoint type
+// which prescribes no explicit endpoint.
+func clusterGatewayForEndpointType(c *ClusterGateway, endpointType ClusterEndpointType) *ClusterGateway {
+	candidate := *c
+	candidate.Spec.Access.Endpoint = &ClusterEndpoint{
+		Type: endpointType,
+	}
+	return &candidate
+}
+
+// endpointCandidateAddress identifies the candidate among the candidates of
+// a cluster, which is the address of a Const endpoint or the endpoint type
+// otherwise.
+func endpointCandidateAddress(candidate *ClusterGateway) string {
+	if endpoint := candidate.Spec.Access.Endpoint; endpoint.Type == ClusterEndpointTypeConst && endpoint.Const != nil {
+		return endpoint.Const.Address
+	}
+	return string(candidate.Spec.Access.Endpoint.Type)
+}
+
+// dialErrorsOf marks the errors of the dialer as dial errors, so that the
+// failures of the dialers other than net.Dialer fail over as well.
+func dialErrorsOf(dial k8snet.DialFunc) k8snet.DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		var opErr *net.OpError
+		if err != nil && !errors.As(err, &opErr) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		return conn, err
+	}
+}
+
+// isEndpointFailoverError tells if the error indicates the endpoint is not
+// reachable, i.e. the request is not delivered to the kube-apiserver and is
+// safe to be retried against another endpoint.
+func isEndpointFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	switch {
+	case errors.As(err, &dnsErr),
+		errors.As(err, &unknownAuthorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &certificateInvalidErr),
+		errors.As(err, &verificationErr),
+		errors.As(err, &recordHeaderErr),
+		errors.As(err, &alertErr):
+		return true
+	}
+	return strings.Contains(err.Error(), "TLS handshake timeout")
+}
+
+// failoverBody keeps the request body open across the failed attempts until
+// it's either consumed or released, so that the request can be replayed to
+// the next endpoint.
+type failoverBody struct {
+	lock     sync.Mutex
+	body     io.ReadCloser
+	read     bool
+	closed   bool
+	released bool
+}
+
+func newFailoverBody(body io.ReadCloser) *failoverBody {
+	if body == nil || body == http.NoBody {
+		return nil
+	}
+	return &failoverBody{body: body}
+}
+
+func (b *failoverBody) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	b.read = true
+	b.lock.Unlock()
+	return b.body.Read(p)
+}
+
+func (b *failoverBody) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	if b.read || b.released {
+		return b.body.Close()
+	}
+	return nil
+}
+
+// replayable tells if the body is not consumed by any attempt yet.
+func (b *failoverBody) replayable() bool {
+	if b == nil {
+		return true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return !b.read
+}
+
+// rewind prepares the unconsumed body for another attempt, forgetting the
+// close from the previous attempt.
+func (b *failoverBody) rewind() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = false
+}
+
+// release hands over the body to the current attempt which is the last one.
+func (b *failoverBody) release() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.released {
+		return
+	}
+	b.released = true
+	if b.closed && !b.read {
+		b.body.Close()
+	}
+}
+
+var _ http.RoundTripper = &failoverRoundTripper{}
+
+// failoverRoundTripper sends the request to the endpoints of a cluster one
+// after another until an endpoint is reachable.
+type failoverRoundTripper struct {
+	cluster    string
+	candidates []*ClusterGateway
+	urls       []*url.URL
+	// delegates are the transports of the endpoints, each of which is
+	// configured with the CA bundle of the endpoint.
+	delegates []http.RoundTripper
+}
+
+func (rt *failoverRoundTripper) withPrimary(primary http.RoundTripper) http.RoundTripper {
+	delegates := make([]http.RoundTripper, len(rt.delegates))
+	copy(delegates, rt.delegates)
+	delegates[0] = primary
+	return &failoverRoundTripper{
+		cluster:    rt.cluster,
+		candidates: rt.candidates,
+		urls:       rt.urls,
+		delegates:  delegates,
+	}
+}
+
+func (rt *failoverRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := newFailoverBody(req.Body)
+	defer body.release()
+	for i, delegate := range rt.delegates {
+		last := i == len(rt.delegates)-1
+		body.rewind()
+		if last {
+			body.release()
+		}
+		attempt := rt.requestForEndpoint(req, i)
+		if body != nil {
+			attempt.Body = body
+		}
+		resp, err := delegate.RoundTrip(attempt)
+		if err == nil {
+			preferredEndpoints.record(rt.cluster, rt.candidates[i])
+			return resp, nil
+		}
+		if last || !isEndpointFailoverError(err) || !body.replayable() {
+			return nil, err
+		}
+		klog.V(4).Infof("Failing over cluster %s from endpoint %s: %v", rt.cluster, endpointCandidateAddress(rt.candidates[i]), err)
+	}
+	return nil, errors.Errorf("no endpoint available for cluster %s", rt.cluster)
+}
+
+// requestForEndpoint copies the request targeting the primary endpoint and
+// rewrites it to the i-th endpoint.
+func (rt *failoverRoundTripper) requestForEndpoint(req *http.Request, i int) *http.Request {
+	if i == 0 {
+		return req.WithContext(req.Context())
+	}
+	primary, endpoint := rt.urls[0], rt.urls[i]
+	attempt := req.Clone(req.Context())
+	attempt.URL.Scheme = endpoint.Scheme
+	attempt.URL.Host = endpoint.Host
+	if prefix := strings.TrimSuffix(primary.Path, "/"); strings.HasPrefix(req.URL.Path, prefix) {
+		attempt.URL.Path = strings.TrimSuffix(endpoint.Path, "/") + strings.TrimPrefix(req.URL.Path, prefix)
+		attempt.URL.RawPath = ""
+	}
+	if len(attempt.Host) > 0 {
+		attempt.Host = endpoint.Host
+	}
+	return attempt
+}
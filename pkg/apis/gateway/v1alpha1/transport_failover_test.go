@@ -0,0 +1,264 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/feature"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/component-base/featuregate/testing"
+	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	contextutil "sigs.k8s.io/apiserver-runtime/pkg/util/context"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+	"github.com/kluster-manager/cluster-gateway/pkg/featuregates"
+)
+
+func setEndpointFailoverDuringTest(t *testing.T, order string, sticky bool) {
+	originalOrder, originalSticky := config.EndpointFailoverOrder, config.EndpointFailoverSticky
+	config.EndpointFailoverOrder, config.EndpointFailoverSticky = order, sticky
+	preferredEndpoints = &endpointPreferences{
+		addresses:     make(map[string]string),
+		endpointTypes: make(map[string]ClusterEndpointType),
+	}
+	t.Cleanup(func() {
+		config.EndpointFailoverOrder, config.EndpointFailoverSticky = originalOrder, originalSticky
+	})
+}
+
+func failoverClusterGateway(name, address string, caBundle []byte, alternatives ...ClusterEndpointAlternative) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:      address,
+						CABundle:     caBundle,
+						Alternatives: alternatives,
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: testToken,
+				},
+			},
+		},
+	}
+}
+
+// unreachableAddress returns an https address refusing connections.
+func unreachableAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := "https://" + listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return address
+}
+
+func candidateAddresses(candidates []*ClusterGateway) []string {
+	addresses := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		addresses = append(addresses, endpointCandidateAddress(candidate))
+	}
+	return addresses
+}
+
+func TestClusterGatewayEndpointCandidates(t *testing.T) {
+	setEndpointFailoverDuringTest(t, config.EndpointFailoverOrderDeclared, true)
+	gw := failoverClusterGateway("foo", "https://a", []byte("caA"),
+		ClusterEndpointAlternative{Address: "https://b", CABundle: []byte("caB")},
+		ClusterEndpointAlternative{Address: "https://c"})
+
+	candidates := clusterGatewayEndpointCandidates(gw)
+	assert.Equal(t, []string{"https://a", "https://b", "https://c"}, candidateAddresses(candidates))
+	assert.Equal(t, []byte("caB"), candidates[1].Spec.Access.Endpoint.Const.CABundle)
+	// an alternative without CA bundle inherits the primary one
+	assert.Equal(t, []byte("caA"), candidates[2].Spec.Access.Endpoint.Const.CABundle)
+	for _, candidate := range candidates {
+		assert.Empty(t, candidate.Spec.Access.Endpoint.Const.Alternatives)
+	}
+	assert.Len(t, gw.Spec.Access.Endpoint.Const.Alternatives, 2, "the original object is not mutated")
+
+	// the preferred endpoint goes first while the rest keeps the order
+	preferredEndpoints.record("foo", candidates[2])
+	assert.Equal(t, []string{"https://c", "https://a", "https://b"}, candidateAddresses(clusterGatewayEndpointCandidates(gw)))
+	preferredEndpoints.record("foo", clusterGatewayForEndpoint(gw, "https://gone", nil))
+	assert.Equal(t, []string{"https://a", "https://b", "https://c"}, candidateAddresses(clusterGatewayEndpointCandidates(gw)))
+
+	config.EndpointFailoverSticky = false
+	preferredEndpoints.record("foo", candidates[2])
+	assert.Equal(t, []string{"https://a", "https://b", "https://c"}, candidateAddresses(clusterGatewayEndpointCandidates(gw)))
+
+	config.EndpointFailoverOrder = config.EndpointFailoverOrderRandom
+	assert.ElementsMatch(t, []string{"https://a", "https://b", "https://c"}, candidateAddresses(clusterGatewayEndpointCandidates(gw)))
+
+	single := failoverClusterGateway("bar", "https://a", []byte("caA"))
+	assert.Equal(t, []*ClusterGateway{single}, clusterGatewayEndpointCandidates(single))
+
+	// the endpoints of the fallback type come last
+	config.EndpointFailoverOrder = config.EndpointFailoverOrderDeclared
+	fallback := failoverClusterGateway("baz", "https://a", []byte("caA"),
+		ClusterEndpointAlternative{Address: "https://b"})
+	fallback.Spec.Access.Endpoint.Fallback = ClusterEndpointTypeClusterProxy
+	candidates = clusterGatewayEndpointCandidates(fallback)
+	assert.Equal(t, []string{"https://a", "https://b", string(ClusterEndpointTypeClusterProxy)}, candidateAddresses(candidates))
+	assert.Empty(t, candidates[2].Spec.Access.Endpoint.Fallback)
+	fallback.Spec.Access.Endpoint.Type, fallback.Spec.Access.Endpoint.Fallback = ClusterEndpointTypeClusterProxy, ClusterEndpointTypeConst
+	candidates = clusterGatewayEndpointCandidates(fallback)
+	assert.Equal(t, []string{string(ClusterEndpointTypeClusterProxy), "https://a", "https://b"}, candidateAddresses(candidates))
+	assert.Nil(t, candidates[0].Spec.Access.Endpoint.Const)
+}
+
+func TestNewConfigFromClusterFailover(t *testing.T) {
+	setEndpointFailoverDuringTest(t, config.EndpointFailoverOrderDeclared, true)
+	var receivedAuth, receivedBody, receivedPath string
+	healthySvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedAuth = req.Header.Get("Authorization")
+		receivedPath = req.URL.Path
+		data, _ := io.ReadAll(req.Body)
+		receivedBody = string(data)
+		resp.WriteHeader(http.StatusCreated)
+	}))
+	defer healthySvr.Close()
+	plainSvr := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected request to the plain http endpoint")
+	}))
+	defer plainSvr.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: healthySvr.Certificate().Raw})
+
+	unreachable := unreachableAddress(t)
+	gw := failoverClusterGateway("foo", unreachable+"/prefix", caBundle,
+		// TLS handshake fails against a plain http server
+		ClusterEndpointAlternative{Address: strings.Replace(plainSvr.URL, "http://", "https://", 1)},
+		ClusterEndpointAlternative{Address: healthySvr.URL + "/other"})
+	cfg, err := NewConfigFromCluster(context.TODO(), gw)
+	require.NoError(t, err)
+	assert.Equal(t, unreachable+"/prefix", cfg.Host)
+	rt, err := restclient.TransportFor(cfg)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, unreachable+"/prefix/api/v1/namespaces", bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "Bearer "+testToken, receivedAuth)
+	assert.Equal(t, "payload", receivedBody)
+	assert.Equal(t, "/other/api/v1/namespaces", receivedPath)
+
+	// the healthy endpoint is tried first afterwards
+	assert.Equal(t, healthySvr.URL+"/other", candidateAddresses(clusterGatewayEndpointCandidates(gw))[0])
+
+	// non-failover errors are returned directly
+	gw = failoverClusterGateway("bar", healthySvr.URL, caBundle,
+		ClusterEndpointAlternative{Address: unreachable})
+	cfg, err = NewConfigFromCluster(context.TODO(), gw)
+	require.NoError(t, err)
+	rt, err = restclient.TransportFor(cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, healthySvr.URL+"/api", nil)
+	require.NoError(t, err)
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestProxyHandlerFailover(t *testing.T) {
+	setEndpointFailoverDuringTest(t, config.EndpointFailoverOrderDeclared, true)
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	var receivedBody string
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		receivedBody = string(data)
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("ok"))
+	}))
+	defer endpointSvr.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: endpointSvr.Certificate().Raw})
+
+	unreachable := unreachableAddress(t)
+	gw := failoverClusterGateway("foo", unreachable, caBundle,
+		ClusterEndpointAlternative{Address: endpointSvr.URL})
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "create"})
+	responder := &fakeResponder{}
+	handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "foo", &ClusterGatewayProxyOptions{Path: "/abc"}, responder)
+	require.NoError(t, err)
+	svr := httptest.NewServer(handler)
+	defer svr.Close()
+
+	resp, err := svr.Client().Post(svr.URL+apiPrefix+"foo"+apiSuffix+"/api/v1/namespaces", "application/json", bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, "payload", receivedBody)
+	assert.Equal(t, endpointSvr.URL, candidateAddresses(clusterGatewayEndpointCandidates(gw))[0])
+}
+
+func TestProxyHandlerEndpointFallback(t *testing.T) {
+	setEndpointFailoverDuringTest(t, config.EndpointFailoverOrderDeclared, false)
+	k8stesting.SetFeatureGateDuringTest(t, feature.DefaultMutableFeatureGate, featuregates.ClientIdentityPenetration, false)
+	dialerGetter := DialerGetter
+	DialerGetter = func(ctx context.Context) (k8snet.DialFunc, error) {
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("no tunnel to the cluster")
+		}, nil
+	}
+	defer func() { DialerGetter = dialerGetter }()
+	endpointSvr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer endpointSvr.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: endpointSvr.Certificate().Raw})
+
+	fakeClient := newWriteTestClient(t, gatewayAddon("foo", map[string]string{
+		common.AnnotationKeyClusterGatewayEndpointFallback: string(ClusterEndpointTypeConst),
+	}))
+	gw := failoverClusterGateway("foo", endpointSvr.URL, caBundle)
+	gw.Spec.Access.Endpoint.Type, gw.Spec.Access.Endpoint.Fallback = ClusterEndpointTypeClusterProxy, ClusterEndpointTypeConst
+
+	ctx := contextutil.WithParentStorage(context.TODO(), &fakeParentStorage{obj: gw})
+	ctx = request.WithRequestInfo(ctx, &request.RequestInfo{Verb: "get"})
+	responder := &fakeResponder{}
+	handler, err := (&ClusterGatewayProxy{}).Connect(ctx, "foo", &ClusterGatewayProxyOptions{Path: "/abc"}, responder)
+	require.NoError(t, err)
+	svr := httptest.NewServer(handler)
+	defer svr.Close()
+
+	resp, err := svr.Client().Get(svr.URL + apiPrefix + "foo" + apiSuffix + "/api/v1/namespaces")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, responder.receivingErr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// the fallback serving the requests is persisted in the addon, which is
+	// reported by the status
+	assert.Eventually(t, func() bool {
+		addon := &addonv1alpha1.ManagedClusterAddOn{}
+		require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: "foo", Name: common.AddonName}, addon))
+		return addon.Annotations[common.AnnotationKeyClusterGatewayStatusActiveEndpointType] == string(ClusterEndpointTypeConst)
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oidcTokenExpiryDelta is how long before the expiry an access token is
+// refreshed, so that the token never expires during a proxied request.
+const oidcTokenExpiryDelta = time.Minute
+
+// oidcHTTPClient requests the OIDC discovery documents and the access tokens.
+var oidcHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// oidcTokenSources keeps the token source of each cluster across the client
+// configs, so that the access tokens are reused until shortly before expiry.
+var oidcTokenSources = &oidcTokenSourceCache{sources: make(map[string]*oidcTokenSource)}
+
+type oidcTokenSourceCache struct {
+	lock    sync.Mutex
+	sources map[string]*oidcTokenSource
+}
+
+// get returns the token source of the cluster, which is replaced once the
+// credentials of the cluster change.
+func (c *oidcTokenSourceCache) get(cluster string, cred *OIDCClientCredentials) (oauth2.TokenSource, error) {
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	fingerprint := hex.EncodeToString(sum[:])
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if source, ok := c.sources[cluster]; ok && source.fingerprint == fingerprint {
+		return source, nil
+	}
+	source := &oidcTokenSource{
+		fingerprint: fingerprint,
+		credentials: *cred.DeepCopy(),
+	}
+	c.sources[cluster] = source
+	return source, nil
+}
+
+var _ oauth2.TokenSource = &oidcTokenSource{}
+
+// oidcTokenSource discovers the token endpoint of the issuer upon the first
+// token request and then requests the tokens via the client-credentials grant.
+type oidcTokenSource struct {
+	lock        sync.Mutex
+	fingerprint string
+	credentials OIDCClientCredentials
+	delegate    oauth2.TokenSource
+}
+
+func (s *oidcTokenSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	if s.delegate == nil {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, oidcHTTPClient)
+		tokenURL, err := discoverOIDCTokenEndpoint(ctx, s.credentials.IssuerURL)
+		if err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+		cfg := &clientcredentials.Config{
+			ClientID:     s.credentials.ClientID,
+			ClientSecret: s.credentials.ClientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       s.credentials.Scopes,
+		}
+		s.delegate = oauth2.ReuseTokenSourceWithExpiry(nil, cfg.TokenSource(ctx), oidcTokenExpiryDelta)
+	}
+	delegate := s.delegate
+	s.lock.Unlock()
+	return delegate.Token()
+}
+
+func discoverOIDCTokenEndpoint(ctx context.Context, issuer string) (string, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed requesting oidc discovery document from %s", issuer)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("failed requesting oidc discovery document from %s: %s", issuer, resp.Status)
+	}
+	discovery := struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return "", errors.Wrapf(err, "failed decoding oidc discovery document from %s", issuer)
+	}
+	if len(discovery.TokenEndpoint) == 0 {
+		return "", errors.Errorf("no token endpoint is discovered from %s", issuer)
+	}
+	return discovery.TokenEndpoint, nil
+}
+
+// newOIDCTransportWrapper returns the wrapper authenticating the requests by
+// the access tokens of the cluster.
+func newOIDCTransportWrapper(c *ClusterGateway) (func(http.RoundTripper) http.RoundTripper, error) {
+	cred := c.Spec.Access.Credential.OIDC
+	if cred == nil {
+		return nil, errors.Errorf("missing oidc client credentials for cluster %s", c.Name)
+	}
+	source, err := oidcTokenSources.get(c.Name, cred)
+	if err != nil {
+		return nil, err
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &oauth2.Transport{Source: source, Base: rt}
+	}, nil
+}
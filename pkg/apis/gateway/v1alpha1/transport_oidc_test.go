@@ -0,0 +1,137 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+// stubOIDCIssuer serves the discovery document and issues numbered access
+// tokens to the client "foo" through the client-credentials grant.
+type stubOIDCIssuer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	issued    int
+	expiresIn int
+	scopes    []string
+}
+
+func newStubOIDCIssuer(t *testing.T, expiresIn int) *stubOIDCIssuer {
+	issuer := &stubOIDCIssuer{expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(resp http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(resp).Encode(map[string]string{
+			"issuer":         issuer.URL,
+			"token_endpoint": issuer.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(resp http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		id, secret, _ := req.BasicAuth()
+		if req.PostForm.Get("grant_type") != "client_credentials" || id != "foo" || secret != "bar" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		issuer.lock.Lock()
+		defer issuer.lock.Unlock()
+		issuer.issued++
+		issuer.scopes = append(issuer.scopes, req.PostForm.Get("scope"))
+		resp.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", issuer.issued),
+			"token_type":   "Bearer",
+			"expires_in":   issuer.expiresIn,
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func oidcClusterGateway(name, address string, cred *OIDCClientCredentials) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  address,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type: CredentialTypeOIDCClientCredentials,
+					OIDC: cred,
+				},
+			},
+		},
+	}
+}
+
+func TestNewConfigFromClusterOIDC(t *testing.T) {
+	var receivedAuth []string
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		receivedAuth = append(receivedAuth, req.Header.Get("Authorization"))
+		resp.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+	request := func(gw *ClusterGateway) error {
+		cfg, err := NewConfigFromCluster(t.Context(), gw)
+		if err != nil {
+			return err
+		}
+		rt, err := restclient.TransportFor(cfg)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, svr.URL+"/healthz", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	t.Run("tokens are cached until shortly before expiry", func(t *testing.T) {
+		receivedAuth = nil
+		issuer := newStubOIDCIssuer(t, 3600)
+		cred := &OIDCClientCredentials{IssuerURL: issuer.URL, ClientID: "foo", ClientSecret: "bar", Scopes: []string{"openid", "k8s"}}
+		require.NoError(t, request(oidcClusterGateway("oidc-cached", svr.URL, cred)))
+		require.NoError(t, request(oidcClusterGateway("oidc-cached", svr.URL, cred)))
+		assert.Equal(t, []string{"Bearer token-1", "Bearer token-1"}, receivedAuth)
+		assert.Equal(t, []string{"openid k8s"}, issuer.scopes)
+
+		// rotating the credentials drops the cached token
+		rotated := cred.DeepCopy()
+		rotated.Scopes = nil
+		require.NoError(t, request(oidcClusterGateway("oidc-cached", svr.URL, rotated)))
+		assert.Equal(t, "Bearer token-2", receivedAuth[2])
+	})
+
+	t.Run("tokens about to expire are refreshed", func(t *testing.T) {
+		receivedAuth = nil
+		issuer := newStubOIDCIssuer(t, int(oidcTokenExpiryDelta.Seconds())/2)
+		cred := &OIDCClientCredentials{IssuerURL: issuer.URL, ClientID: "foo", ClientSecret: "bar"}
+		require.NoError(t, request(oidcClusterGateway("oidc-refreshed", svr.URL, cred)))
+		require.NoError(t, request(oidcClusterGateway("oidc-refreshed", svr.URL, cred)))
+		assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, receivedAuth)
+	})
+
+	t.Run("rejected client credentials fail the request", func(t *testing.T) {
+		receivedAuth = nil
+		issuer := newStubOIDCIssuer(t, 3600)
+		cred := &OIDCClientCredentials{IssuerURL: issuer.URL, ClientID: "foo", ClientSecret: "wrong"}
+		assert.Error(t, request(oidcClusterGateway("oidc-rejected", svr.URL, cred)))
+		assert.Empty(t, receivedAuth)
+	})
+}
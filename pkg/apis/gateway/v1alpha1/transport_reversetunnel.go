@@ -0,0 +1,27 @@
+package v1alpha1
+
+import (
+	"context"
+	"net"
+	"os"
+
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/util/reversetunnel"
+)
+
+// reverseTunnelSessions keeps the sessions of the reverse tunnels dialed out
+// by the agents to this replica.
+var reverseTunnelSessions = reversetunnel.NewRegistry()
+
+// reverseTunnelReplica tells the agents the replica holding their sessions,
+// so that every replica of the gateway is dialed by the agents.
+var reverseTunnelReplica, _ = os.Hostname()
+
+// reverseTunnelDialer returns the dialer through the reverse tunnel of the
+// cluster.
+func reverseTunnelDialer(cluster string) k8snet.DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return reverseTunnelSessions.DialContext(ctx, cluster, network, address)
+	}
+}
@@ -0,0 +1,322 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505 -- hashing of the known_hosts
+	"encoding/base64"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	k8snet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+)
+
+// sshBastionDefaultPort is the port of the SSH bastions without explicit
+// port.
+const sshBastionDefaultPort = "22"
+
+// sshBastionTimeout bounds establishing the SSH connections to the bastions
+// when the dialing context has no deadline.
+const sshBastionTimeout = 30 * time.Second
+
+// sshBastionClients keeps the SSH connection to the bastion of each cluster
+// across the client configs, so that the dials to the cluster are
+// multiplexed over the connection.
+var sshBastionClients = &sshBastionClientCache{clients: make(map[string]*sshBastionClient)}
+
+type sshBastionClientCache struct {
+	lock    sync.Mutex
+	clients map[string]*sshBastionClient
+}
+
+// dialer returns the dialer through the SSH bastion of the cluster. The SSH
+// connection is replaced once the endpoint or the bastion changes.
+func (c *sshBastionClientCache) dialer(cluster *ClusterGateway) (k8snet.DialFunc, error) {
+	fingerprint, err := clusterAccessFingerprint(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if client, ok := c.clients[cluster.Name]; ok {
+		if client.fingerprint == fingerprint {
+			return client.DialContext, nil
+		}
+		client.close()
+		delete(c.clients, cluster.Name)
+	}
+	client, err := newSSHBastionClient(cluster.Spec.Access.Endpoint.SSHBastion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ssh bastion of cluster %s", cluster.Name)
+	}
+	client.fingerprint = fingerprint
+	c.clients[cluster.Name] = client
+	return client.DialContext, nil
+}
+
+// sshBastionClient dials through the SSH bastion over a lazily established
+// SSH connection, which is re-established once broken.
+type sshBastionClient struct {
+	fingerprint string
+	address     string
+	config      *ssh.ClientConfig
+
+	lock   sync.Mutex
+	client *ssh.Client
+}
+
+func newSSHBastionClient(bastion *ClusterEndpointSSHBastion) (*sshBastionClient, error) {
+	if bastion == nil {
+		return nil, errors.New("missing ssh bastion")
+	}
+	address, err := sshBastionAddress(bastion.Host)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(bastion.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing private key")
+	}
+	hostKeyCallback, err := newSSHHostKeyCallback(bastion.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	return &sshBastionClient{
+		address: address,
+		config: &ssh.ClientConfig{
+			User:            bastion.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+		},
+	}, nil
+}
+
+// DialContext dials the address from the SSH bastion, where the address is
+// resolved.
+func (c *sshBastionClient) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	client, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, network, address)
+	var openErr *ssh.OpenChannelError
+	if err == nil || errors.As(err, &openErr) || ctx.Err() != nil {
+		return conn, err
+	}
+	// the connection broke silently, in which case the dial is retried
+	// upon a new connection
+	klog.V(4).InfoS("Re-establishing broken ssh connection", "bastion", c.address, "err", err)
+	c.reset(client)
+	if client, err = c.connect(ctx); err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, network, address)
+}
+
+func (c *sshBastionClient) connect(ctx context.Context) (*ssh.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sshBastionTimeout)
+	}
+	conn, err := (&net.Dialer{Deadline: deadline}).DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed dialing ssh bastion %s", c.address)
+	}
+	// the handshake is bounded by the deadline as well
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.address, c.config)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "failed handshaking with ssh bastion %s", c.address)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		sshConn.Close()
+		return nil, err
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	go func() {
+		_ = client.Wait()
+		c.reset(client)
+	}()
+	c.client = client
+	return client, nil
+}
+
+// reset drops the connection so that the next dial re-establishes it.
+func (c *sshBastionClient) reset(client *ssh.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == client {
+		c.client = nil
+	}
+	_ = client.Close()
+}
+
+func (c *sshBastionClient) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		_ = c.client.Close()
+		c.client = nil
+	}
+}
+
+// sshBastionAddress returns the dialing address of the SSH bastion host.
+func sshBastionAddress(host string) (string, error) {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host, nil
+	}
+	address := net.JoinHostPort(host, sshBastionDefaultPort)
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", errors.Wrapf(err, "invalid ssh bastion host %s", host)
+	}
+	return address, nil
+}
+
+// sshKnownHost is a line of the known_hosts.
+type sshKnownHost struct {
+	patterns []string
+	key      ssh.PublicKey
+	revoked  bool
+}
+
+// newSSHHostKeyCallback verifies the host keys of the SSH bastion against
+// the known_hosts lines, which are mandatory. The lines follow the format of
+// OpenSSH's known_hosts including the hashed hosts, the wildcards, the
+// negations and the revoked keys, while the certificate authorities are not
+// supported.
+func newSSHHostKeyCallback(knownHosts []byte) (ssh.HostKeyCallback, error) {
+	var hosts []sshKnownHost
+	for rest := knownHosts; len(bytes.TrimSpace(rest)) > 0; {
+		marker, patterns, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed parsing known_hosts")
+		}
+		rest = next
+		switch marker {
+		case "":
+			hosts = append(hosts, sshKnownHost{patterns: patterns, key: key})
+		case "revoked":
+			hosts = append(hosts, sshKnownHost{patterns: patterns, key: key, revoked: true})
+		default:
+			return nil, errors.Errorf("unsupported known_hosts marker @%s", marker)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("missing known_hosts of ssh bastion")
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		addresses := []string{knownhosts.Normalize(hostname)}
+		if remote != nil {
+			addresses = append(addresses, knownhosts.Normalize(remote.String()))
+		}
+		// the revoked keys are rejected regardless of the order of the lines
+		known, accepted := false, false
+		for _, host := range hosts {
+			if !host.matches(addresses) {
+				continue
+			}
+			sameKey := bytes.Equal(host.key.Marshal(), key.Marshal())
+			switch {
+			case host.revoked && sameKey:
+				return errors.Errorf("host key of %s is revoked", hostname)
+			case !host.revoked:
+				known = true
+				accepted = accepted || sameKey
+			}
+		}
+		if accepted {
+			return nil
+		}
+		if known {
+			return errors.Errorf("host key of %s mismatches known_hosts", hostname)
+		}
+		return errors.Errorf("host %s is not in known_hosts", hostname)
+	}, nil
+}
+
+// matches returns whether any of the normalized addresses matches the
+// patterns of the line, unless any of the addresses is negated.
+func (h sshKnownHost) matches(addresses []string) bool {
+	matched := false
+	for _, pattern := range h.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		for _, address := range addresses {
+			if !matchSSHKnownHostPattern(pattern, address) {
+				continue
+			}
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchSSHKnownHostPattern matches the address against the pattern, which is
+// either hashed or containing the wildcards "*" and "?".
+func matchSSHKnownHostPattern(pattern, address string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[len("|1|"):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(address))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchWildcard(pattern, address)
+}
+
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,309 @@
+package v1alpha1
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+)
+
+// sshServer is an in-process SSH bastion forwarding the direct-tcpip
+// channels.
+type sshServer struct {
+	address  string
+	hostKey  ssh.Signer
+	accepted int64
+
+	lock  sync.Mutex
+	conns []net.Conn
+}
+
+func newSSHServer(t *testing.T, authorized ssh.PublicKey) *sshServer {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	s := &sshServer{address: listener.Addr().String(), hostKey: hostKey}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "gateway" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	cfg.AddHostKey(hostKey)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&s.accepted, 1)
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.serve(conn, cfg)
+		}
+	}()
+	return s
+}
+
+func (s *sshServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "direct-tcpip" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var payload struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newCh.ExtraData(), &payload); err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer ch.Close()
+			_, _ = io.Copy(ch, target)
+		}()
+		go func() {
+			defer target.Close()
+			_, _ = io.Copy(target, ch)
+		}()
+	}
+}
+
+// breakConnections closes the accepted connections from the server side.
+func (s *sshServer) breakConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func newSSHClientKey(t *testing.T) (ssh.PublicKey, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return sshPub, pem.EncodeToMemory(block)
+}
+
+func TestSSHBastionDialer(t *testing.T) {
+	apiserver := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		io.WriteString(resp, `{"major":"1","minor":"34"}`)
+	}))
+	defer apiserver.Close()
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiserver.Certificate().Raw})
+	clientPub, clientKey := newSSHClientKey(t)
+	bastion := newSSHServer(t, clientPub)
+
+	newCluster := func(name string, knownHosts []byte) *ClusterGateway {
+		return &ClusterGateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: ClusterGatewaySpec{
+				Access: ClusterAccess{
+					Endpoint: &ClusterEndpoint{
+						Type: ClusterEndpointTypeSSHBastion,
+						Const: &ClusterEndpointConst{
+							Address:  apiserver.URL,
+							CABundle: caData,
+						},
+						SSHBastion: &ClusterEndpointSSHBastion{
+							Host:       bastion.address,
+							User:       "gateway",
+							KnownHosts: knownHosts,
+							PrivateKey: clientKey,
+						},
+					},
+					Credential: &ClusterAccessCredential{
+						Type:                CredentialTypeServiceAccountToken,
+						ServiceAccountToken: "token",
+					},
+				},
+			},
+		}
+	}
+	knownHosts := []byte(knownhosts.Line([]string{bastion.address}, bastion.hostKey.PublicKey()) + "\n")
+
+	t.Run("requests are tunneled through the bastion", func(t *testing.T) {
+		cfg, err := NewConfigFromCluster(context.TODO(), newCluster("ssh-tunneled", knownHosts))
+		require.NoError(t, err)
+		httpClient, err := restclient.HTTPClientFor(cfg)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			resp, err := httpClient.Get(apiserver.URL + "/version")
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Contains(t, string(body), `"minor":"34"`)
+		}
+
+		// the dials are multiplexed over the ssh connection
+		before := atomic.LoadInt64(&bastion.accepted)
+		dial, err := sshBastionClients.dialer(newCluster("ssh-tunneled", knownHosts))
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			conn, err := dial(context.TODO(), "tcp", apiserver.Listener.Addr().String())
+			require.NoError(t, err)
+			conn.Close()
+		}
+		assert.Equal(t, before, atomic.LoadInt64(&bastion.accepted))
+
+		// the broken connection is re-established
+		bastion.breakConnections()
+		require.Eventually(t, func() bool {
+			conn, err := dial(context.TODO(), "tcp", apiserver.Listener.Addr().String())
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.Equal(t, before+1, atomic.LoadInt64(&bastion.accepted))
+	})
+
+	t.Run("unreachable targets are reported", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		unreachable := listener.Addr().String()
+		listener.Close()
+		dial, err := sshBastionClients.dialer(newCluster("ssh-unreachable", knownHosts))
+		require.NoError(t, err)
+		_, err = dial(context.TODO(), "tcp", unreachable)
+		var openErr *ssh.OpenChannelError
+		assert.ErrorAs(t, err, &openErr)
+	})
+
+	t.Run("unknown host keys are rejected", func(t *testing.T) {
+		_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		other, err := ssh.NewSignerFromKey(otherPriv)
+		require.NoError(t, err)
+		mismatched := []byte(knownhosts.Line([]string{bastion.address}, other.PublicKey()))
+		dial, err := sshBastionClients.dialer(newCluster("ssh-mismatched", mismatched))
+		require.NoError(t, err)
+		_, err = dial(context.TODO(), "tcp", apiserver.Listener.Addr().String())
+		assert.ErrorContains(t, err, "mismatches known_hosts")
+
+		revoked := append([]byte("@revoked "), knownHosts...)
+		revoked = append(revoked, knownHosts...)
+		dial, err = sshBastionClients.dialer(newCluster("ssh-revoked", revoked))
+		require.NoError(t, err)
+		_, err = dial(context.TODO(), "tcp", apiserver.Listener.Addr().String())
+		assert.ErrorContains(t, err, "revoked")
+
+		_, err = sshBastionClients.dialer(newCluster("ssh-missing", nil))
+		assert.ErrorContains(t, err, "missing known_hosts")
+	})
+}
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	key := signer.PublicKey()
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	cases := []struct {
+		name       string
+		knownHosts string
+		hostname   string
+		accepted   bool
+	}{
+		{
+			name:       "plain host on the default port",
+			knownHosts: knownhosts.Line([]string{"bastion.example.com"}, key),
+			hostname:   "bastion.example.com:22",
+			accepted:   true,
+		},
+		{
+			name:       "hashed host",
+			knownHosts: knownhosts.Line([]string{knownhosts.HashHostname(knownhosts.Normalize("bastion.example.com:2222"))}, key),
+			hostname:   "bastion.example.com:2222",
+			accepted:   true,
+		},
+		{
+			name:       "wildcard host",
+			knownHosts: knownhosts.Line([]string{"*.example.com"}, key),
+			hostname:   "bastion.example.com:22",
+			accepted:   true,
+		},
+		{
+			name:       "negated host",
+			knownHosts: knownhosts.Line([]string{"*.example.com", "!bastion.example.com"}, key),
+			hostname:   "bastion.example.com:22",
+		},
+		{
+			name:       "matching by remote address",
+			knownHosts: knownhosts.Line([]string{"10.0.0.1"}, key),
+			hostname:   "bastion.example.com:22",
+			accepted:   true,
+		},
+		{
+			name:       "unknown host",
+			knownHosts: "# comment\n" + knownhosts.Line([]string{"other.example.com"}, key),
+			hostname:   "bastion.example.com:22",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			callback, err := newSSHHostKeyCallback([]byte(c.knownHosts))
+			require.NoError(t, err)
+			err = callback(c.hostname, addr, key)
+			if c.accepted {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	_, err = newSSHHostKeyCallback([]byte("@cert-authority " + knownhosts.Line([]string{"*"}, key)))
+	assert.ErrorContains(t, err, "unsupported")
+	_, err = newSSHHostKeyCallback([]byte("# comment only\n"))
+	assert.ErrorContains(t, err, "missing known_hosts")
+}
@@ -215,6 +215,41 @@ func TestClusterRestConfigConversion(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "downstream cluster-gateway should work",
+			clusterGateway: &ClusterGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-cluster",
+				},
+				Spec: ClusterGatewaySpec{
+					Access: ClusterAccess{
+						Endpoint: &ClusterEndpoint{
+							Type: ClusterEndpointTypeClusterGateway,
+							Const: &ClusterEndpointConst{
+								Address:  "https://hub.foo.bar:6443",
+								CABundle: testCAData,
+							},
+							ClusterGateway: &ClusterEndpointClusterGateway{
+								Cluster: "remote-cluster",
+							},
+						},
+						Credential: &ClusterAccessCredential{
+							Type:                CredentialTypeServiceAccountToken,
+							ServiceAccountToken: testToken,
+						},
+					},
+				},
+			},
+			expectedCfg: &rest.Config{
+				Host:        "https://hub.foo.bar:6443" + apiPrefix + "remote-cluster" + apiSuffix,
+				Timeout:     40 * time.Second,
+				BearerToken: testToken,
+				TLSClientConfig: rest.TLSClientConfig{
+					ServerName: "hub.foo.bar",
+					CAData:     testCAData,
+				},
+			},
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
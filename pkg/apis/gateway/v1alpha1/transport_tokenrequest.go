@@ -0,0 +1,131 @@
+package v1alpha1
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+// tokenRequestRenewFraction is the fraction of the lifetime after which a
+// minted token is renewed.
+const tokenRequestRenewFraction = 0.8
+
+// tokenRequestTimeout bounds the TokenRequest calls to the clusters.
+const tokenRequestTimeout = 30 * time.Second
+
+// tokenRequestSources keeps the minted tokens of each cluster across the
+// client configs, so that the tokens are reused until renewal.
+var tokenRequestSources = &tokenRequestSourceCache{sources: make(map[string]*tokenRequestSource)}
+
+type tokenRequestSourceCache struct {
+	lock    sync.Mutex
+	sources map[string]*tokenRequestSource
+}
+
+// get returns the token source of the cluster, which is replaced once the
+// endpoint, the bootstrap credential or the token request config change.
+func (c *tokenRequestSourceCache) get(cluster *ClusterGateway) (oauth2.TokenSource, error) {
+	fingerprint, err := clusterAccessFingerprint(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if source, ok := c.sources[cluster.Name]; ok && source.fingerprint == fingerprint {
+		return source.delegate, nil
+	}
+	bootstrap := cluster.DeepCopy()
+	bootstrap.Spec.Access.Credential.TokenRequest = nil
+	source := &tokenRequestSource{
+		fingerprint: fingerprint,
+		bootstrap:   bootstrap,
+		config:      *cluster.Spec.Access.Credential.TokenRequest.DeepCopy(),
+	}
+	source.delegate = oauth2.ReuseTokenSource(nil, source)
+	c.sources[cluster.Name] = source
+	return source.delegate, nil
+}
+
+var _ oauth2.TokenSource = &tokenRequestSource{}
+
+// tokenRequestSource mints the tokens of the ServiceAccount by calling the
+// TokenRequest API of the cluster with the bootstrap credential.
+type tokenRequestSource struct {
+	fingerprint string
+	bootstrap   *ClusterGateway
+	config      TokenRequestConfig
+	delegate    oauth2.TokenSource
+}
+
+func (s *tokenRequestSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+	defer cancel()
+	// the bootstrap client is built upon every minting which is rare
+	cfg, err := NewConfigFromCluster(ctx, s.bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tokenRequestCfg := s.config
+	expirationSeconds := config.TokenRequestExpirationSeconds
+	if tokenRequestCfg.ExpirationSeconds != nil {
+		expirationSeconds = *tokenRequestCfg.ExpirationSeconds
+	}
+	issuedAt := time.Now()
+	resp, err := client.CoreV1().
+		ServiceAccounts(tokenRequestCfg.ServiceAccountNamespace).
+		CreateToken(ctx, tokenRequestCfg.ServiceAccountName, &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{
+				Audiences:         tokenRequestCfg.Audiences,
+				ExpirationSeconds: &expirationSeconds,
+			},
+		}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed requesting token for serviceaccount %s/%s in cluster %s",
+			tokenRequestCfg.ServiceAccountNamespace, tokenRequestCfg.ServiceAccountName, s.bootstrap.Name)
+	}
+	// the cluster may shorten the lifetime so that the renewal is scheduled
+	// upon the actual expiration
+	lifetime := resp.Status.ExpirationTimestamp.Time.Sub(issuedAt)
+	return &oauth2.Token{
+		AccessToken: resp.Status.Token,
+		TokenType:   "Bearer",
+		Expiry:      issuedAt.Add(time.Duration(float64(lifetime) * tokenRequestRenewFraction)),
+	}, nil
+}
+
+// newTokenRequestConfigFromCluster builds the client config authenticating
+// the requests by the tokens minted for the cluster.
+func newTokenRequestConfigFromCluster(ctx context.Context, c *ClusterGateway) (*restclient.Config, error) {
+	if c.Spec.Access.Credential.TokenRequest == nil {
+		return nil, errors.Errorf("missing token request config for cluster %s", c.Name)
+	}
+	source, err := tokenRequestSources.get(c)
+	if err != nil {
+		return nil, err
+	}
+	// the bootstrap credential is never attached to the proxied requests
+	minted := c.DeepCopy()
+	minted.Spec.Access.Credential = &ClusterAccessCredential{Type: CredentialTypeServiceAccountToken}
+	cfg, err := NewConfigFromCluster(ctx, minted)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &oauth2.Transport{Source: source, Base: rt}
+	})
+	return cfg, nil
+}
@@ -0,0 +1,147 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+// stubTokenRequestCluster mints numbered tokens for the ServiceAccount
+// "foo/bar" upon requests authenticated by the bootstrap token, and records
+// the authorization of the other requests.
+type stubTokenRequestCluster struct {
+	*httptest.Server
+	lock         sync.Mutex
+	minted       int
+	lifetime     time.Duration
+	requested    []authenticationv1.TokenRequestSpec
+	receivedAuth []string
+}
+
+func newStubTokenRequestCluster(t *testing.T, lifetime time.Duration) *stubTokenRequestCluster {
+	cluster := &stubTokenRequestCluster{lifetime: lifetime}
+	cluster.Server = httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		cluster.lock.Lock()
+		defer cluster.lock.Unlock()
+		if req.URL.Path != "/api/v1/namespaces/foo/serviceaccounts/bar/token" {
+			cluster.receivedAuth = append(cluster.receivedAuth, req.Header.Get("Authorization"))
+			resp.WriteHeader(http.StatusOK)
+			return
+		}
+		if req.Method != http.MethodPost || req.Header.Get("Authorization") != "Bearer bootstrap" {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the request body is encoded in either json or protobuf
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		obj, err := runtime.Decode(scheme.Codecs.UniversalDeserializer(), body)
+		require.NoError(t, err)
+		tokenRequest := obj.(*authenticationv1.TokenRequest)
+		cluster.requested = append(cluster.requested, tokenRequest.Spec)
+		cluster.minted++
+		tokenRequest.Status = authenticationv1.TokenRequestStatus{
+			Token:               fmt.Sprintf("minted-%d", cluster.minted),
+			ExpirationTimestamp: metav1.NewTime(time.Now().Add(cluster.lifetime)),
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(http.StatusCreated)
+		tokenRequest.APIVersion = authenticationv1.SchemeGroupVersion.String()
+		tokenRequest.Kind = "TokenRequest"
+		json.NewEncoder(resp).Encode(tokenRequest)
+	}))
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func tokenRequestClusterGateway(name, address, bootstrap string, tokenRequest *TokenRequestConfig) *ClusterGateway {
+	return &ClusterGateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: ClusterGatewaySpec{
+			Access: ClusterAccess{
+				Endpoint: &ClusterEndpoint{
+					Type: ClusterEndpointTypeConst,
+					Const: &ClusterEndpointConst{
+						Address:  address,
+						Insecure: pointer.Bool(true),
+					},
+				},
+				Credential: &ClusterAccessCredential{
+					Type:                CredentialTypeServiceAccountToken,
+					ServiceAccountToken: bootstrap,
+					TokenRequest:        tokenRequest,
+				},
+			},
+		},
+	}
+}
+
+func TestNewConfigFromClusterTokenRequest(t *testing.T) {
+	request := func(gw *ClusterGateway) error {
+		cfg, err := NewConfigFromCluster(t.Context(), gw)
+		if err != nil {
+			return err
+		}
+		rt, err := restclient.TransportFor(cfg)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, gw.Spec.Access.Endpoint.Const.Address+"/healthz", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	t.Run("minted tokens are cached until renewal", func(t *testing.T) {
+		cluster := newStubTokenRequestCluster(t, time.Hour)
+		tokenRequest := &TokenRequestConfig{
+			ServiceAccountNamespace: "foo",
+			ServiceAccountName:      "bar",
+			Audiences:               []string{"gateway"},
+			ExpirationSeconds:       pointer.Int64(1800),
+		}
+		require.NoError(t, request(tokenRequestClusterGateway("token-request-cached", cluster.URL, "bootstrap", tokenRequest)))
+		require.NoError(t, request(tokenRequestClusterGateway("token-request-cached", cluster.URL, "bootstrap", tokenRequest)))
+		assert.Equal(t, []string{"Bearer minted-1", "Bearer minted-1"}, cluster.receivedAuth)
+		require.Len(t, cluster.requested, 1)
+		assert.Equal(t, []string{"gateway"}, cluster.requested[0].Audiences)
+		assert.Equal(t, pointer.Int64(1800), cluster.requested[0].ExpirationSeconds)
+
+		// changing the token request config drops the cached token
+		changed := tokenRequest.DeepCopy()
+		changed.Audiences = nil
+		require.NoError(t, request(tokenRequestClusterGateway("token-request-cached", cluster.URL, "bootstrap", changed)))
+		assert.Equal(t, "Bearer minted-2", cluster.receivedAuth[2])
+	})
+
+	t.Run("tokens about to expire are renewed", func(t *testing.T) {
+		cluster := newStubTokenRequestCluster(t, time.Second)
+		tokenRequest := &TokenRequestConfig{ServiceAccountNamespace: "foo", ServiceAccountName: "bar"}
+		require.NoError(t, request(tokenRequestClusterGateway("token-request-renewed", cluster.URL, "bootstrap", tokenRequest)))
+		require.NoError(t, request(tokenRequestClusterGateway("token-request-renewed", cluster.URL, "bootstrap", tokenRequest)))
+		assert.Equal(t, []string{"Bearer minted-1", "Bearer minted-2"}, cluster.receivedAuth)
+	})
+
+	t.Run("rejected bootstrap credential fails the request", func(t *testing.T) {
+		cluster := newStubTokenRequestCluster(t, time.Hour)
+		tokenRequest := &TokenRequestConfig{ServiceAccountNamespace: "foo", ServiceAccountName: "bar"}
+		assert.Error(t, request(tokenRequestClusterGateway("token-request-rejected", cluster.URL, "wrong", tokenRequest)))
+		assert.Empty(t, cluster.receivedAuth)
+	})
+}
@@ -15,12 +15,19 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"net/url"
+	"strings"
 
+	"golang.org/x/crypto/ssh"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/common"
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
 )
 
 func ValidateClusterGateway(c *ClusterGateway) field.ErrorList {
@@ -37,33 +44,147 @@ func ValidateClusterGatewaySpec(c *ClusterGatewaySpec, path *field.Path) field.E
 
 func ValidateClusterGatewaySpecAccess(c *ClusterAccess, path *field.Path) field.ErrorList {
 	var errs field.ErrorList
+	if c.Endpoint == nil {
+		errs = append(errs, field.Required(path.Child("endpoint"), "should provide cluster endpoint"))
+		return errs
+	}
 	switch c.Endpoint.Type {
 	case ClusterEndpointTypeConst:
-		if len(c.Endpoint.Const.Address) == 0 {
-			errs = append(errs, field.Required(path.Child("endpoint"), "should provide cluster endpoint"))
+		errs = append(errs, validateClusterEndpointConst(c.Endpoint, path)...)
+	case ClusterEndpointTypeClusterProxy, ClusterEndpointTypeReverseTunnel:
+	case ClusterEndpointTypeSSHBastion:
+		errs = append(errs, validateClusterEndpointConst(c.Endpoint, path)...)
+		errs = append(errs, ValidateClusterEndpointSSHBastion(c.Endpoint.SSHBastion, path.Child("endpoint").Child("sshBastion"))...)
+	case ClusterEndpointTypeClusterGateway:
+		errs = append(errs, validateClusterEndpointConst(c.Endpoint, path)...)
+		errs = append(errs, ValidateClusterEndpointClusterGateway(c.Endpoint.ClusterGateway, path.Child("endpoint").Child("clusterGateway"))...)
+	default:
+		errs = append(errs, field.NotSupported(path.Child("endpoint").Child("type"), c.Endpoint.Type,
+			[]string{
+				string(ClusterEndpointTypeConst),
+				string(ClusterEndpointTypeClusterProxy),
+				string(ClusterEndpointTypeSSHBastion),
+				string(ClusterEndpointTypeReverseTunnel),
+				string(ClusterEndpointTypeClusterGateway),
+			}))
+	}
+	errs = append(errs, validateClusterEndpointFallback(c.Endpoint, path)...)
+	if c.Credential != nil {
+		errs = append(errs, ValidateClusterGatewaySpecAccessCredential(c.Credential, path.Child("credential"))...)
+	}
+	return errs
+}
+
+// validateClusterEndpointConst validates the fixed endpoint of the
+// kube-apiserver.
+func validateClusterEndpointConst(endpoint *ClusterEndpoint, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if endpoint.Const == nil {
+		errs = append(errs, field.Required(path.Child("endpoint").Child("const"), "should provide const endpoint"))
+		return errs
+	}
+	if len(endpoint.Const.Address) == 0 {
+		errs = append(errs, field.Required(path.Child("endpoint"), "should provide cluster endpoint"))
+	}
+	u, err := url.Parse(endpoint.Const.Address)
+	if err != nil {
+		errs = append(errs, field.Invalid(path.Child("endpoint"), endpoint, fmt.Sprintf("failed parsing as URL: %v", err)))
+		return errs
+	}
+	if u.Scheme != "https" {
+		errs = append(errs, field.Invalid(path.Child("endpoint"), endpoint, "scheme must be https"))
+	}
+	insecure := endpoint.Const.Insecure != nil && *endpoint.Const.Insecure
+	// the CA of a non-insecure endpoint without CA bundle is discovered on
+	// the first contact
+	if len(endpoint.Const.CABundle) == 0 && !insecure && !isEndpointCADiscoveryEnabled() {
+		errs = append(errs, field.Required(path.Child("caBundle"), "required for non-insecure endpoint"))
+	}
+	if insecure && !config.AllowInsecureEndpoints {
+		errs = append(errs, field.Forbidden(path.Child("endpoint").Child("const").Child("insecure"), "insecure endpoints are not allowed"))
+	}
+	if endpoint.Const.EgressProxy != nil {
+		egressProxyPath := path.Child("endpoint").Child("const").Child("egressProxy")
+		if endpoint.Const.ProxyURL != nil && len(*endpoint.Const.ProxyURL) > 0 {
+			errs = append(errs, field.Forbidden(egressProxyPath, "can not be set along with proxy-url"))
+		}
+		errs = append(errs, ValidateClusterEndpointEgressProxy(endpoint.Const.EgressProxy, egressProxyPath)...)
+	}
+	addresses := sets.NewString(endpoint.Const.Address)
+	for i, alternative := range endpoint.Const.Alternatives {
+		alternativePath := path.Child("endpoint").Child("const").Child("alternatives").Index(i).Child("address")
+		if addresses.Has(alternative.Address) {
+			errs = append(errs, field.Duplicate(alternativePath, alternative.Address))
+			continue
 		}
-		u, err := url.Parse(c.Endpoint.Const.Address)
+		addresses.Insert(alternative.Address)
+		u, err := url.Parse(alternative.Address)
 		if err != nil {
-			errs = append(errs, field.Invalid(path.Child("endpoint"), c.Endpoint, fmt.Sprintf("failed parsing as URL: %v", err)))
-			return errs
+			errs = append(errs, field.Invalid(alternativePath, alternative.Address, fmt.Sprintf("failed parsing as URL: %v", err)))
+			continue
 		}
 		if u.Scheme != "https" {
-			errs = append(errs, field.Invalid(path.Child("endpoint"), c.Endpoint, "scheme must be https"))
+			errs = append(errs, field.Invalid(alternativePath, alternative.Address, "scheme must be https"))
 		}
-		if len(c.Endpoint.Const.CABundle) == 0 &&
-			(c.Endpoint.Const.Insecure == nil || *c.Endpoint.Const.Insecure == false) {
-			errs = append(errs, field.Required(path.Child("caBundle"), "required for non-insecure endpoint"))
+	}
+	return errs
+}
+
+func ValidateClusterEndpointEgressProxy(c *ClusterEndpointEgressProxy, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	u, err := url.Parse(c.URL)
+	switch {
+	case len(c.URL) == 0:
+		errs = append(errs, field.Required(path.Child("url"), "should provide egress proxy url"))
+	case err != nil:
+		errs = append(errs, field.Invalid(path.Child("url"), c.URL, fmt.Sprintf("failed parsing as URL: %v", err)))
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5":
+		errs = append(errs, field.NotSupported(path.Child("url"), u.Scheme, []string{"http", "https", "socks5"}))
+	case len(u.Hostname()) == 0:
+		errs = append(errs, field.Invalid(path.Child("url"), c.URL, "should provide egress proxy host"))
+	case u.User != nil:
+		errs = append(errs, field.Forbidden(path.Child("url"), "should provide the credential by credentialSecretRef"))
+	}
+	if len(c.CABundle) > 0 {
+		if err == nil && u.Scheme != "https" {
+			errs = append(errs, field.Forbidden(path.Child("caBundle"), "only verifies https egress proxy"))
+		} else if !x509.NewCertPool().AppendCertsFromPEM(c.CABundle) {
+			errs = append(errs, field.Invalid(path.Child("caBundle"), "", "no certificate found in the CA bundle"))
 		}
 	}
-	if c.Credential != nil {
-		errs = append(errs, ValidateClusterGatewaySpecAccessCredential(c.Credential, path.Child("credential"))...)
+	// the gateway is only allowed to read the credential secret of the fixed
+	// name
+	if ref := c.CredentialSecretRef; ref != nil && ref.Name != common.SecretNameEgressProxyCredential {
+		errs = append(errs, field.NotSupported(path.Child("credentialSecretRef").Child("name"), ref.Name, []string{common.SecretNameEgressProxyCredential}))
+	}
+	for i, entry := range c.NoProxy {
+		if len(strings.TrimSpace(entry)) == 0 {
+			errs = append(errs, field.Required(path.Child("noProxy").Index(i), "should provide the host bypassing egress proxy"))
+		}
+	}
+	return errs
+}
+
+// validateClusterEndpointFallback validates the fallback endpoint type which
+// is only supported between Const and ClusterProxy.
+func validateClusterEndpointFallback(endpoint *ClusterEndpoint, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case len(endpoint.Fallback) == 0:
+	case endpoint.Type == ClusterEndpointTypeConst && endpoint.Fallback == ClusterEndpointTypeClusterProxy:
+	case endpoint.Type == ClusterEndpointTypeClusterProxy && endpoint.Fallback == ClusterEndpointTypeConst:
+		errs = append(errs, validateClusterEndpointConst(endpoint, path)...)
+	default:
+		errs = append(errs, field.Invalid(path.Child("endpoint").Child("fallback"), endpoint.Fallback,
+			"only falling back between Const and ClusterProxy is supported"))
 	}
 	return errs
 }
 
 func ValidateClusterGatewaySpecAccessCredential(c *ClusterAccessCredential, path *field.Path) field.ErrorList {
 	var errs field.ErrorList
-	supportedCredTypes := sets.NewString(string(CredentialTypeServiceAccountToken), string(CredentialTypeX509Certificate))
+	supportedCredTypes := sets.NewString(string(CredentialTypeServiceAccountToken), string(CredentialTypeX509Certificate), string(CredentialTypeExec),
+		string(CredentialTypeOIDCClientCredentials))
 	if !supportedCredTypes.Has(string(c.Type)) {
 		errs = append(errs, field.NotSupported(path.Child("type"), c.Type, supportedCredTypes.List()))
 	}
@@ -87,6 +208,124 @@ func ValidateClusterGatewaySpecAccessCredential(c *ClusterAccessCredential, path
 			}
 			// TODO: test if certificate and private-key matches modulus
 		}
+	case CredentialTypeExec:
+		errs = append(errs, ValidateExecConfig(c.Exec, path.Child("exec"))...)
+	case CredentialTypeOIDCClientCredentials:
+		errs = append(errs, ValidateOIDCClientCredentials(c.OIDC, path.Child("oidc"))...)
+	}
+	if c.TokenRequest != nil {
+		errs = append(errs, ValidateTokenRequestConfig(c.TokenRequest, path.Child("tokenRequest"))...)
+	}
+	return errs
+}
+
+func ValidateExecConfig(c *ExecConfig, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c == nil {
+		errs = append(errs, field.Required(path, "should provide exec config"))
+		return errs
+	}
+	if len(c.Command) == 0 {
+		errs = append(errs, field.Required(path.Child("command"), "should provide exec command"))
+	} else if !config.IsExecCommandAllowed(c.Command) {
+		errs = append(errs, field.Forbidden(path.Child("command"), fmt.Sprintf("command %q is not allowed by the gateway", c.Command)))
+	}
+	if len(c.APIVersion) > 0 && !execAPIVersions.Has(c.APIVersion) {
+		errs = append(errs, field.NotSupported(path.Child("apiVersion"), c.APIVersion, execAPIVersions.List()))
+	}
+	names := sets.NewString()
+	for i, env := range c.Env {
+		if len(env.Name) == 0 {
+			errs = append(errs, field.Required(path.Child("env").Index(i).Child("name"), "should provide env name"))
+		} else if names.Has(env.Name) {
+			errs = append(errs, field.Duplicate(path.Child("env").Index(i).Child("name"), env.Name))
+		} else if msgs := validation.IsEnvVarName(env.Name); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(path.Child("env").Index(i).Child("name"), env.Name, strings.Join(msgs, ", ")))
+		} else if !config.IsExecEnvAllowed(env.Name) {
+			errs = append(errs, field.Forbidden(path.Child("env").Index(i).Child("name"), fmt.Sprintf("env %q is not allowed by the gateway", env.Name)))
+		}
+		names.Insert(env.Name)
+	}
+	return errs
+}
+
+func ValidateOIDCClientCredentials(c *OIDCClientCredentials, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c == nil {
+		errs = append(errs, field.Required(path, "should provide oidc client credentials"))
+		return errs
+	}
+	if len(c.IssuerURL) == 0 {
+		errs = append(errs, field.Required(path.Child("issuerURL"), "should provide oidc issuer url"))
+	} else if u, err := url.Parse(c.IssuerURL); err != nil {
+		errs = append(errs, field.Invalid(path.Child("issuerURL"), c.IssuerURL, fmt.Sprintf("failed parsing as URL: %v", err)))
+	} else if u.Scheme != "https" {
+		errs = append(errs, field.Invalid(path.Child("issuerURL"), c.IssuerURL, "scheme must be https"))
+	}
+	if len(c.ClientID) == 0 {
+		errs = append(errs, field.Required(path.Child("clientID"), "should provide oidc client id"))
+	}
+	if len(c.ClientSecret) == 0 {
+		errs = append(errs, field.Required(path.Child("clientSecret"), "should provide oidc client secret"))
+	}
+	return errs
+}
+
+func ValidateTokenRequestConfig(c *TokenRequestConfig, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(c.ServiceAccountNamespace) == 0 {
+		errs = append(errs, field.Required(path.Child("serviceAccountNamespace"), "should provide service-account namespace"))
+	}
+	if len(c.ServiceAccountName) == 0 {
+		errs = append(errs, field.Required(path.Child("serviceAccountName"), "should provide service-account name"))
+	}
+	if c.ExpirationSeconds != nil && *c.ExpirationSeconds < config.MinTokenRequestExpirationSeconds {
+		errs = append(errs, field.Invalid(path.Child("expirationSeconds"), *c.ExpirationSeconds,
+			fmt.Sprintf("should be at least %d", config.MinTokenRequestExpirationSeconds)))
+	}
+	return errs
+}
+
+func ValidateClusterEndpointSSHBastion(c *ClusterEndpointSSHBastion, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c == nil {
+		errs = append(errs, field.Required(path, "should provide ssh bastion"))
+		return errs
+	}
+	if len(c.Host) == 0 {
+		errs = append(errs, field.Required(path.Child("host"), "should provide ssh bastion host"))
+	} else if _, err := sshBastionAddress(c.Host); err != nil {
+		errs = append(errs, field.Invalid(path.Child("host"), c.Host, err.Error()))
+	}
+	if len(c.User) == 0 {
+		errs = append(errs, field.Required(path.Child("user"), "should provide ssh bastion user"))
+	}
+	if len(c.PrivateKey) == 0 {
+		errs = append(errs, field.Required(path.Child("privateKey"), "should provide ssh bastion private key"))
+	} else if _, err := ssh.ParsePrivateKey(c.PrivateKey); err != nil {
+		errs = append(errs, field.Invalid(path.Child("privateKey"), "<redacted>", fmt.Sprintf("failed parsing private key: %v", err)))
+	}
+	if len(c.KnownHosts) == 0 {
+		errs = append(errs, field.Required(path.Child("knownHosts"), "should provide ssh bastion known_hosts"))
+	} else if _, err := newSSHHostKeyCallback(c.KnownHosts); err != nil {
+		errs = append(errs, field.Invalid(path.Child("knownHosts"), string(c.KnownHosts), err.Error()))
+	}
+	return errs
+}
+
+func ValidateClusterEndpointClusterGateway(c *ClusterEndpointClusterGateway, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if c == nil {
+		errs = append(errs, field.Required(path, "should provide downstream cluster gateway"))
+		return errs
+	}
+	if len(c.Cluster) == 0 {
+		errs = append(errs, field.Required(path.Child("cluster"), "should provide downstream cluster name"))
+		return errs
+	}
+	// the name is joined into the path of the downstream proxy requests
+	for _, msg := range validation.IsDNS1123Subdomain(c.Cluster) {
+		errs = append(errs, field.Invalid(path.Child("cluster"), c.Cluster, msg))
 	}
 	return errs
 }
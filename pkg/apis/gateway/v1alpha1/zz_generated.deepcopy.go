@@ -19,6 +19,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -110,6 +111,21 @@ func (in *ClusterAccessCredential) DeepCopyInto(out *ClusterAccessCredential) {
 		*out = new(X509)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(OIDCClientCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TokenRequest != nil {
+		in, out := &in.TokenRequest, &out.TokenRequest
+		*out = new(TokenRequestConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -123,6 +139,42 @@ func (in *ClusterAccessCredential) DeepCopy() *ClusterAccessCredential {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAccessCredentialContents) DeepCopyInto(out *ClusterAccessCredentialContents) {
+	*out = *in
+	if in.X509 != nil {
+		in, out := &in.X509, &out.X509
+		*out = new(X509)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OIDC != nil {
+		in, out := &in.OIDC, &out.OIDC
+		*out = new(OIDCClientCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TokenRequest != nil {
+		in, out := &in.TokenRequest, &out.TokenRequest
+		*out = new(TokenRequestConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAccessCredentialContents.
+func (in *ClusterAccessCredentialContents) DeepCopy() *ClusterAccessCredentialContents {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAccessCredentialContents)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEndpoint) DeepCopyInto(out *ClusterEndpoint) {
 	*out = *in
@@ -131,6 +183,16 @@ func (in *ClusterEndpoint) DeepCopyInto(out *ClusterEndpoint) {
 		*out = new(ClusterEndpointConst)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.SSHBastion != nil {
+		in, out := &in.SSHBastion, &out.SSHBastion
+		*out = new(ClusterEndpointSSHBastion)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterGateway != nil {
+		in, out := &in.ClusterGateway, &out.ClusterGateway
+		*out = new(ClusterEndpointClusterGateway)
+		**out = **in
+	}
 	return
 }
 
@@ -144,6 +206,43 @@ func (in *ClusterEndpoint) DeepCopy() *ClusterEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEndpointAlternative) DeepCopyInto(out *ClusterEndpointAlternative) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointAlternative.
+func (in *ClusterEndpointAlternative) DeepCopy() *ClusterEndpointAlternative {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEndpointAlternative)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEndpointClusterGateway) DeepCopyInto(out *ClusterEndpointClusterGateway) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointClusterGateway.
+func (in *ClusterEndpointClusterGateway) DeepCopy() *ClusterEndpointClusterGateway {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEndpointClusterGateway)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEndpointConst) DeepCopyInto(out *ClusterEndpointConst) {
 	*out = *in
@@ -162,6 +261,18 @@ func (in *ClusterEndpointConst) DeepCopyInto(out *ClusterEndpointConst) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.EgressProxy != nil {
+		in, out := &in.EgressProxy, &out.EgressProxy
+		*out = new(ClusterEndpointEgressProxy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Alternatives != nil {
+		in, out := &in.Alternatives, &out.Alternatives
+		*out = make([]ClusterEndpointAlternative, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -175,13 +286,70 @@ func (in *ClusterEndpointConst) DeepCopy() *ClusterEndpointConst {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEndpointEgressProxy) DeepCopyInto(out *ClusterEndpointEgressProxy) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialSecretRef != nil {
+		in, out := &in.CredentialSecretRef, &out.CredentialSecretRef
+		*out = new(EgressProxyCredentialSecretReference)
+		**out = **in
+	}
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointEgressProxy.
+func (in *ClusterEndpointEgressProxy) DeepCopy() *ClusterEndpointEgressProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEndpointEgressProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterEndpointSSHBastion) DeepCopyInto(out *ClusterEndpointSSHBastion) {
+	*out = *in
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.PrivateKey != nil {
+		in, out := &in.PrivateKey, &out.PrivateKey
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterEndpointSSHBastion.
+func (in *ClusterEndpointSSHBastion) DeepCopy() *ClusterEndpointSSHBastion {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterEndpointSSHBastion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGateway) DeepCopyInto(out *ClusterGateway) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -203,13 +371,70 @@ func (in *ClusterGateway) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayCredentials) DeepCopyInto(out *ClusterGatewayCredentials) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Endpoint != nil {
+		in, out := &in.Endpoint, &out.Endpoint
+		*out = new(ClusterEndpoint)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SSHBastionPrivateKey != nil {
+		in, out := &in.SSHBastionPrivateKey, &out.SSHBastionPrivateKey
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.Credential != nil {
+		in, out := &in.Credential, &out.Credential
+		*out = new(ClusterAccessCredentialContents)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayCredentials.
+func (in *ClusterGatewayCredentials) DeepCopy() *ClusterGatewayCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGatewayCredentials) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayCredentialsReader) DeepCopyInto(out *ClusterGatewayCredentialsReader) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayCredentialsReader.
+func (in *ClusterGatewayCredentialsReader) DeepCopy() *ClusterGatewayCredentialsReader {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayCredentialsReader)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayHealth) DeepCopyInto(out *ClusterGatewayHealth) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -223,6 +448,47 @@ func (in *ClusterGatewayHealth) DeepCopy() *ClusterGatewayHealth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayKubeconfig) DeepCopyInto(out *ClusterGatewayKubeconfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayKubeconfig.
+func (in *ClusterGatewayKubeconfig) DeepCopy() *ClusterGatewayKubeconfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayKubeconfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayKubeconfigOptions) DeepCopyInto(out *ClusterGatewayKubeconfigOptions) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayKubeconfigOptions.
+func (in *ClusterGatewayKubeconfigOptions) DeepCopy() *ClusterGatewayKubeconfigOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayKubeconfigOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGatewayKubeconfigOptions) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayList) DeepCopyInto(out *ClusterGatewayList) {
 	*out = *in
@@ -357,6 +623,13 @@ func (in *ClusterGatewaySpec) DeepCopy() *ClusterGatewaySpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterGatewayStatus) DeepCopyInto(out *ClusterGatewayStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -370,6 +643,105 @@ func (in *ClusterGatewayStatus) DeepCopy() *ClusterGatewayStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayTunnel) DeepCopyInto(out *ClusterGatewayTunnel) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayTunnel.
+func (in *ClusterGatewayTunnel) DeepCopy() *ClusterGatewayTunnel {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayTunnel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterGatewayTunnelOptions) DeepCopyInto(out *ClusterGatewayTunnelOptions) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterGatewayTunnelOptions.
+func (in *ClusterGatewayTunnelOptions) DeepCopy() *ClusterGatewayTunnelOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterGatewayTunnelOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterGatewayTunnelOptions) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressProxyCredentialSecretReference) DeepCopyInto(out *EgressProxyCredentialSecretReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressProxyCredentialSecretReference.
+func (in *EgressProxyCredentialSecretReference) DeepCopy() *EgressProxyCredentialSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressProxyCredentialSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecConfig) DeepCopyInto(out *ExecConfig) {
+	*out = *in
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]ExecEnvVar, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecConfig.
+func (in *ExecConfig) DeepCopy() *ExecConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecEnvVar) DeepCopyInto(out *ExecEnvVar) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecEnvVar.
+func (in *ExecEnvVar) DeepCopy() *ExecEnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecEnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IdentityExchangerSource) DeepCopyInto(out *IdentityExchangerSource) {
 	*out = *in
@@ -442,6 +814,53 @@ func (in *IdentityExchangerTarget) DeepCopy() *IdentityExchangerTarget {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCClientCredentials) DeepCopyInto(out *OIDCClientCredentials) {
+	*out = *in
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCClientCredentials.
+func (in *OIDCClientCredentials) DeepCopy() *OIDCClientCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCClientCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenRequestConfig) DeepCopyInto(out *TokenRequestConfig) {
+	*out = *in
+	if in.Audiences != nil {
+		in, out := &in.Audiences, &out.Audiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExpirationSeconds != nil {
+		in, out := &in.ExpirationSeconds, &out.ExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenRequestConfig.
+func (in *TokenRequestConfig) DeepCopy() *TokenRequestConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenRequestConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *X509) DeepCopyInto(out *X509) {
 	*out = *in
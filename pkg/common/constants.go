@@ -3,7 +3,8 @@ package common
 import "github.com/kluster-manager/cluster-gateway/pkg/config"
 
 const (
-	AddonName = "cluster-gateway"
+	AddonName             = "cluster-gateway"
+	ClusterProxyAddonName = "cluster-proxy"
 )
 
 const (
@@ -30,4 +31,61 @@ const (
 	LabelKeyIsManagedServiceAccount                = "authentication.open-cluster-management.io/is-managed-serviceaccount"
 	AnnotationKeyClusterGatewayStatusHealthy       = "status.gateway.open-cluster-management.io/healthy"
 	AnnotationKeyClusterGatewayStatusHealthyReason = "status.gateway.open-cluster-management.io/healthy-reason"
+	AnnotationKeyClusterGatewayStatusConditions    = "status.gateway.open-cluster-management.io/conditions"
+	// AnnotationKeyClusterGatewayStatusActiveEndpointType is the endpoint type which served the last request in the addon annotation
+	AnnotationKeyClusterGatewayStatusActiveEndpointType = "status.gateway.open-cluster-management.io/active-endpoint-type"
+	// SecretKeyClusterCredentialExec is the key of the exec plugin configuration in the secret data
+	SecretKeyClusterCredentialExec = "exec"
+	// SecretKeyClusterCredentialOIDCIssuerURL is the key of the OIDC issuer url in the secret data
+	SecretKeyClusterCredentialOIDCIssuerURL = "issuer-url"
+	// SecretKeyClusterCredentialOIDCClientID is the key of the OIDC client id in the secret data
+	SecretKeyClusterCredentialOIDCClientID = "client-id"
+	// SecretKeyClusterCredentialOIDCClientSecret is the key of the OIDC client secret in the secret data
+	SecretKeyClusterCredentialOIDCClientSecret = "client-secret"
+	// SecretKeyClusterCredentialOIDCScopes is the key of the space-delimited OIDC scopes in the secret data
+	SecretKeyClusterCredentialOIDCScopes = "scopes"
+	// SecretKeySSHBastionHost is the key of the SSH bastion address in the secret data
+	SecretKeySSHBastionHost = "ssh-bastion-host"
+	// SecretKeySSHBastionUser is the key of the SSH bastion user in the secret data
+	SecretKeySSHBastionUser = "ssh-bastion-user"
+	// SecretKeySSHBastionPrivateKey is the key of the SSH bastion private key in the secret data
+	SecretKeySSHBastionPrivateKey = "ssh-bastion-private-key"
+	// SecretKeySSHBastionKnownHosts is the key of the SSH bastion known_hosts in the secret data
+	SecretKeySSHBastionKnownHosts = "ssh-bastion-known-hosts"
+	// AnnotationKeyClusterCredentialTokenRequest describes the TokenRequest config of the credential in secret annotation
+	AnnotationKeyClusterCredentialTokenRequest = config.MetaApiGroupName + "/token-request"
+	// AnnotationKeyClusterGatewayCreatedBy marks the ManagedCluster created by writing ClusterGateway
+	AnnotationKeyClusterGatewayCreatedBy = config.MetaApiGroupName + "/created-by"
+	// AnnotationKeyClusterGatewayReverseTunnel opts the cluster in the reverse tunnel in the addon annotation
+	AnnotationKeyClusterGatewayReverseTunnel = config.MetaApiGroupName + "/reverse-tunnel"
+	// AnnotationKeyClusterGatewayDownstreamCluster is the ClusterGateway on the downstream hub routing to the cluster in the addon annotation
+	AnnotationKeyClusterGatewayDownstreamCluster = config.MetaApiGroupName + "/downstream-cluster"
+	// AnnotationKeyClusterGatewayEndpointType pins the endpoint type of the cluster to either Const or ClusterProxy in the addon annotation
+	AnnotationKeyClusterGatewayEndpointType = config.MetaApiGroupName + "/endpoint-type"
+	// AnnotationKeyClusterGatewayEndpointAddress overrides the endpoint address of the ManagedCluster in the addon annotation
+	AnnotationKeyClusterGatewayEndpointAddress = config.MetaApiGroupName + "/endpoint-address"
+	// AnnotationKeyClusterGatewayEndpointCABundle overrides the PEM-encoded endpoint CA bundle of the ManagedCluster in the addon annotation
+	AnnotationKeyClusterGatewayEndpointCABundle = config.MetaApiGroupName + "/endpoint-ca-bundle"
+	// AnnotationKeyClusterGatewayEndpointFallback is the endpoint type falling back to upon dialing failures in the addon annotation
+	AnnotationKeyClusterGatewayEndpointFallback = config.MetaApiGroupName + "/endpoint-fallback"
+	// AnnotationKeyClusterGatewayEgressProxy is the JSON-encoded egress proxy of the endpoint in the addon annotation
+	AnnotationKeyClusterGatewayEgressProxy = config.MetaApiGroupName + "/egress-proxy"
+	// AnnotationKeyClusterGatewayPinnedCABundle is the PEM-encoded endpoint CA discovered on the first contact in the addon annotation
+	AnnotationKeyClusterGatewayPinnedCABundle = config.MetaApiGroupName + "/pinned-ca-bundle"
+	// AnnotationKeyClusterGatewayPinnedCAAddress is the endpoint address which the pinned CA is discovered from in the addon annotation
+	AnnotationKeyClusterGatewayPinnedCAAddress = config.MetaApiGroupName + "/pinned-ca-address"
+	// SecretNamePrefixCredentialProfile prefixes the names of the secrets of the named credential profiles in the cluster namespace
+	SecretNamePrefixCredentialProfile = AddonName + "-profile-"
+	// LabelKeyCredentialProfile labels the secrets of the named credential profiles with the profile name
+	LabelKeyCredentialProfile = config.MetaApiGroupName + "/credential-profile"
+	// SecretNameEgressProxyCredential is the name of the secret of the egress proxy credential in the cluster namespace
+	SecretNameEgressProxyCredential = AddonName + "-egress-proxy"
+	// VerbPrefixCredentialProfile prefixes the verb of the proxy subresource authorizing the use of a named credential profile
+	VerbPrefixCredentialProfile = "credential:"
+	// VerbRevealCredentials is the verb of the credentials subresource authorizing reading the credentials
+	VerbRevealCredentials = "reveal"
+	// VerbServeTunnel is the verb of the tunnel subresource authorizing serving the reverse tunnel of the cluster
+	VerbServeTunnel = "serve"
+	// AuditAnnotationKeyCredentialsRead records the credential type read by the credentials subresource in the audit events
+	AuditAnnotationKeyCredentialsRead = config.MetaApiGroupName + "/credentials-read"
 )
@@ -0,0 +1,12 @@
+package config
+
+import (
+	"github.com/spf13/pflag"
+)
+
+var PropagatedClusterAnnotations []string
+
+func AddClusterMetadataFlags(set *pflag.FlagSet) {
+	set.StringSliceVarP(&PropagatedClusterAnnotations, "propagated-cluster-annotations", "", nil,
+		"the annotation keys copied from ManagedCluster to ClusterGateway, a key ending with \"/\" matches all the annotations under the prefix")
+}
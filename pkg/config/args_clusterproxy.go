@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
 )
@@ -10,6 +12,15 @@ var ClusterProxyPort int
 var ClusterProxyCAFile string
 var ClusterProxyCertFile string
 var ClusterProxyKeyFile string
+var ClusterProxyTunnelPoolSize int
+var ClusterProxyMode string
+
+// modes of the cluster-proxy egress, named after the modes of the
+// konnectivity proxy server
+const (
+	ClusterProxyModeGRPC        = "grpc"
+	ClusterProxyModeHTTPConnect = "http-connect"
+)
 
 func ValidateClusterProxy() error {
 	if len(ClusterProxyHost) == 0 {
@@ -27,6 +38,12 @@ func ValidateClusterProxy() error {
 	if len(ClusterProxyKeyFile) == 0 {
 		return errors.New("--proxy-key must be specified")
 	}
+	if ClusterProxyMode != ClusterProxyModeGRPC && ClusterProxyMode != ClusterProxyModeHTTPConnect {
+		return fmt.Errorf("--proxy-mode must be either %q or %q", ClusterProxyModeGRPC, ClusterProxyModeHTTPConnect)
+	}
+	if ClusterProxyTunnelPoolSize < 1 {
+		return errors.New("--proxy-tunnel-pool-size must be greater than 0")
+	}
 	return nil
 }
 
@@ -41,4 +58,8 @@ func AddClusterProxyFlags(set *pflag.FlagSet) {
 		"the path to tls cert for connecting cluster proxy")
 	set.StringVarP(&ClusterProxyKeyFile, "proxy-key", "", "",
 		"the path to tls key for connecting cluster proxy")
+	set.IntVarP(&ClusterProxyTunnelPoolSize, "proxy-tunnel-pool-size", "", 2,
+		"the number of long-lived grpc connections to the cluster proxy multiplexing the tunnels")
+	set.StringVarP(&ClusterProxyMode, "proxy-mode", "", ClusterProxyModeGRPC,
+		"the mode of the cluster proxy endpoint, either grpc or http-connect")
 }
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// EnableCredentialsSubresource opts in the credentials subresource serving
+// the credentials of the clusters.
+var EnableCredentialsSubresource bool
+
+// CredentialsSubresourceQPS and CredentialsSubresourceBurst rate limit the
+// reads of the credentials subresource by each user, unlimited if the QPS
+// is zero.
+var CredentialsSubresourceQPS float32
+var CredentialsSubresourceBurst int
+
+func ValidateCredentialsSubresource() error {
+	if CredentialsSubresourceQPS < 0 {
+		return fmt.Errorf("--credentials-subresource-qps must not be negative")
+	}
+	if CredentialsSubresourceQPS > 0 && CredentialsSubresourceBurst < 1 {
+		return fmt.Errorf("--credentials-subresource-burst must be positive")
+	}
+	return nil
+}
+
+func AddCredentialsSubresourceFlags(set *pflag.FlagSet) {
+	set.BoolVarP(&EnableCredentialsSubresource, "enable-credentials-subresource", "", false,
+		"serving the credentials of the clusters by the credentials subresource, which is authorized "+
+			"by the \"reveal\" verb upon the subresource in addition to \"get\"")
+	set.Float32VarP(&CredentialsSubresourceQPS, "credentials-subresource-qps", "", 0,
+		"the QPS of reading the credentials subresource by each user, unlimited if zero")
+	set.IntVarP(&CredentialsSubresourceBurst, "credentials-subresource-burst", "", 1,
+		"the burst of reading the credentials subresource by each user")
+}
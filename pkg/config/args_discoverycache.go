@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DiscoveryCacheRefreshInterval is the age of the cached discovery and OpenAPI
+// documents of the clusters after which they are refreshed in the background.
+var DiscoveryCacheRefreshInterval time.Duration
+
+// DiscoveryCacheMaxSize is the total size in bytes of the cached documents of
+// all the clusters.
+var DiscoveryCacheMaxSize int64 = 256 << 20
+
+func ValidateDiscoveryCache() error {
+	if DiscoveryCacheRefreshInterval < 0 {
+		return fmt.Errorf("--discovery-cache-refresh-interval must not be negative")
+	}
+	if DiscoveryCacheMaxSize <= 0 {
+		return fmt.Errorf("--discovery-cache-max-size must be positive")
+	}
+	return nil
+}
+
+func AddDiscoveryCacheFlags(set *pflag.FlagSet) {
+	set.DurationVarP(&DiscoveryCacheRefreshInterval, "discovery-cache-refresh-interval", "", 0,
+		"caching the discovery and the OpenAPI documents of the clusters proxied by the gateway, which are "+
+			"refreshed in the background once older than the interval (at most 30s for \"/api\" and \"/apis\"), "+
+			"disabled if zero. Only writing the CRDs or the APIServices through the gateway drops the documents "+
+			"of the cluster immediately")
+	set.Int64VarP(&DiscoveryCacheMaxSize, "discovery-cache-max-size", "", DiscoveryCacheMaxSize,
+		"the total size in bytes of the cached discovery and OpenAPI documents of all the clusters, beyond which "+
+			"the least recently used documents are evicted")
+}
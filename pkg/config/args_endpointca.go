@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// EndpointCADiscoveryAuto discovers the CA from the cluster-info
+	// ConfigMap, falling back to pinning the serving chain when the
+	// ConfigMap is not served.
+	EndpointCADiscoveryAuto = "Auto"
+	// EndpointCADiscoveryClusterInfo discovers the CA from the cluster-info
+	// ConfigMap in the kube-public namespace, which must have signed the
+	// serving certificate.
+	EndpointCADiscoveryClusterInfo = "ClusterInfo"
+	// EndpointCADiscoveryServingChain pins the topmost certificate of the
+	// chain presented by the kube-apiserver.
+	EndpointCADiscoveryServingChain = "ServingChain"
+	// EndpointCADiscoveryDisabled verifies the endpoints without CA bundle by
+	// the system trust roots.
+	EndpointCADiscoveryDisabled = "Disabled"
+)
+
+var EndpointCADiscovery string
+var AllowInsecureEndpoints bool
+
+func ValidateEndpointCA() error {
+	switch EndpointCADiscovery {
+	case EndpointCADiscoveryAuto, EndpointCADiscoveryClusterInfo, EndpointCADiscoveryServingChain, EndpointCADiscoveryDisabled:
+		return nil
+	default:
+		return fmt.Errorf("--endpoint-ca-discovery must be one of %q, %q, %q or %q",
+			EndpointCADiscoveryAuto, EndpointCADiscoveryClusterInfo, EndpointCADiscoveryServingChain, EndpointCADiscoveryDisabled)
+	}
+}
+
+func AddEndpointCAFlags(set *pflag.FlagSet) {
+	set.StringVarP(&EndpointCADiscovery, "endpoint-ca-discovery", "", EndpointCADiscoveryAuto,
+		"the way of discovering the CA of the cluster endpoints without CA bundle on the first contact, "+
+			"one of \"Auto\", \"ClusterInfo\", \"ServingChain\" or \"Disabled\". The discovered CA is pinned "+
+			"in the cluster-gateway addon and verifies the endpoints afterwards, while the endpoints are verified "+
+			"by the system trust roots if disabled")
+	set.BoolVarP(&AllowInsecureEndpoints, "allow-insecure-endpoints", "", false,
+		"request the cluster endpoints without CA bundle insecurely instead of discovering their CA")
+}
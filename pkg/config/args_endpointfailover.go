@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// EndpointFailoverOrderDeclared tries the cluster endpoints following
+	// the order of the ManagedClusterClientConfigs.
+	EndpointFailoverOrderDeclared = "Declared"
+	// EndpointFailoverOrderRandom tries the cluster endpoints in a random
+	// order for spreading the load across them.
+	EndpointFailoverOrderRandom = "Random"
+)
+
+var EndpointFailoverOrder string
+var EndpointFailoverSticky bool
+
+func ValidateEndpointFailover() error {
+	switch EndpointFailoverOrder {
+	case EndpointFailoverOrderDeclared, EndpointFailoverOrderRandom:
+		return nil
+	default:
+		return fmt.Errorf("--endpoint-failover-order must be one of %q or %q",
+			EndpointFailoverOrderDeclared, EndpointFailoverOrderRandom)
+	}
+}
+
+func AddEndpointFailoverFlags(set *pflag.FlagSet) {
+	set.StringVarP(&EndpointFailoverOrder, "endpoint-failover-order", "", EndpointFailoverOrderDeclared,
+		"the order of trying the endpoints of a cluster, either \"Declared\" or \"Random\"")
+	set.BoolVarP(&EndpointFailoverSticky, "endpoint-failover-sticky", "", true,
+		"prefer the endpoint of a cluster which served the last request successfully")
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+var ExecCredentialAllowedCommands []string
+
+// execCredentialDeniedEnvs are the envs altering how the allowed command is
+// resolved, loaded or interpreted, which are never set by the exec
+// credentials.
+var execCredentialDeniedEnvs = map[string]bool{
+	"PATH":          true,
+	"HOME":          true,
+	"SHELL":         true,
+	"IFS":           true,
+	"ENV":           true,
+	"BASH_ENV":      true,
+	"TMPDIR":        true,
+	"GCONV_PATH":    true,
+	"LOCPATH":       true,
+	"NLSPATH":       true,
+	"HOSTALIASES":   true,
+	"RES_OPTIONS":   true,
+	"PYTHONPATH":    true,
+	"PYTHONHOME":    true,
+	"PYTHONSTARTUP": true,
+	"NODE_OPTIONS":  true,
+	"NODE_PATH":     true,
+	"PERL5LIB":      true,
+	"PERL5OPT":      true,
+	"RUBYLIB":       true,
+	"RUBYOPT":       true,
+}
+
+// execCredentialDeniedEnvPrefixes are the prefixes of the envs read by the
+// dynamic loaders.
+var execCredentialDeniedEnvPrefixes = []string{"LD_", "DYLD_", "MALLOC_"}
+
+func ValidateExecCredential() error {
+	for _, command := range ExecCredentialAllowedCommands {
+		if !filepath.IsAbs(command) {
+			return errors.Errorf("--exec-credential-allowed-commands must be absolute paths, got %q", command)
+		}
+	}
+	return nil
+}
+
+// IsExecCommandAllowed tells if the command of an exec credential is in the
+// allow-list. No command is allowed by default.
+func IsExecCommandAllowed(command string) bool {
+	for _, allowed := range ExecCredentialAllowedCommands {
+		if filepath.Clean(command) == filepath.Clean(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExecEnvAllowed tells if the env can be set for the command of an exec
+// credential, which rejects the envs of the loaders and the interpreters.
+func IsExecEnvAllowed(name string) bool {
+	name = strings.ToUpper(name)
+	if execCredentialDeniedEnvs[name] {
+		return false
+	}
+	for _, prefix := range execCredentialDeniedEnvPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func AddExecCredentialFlags(set *pflag.FlagSet) {
+	set.StringSliceVarP(&ExecCredentialAllowedCommands, "exec-credential-allowed-commands", "", nil,
+		"the absolute paths of the binaries permitted as the command of the exec credentials, e.g. /usr/local/bin/aws")
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/pflag"
+)
+
+// KubeconfigServer is the address of the hub kube-apiserver written to the
+// kubeconfigs generated by the kubeconfig subresource.
+var KubeconfigServer string
+
+// KubeconfigCertificateAuthority is the CA file of the hub kube-apiserver
+// written to the kubeconfigs generated by the kubeconfig subresource.
+var KubeconfigCertificateAuthority string
+
+func ValidateKubeconfig() error {
+	if len(KubeconfigServer) == 0 {
+		return nil
+	}
+	u, err := url.Parse(KubeconfigServer)
+	if err != nil {
+		return fmt.Errorf("--kubeconfig-server is invalid: %v", err)
+	}
+	if u.Scheme != "https" || len(u.Host) == 0 {
+		return fmt.Errorf("--kubeconfig-server must be an https url, got %q", KubeconfigServer)
+	}
+	return nil
+}
+
+func AddKubeconfigFlags(set *pflag.FlagSet) {
+	set.StringVarP(&KubeconfigServer, "kubeconfig-server", "", "",
+		"the address of the hub kube-apiserver reachable by the users of the generated kubeconfigs, "+
+			"defaulting to the address the gateway requests the hub by")
+	set.StringVarP(&KubeconfigCertificateAuthority, "kubeconfig-certificate-authority", "", "",
+		"the path to the CA file of the hub kube-apiserver written to the generated kubeconfigs, "+
+			"defaulting to the CA the gateway verifies the hub by")
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var LocalClusterName string
+
+func ValidateLocalCluster() error {
+	if len(LocalClusterName) == 0 {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(LocalClusterName); len(errs) > 0 {
+		return fmt.Errorf("--local-cluster-name is invalid: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func AddLocalClusterFlags(set *pflag.FlagSet) {
+	set.StringVarP(&LocalClusterName, "local-cluster-name", "", "",
+		"the name of the built-in ClusterGateway proxying to the hub cluster via the client config of the gateway, "+
+			"which shadows the ManagedCluster of the same name, disabled if empty")
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// MinTokenRequestExpirationSeconds is the minimum lifetime of the tokens
+// accepted by the TokenRequest API.
+const MinTokenRequestExpirationSeconds = 600
+
+var TokenRequestExpirationSeconds int64
+
+func ValidateTokenRequest() error {
+	if TokenRequestExpirationSeconds < MinTokenRequestExpirationSeconds {
+		return fmt.Errorf("--token-request-expiration-seconds must be at least %d", MinTokenRequestExpirationSeconds)
+	}
+	return nil
+}
+
+func AddTokenRequestFlags(set *pflag.FlagSet) {
+	set.Int64VarP(&TokenRequestExpirationSeconds, "token-request-expiration-seconds", "", 3600,
+		"the default lifetime of the tokens minted via TokenRequest for the clusters opting in, the tokens are renewed after 80% of the lifetime")
+}
@@ -33,10 +33,19 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClientIdentityExchanger":              schema_pkg_apis_gateway_v1alpha1_ClientIdentityExchanger(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterAccess":                        schema_pkg_apis_gateway_v1alpha1_ClusterAccess(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterAccessCredential":              schema_pkg_apis_gateway_v1alpha1_ClusterAccessCredential(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterAccessCredentialContents":      schema_pkg_apis_gateway_v1alpha1_ClusterAccessCredentialContents(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpoint":                      schema_pkg_apis_gateway_v1alpha1_ClusterEndpoint(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointAlternative":           schema_pkg_apis_gateway_v1alpha1_ClusterEndpointAlternative(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointClusterGateway":        schema_pkg_apis_gateway_v1alpha1_ClusterEndpointClusterGateway(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointConst":                 schema_pkg_apis_gateway_v1alpha1_ClusterEndpointConst(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointEgressProxy":           schema_pkg_apis_gateway_v1alpha1_ClusterEndpointEgressProxy(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointSSHBastion":            schema_pkg_apis_gateway_v1alpha1_ClusterEndpointSSHBastion(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGateway":                       schema_pkg_apis_gateway_v1alpha1_ClusterGateway(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayCredentials":            schema_pkg_apis_gateway_v1alpha1_ClusterGatewayCredentials(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayCredentialsReader":      schema_pkg_apis_gateway_v1alpha1_ClusterGatewayCredentialsReader(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayHealth":                 schema_pkg_apis_gateway_v1alpha1_ClusterGatewayHealth(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayKubeconfig":             schema_pkg_apis_gateway_v1alpha1_ClusterGatewayKubeconfig(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayKubeconfigOptions":      schema_pkg_apis_gateway_v1alpha1_ClusterGatewayKubeconfigOptions(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayList":                   schema_pkg_apis_gateway_v1alpha1_ClusterGatewayList(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayProxy":                  schema_pkg_apis_gateway_v1alpha1_ClusterGatewayProxy(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayProxyConfiguration":     schema_pkg_apis_gateway_v1alpha1_ClusterGatewayProxyConfiguration(ref),
@@ -44,8 +53,15 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayProxyOptions":           schema_pkg_apis_gateway_v1alpha1_ClusterGatewayProxyOptions(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewaySpec":                   schema_pkg_apis_gateway_v1alpha1_ClusterGatewaySpec(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayStatus":                 schema_pkg_apis_gateway_v1alpha1_ClusterGatewayStatus(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayTunnel":                 schema_pkg_apis_gateway_v1alpha1_ClusterGatewayTunnel(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterGatewayTunnelOptions":          schema_pkg_apis_gateway_v1alpha1_ClusterGatewayTunnelOptions(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.EgressProxyCredentialSecretReference": schema_pkg_apis_gateway_v1alpha1_EgressProxyCredentialSecretReference(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecConfig":                           schema_pkg_apis_gateway_v1alpha1_ExecConfig(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecEnvVar":                           schema_pkg_apis_gateway_v1alpha1_ExecEnvVar(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.IdentityExchangerSource":              schema_pkg_apis_gateway_v1alpha1_IdentityExchangerSource(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.IdentityExchangerTarget":              schema_pkg_apis_gateway_v1alpha1_IdentityExchangerTarget(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.OIDCClientCredentials":                schema_pkg_apis_gateway_v1alpha1_OIDCClientCredentials(ref),
+		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.TokenRequestConfig":                   schema_pkg_apis_gateway_v1alpha1_TokenRequestConfig(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.X509":                                 schema_pkg_apis_gateway_v1alpha1_X509(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.clusterGatewayProxyRequestEscaper":    schema_pkg_apis_gateway_v1alpha1_clusterGatewayProxyRequestEscaper(ref),
 		"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.noSuppressPanicError":                 schema_pkg_apis_gateway_v1alpha1_noSuppressPanicError(ref),
@@ -220,10 +236,67 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterAccessCredential(ref common.Referen
 							Format:      "",
 						},
 					},
+					"tokenRequest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TokenRequest opts in minting short-lived tokens of a ServiceAccount in the cluster, in which case the credential above is only used for the TokenRequest calls and the proxied requests carry the minted tokens.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.TokenRequestConfig"),
+						},
+					},
 				},
 				Required: []string{"type"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.TokenRequestConfig"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterAccessCredentialContents(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterAccessCredentialContents is the serialized ClusterAccessCredential including the credential contents.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"serviceAccountToken": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"x509": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.X509"),
+						},
+					},
+					"exec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecConfig"),
+						},
+					},
+					"oidc": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.OIDCClientCredentials"),
+						},
+					},
+					"tokenRequest": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.TokenRequestConfig"),
+						},
+					},
+				},
+				Required: []string{"type"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecConfig", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.OIDCClientCredentials", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.TokenRequestConfig", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.X509"},
 	}
 }
 
@@ -247,12 +320,80 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterEndpoint(ref common.ReferenceCallba
 							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointConst"),
 						},
 					},
+					"sshBastion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSHBastion prescribes the SSH jump host tunneling the requests to the Const endpoint under SSHBastion mode.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointSSHBastion"),
+						},
+					},
+					"clusterGateway": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClusterGateway prescribes the ClusterGateway on the downstream hub routing the requests to the cluster under ClusterGateway mode, where the Const endpoint is the kube-apiserver of the downstream hub.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointClusterGateway"),
+						},
+					},
+					"fallback": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Fallback is the endpoint type which the requests fall back to when the endpoint of Type is not reachable. It's only supported between Const and ClusterProxy, where the Const endpoint is also required under ClusterProxy mode falling back to Const.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"type"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointConst"},
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointClusterGateway", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointConst", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointSSHBastion"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterEndpointAlternative(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Address is a qualified hostname for accessing the local kube-apiserver.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"caBundle": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CABundle is used for verifying the serving CA certificate of the endpoint. The CABundle of the primary endpoint is used if absent.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+				},
+				Required: []string{"address"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterEndpointClusterGateway(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"cluster": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Cluster is the name of the ClusterGateway on the downstream hub.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"cluster"},
+			},
+		},
 	}
 }
 
@@ -291,10 +432,119 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterEndpointConst(ref common.ReferenceC
 							Format:      "",
 						},
 					},
+					"egressProxy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EgressProxy prescribes the proxy which the connections to the server egress through, including the upgraded ones of exec and port-forward. It can not be set along with ProxyURL.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointEgressProxy"),
+						},
+					},
+					"alternatives": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Alternatives are the endpoints of the same kube-apiserver to fail over to when the Address is not reachable, following the order of the ManagedClusterClientConfigs.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointAlternative"),
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"address"},
 			},
 		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointAlternative", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpointEgressProxy"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterEndpointEgressProxy(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"url": {
+						SchemaProps: spec.SchemaProps{
+							Description: "URL is the address of the proxy whose scheme is one of \"http\", \"https\" and \"socks5\". The connections are tunneled by CONNECT requests to the http(s) proxies.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"caBundle": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CABundle is used for verifying the serving certificate of the https proxy, defaulting to the system trust roots.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+					"credentialSecretRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CredentialSecretRef refers to the Secret \"cluster-gateway-egress-proxy\" in the namespace of the cluster holding the \"username\" and the \"password\" authenticating to the proxy.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.EgressProxyCredentialSecretReference"),
+						},
+					},
+					"noProxy": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NoProxy lists the hosts connected directly in the format of the NO_PROXY environment variable, each of which is either \"*\", an IP address, a CIDR or a domain name matching its subdomains as well, optionally followed by a port.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"url"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.EgressProxyCredentialSecretReference"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterEndpointSSHBastion(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"host": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Host is the address of the SSH server in the form of \"host[:port]\", the port defaults to 22.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"user": {
+						SchemaProps: spec.SchemaProps{
+							Description: "User is the user logging in the SSH server.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"knownHosts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "KnownHosts are the known_hosts lines verifying the host keys of the SSH server, which is mandatory.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+				},
+				Required: []string{"host", "user", "knownHosts"},
+			},
+		},
 	}
 }
 
@@ -345,6 +595,71 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGateway(ref common.ReferenceCallbac
 	}
 }
 
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayCredentials(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayCredentials is the privileged view of a ClusterGateway served by the credentials subresource, carrying the credential contents which are never served by the ClusterGateway itself.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint is the endpoint of the cluster.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpoint"),
+						},
+					},
+					"sshBastionPrivateKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SSHBastionPrivateKey is the private key authenticating to the SSH bastion of the endpoint.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+					"credential": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Credential is the credential of the cluster.",
+							Ref:         ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterAccessCredentialContents"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterAccessCredentialContents", "github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ClusterEndpoint", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayCredentialsReader(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayCredentialsReader is an opt-in subresource for ClusterGateway which serves the credentials of the cluster to the break-glass tooling. The reads are authorized by the \"reveal\" verb upon the subresource in addition to \"get\", audited, and optionally rate limited for each user.",
+				Type:        []string{"object"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayHealth(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -391,6 +706,45 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayHealth(ref common.ReferenceC
 	}
 }
 
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayKubeconfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayKubeconfig is a subresource for ClusterGateway which generates the kubeconfig requesting the managed cluster through the proxy subresource, so that the plain clients e.g. kubectl and helm reach the managed cluster without wiring the gateway round-tripper. The kubeconfig carries no credential: the requests are authenticated by the hub credential of the user, which is referred to by the \"authInfo\" option and merged from the kubeconfig of the user e.g. KUBECONFIG=<hub kubeconfig>:<generated kubeconfig>.",
+				Type:        []string{"object"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayKubeconfigOptions(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"TypeMeta": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"),
+						},
+					},
+					"authInfo": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AuthInfo is the name of the user in the kubeconfig of the caller authenticating to the hub cluster, which the context of the generated kubeconfig refers to.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"TypeMeta"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"},
+	}
+}
+
 func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -535,6 +889,13 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayProxyOptions(ref common.Refe
 							Format:      "",
 						},
 					},
+					"credential": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Credential is the name of the credential profile of the cluster proxying the request instead of the default credential. Using a profile requires the verb \"credential:<profile>\" upon the proxy subresource of the cluster on the hub.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"TypeMeta", "path", "impersonate"},
 			},
@@ -580,7 +941,7 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayStatus(ref common.ReferenceC
 				Properties: map[string]spec.Schema{
 					"healthy": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Healthy indicates whether the cluster is healthy. If the `HealthinessCheck` feature gate is enabled, calling proxy subresource upon unhealthy clusters will be rejected.",
+							Description: "Healthy indicates whether the cluster is healthy. If the `HealthinessCheck` feature gate is enabled, calling proxy subresource upon unhealthy clusters will be rejected. When the conditions are reported, it is derived from them and is true only if all the conditions are true.",
 							Default:     false,
 							Type:        []string{"boolean"},
 							Format:      "",
@@ -588,7 +949,36 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayStatus(ref common.ReferenceC
 					},
 					"healthyReason": {
 						SchemaProps: spec.SchemaProps{
-							Description: "HealthyReason is the reason explaining the cluster's healthiness.",
+							Description: "HealthyReason is the reason explaining the cluster's healthiness. When the conditions are reported, it is the reason of the first condition which is not true.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"conditions": {
+						VendorExtensible: spec.VendorExtensible{
+							Extensions: spec.Extensions{
+								"x-kubernetes-list-map-keys": []interface{}{
+									"type",
+								},
+								"x-kubernetes-list-type": "map",
+							},
+						},
+						SchemaProps: spec.SchemaProps{
+							Description: "Conditions are the observations of the cluster's healthiness.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.Condition"),
+									},
+								},
+							},
+						},
+					},
+					"activeEndpointType": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ActiveEndpointType is the endpoint type which served the last request proxied to the cluster by the gateway, reported when the endpoint prescribes a fallback.",
 							Type:        []string{"string"},
 							Format:      "",
 						},
@@ -597,6 +987,149 @@ func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayStatus(ref common.ReferenceC
 				Required: []string{"healthy"},
 			},
 		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Condition"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayTunnel(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterGatewayTunnel is a subresource for ClusterGateway which accepts the reverse tunnels dialed out by the agents in the managed clusters. The tunnels are authorized by the \"serve\" verb upon the subresource in addition to \"get\", which are granted to the agent of each cluster upon the registration. A live session of the cluster is never replaced by a new one.",
+				Type:        []string{"object"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ClusterGatewayTunnelOptions(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"TypeMeta": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"),
+						},
+					},
+				},
+				Required: []string{"TypeMeta"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.TypeMeta"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_EgressProxyCredentialSecretReference(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name is the name of the Secret.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"name"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ExecConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ExecConfig prescribes the exec plugin issuing the credential, following the ExecConfig of the kubeconfig.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"command": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Command to execute, which must be allowed by the gateway.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"args": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Args are the arguments to pass to the command.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"env": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Env defines additional environment variables to expose to the process, except the ones of the loaders and the interpreters, e.g. PATH and LD_PRELOAD.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecEnvVar"),
+									},
+								},
+							},
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion is the preferred input version of the ExecInfo, defaults to \"client.authentication.k8s.io/v1\".",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"command"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/kluster-manager/cluster-gateway/pkg/apis/gateway/v1alpha1.ExecEnvVar"},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_ExecEnvVar(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ExecEnvVar is used for setting environment variables when executing an exec-based credential plugin.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+					"value": {
+						SchemaProps: spec.SchemaProps{
+							Default: "",
+							Type:    []string{"string"},
+							Format:  "",
+						},
+					},
+				},
+				Required: []string{"name", "value"},
+			},
+		},
 	}
 }
 
@@ -692,6 +1225,111 @@ func schema_pkg_apis_gateway_v1alpha1_IdentityExchangerTarget(ref common.Referen
 	}
 }
 
+func schema_pkg_apis_gateway_v1alpha1_OIDCClientCredentials(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "OIDCClientCredentials prescribes the OIDC client requesting access tokens through the client-credentials grant.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"issuerURL": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IssuerURL is the URL of the OIDC issuer serving the discovery document under \"/.well-known/openid-configuration\".",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientID": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientID is the id of the OIDC client.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"clientSecret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientSecret is the secret of the OIDC client.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"scopes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Scopes are the scopes requested along with the access token.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"issuerURL", "clientID", "clientSecret"},
+			},
+		},
+	}
+}
+
+func schema_pkg_apis_gateway_v1alpha1_TokenRequestConfig(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "TokenRequestConfig prescribes the ServiceAccount to mint tokens for and the properties of the minted tokens.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"serviceAccountNamespace": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServiceAccountNamespace is the namespace of the ServiceAccount in the cluster.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"serviceAccountName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServiceAccountName is the name of the ServiceAccount in the cluster.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"audiences": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Audiences are the intended audiences of the minted tokens, defaults to the audiences of the cluster's kube-apiserver.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"expirationSeconds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ExpirationSeconds is the requested lifetime of the minted tokens, defaults to the \"--token-request-expiration-seconds\" of the gateway.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+				},
+				Required: []string{"serviceAccountNamespace", "serviceAccountName"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_gateway_v1alpha1_X509(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
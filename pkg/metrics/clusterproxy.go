@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	compbasemetrics "k8s.io/component-base/metrics"
+)
+
+// labels
+const (
+	dialFailureReason = "reason"
+)
+
+var (
+	ocmClusterProxyDialDurationHistogram = compbasemetrics.NewHistogramVec(
+		&compbasemetrics.HistogramOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_dial_duration_seconds",
+			Help:           "Time cost of dialing through the cluster-proxy tunnels",
+			Buckets:        requestDurationSecondsBuckets,
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{success},
+	)
+	ocmClusterProxyDialFailuresTotal = compbasemetrics.NewCounterVec(
+		&compbasemetrics.CounterOpts{
+			Namespace:      namespace,
+			Subsystem:      subsystem,
+			Name:           "cluster_proxy_dial_failures_total",
+			Help:           "Number of failed dials through the cluster-proxy tunnels",
+			StabilityLevel: compbasemetrics.ALPHA,
+		},
+		[]string{dialFailureReason},
+	)
+)
+
+func RecordClusterProxyDial(ts time.Duration, succeeded bool) {
+	ocmClusterProxyDialDurationHistogram.
+		WithLabelValues(strconv.FormatBool(succeeded)).
+		Observe(ts.Seconds())
+}
+
+func RecordClusterProxyDialFailure(reason string) {
+	ocmClusterProxyDialFailuresTotal.
+		WithLabelValues(reason).
+		Inc()
+}
@@ -15,6 +15,8 @@ var metrics = []compbasemetrics.Registerable{
 	ocmProxiedRequestsByClusterTotal,
 	ocmProxiedRequestsDurationHistogram,
 	ocmProxiedClusterEscalationRequestDurationHistogram,
+	ocmClusterProxyDialDurationHistogram,
+	ocmClusterProxyDialFailuresTotal,
 }
 
 func Register() {
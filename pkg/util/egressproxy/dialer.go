@@ -0,0 +1,264 @@
+package egressproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// dialTimeout bounds the dials without any deadline.
+	dialTimeout = 30 * time.Second
+	// maxConnectResponseBody bounds reading the error message from the
+	// rejected CONNECT requests.
+	maxConnectResponseBody = 4096
+)
+
+var defaultPorts = map[string]string{
+	"http":   "80",
+	"https":  "443",
+	"socks5": "1080",
+}
+
+// Credential returns the username and the password authenticating to the
+// proxy. It's called upon every dial so that the rotated credentials take
+// effect without rebuilding the dialer.
+type Credential func(ctx context.Context) (username, password string, err error)
+
+// Dialer dials through the egress proxy unless the address is excluded by the
+// NO_PROXY rules. The http(s) proxies are tunneled through by CONNECT
+// requests, while the socks5 proxies are dialed by the SOCKS5 protocol.
+type Dialer struct {
+	proxy      *url.URL
+	tlsConfig  *tls.Config
+	credential Credential
+	noProxy    []noProxyRule
+	direct     *net.Dialer
+}
+
+// NewDialer returns the dialer through the proxy at the URL. The CA bundle
+// verifies the https proxy in place of the system trust roots, and a nil
+// credential dials the proxy anonymously.
+func NewDialer(proxyURL string, caBundle []byte, credential Credential, noProxy []string) (*Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing egress proxy url")
+	}
+	defaultPort, ok := defaultPorts[u.Scheme]
+	if !ok {
+		return nil, errors.Errorf("unsupported egress proxy scheme %q", u.Scheme)
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, errors.New("missing egress proxy host")
+	}
+	if len(u.Port()) == 0 {
+		u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	d := &Dialer{
+		proxy:      u,
+		credential: credential,
+		noProxy:    parseNoProxy(noProxy),
+		direct:     &net.Dialer{Timeout: dialTimeout},
+	}
+	if u.Scheme == "https" {
+		d.tlsConfig = &tls.Config{
+			ServerName: u.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		}
+		if len(caBundle) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caBundle) {
+				return nil, errors.New("no certificate found in the egress proxy CA bundle")
+			}
+			d.tlsConfig.RootCAs = pool
+		}
+	}
+	return d, nil
+}
+
+// DialContext dials the address through the proxy, or directly if the address
+// is excluded from the proxy.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.bypass(address) {
+		return d.direct.DialContext(ctx, network, address)
+	}
+	var username, password string
+	if d.credential != nil {
+		var err error
+		if username, password, err = d.credential(ctx); err != nil {
+			return nil, errors.Wrapf(err, "failed getting egress proxy credential")
+		}
+	}
+	if d.proxy.Scheme == "socks5" {
+		var auth *proxy.Auth
+		if len(username) > 0 {
+			auth = &proxy.Auth{User: username, Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", d.proxy.Host, auth, d.direct)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, network, address)
+	}
+	return d.dialConnect(ctx, address, username, password)
+}
+
+func (d *Dialer) dialConnect(ctx context.Context, address, username, password string) (net.Conn, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+	conn, err := d.direct.DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if d.tlsConfig != nil {
+		tlsConn := tls.Client(conn, d.tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// the CONNECT request is bounded by the dialing context
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if len(username) > 0 {
+		connect.Header.Set("Proxy-Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := func() (*http.Response, error) {
+		if err := connect.Write(conn); err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(reader, connect)
+	}()
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxConnectResponseBody))
+		conn.Close()
+		msg := "egress proxy rejected connecting " + address + ": " + resp.Status
+		if detail := strings.TrimSpace(string(body)); len(detail) > 0 {
+			msg += ": " + detail
+		}
+		return nil, errors.New(msg)
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered along with the CONNECT response
+// ahead of the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (d *Dialer) bypass(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, rule := range d.noProxy {
+		if rule.matches(host, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// noProxyRule is an entry of the NO_PROXY rules.
+type noProxyRule struct {
+	all    bool
+	cidr   *net.IPNet
+	ip     net.IP
+	domain string
+	port   string
+}
+
+func parseNoProxy(entries []string) []noProxyRule {
+	var rules []noProxyRule
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 0 {
+			continue
+		}
+		if entry == "*" {
+			rules = append(rules, noProxyRule{all: true})
+			continue
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			rules = append(rules, noProxyRule{cidr: cidr})
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			rules = append(rules, noProxyRule{ip: ip})
+			continue
+		}
+		rule := noProxyRule{}
+		host := entry
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			host, rule.port = h, p
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			rule.ip = ip
+		} else {
+			rule.domain = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(host, "*"), "."), ".")
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (r noProxyRule) matches(host, port string) bool {
+	if r.all {
+		return true
+	}
+	if len(r.port) > 0 && r.port != port {
+		return false
+	}
+	switch {
+	case r.cidr != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.cidr.Contains(ip)
+	case r.ip != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.ip.Equal(ip)
+	}
+	return len(r.domain) > 0 && (host == r.domain || strings.HasSuffix(host, "."+r.domain))
+}
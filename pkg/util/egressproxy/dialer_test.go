@@ -0,0 +1,279 @@
+package egressproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectProxy serves the CONNECT requests authenticated by the credential,
+// recording the tunneled addresses.
+type connectProxy struct {
+	lock      sync.Mutex
+	username  string
+	password  string
+	connected []string
+}
+
+func (p *connectProxy) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.username+":"+p.password))
+	if req.Header.Get("Proxy-Authorization") != expected {
+		resp.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	p.lock.Lock()
+	p.connected = append(p.connected, req.Host)
+	p.lock.Unlock()
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+	conn, buf, err := resp.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	pipe(conn, buf.Reader, upstream)
+}
+
+func pipe(conn net.Conn, reader io.Reader, upstream net.Conn) {
+	go func() {
+		io.Copy(upstream, reader)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+// serveSOCKS5 serves the SOCKS5 CONNECT commands authenticated by the
+// username and the password.
+func serveSOCKS5(t *testing.T, username, password string) (string, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	var lock sync.Mutex
+	var connected []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				reader := bufio.NewReader(conn)
+				target, err := socks5Handshake(reader, conn, username, password)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				lock.Lock()
+				connected = append(connected, target)
+				lock.Unlock()
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				// succeeded, bound to 0.0.0.0:0
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				pipe(conn, reader, upstream)
+			}()
+		}
+	}()
+	return listener.Addr().String(), &connected
+}
+
+func socks5Handshake(reader *bufio.Reader, conn net.Conn, username, password string) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(reader, make([]byte, header[1])); err != nil {
+		return "", err
+	}
+	// username/password authentication
+	conn.Write([]byte{5, 2})
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(reader, version); err != nil {
+		return "", err
+	}
+	user := make([]byte, version[1])
+	io.ReadFull(reader, user)
+	passwordLength, _ := reader.ReadByte()
+	pass := make([]byte, passwordLength)
+	io.ReadFull(reader, pass)
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{1, 1})
+		return "", io.EOF
+	}
+	conn.Write([]byte{1, 0})
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(reader, request); err != nil {
+		return "", err
+	}
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(reader, ip)
+		host = net.IP(ip).String()
+	case 3:
+		length, _ := reader.ReadByte()
+		name := make([]byte, length)
+		io.ReadFull(reader, name)
+		host = string(name)
+	default:
+		return "", io.EOF
+	}
+	port := make([]byte, 2)
+	io.ReadFull(reader, port)
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func staticCredential(username, password string) Credential {
+	return func(context.Context) (string, string, error) {
+		return username, password, nil
+	}
+}
+
+func requestThrough(t *testing.T, dialer *Dialer, target string) string {
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	resp, err := client.Get(target)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDialerHTTPConnect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	proxy := &connectProxy{username: "alice", password: "secret"}
+	proxySvr := httptest.NewServer(proxy)
+	defer proxySvr.Close()
+
+	dialer, err := NewDialer(proxySvr.URL, nil, staticCredential("alice", "secret"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", requestThrough(t, dialer, target.URL))
+	assert.Equal(t, []string{strings.TrimPrefix(target.URL, "http://")}, proxy.connected)
+
+	// the rejected CONNECT fails the dial
+	dialer, err = NewDialer(proxySvr.URL, nil, staticCredential("alice", "wrong"), nil)
+	require.NoError(t, err)
+	_, err = dialer.DialContext(context.TODO(), "tcp", strings.TrimPrefix(target.URL, "http://"))
+	assert.ErrorContains(t, err, "407")
+}
+
+func TestDialerHTTPSConnect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	proxy := &connectProxy{username: "alice", password: "secret"}
+	proxySvr := httptest.NewTLSServer(proxy)
+	defer proxySvr.Close()
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxySvr.Certificate().Raw})
+
+	dialer, err := NewDialer(proxySvr.URL, caBundle, staticCredential("alice", "secret"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", requestThrough(t, dialer, target.URL))
+
+	// the proxy is not trusted without the CA bundle
+	dialer, err = NewDialer(proxySvr.URL, nil, staticCredential("alice", "secret"), nil)
+	require.NoError(t, err)
+	_, err = dialer.DialContext(context.TODO(), "tcp", strings.TrimPrefix(target.URL, "http://"))
+	assert.ErrorContains(t, err, "certificate")
+
+	_, err = NewDialer(proxySvr.URL, []byte("not a certificate"), nil, nil)
+	assert.Error(t, err)
+}
+
+func TestDialerSOCKS5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	address, connected := serveSOCKS5(t, "alice", "secret")
+
+	dialer, err := NewDialer("socks5://"+address, nil, staticCredential("alice", "secret"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", requestThrough(t, dialer, target.URL))
+	assert.Equal(t, []string{strings.TrimPrefix(target.URL, "http://")}, *connected)
+}
+
+func TestDialerNoProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	proxy := &connectProxy{}
+	proxySvr := httptest.NewServer(proxy)
+	defer proxySvr.Close()
+
+	dialer, err := NewDialer(proxySvr.URL, nil, nil, []string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", requestThrough(t, dialer, target.URL))
+	assert.Empty(t, proxy.connected)
+
+	dialer, err = NewDialer("http://proxy.example.com", nil, nil, []string{
+		".internal.example.com", "api.example.com:6443", "10.0.0.0/8", "192.168.1.1", "[fd00::1]:443",
+	})
+	require.NoError(t, err)
+	cases := map[string]bool{
+		"internal.example.com:443":     true,
+		"a.internal.example.com:443":   true,
+		"notinternal.example.com:443":  false,
+		"api.example.com:6443":         true,
+		"api.example.com:443":          false,
+		"x.api.example.com:6443":       true,
+		"10.1.2.3:6443":                true,
+		"11.1.2.3:6443":                false,
+		"192.168.1.1:6443":             true,
+		"[fd00::1]:443":                true,
+		"[fd00::1]:6443":               false,
+		"API.Internal.Example.COM.:80": true,
+	}
+	for address, expected := range cases {
+		assert.Equal(t, expected, dialer.bypass(address), address)
+	}
+
+	dialer, err = NewDialer("http://proxy.example.com", nil, nil, []string{"*"})
+	require.NoError(t, err)
+	assert.True(t, dialer.bypass("anything:443"))
+}
+
+func TestNewDialer(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy", "http://", "://"} {
+		_, err := NewDialer(proxyURL, nil, nil, nil)
+		assert.Error(t, err, proxyURL)
+	}
+	dialer, err := NewDialer("socks5://proxy", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy:1080", dialer.proxy.Host)
+	dialer, err = NewDialer("https://proxy", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy:443", dialer.proxy.Host)
+	assert.Equal(t, "proxy", dialer.tlsConfig.ServerName)
+}
@@ -0,0 +1,165 @@
+package konnectivity
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-network-proxy/konnectivity-client/proto/client"
+)
+
+// closeTimeout is how long a closing connection waits for the CLOSE_RSP.
+const closeTimeout = 10 * time.Second
+
+var errNotImplemented = errors.New("not implemented")
+
+var _ net.Conn = &tunnelConn{}
+
+// tunnelConn is a connection dialed over a dedicated Proxy stream.
+type tunnelConn struct {
+	stream client.ProxyService_ProxyClient
+	cancel context.CancelFunc
+	random int64
+	// connID is set upon the successful DIAL_RSP
+	connID int64
+
+	sendLock sync.Mutex
+	readCh   chan []byte
+	rdata    []byte
+	// closing is closed once the connection is being closed
+	closing chan struct{}
+	// closed is closed once the CLOSE_RSP is received or the stream breaks
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newTunnelConn(stream client.ProxyService_ProxyClient, cancel context.CancelFunc, random int64) *tunnelConn {
+	return &tunnelConn{
+		stream:  stream,
+		cancel:  cancel,
+		random:  random,
+		readCh:  make(chan []byte, 10),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *tunnelConn) send(pkt *client.Packet) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	return c.stream.Send(pkt)
+}
+
+// serve delivers the data received from the stream until the connection is
+// closed by either side.
+func (c *tunnelConn) serve() {
+	defer func() {
+		close(c.readCh)
+		close(c.closed)
+		c.cancel()
+	}()
+	for {
+		pkt, err := c.stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				klog.V(4).InfoS("Tunnel stream broken", "connectionID", c.connID, "err", err)
+			}
+			return
+		}
+		switch pkt.Type {
+		case client.PacketType_DATA:
+			data := pkt.GetData()
+			if data.ConnectID != c.connID {
+				continue
+			}
+			select {
+			case c.readCh <- data.Data:
+			case <-c.closing:
+				// dropping the data nobody is going to read
+			}
+		case client.PacketType_CLOSE_RSP:
+			return
+		}
+	}
+}
+
+// Read receives the data from the connection.
+func (c *tunnelConn) Read(b []byte) (int, error) {
+	data := c.rdata
+	if data == nil {
+		data = <-c.readCh
+	}
+	if data == nil {
+		return 0, io.EOF
+	}
+	n := copy(b, data)
+	if n < len(data) {
+		c.rdata = data[n:]
+	} else {
+		c.rdata = nil
+	}
+	return n, nil
+}
+
+// Write sends the data through the connection.
+func (c *tunnelConn) Write(data []byte) (int, error) {
+	err := c.send(&client.Packet{
+		Type: client.PacketType_DATA,
+		Payload: &client.Packet_Data{
+			Data: &client.Data{
+				ConnectID: c.connID,
+				Data:      data,
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Close closes the connection and the underlying stream while keeping the
+// shared gRPC connection.
+func (c *tunnelConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		defer c.cancel()
+		if sendErr := c.send(&client.Packet{
+			Type:    client.PacketType_CLOSE_REQ,
+			Payload: &client.Packet_CloseRequest{CloseRequest: &client.CloseRequest{ConnectID: c.connID}},
+		}); sendErr != nil {
+			return
+		}
+		select {
+		case <-c.closed:
+		case <-time.After(closeTimeout):
+			err = errors.New("close timeout")
+		}
+	})
+	return err
+}
+
+func (c *tunnelConn) LocalAddr() net.Addr {
+	return nil
+}
+
+func (c *tunnelConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (c *tunnelConn) SetDeadline(time.Time) error {
+	return errNotImplemented
+}
+
+func (c *tunnelConn) SetReadDeadline(time.Time) error {
+	return errNotImplemented
+}
+
+func (c *tunnelConn) SetWriteDeadline(time.Time) error {
+	return errNotImplemented
+}
@@ -0,0 +1,125 @@
+package konnectivity
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/metrics"
+)
+
+// maxConnectResponseBody bounds reading the error message from the rejected
+// CONNECT requests.
+const maxConnectResponseBody = 4096
+
+// HTTPConnectDialer dials through the konnectivity proxy server serving in the
+// HTTP-CONNECT mode. Every dial establishes a (mutual) TLS connection to the
+// proxy server and tunnels over it by a CONNECT request, which passes through
+// the L7 load balancers not passing gRPC.
+type HTTPConnectDialer struct {
+	address   string
+	tlsConfig *tls.Config
+}
+
+// NewHTTPConnectDialer returns the dialer through the proxy server listening
+// at the address. A nil TLS config dials the proxy server in plaintext.
+func NewHTTPConnectDialer(address string, tlsConfig *tls.Config) *HTTPConnectDialer {
+	return &HTTPConnectDialer{
+		address:   address,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// DialContext dials the address through the proxy server. The only
+// supported protocol is tcp.
+func (d *HTTPConnectDialer) DialContext(ctx context.Context, protocol, address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.dial(ctx, protocol, address)
+	metrics.RecordClusterProxyDial(time.Since(start), err == nil)
+	if err != nil {
+		metrics.RecordClusterProxyDialFailure(dialFailureReason(err))
+	}
+	return conn, err
+}
+
+func (d *HTTPConnectDialer) dial(ctx context.Context, protocol, address string) (net.Conn, error) {
+	if protocol != "tcp" {
+		return nil, &dialFailure{msg: "protocol not supported", reason: dialFailureProtocol}
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+
+	var conn net.Conn
+	var err error
+	if d.tlsConfig != nil {
+		conn, err = (&tls.Dialer{Config: d.tlsConfig}).DialContext(ctx, "tcp", d.address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", d.address)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+		}
+		return nil, &dialFailure{msg: err.Error(), reason: dialFailureProxy, cause: err}
+	}
+
+	// the CONNECT request is bounded by the dialing context
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := func() (*http.Response, error) {
+		if err := connect.Write(conn); err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(reader, connect)
+	}()
+	if !stop() {
+		conn.Close()
+		return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &dialFailure{msg: err.Error(), reason: dialFailureProxy, cause: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxConnectResponseBody))
+		conn.Close()
+		msg := fmt.Sprintf("proxy server rejected connecting %s: %s", address, resp.Status)
+		if detail := strings.TrimSpace(string(body)); len(detail) > 0 {
+			msg += ": " + detail
+		}
+		return nil, &dialFailure{msg: msg, reason: dialFailureEndpoint}
+	}
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered along with the CONNECT response
+// ahead of the connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,116 @@
+package konnectivity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	"sigs.k8s.io/apiserver-network-proxy/pkg/server"
+)
+
+func TestHTTPConnectDialer(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		io.WriteString(resp, "pong")
+	}))
+	defer backend.Close()
+	proxy := newProxyServer(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cert, err := certutil.NewSelfSignedCACert(certutil.Config{CommonName: "cluster-gateway"}, key)
+	require.NoError(t, err)
+	clientCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	clientKey, err := keyutil.MarshalPrivateKeyToPEM(key)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	frontend := httptest.NewUnstartedServer(&server.Tunnel{Server: proxy.proxy})
+	frontend.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	frontend.StartTLS()
+	defer frontend.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: frontend.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, serverCA, 0600))
+	require.NoError(t, os.WriteFile(certFile, clientCert, 0600))
+	require.NoError(t, os.WriteFile(keyFile, clientKey, 0600))
+	tlsCfg, err := NewReloadingClientTLSConfig(caFile, certFile, keyFile, "example.com")
+	require.NoError(t, err)
+	dialer := NewHTTPConnectDialer(frontend.Listener.Addr().String(), tlsCfg)
+
+	t.Run("dials are tunneled by CONNECT requests", func(t *testing.T) {
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				DialContext:       dialer.DialContext,
+				DisableKeepAlives: true,
+			},
+			Timeout: 10 * time.Second,
+		}
+		for i := 0; i < 3; i++ {
+			resp, err := httpClient.Get(backend.URL)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, "pong", string(body))
+		}
+	})
+
+	t.Run("failed dials are reported", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		unreachable := listener.Addr().String()
+		listener.Close()
+		_, err = dialer.DialContext(context.TODO(), "tcp", unreachable)
+		require.Error(t, err)
+		assert.Equal(t, dialFailureEndpoint, dialFailureReason(err))
+
+		_, err = dialer.DialContext(context.TODO(), "udp", unreachable)
+		assert.Equal(t, dialFailureProtocol, dialFailureReason(err))
+	})
+
+	t.Run("dials without client certificate are rejected", func(t *testing.T) {
+		anonymous := NewHTTPConnectDialer(frontend.Listener.Addr().String(), &tls.Config{
+			RootCAs:    frontend.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+			ServerName: "example.com",
+		})
+		_, err := anonymous.DialContext(context.TODO(), "tcp", backend.Listener.Addr().String())
+		require.Error(t, err)
+		assert.Equal(t, dialFailureProxy, dialFailureReason(err))
+	})
+
+	t.Run("dials are bounded by the context", func(t *testing.T) {
+		// the listener accepts the connection but never responds
+		silent, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer silent.Close()
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		_, err = NewHTTPConnectDialer(silent.Addr().String(), nil).
+			DialContext(ctx, "tcp", backend.Listener.Addr().String())
+		require.Error(t, err)
+		assert.Equal(t, dialFailureContext, dialFailureReason(err))
+	})
+}
@@ -0,0 +1,278 @@
+package konnectivity
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/apiserver-network-proxy/konnectivity-client/proto/client"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/metrics"
+)
+
+// dialTimeout bounds waiting for the DIAL_RSP when the dialing context has
+// no deadline.
+const dialTimeout = 30 * time.Second
+
+// retryInterval is the pause between the dials retried upon the unavailable
+// proxy server.
+const retryInterval = 100 * time.Millisecond
+
+// reconnectBackoff is the backoff of re-establishing the gRPC connections
+// to the proxy server.
+var reconnectBackoff = backoff.Config{
+	BaseDelay:  time.Second,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   30 * time.Second,
+}
+
+// Pool dials through the konnectivity proxy server over a fixed number of
+// long-lived gRPC connections. Every dial opens a Proxy stream multiplexed
+// over one of the connections, so that the dials never pay the gRPC and TLS
+// handshakes. The connections are re-established with backoff by gRPC once
+// they break.
+type Pool struct {
+	address string
+	size    int
+	options []grpc.DialOption
+
+	lock  sync.Mutex
+	conns []*grpc.ClientConn
+	next  uint32
+}
+
+// NewPool returns the pool of the given number of connections to the proxy
+// server. The connections are established upon the first dial.
+func NewPool(address string, size int, opts ...grpc.DialOption) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		address: address,
+		size:    size,
+		options: append([]grpc.DialOption{
+			grpc.WithConnectParams(grpc.ConnectParams{
+				Backoff:           reconnectBackoff,
+				MinConnectTimeout: 20 * time.Second,
+			}),
+		}, opts...),
+	}
+}
+
+// DialContext dials the address through the proxy server. The only
+// supported protocol is tcp.
+func (p *Pool) DialContext(ctx context.Context, protocol, address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := p.dial(ctx, protocol, address)
+	metrics.RecordClusterProxyDial(time.Since(start), err == nil)
+	if err != nil {
+		metrics.RecordClusterProxyDialFailure(dialFailureReason(err))
+	}
+	return conn, err
+}
+
+// Close closes the connections of the pool, which breaks the connections
+// dialed through the pool.
+func (p *Pool) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var errs []error
+	for _, cc := range p.conns {
+		if err := cc.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.conns = nil
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// pick returns the connections in turns.
+func (p *Pool) pick() (*grpc.ClientConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for len(p.conns) < p.size {
+		cc, err := grpc.NewClient(p.address, p.options...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed creating connection to proxy server %s", p.address)
+		}
+		p.conns = append(p.conns, cc)
+	}
+	i := atomic.AddUint32(&p.next, 1)
+	return p.conns[int(i)%len(p.conns)], nil
+}
+
+func (p *Pool) dial(ctx context.Context, protocol, address string) (net.Conn, error) {
+	if protocol != "tcp" {
+		return nil, &dialFailure{msg: "protocol not supported", reason: dialFailureProtocol}
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+	for {
+		cc, err := p.pick()
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialStream(ctx, cc, protocol, address)
+		// the streams break along with the connection being re-established,
+		// in which case the dial waits for the connection to become ready
+		var f *dialFailure
+		if err == nil || !errors.As(err, &f) || status.Code(f.cause) != codes.Unavailable {
+			return conn, err
+		}
+		klog.V(4).InfoS("Retrying dial upon unavailable proxy server", "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// dialStream dials the address over a Proxy stream of the connection.
+func dialStream(ctx context.Context, cc *grpc.ClientConn, protocol, address string) (net.Conn, error) {
+
+	// the stream outlives the dialing context, which only bounds waiting
+	// for the connection to become ready
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	var lock sync.Mutex
+	created := false
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			lock.Lock()
+			defer lock.Unlock()
+			if !created {
+				cancelStream()
+			}
+		case <-stop:
+		}
+	}()
+	stream, err := client.NewProxyServiceClient(cc).Proxy(streamCtx, grpc.WaitForReady(true))
+	lock.Lock()
+	created = true
+	lock.Unlock()
+	close(stop)
+	if err != nil {
+		cancelStream()
+		if ctx.Err() != nil {
+			return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+		}
+		return nil, &dialFailure{msg: err.Error(), reason: dialFailureStream, cause: err}
+	}
+
+	c := newTunnelConn(stream, cancelStream, rand.Int63()) // #nosec G404
+	if err := c.send(&client.Packet{
+		Type: client.PacketType_DIAL_REQ,
+		Payload: &client.Packet_DialRequest{
+			DialRequest: &client.DialRequest{
+				Protocol: protocol,
+				Address:  address,
+				Random:   c.random,
+			},
+		},
+	}); err != nil {
+		cancelStream()
+		return nil, &dialFailure{msg: err.Error(), reason: dialFailureStream, cause: err}
+	}
+
+	type dialResult struct {
+		resp *client.DialResponse
+		err  error
+	}
+	result := make(chan dialResult, 1)
+	go func() {
+		for {
+			pkt, err := stream.Recv()
+			if err != nil {
+				result <- dialResult{err: err}
+				return
+			}
+			switch pkt.Type {
+			case client.PacketType_DIAL_RSP:
+				if resp := pkt.GetDialResponse(); resp.Random == c.random {
+					result <- dialResult{resp: resp}
+					return
+				}
+			case client.PacketType_DIAL_CLS:
+				result <- dialResult{err: &dialFailure{msg: "dial closed", reason: dialFailureDialClosed}}
+				return
+			}
+		}
+	}()
+	select {
+	case res := <-result:
+		switch {
+		case res.err != nil:
+			cancelStream()
+			if ctx.Err() != nil {
+				return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+			}
+			if _, ok := res.err.(*dialFailure); ok {
+				return nil, res.err
+			}
+			return nil, &dialFailure{msg: res.err.Error(), reason: dialFailureStream, cause: res.err}
+		case len(res.resp.Error) > 0:
+			cancelStream()
+			return nil, &dialFailure{msg: res.resp.Error, reason: dialFailureEndpoint}
+		}
+		c.connID = res.resp.ConnectID
+	case <-ctx.Done():
+		klog.V(5).InfoS("Context canceled waiting for DialResp", "ctxErr", ctx.Err(), "dialID", c.random)
+		go func() {
+			defer cancelStream()
+			_ = c.send(&client.Packet{
+				Type:    client.PacketType_DIAL_CLS,
+				Payload: &client.Packet_CloseDial{CloseDial: &client.CloseDial{Random: c.random}},
+			})
+		}()
+		return nil, &dialFailure{msg: "dial timeout, context", reason: dialFailureContext}
+	}
+	go c.serve()
+	return c, nil
+}
+
+// reasons of dial failures in the metrics
+const (
+	dialFailureProtocol   = "protocol"
+	dialFailureProxy      = "proxy"
+	dialFailureStream     = "stream"
+	dialFailureContext    = "context"
+	dialFailureEndpoint   = "endpoint"
+	dialFailureDialClosed = "dial_closed"
+	dialFailureUnknown    = "unknown"
+)
+
+type dialFailure struct {
+	msg    string
+	reason string
+	cause  error
+}
+
+func (f *dialFailure) Error() string {
+	return f.msg
+}
+
+func dialFailureReason(err error) string {
+	var f *dialFailure
+	if errors.As(err, &f) {
+		return f.reason
+	}
+	return dialFailureUnknown
+}
@@ -0,0 +1,161 @@
+package konnectivity
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"sigs.k8s.io/apiserver-network-proxy/konnectivity-client/proto/client"
+	"sigs.k8s.io/apiserver-network-proxy/pkg/agent"
+	"sigs.k8s.io/apiserver-network-proxy/pkg/server"
+	"sigs.k8s.io/apiserver-network-proxy/pkg/server/proxystrategies"
+	agentproto "sigs.k8s.io/apiserver-network-proxy/proto/agent"
+)
+
+type fixedServerCounter int
+
+func (c fixedServerCounter) Count() int {
+	return int(c)
+}
+
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt64(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+// proxyServer runs the konnectivity proxy server along with an agent in the
+// process.
+type proxyServer struct {
+	frontendAddress string
+	frontend        *countingListener
+	frontendServer  *grpc.Server
+	proxy           *server.ProxyServer
+}
+
+func newProxyServer(t *testing.T) *proxyServer {
+	proxy := server.NewProxyServer("server", []proxystrategies.ProxyStrategy{proxystrategies.ProxyStrategyDefault}, 1, &server.AgentTokenAuthenticationOptions{}, 150)
+
+	agentListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	agentServer := grpc.NewServer()
+	agentproto.RegisterAgentServiceServer(agentServer, proxy)
+	go agentServer.Serve(agentListener)
+	t.Cleanup(agentServer.Stop)
+
+	s := &proxyServer{proxy: proxy}
+	s.serveFrontend(t, "127.0.0.1:0")
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cs := (&agent.ClientSetConfig{
+		Address:         agentListener.Addr().String(),
+		AgentID:         "agent",
+		SyncInterval:    100 * time.Millisecond,
+		ProbeInterval:   100 * time.Millisecond,
+		SyncIntervalCap: time.Second,
+		DialOptions:     []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		XfrChannelSize:  150,
+	}).NewAgentClientSet(make(chan struct{}), stopCh)
+	cs.SetServerCounter(fixedServerCounter(1))
+	cs.Serve()
+	require.Eventually(t, func() bool {
+		ready, _ := proxy.Readiness.Ready()
+		return ready
+	}, 10*time.Second, 50*time.Millisecond)
+	return s
+}
+
+func (s *proxyServer) serveFrontend(t *testing.T, address string) {
+	listener, err := net.Listen("tcp", address)
+	require.NoError(t, err)
+	s.frontendAddress = listener.Addr().String()
+	s.frontend = &countingListener{Listener: listener}
+	s.frontendServer = grpc.NewServer()
+	client.RegisterProxyServiceServer(s.frontendServer, s.proxy)
+	go s.frontendServer.Serve(s.frontend)
+	t.Cleanup(s.frontendServer.Stop)
+}
+
+func TestPool(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		io.WriteString(resp, "pong")
+	}))
+	defer backend.Close()
+	proxy := newProxyServer(t)
+
+	pool := NewPool(proxy.frontendAddress, 1, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer pool.Close()
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: pool.DialContext,
+			// every request dials through the pool
+			DisableKeepAlives: true,
+		},
+		Timeout: 10 * time.Second,
+	}
+	get := func() error {
+		resp, err := httpClient.Get(backend.URL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if string(body) != "pong" {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+
+	t.Run("dials are multiplexed over the pooled connection", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, get())
+		}
+		assert.Equal(t, int64(1), atomic.LoadInt64(&proxy.frontend.accepted))
+	})
+
+	t.Run("failed dials are reported", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		unreachable := listener.Addr().String()
+		listener.Close()
+		_, err = pool.DialContext(context.TODO(), "tcp", unreachable)
+		require.Error(t, err)
+		assert.Equal(t, dialFailureEndpoint, dialFailureReason(err))
+
+		_, err = pool.DialContext(context.TODO(), "udp", unreachable)
+		assert.Equal(t, dialFailureProtocol, dialFailureReason(err))
+	})
+
+	t.Run("broken connections are re-established", func(t *testing.T) {
+		proxy.frontendServer.Stop()
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		_, err := pool.DialContext(ctx, "tcp", backend.Listener.Addr().String())
+		require.Error(t, err)
+		assert.Equal(t, dialFailureContext, dialFailureReason(err))
+
+		proxy.serveFrontend(t, proxy.frontendAddress)
+		require.NoError(t, get())
+	})
+}
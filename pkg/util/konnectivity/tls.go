@@ -0,0 +1,107 @@
+package konnectivity
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// NewReloadingClientTLSConfig returns the client TLS config for the proxy
+// server which reloads the CA bundle and the key pair from the files upon the
+// handshakes once the files change on disk, so that the rotated certificates
+// take effect when the connections are re-established.
+func NewReloadingClientTLSConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	files := &tlsFiles{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if _, _, err := files.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+		// the server certificate is verified by VerifyConnection against the
+		// reloaded CA bundle instead
+		InsecureSkipVerify: true, // #nosec G402
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := files.load()
+			return cert, err
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			_, roots, err := files.load()
+			if err != nil {
+				return err
+			}
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no certificate is presented by the proxy server")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				DNSName:       state.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err = state.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}, nil
+}
+
+// tlsFiles caches the CA bundle and the key pair loaded from the files until
+// any of the files is modified.
+type tlsFiles struct {
+	caFile, certFile, keyFile string
+
+	lock     sync.Mutex
+	modTimes [3]time.Time
+	cert     *tls.Certificate
+	roots    *x509.CertPool
+}
+
+func (f *tlsFiles) load() (*tls.Certificate, *x509.CertPool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var modTimes [3]time.Time
+	for i, file := range []string{f.caFile, f.certFile, f.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return f.loaded(errors.Wrapf(err, "failed reading %s", file))
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if f.cert != nil && modTimes == f.modTimes {
+		return f.cert, f.roots, nil
+	}
+	caData, err := os.ReadFile(f.caFile)
+	if err != nil {
+		return f.loaded(errors.Wrapf(err, "failed reading %s", f.caFile))
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return f.loaded(errors.Errorf("no certificate is found in %s", f.caFile))
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return f.loaded(errors.Wrapf(err, "failed loading key pair %s and %s", f.certFile, f.keyFile))
+	}
+	if f.cert != nil {
+		klog.Infof("Reloaded the certificates for connecting the proxy server")
+	}
+	f.modTimes, f.cert, f.roots = modTimes, &cert, roots
+	return f.cert, f.roots, nil
+}
+
+// loaded falls back to the previously loaded files if any, e.g. while the
+// files are being rotated.
+func (f *tlsFiles) loaded(err error) (*tls.Certificate, *x509.CertPool, error) {
+	if f.cert == nil {
+		return nil, nil, err
+	}
+	klog.Warningf("Keeping the previous certificates for connecting the proxy server: %v", err)
+	return f.cert, f.roots, nil
+}
@@ -0,0 +1,76 @@
+package konnectivity
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestReloadingClientTLSConfig(t *testing.T) {
+	svr := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+	defer svr.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: svr.Certificate().Raw})
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	modTime := time.Now()
+	write := func(ca, cert, key []byte) {
+		modTime = modTime.Add(time.Second)
+		for file, data := range map[string][]byte{caFile: ca, certFile: cert, keyFile: key} {
+			require.NoError(t, os.WriteFile(file, data, 0600))
+			require.NoError(t, os.Chtimes(file, modTime, modTime))
+		}
+	}
+	cert1, key1, err := certutil.GenerateSelfSignedCertKey("client-1", nil, nil)
+	require.NoError(t, err)
+	cert2, key2, err := certutil.GenerateSelfSignedCertKey("client-2", nil, nil)
+	require.NoError(t, err)
+
+	// the CA bundle does not trust the server yet
+	write(cert1, cert1, key1)
+	tlsCfg, err := NewReloadingClientTLSConfig(caFile, certFile, keyFile, "example.com")
+	require.NoError(t, err)
+	handshake := func() error {
+		conn, err := tls.Dial("tcp", svr.Listener.Addr().String(), tlsCfg)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	assert.Error(t, handshake())
+	clientCert, err := tlsCfg.GetClientCertificate(nil)
+	require.NoError(t, err)
+	expected, err := tls.X509KeyPair(cert1, key1)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Certificate, clientCert.Certificate)
+
+	// the rotated files take effect upon the next handshake
+	write(serverCA, cert2, key2)
+	assert.NoError(t, handshake())
+	clientCert, err = tlsCfg.GetClientCertificate(nil)
+	require.NoError(t, err)
+	expected, err = tls.X509KeyPair(cert2, key2)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Certificate, clientCert.Certificate)
+
+	// the files being rotated fall back to the previously loaded ones
+	write(serverCA, []byte("malformed"), key2)
+	clientCert, err = tlsCfg.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Certificate, clientCert.Certificate)
+
+	// missing files fail at the beginning
+	_, err = NewReloadingClientTLSConfig(filepath.Join(dir, "missing"), certFile, keyFile, "example.com")
+	assert.Error(t, err)
+}
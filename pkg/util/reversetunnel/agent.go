@@ -0,0 +1,298 @@
+package reversetunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// maxConcurrentStreams bounds the connections tunneled over a session.
+	maxConcurrentStreams = 1000
+	// duplicateRetryInterval is the pause before the agent retries a session
+	// which landed on a replica already holding one.
+	duplicateRetryInterval = time.Second
+)
+
+// Agent keeps the sessions to the gateway for the cluster, one for every
+// gateway replica, and serves the tunneled connections by dialing the local
+// kube-apiserver.
+type Agent struct {
+	// Config is the client config of the hub cluster, through which the
+	// tunnel requests are forwarded to the gateway.
+	Config *rest.Config
+	// Cluster is the name of the managed cluster.
+	Cluster string
+	// Replicas is the number of the gateway replicas.
+	Replicas int
+	// TargetAddress is the address of the local kube-apiserver.
+	TargetAddress string
+}
+
+// Run keeps the sessions until the context is done.
+func (a *Agent) Run(ctx context.Context) error {
+	if a.Config == nil || len(a.Cluster) == 0 || len(a.TargetAddress) == 0 {
+		return errors.New("missing hub config, cluster name or target address")
+	}
+	replicas := a.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	covered := &replicaSet{replicas: make(map[string]bool)}
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.keepSession(ctx, covered)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// keepSession re-establishes the session once it breaks. The sessions
+// landing on a replica already covered are dropped and retried, so that
+// every replica holds a session eventually.
+func (a *Agent) keepSession(ctx context.Context, covered *replicaSet) {
+	backoff := newReconnectBackoff()
+	for ctx.Err() == nil {
+		conn, replica, err := a.connect(ctx)
+		if err != nil {
+			klog.Warningf("Failed connecting reverse tunnel of cluster %s: %v", a.Cluster, err)
+			sleep(ctx, backoff.Step())
+			continue
+		}
+		if !covered.add(replica) {
+			conn.Close()
+			sleep(ctx, wait.Jitter(duplicateRetryInterval, 1.0))
+			continue
+		}
+		klog.Infof("Connected reverse tunnel of cluster %s to gateway replica %s", a.Cluster, replica)
+		backoff = newReconnectBackoff()
+		a.serve(ctx, conn)
+		covered.remove(replica)
+		klog.Infof("Disconnected reverse tunnel of cluster %s from gateway replica %s", a.Cluster, replica)
+	}
+}
+
+// connect upgrades the tunnel request to the gateway and returns the tunnel
+// connection along with the replica holding the session.
+func (a *Agent) connect(ctx context.Context) (net.Conn, string, error) {
+	u, err := url.Parse(a.Config.Host)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "invalid hub host %s", a.Config.Host)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + Path(a.Cluster)
+	tlsConfig, err := rest.TLSConfigFor(a.Config)
+	if err != nil {
+		return nil, "", err
+	}
+	upgrader := &upgradeRoundTripper{tlsConfig: tlsConfig}
+	rt, err := rest.HTTPWrappersForConfig(a.Config, upgrader)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", Protocol)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxConnectResponseBody))
+		resp.Body.Close()
+		return nil, "", errors.Errorf("gateway rejected the tunnel: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return upgrader.conn, resp.Header.Get(HeaderReplica), nil
+}
+
+// serve serves the CONNECT streams of the session until the tunnel breaks.
+func (a *Agent) serve(ctx context.Context, conn net.Conn) {
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	server := &http2.Server{
+		MaxConcurrentStreams: maxConcurrentStreams,
+		ReadIdleTimeout:      pingInterval,
+		PingTimeout:          pingTimeout,
+	}
+	server.ServeConn(conn, &http2.ServeConnOpts{
+		Context: ctx,
+		Handler: http.HandlerFunc(a.serveConnect),
+	})
+}
+
+func (a *Agent) serveConnect(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	target, err := (&net.Dialer{Timeout: dialTimeout}).DialContext(req.Context(), "tcp", a.TargetAddress)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+	// the target is closed once the stream is reset by the gateway
+	stop := context.AfterFunc(req.Context(), func() {
+		target.Close()
+	})
+	defer stop()
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	go func() {
+		if _, err := io.Copy(target, req.Body); err != nil {
+			target.Close()
+			return
+		}
+		// half-closing upon the gateway closing its writing side
+		if tcpConn, ok := target.(*net.TCPConn); ok {
+			_ = tcpConn.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(&flushWriter{writer: w, flusher: flusher}, target)
+}
+
+// flushWriter flushes every write to the stream.
+type flushWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+}
+
+func (w *flushWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return n, err
+}
+
+// upgradeRoundTripper sends the upgrade request over a dedicated connection
+// which is kept for the tunnel upon switching protocols.
+type upgradeRoundTripper struct {
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func (u *upgradeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	address := req.URL.Host
+	if len(req.URL.Port()) == 0 {
+		port := "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+		address = net.JoinHostPort(req.URL.Hostname(), port)
+	}
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if req.URL.Scheme == "http" {
+		conn, err = dialer.DialContext(req.Context(), "tcp", address)
+	} else {
+		tlsConfig := &tls.Config{}
+		if u.tlsConfig != nil {
+			tlsConfig = u.tlsConfig.Clone()
+		}
+		// the upgrade is only supported by HTTP/1.1
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(req.Context(), "tcp", address)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed dialing %s", address)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// the connection is closed along with the response body
+		resp.Body = &closingBody{ReadCloser: resp.Body, conn: conn}
+		return resp, nil
+	}
+	if reader.Buffered() > 0 {
+		u.conn = &bufferedConn{Conn: conn, reader: reader}
+	} else {
+		u.conn = conn
+	}
+	return resp, nil
+}
+
+type closingBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *closingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
+
+// replicaSet is the gateway replicas covered by the sessions.
+type replicaSet struct {
+	lock     sync.Mutex
+	replicas map[string]bool
+}
+
+func (s *replicaSet) add(replica string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.replicas[replica] {
+		return false
+	}
+	s.replicas[replica] = true
+	return true
+}
+
+func (s *replicaSet) remove(replica string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.replicas, replica)
+}
+
+func newReconnectBackoff() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: time.Second,
+		Factor:   1.6,
+		Jitter:   0.2,
+		Steps:    int(^uint(0) >> 1),
+		Cap:      30 * time.Second,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
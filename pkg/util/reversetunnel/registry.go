@@ -0,0 +1,97 @@
+package reversetunnel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// probeTimeout bounds pinging the existing session of a cluster upon
+// admitting a new one.
+const probeTimeout = 5 * time.Second
+
+// ErrSessionLive is returned when admitting a session of a cluster whose
+// existing session is still live.
+var ErrSessionLive = errors.New("the cluster has a live reverse tunnel session")
+
+// Registry keeps the session of each cluster. The sessions are removed once
+// closed.
+type Registry struct {
+	lock     sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{sessions: make(map[string]*Session)}
+}
+
+// Admit makes room for a new session of the cluster. A live session is never
+// replaced: the new session is refused as long as the existing one answers
+// the ping, and the existing one is closed otherwise, e.g. the agent
+// restarted without closing the tunnel.
+func (r *Registry) Admit(ctx context.Context, cluster string) error {
+	r.lock.RLock()
+	existing := r.sessions[cluster]
+	r.lock.RUnlock()
+	if existing == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if err := existing.Ping(ctx); err == nil {
+		return ErrSessionLive
+	}
+	klog.Infof("Closing unresponsive reverse tunnel session of cluster %s", cluster)
+	existing.Close()
+	r.remove(cluster, existing)
+	return nil
+}
+
+// Register adds the admitted session of the cluster. The session is refused
+// if another session was registered since admitted.
+func (r *Registry) Register(cluster string, session *Session) error {
+	r.lock.Lock()
+	if r.sessions[cluster] != nil {
+		r.lock.Unlock()
+		return ErrSessionLive
+	}
+	r.sessions[cluster] = session
+	r.lock.Unlock()
+	go func() {
+		<-session.Done()
+		r.remove(cluster, session)
+		klog.Infof("Closed reverse tunnel session of cluster %s", cluster)
+	}()
+	return nil
+}
+
+func (r *Registry) remove(cluster string, session *Session) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.sessions[cluster] == session {
+		delete(r.sessions, cluster)
+	}
+}
+
+// Connected tells whether the cluster has any session.
+func (r *Registry) Connected(cluster string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.sessions[cluster] != nil
+}
+
+// DialContext dials the address through the session of the cluster.
+func (r *Registry) DialContext(ctx context.Context, cluster, network, address string) (net.Conn, error) {
+	r.lock.RLock()
+	session := r.sessions[cluster]
+	r.lock.RUnlock()
+	if session == nil {
+		return nil, errors.Errorf("no reverse tunnel session of cluster %s", cluster)
+	}
+	return session.DialContext(ctx, network, address)
+}
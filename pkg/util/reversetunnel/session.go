@@ -0,0 +1,195 @@
+package reversetunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// pingInterval is how long a session stays idle before it is pinged.
+	pingInterval = 30 * time.Second
+	// pingTimeout is how long a ping waits before the session is closed.
+	pingTimeout = 15 * time.Second
+	// dialTimeout bounds the dials when the dialing context has no deadline.
+	dialTimeout = 30 * time.Second
+	// maxConnectResponseBody bounds reading the error message from the
+	// rejected CONNECT requests.
+	maxConnectResponseBody = 4096
+)
+
+var errNotImplemented = errors.New("not implemented")
+
+// Session is the HTTP/2 client connection over the tunnel of an agent. The
+// session is closed once the tunnel breaks or the agent stops answering the
+// pings.
+type Session struct {
+	conn   *http2.ClientConn
+	closed chan struct{}
+}
+
+// NewSession opens the session over the upgraded tunnel connection.
+func NewSession(conn net.Conn) (*Session, error) {
+	s := &Session{closed: make(chan struct{})}
+	transport := &http2.Transport{
+		ReadIdleTimeout: pingInterval,
+		PingTimeout:     pingTimeout,
+	}
+	cc, err := transport.NewClientConn(&notifyingConn{Conn: conn, closed: s.closed})
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed opening session")
+	}
+	s.conn = cc
+	return s, nil
+}
+
+// Done is closed once the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Ping tells whether the agent answers on the session.
+func (s *Session) Ping(ctx context.Context) error {
+	return s.conn.Ping(ctx)
+}
+
+// Close closes the session along with the tunneled connections.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// DialContext dials the address from the agent. The agent always dials its
+// local kube-apiserver regardless of the address, which is merely the
+// authority of the CONNECT request.
+func (s *Session) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, errors.Errorf("protocol %s not supported", network)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dialTimeout)
+		defer cancel()
+	}
+	// the stream outlives the dialing context
+	streamCtx, cancel := context.WithCancel(context.Background())
+	reader, writer := io.Pipe()
+	req := (&http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+		Body:   reader,
+	}).WithContext(streamCtx)
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := s.conn.RoundTrip(req)
+		results <- result{resp: resp, err: err}
+	}()
+	var resp *http.Response
+	select {
+	case <-ctx.Done():
+		cancel()
+		writer.Close()
+		return nil, errors.Wrapf(ctx.Err(), "failed dialing %s through reverse tunnel", address)
+	case r := <-results:
+		if r.err != nil {
+			cancel()
+			writer.Close()
+			return nil, errors.Wrapf(r.err, "failed dialing %s through reverse tunnel", address)
+		}
+		resp = r.resp
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxConnectResponseBody))
+		resp.Body.Close()
+		cancel()
+		writer.Close()
+		msg := fmt.Sprintf("agent rejected connecting %s: %s", address, resp.Status)
+		if detail := strings.TrimSpace(string(body)); len(detail) > 0 {
+			msg += ": " + detail
+		}
+		return nil, errors.New(msg)
+	}
+	return &streamConn{
+		reader: resp.Body,
+		writer: writer,
+		cancel: cancel,
+	}, nil
+}
+
+var _ net.Conn = &streamConn{}
+
+// streamConn is a connection dialed over a CONNECT stream of the session.
+type streamConn struct {
+	reader    io.ReadCloser
+	writer    *io.PipeWriter
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+func (c *streamConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.writer.Close()
+		c.reader.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return nil
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (c *streamConn) SetDeadline(time.Time) error {
+	return errNotImplemented
+}
+
+func (c *streamConn) SetReadDeadline(time.Time) error {
+	return errNotImplemented
+}
+
+func (c *streamConn) SetWriteDeadline(time.Time) error {
+	return errNotImplemented
+}
+
+// notifyingConn notifies the closing of the tunnel connection, which is
+// closed by the HTTP/2 client connection once it breaks.
+type notifyingConn struct {
+	net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *notifyingConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return err
+}
@@ -0,0 +1,81 @@
+// Package reversetunnel tunnels the requests of the gateway to the clusters
+// through the connections dialed out by the agents in the managed clusters.
+//
+// The agent upgrades a request to the tunnel subresource of its
+// ClusterGateway, which is forwarded by the hub kube-apiserver to the
+// gateway. Over the upgraded connection the gateway speaks HTTP/2 as the
+// client, so that every dial of the gateway is a CONNECT stream multiplexed
+// over the connection, which the agent serves by dialing the local
+// kube-apiserver.
+package reversetunnel
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+
+	"github.com/kluster-manager/cluster-gateway/pkg/config"
+)
+
+// Protocol is the protocol which the tunnel requests upgrade to.
+const Protocol = "cluster-gateway-tunnel"
+
+// HeaderReplica is the header of the upgrade response telling the gateway
+// replica holding the session, so that the agent spreads its sessions over
+// all the replicas.
+const HeaderReplica = "X-Cluster-Gateway-Replica"
+
+// Path returns the path of the tunnel subresource of the cluster.
+func Path(cluster string) string {
+	return "/apis/" + config.MetaApiGroupName + "/" + config.MetaApiVersionName + "/clustergateways/" + cluster + "/tunnel"
+}
+
+// IsTunnelRequest tells whether the request upgrades to the tunnel.
+func IsTunnelRequest(req *http.Request) bool {
+	return httpstream.IsUpgradeRequest(req) && strings.EqualFold(req.Header.Get("Upgrade"), Protocol)
+}
+
+// Accept upgrades the tunnel request and returns the upgraded connection,
+// over which the session is opened by NewSession.
+func Accept(w http.ResponseWriter, req *http.Request, replica string) (net.Conn, error) {
+	if !IsTunnelRequest(req) {
+		return nil, errors.Errorf("not upgrading to %s", Protocol)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection not hijackable")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed hijacking connection")
+	}
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n%s: %s\r\n\r\n",
+		Protocol, HeaderReplica, replica); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if rw.Reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: rw.Reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered along with the upgrade ahead of the
+// connection.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
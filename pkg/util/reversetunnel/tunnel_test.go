@@ -0,0 +1,202 @@
+package reversetunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+)
+
+// newGateway serves the tunnel requests of the cluster as the given
+// replicas in turn, each of which keeps its sessions in the registry of the
+// same index.
+func newGateway(t *testing.T, registries []*Registry, cluster string, replicas ...string) *httptest.Server {
+	var next int64
+	gateway := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != Path(cluster) {
+			http.Error(w, "no such cluster", http.StatusNotFound)
+			return
+		}
+		i := int(atomic.AddInt64(&next, 1)) % len(replicas)
+		if IsTunnelRequest(req) {
+			if err := registries[i].Admit(req.Context(), cluster); err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+		}
+		conn, err := Accept(w, req, replicas[i])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		session, err := NewSession(conn)
+		if err != nil {
+			return
+		}
+		if err := registries[i].Register(cluster, session); err != nil {
+			session.Close()
+		}
+	}))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func runAgent(t *testing.T, gateway *httptest.Server, cluster string, replicas int, target string) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	agent := &Agent{
+		Config: &rest.Config{
+			Host:            gateway.URL,
+			TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+		},
+		Cluster:       cluster,
+		Replicas:      replicas,
+		TargetAddress: target,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, agent.Run(ctx))
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func sessionCount(registries []*Registry, cluster string) int {
+	count := 0
+	for _, registry := range registries {
+		if registry.Connected(cluster) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestReverseTunnel(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "pong")
+	}))
+	defer backend.Close()
+	registry := NewRegistry()
+	gateway := newGateway(t, []*Registry{registry}, "cluster1", "replica-0")
+	runAgent(t, gateway, "cluster1", 1, backend.Listener.Addr().String())
+	require.Eventually(t, func() bool {
+		return registry.Connected("cluster1")
+	}, 5*time.Second, 20*time.Millisecond)
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return registry.DialContext(ctx, "cluster1", network, address)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	t.Run("connections are tunneled to the target", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			resp, err := httpClient.Get("http://cluster1/")
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, "pong", string(body))
+		}
+	})
+
+	t.Run("broken sessions are re-established", func(t *testing.T) {
+		registry.lock.RLock()
+		session := registry.sessions["cluster1"]
+		registry.lock.RUnlock()
+		require.NoError(t, session.Close())
+		require.Eventually(t, func() bool {
+			resp, err := httpClient.Get("http://cluster1/")
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		}, 10*time.Second, 50*time.Millisecond)
+		assert.True(t, registry.Connected("cluster1"))
+	})
+
+	t.Run("live sessions are never replaced", func(t *testing.T) {
+		registry.lock.RLock()
+		live := registry.sessions["cluster1"]
+		registry.lock.RUnlock()
+		assert.ErrorIs(t, registry.Admit(context.TODO(), "cluster1"), ErrSessionLive)
+		client, server := net.Pipe()
+		defer server.Close()
+		go io.Copy(io.Discard, server)
+		session, err := NewSession(client)
+		require.NoError(t, err)
+		defer session.Close()
+		assert.ErrorIs(t, registry.Register("cluster1", session), ErrSessionLive)
+		registry.lock.RLock()
+		defer registry.lock.RUnlock()
+		assert.Same(t, live, registry.sessions["cluster1"])
+	})
+
+	t.Run("unresponsive sessions are replaced", func(t *testing.T) {
+		other := NewRegistry()
+		client, server := net.Pipe()
+		defer server.Close()
+		// the peer never answers the pings
+		go io.Copy(io.Discard, server)
+		session, err := NewSession(client)
+		require.NoError(t, err)
+		require.NoError(t, other.Register("cluster1", session))
+		ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+		defer cancel()
+		require.NoError(t, other.Admit(ctx, "cluster1"))
+		assert.False(t, other.Connected("cluster1"))
+		<-session.Done()
+	})
+
+	t.Run("clusters without sessions are reported", func(t *testing.T) {
+		_, err := registry.DialContext(context.TODO(), "cluster2", "tcp", "cluster2:443")
+		assert.ErrorContains(t, err, "no reverse tunnel session")
+	})
+}
+
+func TestReverseTunnelReplicas(t *testing.T) {
+	registries := []*Registry{NewRegistry(), NewRegistry()}
+	gateway := newGateway(t, registries, "cluster1", "replica-0", "replica-1")
+	runAgent(t, gateway, "cluster1", 2, "127.0.0.1:1")
+	// the sessions landing on the covered replica are dropped
+	require.Eventually(t, func() bool {
+		return sessionCount(registries, "cluster1") == 2
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// the target refusing the connections are reported by the agent
+	_, err := registries[0].DialContext(context.TODO(), "cluster1", "tcp", "cluster1:443")
+	assert.ErrorContains(t, err, "502 Bad Gateway")
+}
+
+func TestAcceptRejectsPlainRequests(t *testing.T) {
+	gateway := newGateway(t, []*Registry{NewRegistry()}, "cluster1", "replica-0")
+	resp, err := gateway.Client().Get(gateway.URL + Path("cluster1"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	agent := &Agent{
+		Config: &rest.Config{
+			Host:            gateway.URL,
+			TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+		},
+		Cluster:       "cluster2",
+		TargetAddress: "127.0.0.1:1",
+	}
+	_, _, err = agent.connect(context.TODO())
+	assert.ErrorContains(t, err, "404 Not Found")
+}
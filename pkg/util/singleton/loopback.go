@@ -1,10 +1,16 @@
 package singleton
 
 import (
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var kc client.Client
+var apiReader client.Reader
+var informers cache.Cache
+var credentialProfiles client.Reader
+var loopbackConfig *rest.Config
 
 func GetClient() client.Client {
 	return kc
@@ -13,3 +19,42 @@ func GetClient() client.Client {
 func SetClient(cc client.Client) {
 	kc = cc
 }
+
+// GetAPIReader returns the reader requesting the hub kube-apiserver directly,
+// which reads the objects excluded from the cache e.g. the secrets other
+// than the ones of the ClusterGateways.
+func GetAPIReader() client.Reader {
+	return apiReader
+}
+
+func SetAPIReader(r client.Reader) {
+	apiReader = r
+}
+
+// GetCredentialProfileReader returns the reader of the cache holding the
+// secrets of the credential profiles.
+func GetCredentialProfileReader() client.Reader {
+	return credentialProfiles
+}
+
+func SetCredentialProfileReader(r client.Reader) {
+	credentialProfiles = r
+}
+
+func GetCache() cache.Cache {
+	return informers
+}
+
+func SetCache(c cache.Cache) {
+	informers = c
+}
+
+// GetLoopbackConfig returns the client config of the hub kube-apiserver used
+// by the gateway itself.
+func GetLoopbackConfig() *rest.Config {
+	return loopbackConfig
+}
+
+func SetLoopbackConfig(cfg *rest.Config) {
+	loopbackConfig = cfg
+}